@@ -79,3 +79,29 @@ func (pb *ProtobufEncoder) Decode(subject string, data []byte, vPtr any) error {
 
 	return proto.Unmarshal(data, i)
 }
+
+// ProtobufCodec is a protobuf implementation of the jetstream.Codec
+// interface, used to encode and decode payloads of typed JetStream
+// publishers and consumers. Values have to implement proto.Message.
+type ProtobufCodec struct {
+	// Empty
+}
+
+// PROTOBUF_CONTENT_TYPE is the content type of payloads encoded using
+// ProtobufCodec.
+const PROTOBUF_CONTENT_TYPE = "application/protobuf"
+
+// ContentType returns the content type of protobuf payloads.
+func (pc *ProtobufCodec) ContentType() string {
+	return PROTOBUF_CONTENT_TYPE
+}
+
+// Encode marshals v, which has to implement proto.Message.
+func (pc *ProtobufCodec) Encode(v any) ([]byte, error) {
+	return (&ProtobufEncoder{}).Encode("", v)
+}
+
+// Decode unmarshals data into vPtr, which has to implement proto.Message.
+func (pc *ProtobufCodec) Decode(data []byte, vPtr any) error {
+	return (&ProtobufEncoder{}).Decode("", data, vPtr)
+}
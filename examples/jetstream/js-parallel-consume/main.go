@@ -56,20 +56,18 @@ func main() {
 	}
 	go endlessPublish(ctx, nc, js)
 
-	for i := 0; i < 5; i++ {
-		cc, err := cons.Consume(func(consumeID int) jetstream.MessageHandler {
-			return func(msg jetstream.Msg) {
-				fmt.Printf("Received msg on consume %d\n", consumeID)
-				msg.Ack()
-			}
-		}(i), jetstream.ConsumeErrHandler(func(consumeCtx jetstream.ConsumeContext, err error) {
-			fmt.Println(err)
-		}))
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer cc.Stop()
+	// messages are handled by 5 workers, messages on the same subject
+	// are handled sequentially, in order
+	cc, err := cons.Consume(func(msg jetstream.Msg) {
+		fmt.Printf("Received msg on %s: %s\n", msg.Subject(), string(msg.Data()))
+		msg.Ack()
+	}, jetstream.WithConsumeWorkers(5, nil), jetstream.ConsumeErrHandler(func(consumeCtx jetstream.ConsumeContext, err error) {
+		fmt.Println(err)
+	}))
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer cc.Stop()
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
@@ -84,7 +82,7 @@ func endlessPublish(ctx context.Context, nc *nats.Conn, js jetstream.JetStream)
 		if nc.Status() != nats.CONNECTED {
 			continue
 		}
-		if _, err := js.Publish(ctx, "FOO.TEST1", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+		if _, err := js.Publish(ctx, fmt.Sprintf("FOO.TEST%d", i%5), []byte(fmt.Sprintf("msg %d", i))); err != nil {
 			fmt.Println("pub error: ", err)
 		}
 		i++
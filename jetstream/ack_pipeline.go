@@ -0,0 +1,444 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+type (
+	// AckPipeline sends acknowledgements asynchronously and waits for their
+	// confirmation from the server, without blocking the message handler
+	// on a request per message. It is available on [ConsumeContext] using
+	// Acks.
+	//
+	// Acknowledgements which are not confirmed within AckTimeout are
+	// retried, and unconfirmed acknowledgements are re-sent after
+	// reconnecting to the server. Acknowledgements which could not be
+	// confirmed are reported to [AckPipelineConfig.ErrHandler].
+	//
+	// The pipeline is closed when consuming ends. When draining, pending
+	// acknowledgements are confirmed (or time out) first. Otherwise, e.g.
+	// on Stop or when the consumer is deleted, they are not waited for and
+	// are reported as failed with [ErrAckPipelineClosed], as is any
+	// further call to Ack.
+	//
+	// If the consumer uses [AckAllPolicy], acknowledgements queued together
+	// are collapsed into a single acknowledgement of the message with the
+	// highest consumer sequence.
+	AckPipeline interface {
+		// Ack queues the message for acknowledgement. Ack blocks if the
+		// number of unconfirmed acknowledgements reached MaxPending. The
+		// message is considered acknowledged while pending, unless the
+		// acknowledgement fails.
+		Ack(msg Msg) error
+
+		// Flush sends all queued acknowledgements and waits until they are
+		// confirmed or failed, or until the context is done.
+		Flush(ctx context.Context) error
+
+		// Pending returns the number of acknowledgements which were not yet
+		// confirmed.
+		Pending() int
+	}
+
+	// AckPipelineConfig is used to configure the [AckPipeline] created for
+	// Consume using [WithAckPipeline].
+	AckPipelineConfig struct {
+		// MaxPending is the maximum number of unconfirmed acknowledgements.
+		// Defaults to 1000.
+		MaxPending int
+
+		// FlushInterval is the time for which acknowledgements are collected
+		// before being sent to the server. Defaults to 10ms.
+		FlushInterval time.Duration
+
+		// AckTimeout is the time to wait for confirmation of an
+		// acknowledgement before it is retried. Defaults to 5s.
+		AckTimeout time.Duration
+
+		// MaxRetries is the maximum number of times an acknowledgement is
+		// re-sent before it is reported as failed. Defaults to 3.
+		MaxRetries int
+
+		// ErrHandler is called for each message which could not be
+		// acknowledged.
+		ErrHandler func(msg Msg, err error)
+	}
+
+	ackPipeline struct {
+		sync.Mutex
+		js                *jetStream
+		cfg               AckPipelineConfig
+		ackAll            bool
+		inbox             string
+		sub               *nats.Subscription
+		connStatus        chan nats.Status
+		releaseConnStatus func()
+		queued            []*jetStreamMsg
+		inFlight          map[string]*pendingAck
+		slots             chan struct{}
+		flushCh           chan struct{}
+		waiters           []chan struct{}
+		done              chan struct{}
+		closed            bool
+	}
+
+	// pendingAck is a single acknowledgement sent to the server, confirming
+	// all covered messages.
+	pendingAck struct {
+		msg      *jetStreamMsg
+		covers   []*jetStreamMsg
+		sent     time.Time
+		attempts int
+	}
+)
+
+const (
+	defaultAckPipelineMaxPending    = 1000
+	defaultAckPipelineFlushInterval = 10 * time.Millisecond
+	defaultAckPipelineMaxRetries    = 3
+)
+
+func newAckPipeline(js *jetStream, cfg AckPipelineConfig, ackAll bool) *ackPipeline {
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = defaultAckPipelineMaxPending
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultAckPipelineFlushInterval
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = defaultAPITimeout
+	}
+	if cfg.MaxRetries <= 0 {
+		cfg.MaxRetries = defaultAckPipelineMaxRetries
+	}
+	return &ackPipeline{
+		js:       js,
+		cfg:      cfg,
+		ackAll:   ackAll,
+		inFlight: make(map[string]*pendingAck),
+		slots:    make(chan struct{}, cfg.MaxPending),
+		flushCh:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// Ack queues the message for acknowledgement.
+func (p *ackPipeline) Ack(msg Msg) error {
+	m, ok := unwrapMsg(msg).(*jetStreamMsg)
+	if !ok {
+		return ErrMsgNotBound
+	}
+	if err := m.checkReply(); err != nil {
+		return err
+	}
+	// mark the message as acknowledged right away, so that it is not
+	// acknowledged again (e.g. by middleware) while pending
+	m.Lock()
+	if m.ackd {
+		m.Unlock()
+		return ErrMsgAlreadyAckd
+	}
+	m.ackd = true
+	m.Unlock()
+
+	err := p.enqueue(m)
+	if err != nil {
+		m.Lock()
+		m.ackd = false
+		m.Unlock()
+	}
+	return err
+}
+
+func (p *ackPipeline) enqueue(m *jetStreamMsg) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-p.done:
+		return ErrAckPipelineClosed
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		<-p.slots
+		return ErrAckPipelineClosed
+	}
+	if err := p.start(); err != nil {
+		<-p.slots
+		return err
+	}
+	p.queued = append(p.queued, m)
+	return nil
+}
+
+// Flush sends all queued acknowledgements and waits until they are
+// confirmed or failed.
+func (p *ackPipeline) Flush(ctx context.Context) error {
+	p.Lock()
+	if len(p.queued) == 0 && len(p.inFlight) == 0 {
+		p.Unlock()
+		return nil
+	}
+	if p.closed {
+		p.Unlock()
+		return ErrAckPipelineClosed
+	}
+	wait := make(chan struct{})
+	p.waiters = append(p.waiters, wait)
+	p.Unlock()
+
+	select {
+	case p.flushCh <- struct{}{}:
+	default:
+	}
+	select {
+	case <-wait:
+		return nil
+	case <-p.done:
+		return ErrAckPipelineClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Pending returns the number of unconfirmed acknowledgements.
+func (p *ackPipeline) Pending() int {
+	return len(p.slots)
+}
+
+// start subscribes to confirmations and starts the flush loop on first use.
+// Lock should be held.
+func (p *ackPipeline) start() error {
+	if p.sub != nil {
+		return nil
+	}
+	p.inbox = p.js.conn.NewInbox()
+	sub, err := p.js.conn.Subscribe(p.inbox+".*", p.handleReply)
+	if err != nil {
+		return err
+	}
+	p.sub = sub
+	p.connStatus, p.releaseConnStatus = statusChanged(p.js.conn, nats.CONNECTED, nats.RECONNECTING)
+	go p.loop()
+	return nil
+}
+
+func (p *ackPipeline) loop() {
+	ticker := time.NewTicker(p.cfg.FlushInterval)
+	defer ticker.Stop()
+	isConnected := true
+	for {
+		select {
+		case <-ticker.C:
+			p.flush()
+		case <-p.flushCh:
+			p.flush()
+		case status := <-p.connStatus:
+			if status == nats.RECONNECTING {
+				isConnected = false
+				continue
+			}
+			if !isConnected {
+				isConnected = true
+				p.resendAll()
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// flush sends queued acknowledgements and retries the ones which were not
+// confirmed in time.
+func (p *ackPipeline) flush() {
+	p.Lock()
+	var failed []*pendingAck
+	now := time.Now()
+	for id, ack := range p.inFlight {
+		if now.Sub(ack.sent) < p.cfg.AckTimeout {
+			continue
+		}
+		if ack.attempts > p.cfg.MaxRetries {
+			delete(p.inFlight, id)
+			failed = append(failed, ack)
+			continue
+		}
+		p.send(id, ack)
+	}
+	queued := p.queued
+	p.queued = nil
+	if len(queued) > 0 {
+		if p.ackAll {
+			p.send(nuid.Next(), collapseAcks(queued))
+		} else {
+			for _, m := range queued {
+				p.send(nuid.Next(), &pendingAck{msg: m, covers: []*jetStreamMsg{m}})
+			}
+		}
+	}
+	p.Unlock()
+	p.fail(failed, nats.ErrTimeout)
+}
+
+// collapseAcks returns a single acknowledgement of the message with the
+// highest consumer sequence, covering all messages.
+func collapseAcks(msgs []*jetStreamMsg) *pendingAck {
+	ack := &pendingAck{msg: msgs[0], covers: msgs}
+	var maxSeq uint64
+	for _, m := range msgs {
+		meta, err := m.Metadata()
+		if err != nil {
+			continue
+		}
+		if meta.Sequence.Consumer > maxSeq {
+			maxSeq = meta.Sequence.Consumer
+			ack.msg = m
+		}
+	}
+	return ack
+}
+
+// send publishes the acknowledgement. Publish errors are not reported, as
+// the acknowledgement is retried after AckTimeout.
+// Lock should be held.
+func (p *ackPipeline) send(id string, ack *pendingAck) {
+	ack.sent = time.Now()
+	ack.attempts++
+	p.inFlight[id] = ack
+	p.js.conn.PublishRequest(ack.msg.msg.Reply, p.inbox+"."+id, ackAck)
+}
+
+// resendAll re-sends all unconfirmed acknowledgements after reconnect.
+func (p *ackPipeline) resendAll() {
+	p.Lock()
+	defer p.Unlock()
+	for id, ack := range p.inFlight {
+		p.send(id, ack)
+	}
+}
+
+func (p *ackPipeline) handleReply(msg *nats.Msg) {
+	id := msg.Subject[strings.LastIndexByte(msg.Subject, '.')+1:]
+	if userMsg, err := checkMsg(msg); !userMsg || err != nil {
+		// the acknowledgement is retried after AckTimeout
+		return
+	}
+	p.Lock()
+	ack, ok := p.inFlight[id]
+	if !ok {
+		p.Unlock()
+		return
+	}
+	delete(p.inFlight, id)
+	p.release(len(ack.covers))
+	p.Unlock()
+	for _, m := range ack.covers {
+		m.stats.recordAck(ackAck)
+	}
+}
+
+// release frees slots of confirmed or failed acknowledgements and notifies
+// Flush callers once there are no more pending acknowledgements.
+// Lock should be held.
+func (p *ackPipeline) release(n int) {
+	for i := 0; i < n; i++ {
+		<-p.slots
+	}
+	if len(p.queued) == 0 && len(p.inFlight) == 0 {
+		for _, wait := range p.waiters {
+			close(wait)
+		}
+		p.waiters = nil
+	}
+}
+
+func (p *ackPipeline) fail(acks []*pendingAck, err error) {
+	if len(acks) == 0 {
+		return
+	}
+	p.Lock()
+	for _, ack := range acks {
+		p.release(len(ack.covers))
+		for _, m := range ack.covers {
+			m.Lock()
+			m.ackd = false
+			m.Unlock()
+		}
+	}
+	p.Unlock()
+	if p.cfg.ErrHandler == nil {
+		return
+	}
+	for _, ack := range acks {
+		for _, m := range ack.covers {
+			p.cfg.ErrHandler(m, err)
+		}
+	}
+}
+
+// close stops the pipeline. If wait is true, close waits for pending
+// acknowledgements to be confirmed first. Acknowledgements which are still
+// pending are reported as failed with ErrAckPipelineClosed.
+func (p *ackPipeline) close(wait bool) {
+	p.Lock()
+	if p.closed {
+		p.Unlock()
+		return
+	}
+	started := p.sub != nil
+	p.Unlock()
+	if wait && started {
+		timeout := p.cfg.AckTimeout * time.Duration(p.cfg.MaxRetries+1)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		p.Flush(ctx)
+		cancel()
+	}
+
+	p.Lock()
+	p.closed = true
+	close(p.done)
+	if p.sub != nil {
+		p.sub.Unsubscribe()
+		p.releaseConnStatus()
+	}
+	remaining := make([]*pendingAck, 0, len(p.inFlight)+1)
+	for _, ack := range p.inFlight {
+		remaining = append(remaining, ack)
+	}
+	if len(p.queued) > 0 {
+		remaining = append(remaining, &pendingAck{covers: p.queued})
+	}
+	p.inFlight = make(map[string]*pendingAck)
+	p.queued = nil
+	p.Unlock()
+	p.fail(remaining, ErrAckPipelineClosed)
+}
+
+// unwrapMsg returns the innermost message wrapped by middleware.
+func unwrapMsg(msg Msg) Msg {
+	for {
+		w, ok := msg.(msgWrapper)
+		if !ok {
+			return msg
+		}
+		msg = w.unwrap()
+	}
+}
@@ -0,0 +1,551 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// Advisory is an event published by the server, either an advisory
+	// (e.g. [ConsumerActionAdvisory]) or a metric (e.g.
+	// [ConsumerAckMetric]). Use a type switch to access event specific
+	// fields.
+	Advisory interface {
+		// Meta returns the fields common to all events.
+		Meta() AdvisoryMeta
+	}
+
+	// AdvisoryType identifies the kind of an [Advisory]. It is used to
+	// select events using [WithAdvisoryTypes].
+	AdvisoryType string
+
+	// AdvisoryMeta contains the fields common to all events.
+	AdvisoryMeta struct {
+		// Type is the kind of the event.
+		Type AdvisoryType `json:"-"`
+
+		// Schema is the schema identifier of the event, e.g.
+		// io.nats.jetstream.advisory.v1.consumer_action.
+		Schema string `json:"type"`
+
+		// ID is the unique identifier of the event.
+		ID string `json:"id"`
+
+		// Time is the time the event was created.
+		Time time.Time `json:"timestamp"`
+
+		// Domain is the JetStream domain of the server publishing the
+		// event.
+		Domain string `json:"domain,omitempty"`
+
+		// Stream is the name of the stream the event relates to.
+		Stream string `json:"stream"`
+
+		// Consumer is the name of the consumer the event relates to. It is
+		// empty for stream events.
+		Consumer string `json:"consumer,omitempty"`
+	}
+
+	// AdvisoryClient contains information about the client which triggered
+	// an event.
+	AdvisoryClient struct {
+		Host    string `json:"host,omitempty"`
+		ID      uint64 `json:"id,omitempty"`
+		Account string `json:"acc,omitempty"`
+		User    string `json:"user,omitempty"`
+		Name    string `json:"name,omitempty"`
+		Lang    string `json:"lang,omitempty"`
+		Version string `json:"ver,omitempty"`
+	}
+
+	// ConsumerActionAdvisory is published when a consumer is created or
+	// deleted.
+	ConsumerActionAdvisory struct {
+		AdvisoryMeta
+
+		// Action is either "create" or "delete".
+		Action string `json:"action"`
+	}
+
+	// StreamLeaderElectedAdvisory is published when a new leader is elected
+	// for a clustered stream.
+	StreamLeaderElectedAdvisory struct {
+		AdvisoryMeta
+
+		// Leader is the server name of the new leader.
+		Leader string `json:"leader"`
+
+		// Replicas is the list of members of the RAFT group.
+		Replicas []*PeerInfo `json:"replicas"`
+	}
+
+	// ConsumerLeaderElectedAdvisory is published when a new leader is
+	// elected for a clustered consumer.
+	ConsumerLeaderElectedAdvisory struct {
+		AdvisoryMeta
+
+		// Leader is the server name of the new leader.
+		Leader string `json:"leader"`
+
+		// Replicas is the list of members of the RAFT group.
+		Replicas []*PeerInfo `json:"replicas"`
+	}
+
+	// ConsumerMaxDeliveriesAdvisory is published when a message reaches the
+	// MaxDeliver limit of a consumer.
+	ConsumerMaxDeliveriesAdvisory struct {
+		AdvisoryMeta
+
+		// StreamSeq is the sequence of the message in the stream.
+		StreamSeq uint64 `json:"stream_seq"`
+
+		// Deliveries is the number of delivery attempts.
+		Deliveries uint64 `json:"deliveries"`
+	}
+
+	// ConsumerMsgTerminatedAdvisory is published when a message is
+	// terminated using [Msg.Term] or [Msg.TermWithReason].
+	ConsumerMsgTerminatedAdvisory struct {
+		AdvisoryMeta
+
+		// ConsumerSeq is the sequence of the delivery.
+		ConsumerSeq uint64 `json:"consumer_seq"`
+
+		// StreamSeq is the sequence of the message in the stream.
+		StreamSeq uint64 `json:"stream_seq"`
+
+		// Deliveries is the number of delivery attempts.
+		Deliveries uint64 `json:"deliveries"`
+
+		// Reason is the reason passed to [Msg.TermWithReason].
+		Reason string `json:"reason,omitempty"`
+	}
+
+	// ConsumerAckMetric is published when a sampled message is
+	// acknowledged. Sampling is enabled using SampleFrequency in
+	// [ConsumerConfig].
+	ConsumerAckMetric struct {
+		AdvisoryMeta
+
+		// ConsumerSeq is the sequence of the delivery.
+		ConsumerSeq uint64 `json:"consumer_seq"`
+
+		// StreamSeq is the sequence of the message in the stream.
+		StreamSeq uint64 `json:"stream_seq"`
+
+		// Delay is the time between the delivery and the acknowledgement.
+		Delay time.Duration `json:"ack_time"`
+
+		// Deliveries is the number of delivery attempts.
+		Deliveries uint64 `json:"deliveries"`
+	}
+
+	// SnapshotCreateAdvisory is published when a stream snapshot is
+	// started.
+	SnapshotCreateAdvisory struct {
+		AdvisoryMeta
+
+		// State is the state of the stream at the start of the snapshot.
+		State StreamState `json:"state"`
+
+		// Client is the client which requested the snapshot.
+		Client *AdvisoryClient `json:"client,omitempty"`
+	}
+
+	// SnapshotCompleteAdvisory is published when a stream snapshot is
+	// completed.
+	SnapshotCompleteAdvisory struct {
+		AdvisoryMeta
+
+		// Start is the time the snapshot was started.
+		Start time.Time `json:"start"`
+
+		// End is the time the snapshot was completed.
+		End time.Time `json:"end"`
+
+		// Client is the client which requested the snapshot.
+		Client *AdvisoryClient `json:"client,omitempty"`
+	}
+
+	// RestoreCreateAdvisory is published when a stream restore is started.
+	RestoreCreateAdvisory struct {
+		AdvisoryMeta
+
+		// Client is the client which requested the restore.
+		Client *AdvisoryClient `json:"client,omitempty"`
+	}
+
+	// RestoreCompleteAdvisory is published when a stream restore is
+	// completed.
+	RestoreCompleteAdvisory struct {
+		AdvisoryMeta
+
+		// Start is the time the restore was started.
+		Start time.Time `json:"start"`
+
+		// End is the time the restore was completed.
+		End time.Time `json:"end"`
+
+		// Bytes is the size of the restored snapshot.
+		Bytes int64 `json:"bytes"`
+
+		// Client is the client which requested the restore.
+		Client *AdvisoryClient `json:"client,omitempty"`
+	}
+
+	// AdvisoryWatcher is used to receive events requested using
+	// [JetStream.Advisories].
+	AdvisoryWatcher interface {
+		// Events returns a channel on which events are delivered. The
+		// channel is closed once the watcher is stopped.
+		Events() <-chan Advisory
+
+		// Stop stops receiving events.
+		Stop() error
+	}
+
+	// AdvisoryOpt is a function setting options for [JetStream.Advisories].
+	AdvisoryOpt func(*advisoryOpts) error
+
+	advisoryOpts struct {
+		types    []AdvisoryType
+		stream   string
+		consumer string
+		prefix   string
+	}
+
+	// advisoryEvent is implemented by all events through the embedded
+	// AdvisoryMeta.
+	advisoryEvent interface {
+		Advisory
+		setType(AdvisoryType)
+	}
+
+	advisoryKind struct {
+		// subject is the subject of the event, without the prefix and
+		// stream/consumer tokens
+		subject string
+		// consumer is set if the subject contains consumer name
+		consumer bool
+		newEvent func() advisoryEvent
+	}
+
+	advisoryWatcher struct {
+		events   chan Advisory
+		done     chan struct{}
+		subs     []*nats.Subscription
+		active   atomic.Int32
+		domain   string
+		stopOnce sync.Once
+	}
+)
+
+// Advisory types which can be selected using [WithAdvisoryTypes]. Each type
+// matches events published on a subject under [DefaultAdvisoryPrefix] (or
+// the prefix set using [WithAdvisoryPrefix]), followed by the stream name
+// and, for consumer events, the consumer name.
+const (
+	// AdvisoryConsumerCreated matches ADVISORY.CONSUMER.CREATED events.
+	AdvisoryConsumerCreated AdvisoryType = "consumer_created"
+
+	// AdvisoryConsumerDeleted matches ADVISORY.CONSUMER.DELETED events.
+	AdvisoryConsumerDeleted AdvisoryType = "consumer_deleted"
+
+	// AdvisoryStreamLeaderElected matches ADVISORY.STREAM.LEADER_ELECTED
+	// events.
+	AdvisoryStreamLeaderElected AdvisoryType = "stream_leader_elected"
+
+	// AdvisoryConsumerLeaderElected matches ADVISORY.CONSUMER.LEADER_ELECTED
+	// events.
+	AdvisoryConsumerLeaderElected AdvisoryType = "consumer_leader_elected"
+
+	// AdvisoryMaxDeliveries matches ADVISORY.CONSUMER.MAX_DELIVERIES events.
+	AdvisoryMaxDeliveries AdvisoryType = "max_deliveries"
+
+	// AdvisoryMsgTerminated matches ADVISORY.CONSUMER.MSG_TERMINATED events.
+	AdvisoryMsgTerminated AdvisoryType = "msg_terminated"
+
+	// AdvisoryConsumerAck matches METRIC.CONSUMER.ACK events, published for
+	// sampled acknowledgements.
+	AdvisoryConsumerAck AdvisoryType = "consumer_ack"
+
+	// AdvisorySnapshotCreate matches ADVISORY.STREAM.SNAPSHOT_CREATE events.
+	AdvisorySnapshotCreate AdvisoryType = "snapshot_create"
+
+	// AdvisorySnapshotComplete matches ADVISORY.STREAM.SNAPSHOT_COMPLETE
+	// events.
+	AdvisorySnapshotComplete AdvisoryType = "snapshot_complete"
+
+	// AdvisoryRestoreCreate matches ADVISORY.STREAM.RESTORE_CREATE events.
+	AdvisoryRestoreCreate AdvisoryType = "restore_create"
+
+	// AdvisoryRestoreComplete matches ADVISORY.STREAM.RESTORE_COMPLETE
+	// events.
+	AdvisoryRestoreComplete AdvisoryType = "restore_complete"
+)
+
+// DefaultAdvisoryPrefix is the prefix of subjects on which JetStream
+// events are published.
+const DefaultAdvisoryPrefix = "$JS.EVENT"
+
+var (
+	advisoryKinds = map[AdvisoryType]advisoryKind{
+		AdvisoryConsumerCreated: {
+			subject:  "ADVISORY.CONSUMER.CREATED",
+			consumer: true,
+			newEvent: func() advisoryEvent { return &ConsumerActionAdvisory{} },
+		},
+		AdvisoryConsumerDeleted: {
+			subject:  "ADVISORY.CONSUMER.DELETED",
+			consumer: true,
+			newEvent: func() advisoryEvent { return &ConsumerActionAdvisory{} },
+		},
+		AdvisoryStreamLeaderElected: {
+			subject:  "ADVISORY.STREAM.LEADER_ELECTED",
+			newEvent: func() advisoryEvent { return &StreamLeaderElectedAdvisory{} },
+		},
+		AdvisoryConsumerLeaderElected: {
+			subject:  "ADVISORY.CONSUMER.LEADER_ELECTED",
+			consumer: true,
+			newEvent: func() advisoryEvent { return &ConsumerLeaderElectedAdvisory{} },
+		},
+		AdvisoryMaxDeliveries: {
+			subject:  "ADVISORY.CONSUMER.MAX_DELIVERIES",
+			consumer: true,
+			newEvent: func() advisoryEvent { return &ConsumerMaxDeliveriesAdvisory{} },
+		},
+		AdvisoryMsgTerminated: {
+			subject:  "ADVISORY.CONSUMER.MSG_TERMINATED",
+			consumer: true,
+			newEvent: func() advisoryEvent { return &ConsumerMsgTerminatedAdvisory{} },
+		},
+		AdvisoryConsumerAck: {
+			subject:  "METRIC.CONSUMER.ACK",
+			consumer: true,
+			newEvent: func() advisoryEvent { return &ConsumerAckMetric{} },
+		},
+		AdvisorySnapshotCreate: {
+			subject:  "ADVISORY.STREAM.SNAPSHOT_CREATE",
+			newEvent: func() advisoryEvent { return &SnapshotCreateAdvisory{} },
+		},
+		AdvisorySnapshotComplete: {
+			subject:  "ADVISORY.STREAM.SNAPSHOT_COMPLETE",
+			newEvent: func() advisoryEvent { return &SnapshotCompleteAdvisory{} },
+		},
+		AdvisoryRestoreCreate: {
+			subject:  "ADVISORY.STREAM.RESTORE_CREATE",
+			newEvent: func() advisoryEvent { return &RestoreCreateAdvisory{} },
+		},
+		AdvisoryRestoreComplete: {
+			subject:  "ADVISORY.STREAM.RESTORE_COMPLETE",
+			newEvent: func() advisoryEvent { return &RestoreCompleteAdvisory{} },
+		},
+	}
+
+	// allAdvisoryTypes is the list of events received if
+	// WithAdvisoryTypes is not used.
+	allAdvisoryTypes = []AdvisoryType{
+		AdvisoryConsumerCreated,
+		AdvisoryConsumerDeleted,
+		AdvisoryStreamLeaderElected,
+		AdvisoryConsumerLeaderElected,
+		AdvisoryMaxDeliveries,
+		AdvisoryMsgTerminated,
+		AdvisoryConsumerAck,
+		AdvisorySnapshotCreate,
+		AdvisorySnapshotComplete,
+		AdvisoryRestoreCreate,
+		AdvisoryRestoreComplete,
+	}
+)
+
+// Meta returns the fields common to all events.
+func (m AdvisoryMeta) Meta() AdvisoryMeta {
+	return m
+}
+
+func (m *AdvisoryMeta) setType(t AdvisoryType) {
+	m.Type = t
+}
+
+// WithAdvisoryTypes limits the events received by
+// [JetStream.Advisories] to the provided types. By default, all supported
+// events are received.
+func WithAdvisoryTypes(types ...AdvisoryType) AdvisoryOpt {
+	return func(opts *advisoryOpts) error {
+		for _, t := range types {
+			if _, ok := advisoryKinds[t]; !ok {
+				return fmt.Errorf("%w: unknown advisory type %q", ErrInvalidOption, t)
+			}
+		}
+		opts.types = types
+		return nil
+	}
+}
+
+// WithAdvisoryStream limits the events received by [JetStream.Advisories]
+// to the ones related to the provided stream.
+func WithAdvisoryStream(stream string) AdvisoryOpt {
+	return func(opts *advisoryOpts) error {
+		if err := validateStreamName(stream); err != nil {
+			return err
+		}
+		opts.stream = stream
+		return nil
+	}
+}
+
+// WithAdvisoryConsumer limits the consumer events received by
+// [JetStream.Advisories] to the ones related to the provided consumer.
+// Stream events are not affected.
+func WithAdvisoryConsumer(consumer string) AdvisoryOpt {
+	return func(opts *advisoryOpts) error {
+		if err := validateConsumerName(consumer); err != nil {
+			return err
+		}
+		opts.consumer = consumer
+		return nil
+	}
+}
+
+// WithAdvisoryPrefix sets the prefix of subjects on which events are
+// received (Default: [DefaultAdvisoryPrefix]). It can be used when events
+// of another account or JetStream domain are imported using a different
+// prefix.
+func WithAdvisoryPrefix(prefix string) AdvisoryOpt {
+	return func(opts *advisoryOpts) error {
+		prefix = strings.TrimSuffix(prefix, ".")
+		if err := validateSubject(prefix); err != nil {
+			return fmt.Errorf("%w: invalid advisory prefix: %s", ErrInvalidOption, err)
+		}
+		opts.prefix = prefix
+		return nil
+	}
+}
+
+// Advisories subscribes to JetStream advisories and metrics and returns
+// an [AdvisoryWatcher], delivering typed events (e.g.
+// [ConsumerActionAdvisory]). Events can be filtered using
+// [WithAdvisoryTypes], [WithAdvisoryStream] and [WithAdvisoryConsumer].
+//
+// If JetStream was created using [NewWithDomain], only events published
+// in that domain are delivered. The watcher is stopped when the context is
+// canceled.
+func (js *jetStream) Advisories(ctx context.Context, opts ...AdvisoryOpt) (AdvisoryWatcher, error) {
+	o := advisoryOpts{
+		types:  allAdvisoryTypes,
+		prefix: DefaultAdvisoryPrefix,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &advisoryWatcher{
+		events: make(chan Advisory, 256),
+		done:   make(chan struct{}),
+		domain: js.opts.Domain,
+	}
+	for _, t := range o.types {
+		kind := advisoryKinds[t]
+		sub, err := js.conn.Subscribe(kind.subjectFor(o), w.handler(t, kind))
+		if err != nil {
+			for _, sub := range w.subs {
+				sub.Unsubscribe()
+			}
+			return nil, err
+		}
+		w.subs = append(w.subs, sub)
+	}
+	w.active.Store(int32(len(w.subs)))
+	for _, sub := range w.subs {
+		sub.SetClosedHandler(func(string) {
+			if w.active.Add(-1) == 0 {
+				close(w.events)
+			}
+		})
+	}
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				w.Stop()
+			case <-w.done:
+			}
+		}()
+	}
+	return w, nil
+}
+
+func (kind advisoryKind) subjectFor(o advisoryOpts) string {
+	stream, consumer := "*", "*"
+	if o.stream != "" {
+		stream = o.stream
+	}
+	if o.consumer != "" {
+		consumer = o.consumer
+	}
+	if kind.consumer {
+		return fmt.Sprintf("%s.%s.%s.%s", o.prefix, kind.subject, stream, consumer)
+	}
+	return fmt.Sprintf("%s.%s.%s", o.prefix, kind.subject, stream)
+}
+
+func (w *advisoryWatcher) handler(t AdvisoryType, kind advisoryKind) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		event := kind.newEvent()
+		if err := json.Unmarshal(msg.Data, event); err != nil {
+			return
+		}
+		meta := event.Meta()
+		if w.domain != "" && meta.Domain != w.domain {
+			return
+		}
+		event.setType(t)
+		select {
+		case w.events <- event:
+		case <-w.done:
+		}
+	}
+}
+
+// Events returns a channel on which events are delivered.
+func (w *advisoryWatcher) Events() <-chan Advisory {
+	return w.events
+}
+
+// Stop stops receiving events.
+func (w *advisoryWatcher) Stop() error {
+	var err error
+	w.stopOnce.Do(func() {
+		close(w.done)
+		for _, sub := range w.subs {
+			if unsubErr := sub.Unsubscribe(); unsubErr != nil && err == nil {
+				err = unsubErr
+			}
+		}
+	})
+	return err
+}
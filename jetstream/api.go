@@ -16,7 +16,12 @@ package jetstream
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"math/rand"
 	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
 )
 
 type (
@@ -31,6 +36,41 @@ type (
 		Offset int `json:"offset"`
 		Limit  int `json:"limit"`
 	}
+
+	// APIRetryPolicy configures retrying of idempotent JetStream API
+	// requests (e.g. fetching stream and consumer info, creating or
+	// updating streams and consumers and getting messages) which failed
+	// with a retryable error (see [IsRetryableError]). It is set using
+	// [WithAPIRetry].
+	APIRetryPolicy struct {
+		// MaxAttempts is the maximum number of attempts, including the
+		// initial request. Defaults to 5.
+		MaxAttempts int
+
+		// InitialBackoff is the delay before the first retry. The delay is
+		// doubled with each retry. Defaults to 100ms.
+		InitialBackoff time.Duration
+
+		// MaxBackoff is the maximum delay between retries. Defaults to 2s.
+		MaxBackoff time.Duration
+
+		// Jitter is the fraction by which delays are randomly increased or
+		// decreased, up to 1. Defaults to 0.2. Set to a negative value to
+		// disable jitter, e.g. for deterministic tests.
+		Jitter float64
+
+		// AttemptTimeout is the timeout of a single attempt. If not set,
+		// each attempt may take until the deadline of the request context,
+		// in which case timed out requests are not retried.
+		AttemptTimeout time.Duration
+	}
+)
+
+const (
+	defaultAPIRetryMaxAttempts    = 5
+	defaultAPIRetryInitialBackoff = 100 * time.Millisecond
+	defaultAPIRetryMaxBackoff     = 2 * time.Second
+	defaultAPIRetryJitter         = 0.2
 )
 
 // Request API subjects for JetStream.
@@ -90,6 +130,12 @@ const (
 	// apiStreamListT is the endpoint that will return all detailed stream information
 	apiStreamListT = "STREAM.LIST"
 
+	// apiStreamSnapshotT is the endpoint to snapshot streams.
+	apiStreamSnapshotT = "STREAM.SNAPSHOT.%s"
+
+	// apiStreamRestoreT is the endpoint to restore a stream from a snapshot.
+	apiStreamRestoreT = "STREAM.RESTORE.%s"
+
 	// apiMsgGetT is the endpoint to get a message.
 	apiMsgGetT = "STREAM.MSG.GET.%s"
 
@@ -141,6 +187,91 @@ func (js *jetStream) apiRequest(ctx context.Context, subj string, data ...[]byte
 	return js.toJSMsg(resp), nil
 }
 
+// idempotentAPIRequestJSON sends an API request which can be safely
+// repeated, retrying it according to the policy set using WithAPIRetry.
+// Retryable API errors are returned in resp once attempts are exhausted,
+// same as for apiRequestJSON.
+func (js *jetStream) idempotentAPIRequestJSON(ctx context.Context, subject string, resp any, data ...[]byte) (*jetStreamMsg, error) {
+	jsMsg, err := js.idempotentAPIRequest(ctx, subject, apiResponseError, data...)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(jsMsg.Data(), resp); err != nil {
+		return nil, err
+	}
+	return jsMsg, nil
+}
+
+// idempotentAPIRequest sends an API request which can be safely repeated,
+// retrying it according to the policy set using WithAPIRetry. Request
+// errors are retried if retryable, and so are errors returned by respErr
+// for a response (if set).
+func (js *jetStream) idempotentAPIRequest(ctx context.Context, subject string, respErr func(*jetStreamMsg) error, data ...[]byte) (*jetStreamMsg, error) {
+	policy := js.opts.apiRetry
+	if policy == nil {
+		return js.apiRequest(ctx, subject, data...)
+	}
+	// outcome of the last attempt which failed with a retryable error
+	var lastMsg *jetStreamMsg
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		jsMsg, err := js.apiRequestAttempt(ctx, policy.AttemptTimeout, subject, data...)
+		if attempt > 1 && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			// the context is done, report the error of the previous attempt
+			// rather than the context error
+			jsMsg, err = lastMsg, lastErr
+		}
+		retryErr := err
+		if err == nil && respErr != nil {
+			retryErr = respErr(jsMsg)
+		}
+		if retryErr != nil && attempt < policy.MaxAttempts && IsRetryableError(retryErr) && ctx.Err() == nil {
+			lastMsg, lastErr = jsMsg, err
+			select {
+			case <-time.After(policy.backoff(attempt)):
+				continue
+			case <-ctx.Done():
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return jsMsg, nil
+	}
+}
+
+// apiResponseError returns the error set in a JSON API response, if any.
+func apiResponseError(jsMsg *jetStreamMsg) error {
+	var r apiResponse
+	if json.Unmarshal(jsMsg.Data(), &r) == nil && r.Error != nil {
+		return r.Error
+	}
+	return nil
+}
+
+func (js *jetStream) apiRequestAttempt(ctx context.Context, timeout time.Duration, subj string, data ...[]byte) (*jetStreamMsg, error) {
+	if timeout <= 0 {
+		return js.apiRequest(ctx, subj, data...)
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	jsMsg, err := js.apiRequest(attemptCtx, subj, data...)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		// only the attempt timed out, which can be retried
+		return nil, nats.ErrTimeout
+	}
+	return jsMsg, err
+}
+
+// backoff returns the delay before the next attempt.
+func (p *APIRetryPolicy) backoff(attempt int) time.Duration {
+	delay := backoffDelay(p.InitialBackoff, p.MaxBackoff, uint64(attempt))
+	if p.Jitter > 0 {
+		delay += time.Duration(p.Jitter * (2*rand.Float64() - 1) * float64(delay))
+	}
+	return delay
+}
+
 func (js *jetStream) apiSubject(subj string) string {
 	if js.opts.apiPrefix == "" {
 		return subj
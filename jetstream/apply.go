@@ -0,0 +1,421 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Manifest describes the desired state of JetStream resources. It can
+	// be decoded from JSON using [ParseManifest]; field names follow the
+	// JetStream JSON API. Other formats, such as YAML, are not supported.
+	Manifest struct {
+		// Streams is a list of stream configurations.
+		Streams []StreamConfig `json:"streams,omitempty"`
+
+		// Consumers is a list of consumer configurations, along with the
+		// names of their streams.
+		Consumers []ManifestConsumer `json:"consumers,omitempty"`
+
+		// KeyValueStores is a list of KeyValue bucket configurations.
+		KeyValueStores []KeyValueConfig `json:"key_value_stores,omitempty"`
+
+		// ObjectStores is a list of object store configurations.
+		ObjectStores []ObjectStoreConfig `json:"object_stores,omitempty"`
+	}
+
+	// ManifestConsumer is a consumer definition in a [Manifest]. Either
+	// Name or Durable has to be set in the consumer config.
+	ManifestConsumer struct {
+		// Stream is the name of the stream the consumer is created on.
+		Stream string `json:"stream"`
+
+		// Config is the consumer configuration.
+		Config ConsumerConfig `json:"config"`
+	}
+
+	// ApplyOpt is a function setting options for [Apply].
+	ApplyOpt func(*applyOpts) error
+
+	applyOpts struct {
+		dryRun bool
+	}
+
+	// Plan is the result of comparing a [Manifest] with the state of the
+	// server. It is returned by [Apply].
+	Plan struct {
+		// Actions contains a single action for each resource in the
+		// manifest, in the order they are applied.
+		Actions []PlanAction
+
+		// DryRun is set if the plan was not applied.
+		DryRun bool
+	}
+
+	// PlanAction describes what Apply does (or did) for a single resource.
+	PlanAction struct {
+		// Resource is the type of the resource.
+		Resource ResourceType
+
+		// Name is the name of the stream, consumer or bucket.
+		Name string
+
+		// Stream is the name of the stream for consumers.
+		Stream string
+
+		// Action is the action required to reach the desired state.
+		Action ActionType
+
+		// Changes lists the fields which differ from the state on the
+		// server. It is empty for created and unchanged resources.
+		Changes []ConfigChange
+	}
+
+	// ResourceType is the type of resource in a [Manifest].
+	ResourceType int
+
+	// ActionType is the action required to bring a resource to the state
+	// described in a [Manifest].
+	ActionType int
+)
+
+const (
+	// StreamResource is a stream.
+	StreamResource ResourceType = iota
+
+	// ConsumerResource is a consumer.
+	ConsumerResource
+
+	// KeyValueResource is a KeyValue bucket.
+	KeyValueResource
+
+	// ObjectStoreResource is an object store.
+	ObjectStoreResource
+)
+
+const (
+	// ActionNone means the resource is already in the desired state.
+	ActionNone ActionType = iota
+
+	// ActionCreate means the resource does not exist and will be created.
+	ActionCreate
+
+	// ActionUpdate means the resource exists and will be updated.
+	ActionUpdate
+
+	// ActionNotUpdatable means the resource exists, but the desired state
+	// contains changes which are not editable (see [Mutability]). Such
+	// resources are not modified.
+	ActionNotUpdatable
+)
+
+func (r ResourceType) String() string {
+	switch r {
+	case StreamResource:
+		return "Stream"
+	case ConsumerResource:
+		return "Consumer"
+	case KeyValueResource:
+		return "KeyValue"
+	case ObjectStoreResource:
+		return "ObjectStore"
+	default:
+		return "Unknown Resource Type"
+	}
+}
+
+func (a ActionType) String() string {
+	switch a {
+	case ActionNone:
+		return "None"
+	case ActionCreate:
+		return "Create"
+	case ActionUpdate:
+		return "Update"
+	case ActionNotUpdatable:
+		return "NotUpdatable"
+	default:
+		return "Unknown Action Type"
+	}
+}
+
+// WithDryRun makes [Apply] return the plan without modifying any resources.
+func WithDryRun() ApplyOpt {
+	return func(opts *applyOpts) error {
+		opts.dryRun = true
+		return nil
+	}
+}
+
+// ParseManifest decodes a JSON manifest. Only JSON input is accepted.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// NotUpdatable returns actions for resources which cannot be updated to the
+// desired state.
+func (p *Plan) NotUpdatable() []PlanAction {
+	var res []PlanAction
+	for _, action := range p.Actions {
+		if action.Action == ActionNotUpdatable {
+			res = append(res, action)
+		}
+	}
+	return res
+}
+
+// HasChanges returns true if any resource has to be created or updated.
+func (p *Plan) HasChanges() bool {
+	for _, action := range p.Actions {
+		if action.Action != ActionNone {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply compares the resources described in the manifest with their state
+// on the server and creates or updates them to match the manifest.
+// Resources not present in the manifest are not modified.
+//
+// The plan is computed before any changes are made. If any resource
+// requires a change of an immutable field (e.g. stream storage type or
+// retention policy), nothing is applied and ErrNotUpdatable is returned
+// along with the plan. If WithDryRun option is used, the plan is returned
+// without applying it.
+//
+// Streams are applied first, followed by KeyValue stores, object stores and
+// consumers.
+//
+// Apply only supports JetStream instances created using [New], other
+// implementations (e.g. jetstreamtest) are rejected with ErrInvalidOption.
+func Apply(ctx context.Context, js JetStream, m Manifest, opts ...ApplyOpt) (*Plan, error) {
+	var o applyOpts
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	jsc, ok := js.(*jetStream)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported JetStream implementation", ErrInvalidOption)
+	}
+
+	plan, err := jsc.plan(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	plan.DryRun = o.dryRun
+	if o.dryRun {
+		return plan, nil
+	}
+	if notUpdatable := plan.NotUpdatable(); len(notUpdatable) > 0 {
+		names := make([]string, 0, len(notUpdatable))
+		for _, action := range notUpdatable {
+			names = append(names, fmt.Sprintf("%s %q", action.Resource, action.Name))
+		}
+		return plan, fmt.Errorf("%w: %s", ErrNotUpdatable, strings.Join(names, ", "))
+	}
+	if err := jsc.applyPlan(ctx, m, plan); err != nil {
+		return plan, err
+	}
+	return plan, nil
+}
+
+func (js *jetStream) plan(ctx context.Context, m Manifest) (*Plan, error) {
+	plan := &Plan{}
+	created := make(map[string]struct{})
+
+	planStream := func(resource ResourceType, name string, cfg StreamConfig) error {
+		action := PlanAction{Resource: resource, Name: name}
+		s, err := js.Stream(ctx, cfg.Name)
+		switch {
+		case errors.Is(err, ErrStreamNotFound):
+			action.Action = ActionCreate
+			created[cfg.Name] = struct{}{}
+		case err != nil:
+			return err
+		default:
+			action.Changes = s.CachedInfo().Config.Diff(cfg)
+			action.Action = actionForChanges(action.Changes)
+		}
+		plan.Actions = append(plan.Actions, action)
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	for _, cfg := range m.Streams {
+		if err := validateStreamName(cfg.Name); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[cfg.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate stream %q in manifest", ErrInvalidOption, cfg.Name)
+		}
+		seen[cfg.Name] = struct{}{}
+		if err := planStream(StreamResource, cfg.Name, cfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range m.KeyValueStores {
+		scfg, err := js.prepareKeyValueConfig(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[scfg.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate bucket %q in manifest", ErrInvalidOption, cfg.Bucket)
+		}
+		seen[scfg.Name] = struct{}{}
+		if err := planStream(KeyValueResource, cfg.Bucket, scfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, cfg := range m.ObjectStores {
+		scfg, err := js.prepareObjectStoreConfig(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[scfg.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate bucket %q in manifest", ErrInvalidOption, cfg.Bucket)
+		}
+		seen[scfg.Name] = struct{}{}
+		if err := planStream(ObjectStoreResource, cfg.Bucket, scfg); err != nil {
+			return nil, err
+		}
+	}
+
+	seenConsumers := make(map[string]struct{})
+	for _, c := range m.Consumers {
+		if err := validateStreamName(c.Stream); err != nil {
+			return nil, err
+		}
+		name := manifestConsumerName(c.Config)
+		if name == "" {
+			return nil, fmt.Errorf("%w: consumer name is required in manifest", ErrInvalidConsumerName)
+		}
+		if err := validateConsumerName(name); err != nil {
+			return nil, err
+		}
+		key := c.Stream + "." + name
+		if _, ok := seenConsumers[key]; ok {
+			return nil, fmt.Errorf("%w: duplicate consumer %q on stream %q in manifest", ErrInvalidOption, name, c.Stream)
+		}
+		seenConsumers[key] = struct{}{}
+
+		action := PlanAction{Resource: ConsumerResource, Name: name, Stream: c.Stream}
+		if _, ok := created[c.Stream]; ok {
+			action.Action = ActionCreate
+			plan.Actions = append(plan.Actions, action)
+			continue
+		}
+		info, err := fetchConsumerInfo(ctx, js, c.Stream, name)
+		switch {
+		case errors.Is(err, ErrConsumerNotFound):
+			action.Action = ActionCreate
+		case err != nil:
+			return nil, err
+		default:
+			action.Changes = info.Config.Diff(c.Config)
+			action.Action = actionForChanges(action.Changes)
+		}
+		plan.Actions = append(plan.Actions, action)
+	}
+	return plan, nil
+}
+
+func (js *jetStream) applyPlan(ctx context.Context, m Manifest, plan *Plan) error {
+	// Actions are stored in the same order as resources in the manifest.
+	actions := plan.Actions
+	next := func() PlanAction {
+		action := actions[0]
+		actions = actions[1:]
+		return action
+	}
+	for _, cfg := range m.Streams {
+		var err error
+		switch next().Action {
+		case ActionCreate:
+			_, err = js.CreateStream(ctx, cfg)
+		case ActionUpdate:
+			_, err = js.UpdateStream(ctx, cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("applying stream %q: %w", cfg.Name, err)
+		}
+	}
+	for _, cfg := range m.KeyValueStores {
+		var err error
+		switch next().Action {
+		case ActionCreate:
+			_, err = js.CreateKeyValue(ctx, cfg)
+		case ActionUpdate:
+			_, err = js.UpdateKeyValue(ctx, cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("applying key value store %q: %w", cfg.Bucket, err)
+		}
+	}
+	for _, cfg := range m.ObjectStores {
+		var err error
+		switch next().Action {
+		case ActionCreate:
+			_, err = js.CreateObjectStore(ctx, cfg)
+		case ActionUpdate:
+			_, err = js.UpdateObjectStore(ctx, cfg)
+		}
+		if err != nil {
+			return fmt.Errorf("applying object store %q: %w", cfg.Bucket, err)
+		}
+	}
+	for _, c := range m.Consumers {
+		var err error
+		switch next().Action {
+		case ActionCreate:
+			_, err = sendConsumerCreateRequest(ctx, js, c.Stream, c.Config, consumerActionCreate)
+		case ActionUpdate:
+			_, err = sendConsumerCreateRequest(ctx, js, c.Stream, c.Config, consumerActionUpdate)
+		}
+		if err != nil {
+			return fmt.Errorf("applying consumer %q on stream %q: %w", manifestConsumerName(c.Config), c.Stream, err)
+		}
+	}
+	return nil
+}
+
+func manifestConsumerName(cfg ConsumerConfig) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return cfg.Durable
+}
+
+func actionForChanges(changes []ConfigChange) ActionType {
+	if len(changes) == 0 {
+		return ActionNone
+	}
+	for _, change := range changes {
+		if change.Mutability != MutabilityEditable {
+			return ActionNotUpdatable
+		}
+	}
+	return ActionUpdate
+}
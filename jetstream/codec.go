@@ -0,0 +1,85 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/encoders/builtin"
+)
+
+//lint:file-ignore SA1019 Ignore deprecation warnings for builtin encoders
+
+type (
+	// Codec encodes and decodes message payloads for [TypedPublisher] and
+	// [TypedConsumer]. The content type returned by ContentType is set on
+	// published messages using [ContentTypeHeader] and verified when
+	// decoding messages.
+	//
+	// [JSONCodec] and [GobCodec] are provided by this package, a protobuf
+	// codec is available in the encoders/protobuf package.
+	Codec interface {
+		// ContentType returns the content type of encoded payloads, e.g.
+		// "application/json".
+		ContentType() string
+
+		// Encode returns the encoded payload of v.
+		Encode(v any) ([]byte, error)
+
+		// Decode decodes data into the value pointed to by vPtr.
+		Decode(data []byte, vPtr any) error
+	}
+
+	// encoderCodec adapts an encoder used by encoded connections to the
+	// Codec interface. If set, decode is used instead of the encoder to
+	// decode payloads.
+	encoderCodec struct {
+		contentType string
+		enc         nats.Encoder
+		decode      func(data []byte, vPtr any) error
+	}
+)
+
+// ContentTypeHeader contains the content type of messages published using
+// [TypedPublisher]. It is used by [TypedConsumer] to reject messages which
+// were encoded using a different codec.
+const ContentTypeHeader = "Content-Type"
+
+var (
+	// JSONCodec encodes payloads as JSON using encoding/json.
+	//
+	// Unlike the encoder used by encoded connections, strings and byte
+	// slices are decoded using encoding/json as well, so that they
+	// round-trip with the encoded values.
+	JSONCodec Codec = &encoderCodec{contentType: "application/json", enc: &builtin.JsonEncoder{}, decode: json.Unmarshal}
+
+	// GobCodec encodes payloads using encoding/gob.
+	GobCodec Codec = &encoderCodec{contentType: "application/x-gob", enc: &builtin.GobEncoder{}}
+)
+
+func (c *encoderCodec) ContentType() string {
+	return c.contentType
+}
+
+func (c *encoderCodec) Encode(v any) ([]byte, error) {
+	return c.enc.Encode("", v)
+}
+
+func (c *encoderCodec) Decode(data []byte, vPtr any) error {
+	if c.decode != nil {
+		return c.decode(data, vPtr)
+	}
+	return c.enc.Decode("", data, vPtr)
+}
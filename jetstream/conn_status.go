@@ -0,0 +1,81 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// connStatusListeners holds a single status listener per connection,
+// shared by consumers, ack pipelines, outboxes and caches. Channels
+// returned by nats.Conn.StatusChanged cannot be removed from the
+// connection, so registering one for each of them would leak a channel
+// every time one is stopped.
+var connStatusListeners = struct {
+	sync.Mutex
+	conns map[*nats.Conn]map[chan nats.Status][]nats.Status
+}{conns: make(map[*nats.Conn]map[chan nats.Status][]nats.Status)}
+
+// statusChanged returns a channel on which the given status changes of nc
+// are reported, in the same manner as nats.Conn.StatusChanged. The returned
+// function removes the channel and has to be called once it is no longer
+// used. The channel is never closed.
+func statusChanged(nc *nats.Conn, statuses ...nats.Status) (chan nats.Status, func()) {
+	ch := make(chan nats.Status, 10)
+	connStatusListeners.Lock()
+	defer connStatusListeners.Unlock()
+	listeners, ok := connStatusListeners.conns[nc]
+	if !ok {
+		if nc.IsClosed() {
+			// no status changes will be reported anymore
+			return ch, func() {}
+		}
+		listeners = make(map[chan nats.Status][]nats.Status)
+		connStatusListeners.conns[nc] = listeners
+		go dispatchStatus(nc, nc.StatusChanged(nats.CONNECTED, nats.RECONNECTING, nats.DISCONNECTED, nats.CLOSED))
+	}
+	listeners[ch] = statuses
+	return ch, func() {
+		connStatusListeners.Lock()
+		defer connStatusListeners.Unlock()
+		delete(listeners, ch)
+	}
+}
+
+// dispatchStatus forwards status changes of nc to the registered channels
+// until the connection is closed.
+func dispatchStatus(nc *nats.Conn, connStatus <-chan nats.Status) {
+	for status := range connStatus {
+		connStatusListeners.Lock()
+		for ch, statuses := range connStatusListeners.conns[nc] {
+			if !slices.Contains(statuses, status) {
+				continue
+			}
+			// only send event if someone's listening
+			select {
+			case ch <- status:
+			default:
+			}
+		}
+		if status == nats.CLOSED {
+			delete(connStatusListeners.conns, nc)
+			connStatusListeners.Unlock()
+			return
+		}
+		connStatusListeners.Unlock()
+	}
+}
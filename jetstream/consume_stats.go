@@ -0,0 +1,223 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/internal/parser"
+)
+
+type (
+	// ConsumeStats contains runtime statistics of a [ConsumeContext] or a
+	// [MessagesContext], returned by their Stats method. Counters are
+	// cumulative for the lifetime of the context. For ordered consumers,
+	// they include all consumers created on reset.
+	ConsumeStats struct {
+		// Delivered is the number of messages passed to the handler or
+		// returned by Next.
+		Delivered uint64
+
+		// Redelivered is the number of delivered messages which were
+		// delivered by the server more than once.
+		Redelivered uint64
+
+		// Acked is the number of delivered messages which were
+		// acknowledged, either directly or using the [AckPipeline] once
+		// the acknowledgement was confirmed.
+		Acked uint64
+
+		// Naked is the number of delivered messages which were negatively
+		// acknowledged.
+		Naked uint64
+
+		// Termed is the number of delivered messages which were
+		// terminated.
+		Termed uint64
+
+		// PendingMsgs is the number of messages requested in pull
+		// requests which were not yet received. It is always 0 for push
+		// consumers.
+		PendingMsgs int
+
+		// PendingBytes is the number of bytes requested in pull requests
+		// which were not yet received. It is only tracked when consuming
+		// with [PullMaxBytes].
+		PendingBytes int
+
+		// Buffered is the number of messages received from the server
+		// which are waiting to be processed.
+		Buffered int
+
+		// MissedHeartbeats is the number of times heartbeats were not
+		// received in time.
+		MissedHeartbeats uint64
+
+		// PullRequests is the number of pull requests sent to the server.
+		PullRequests uint64
+
+		// Reconnects is the number of times the connection was
+		// re-established while consuming.
+		Reconnects uint64
+
+		// Resets is the number of times an ordered consumer recreated its
+		// underlying consumer.
+		Resets uint64
+
+		// HandlerLatency is the average time spent in the handler. It is
+		// always 0 for [MessagesContext].
+		HandlerLatency time.Duration
+
+		// MaxHandlerLatency is the longest time spent in the handler.
+		MaxHandlerLatency time.Duration
+	}
+
+	// consumeStats collects statistics of a single Consume or Messages
+	// call. It is shared by all subscriptions created by an ordered
+	// consumer. All methods are safe to call on a nil receiver.
+	consumeStats struct {
+		delivered        atomic.Uint64
+		redelivered      atomic.Uint64
+		acked            atomic.Uint64
+		naked            atomic.Uint64
+		termed           atomic.Uint64
+		pendingMsgs      atomic.Int64
+		pendingBytes     atomic.Int64
+		missedHeartbeats atomic.Uint64
+		pullRequests     atomic.Uint64
+		reconnects       atomic.Uint64
+		resets           atomic.Uint64
+		handled          atomic.Uint64
+		handlerTime      atomic.Int64
+		maxHandlerTime   atomic.Int64
+	}
+)
+
+// recordDelivered counts a message delivered to the user.
+func (s *consumeStats) recordDelivered(msg *nats.Msg) {
+	if s == nil {
+		return
+	}
+	s.delivered.Add(1)
+	tokens, err := parser.GetMetadataFields(msg.Reply)
+	if err == nil && parser.ParseNum(tokens[parser.AckNumDeliveredTokenPos]) > 1 {
+		s.redelivered.Add(1)
+	}
+}
+
+// recordHandled records the time spent in the handler.
+func (s *consumeStats) recordHandled(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.handled.Add(1)
+	s.handlerTime.Add(int64(d))
+	for {
+		cur := s.maxHandlerTime.Load()
+		if int64(d) <= cur || s.maxHandlerTime.CompareAndSwap(cur, int64(d)) {
+			return
+		}
+	}
+}
+
+// recordAck counts an acknowledgement of the given type.
+func (s *consumeStats) recordAck(ackType ackType) {
+	if s == nil {
+		return
+	}
+	switch {
+	case bytes.Equal(ackType, ackAck):
+		s.acked.Add(1)
+	case bytes.Equal(ackType, ackNak):
+		s.naked.Add(1)
+	case bytes.Equal(ackType, ackTerm):
+		s.termed.Add(1)
+	}
+}
+
+func (s *consumeStats) setPending(msgs, size int) {
+	if s == nil {
+		return
+	}
+	s.pendingMsgs.Store(int64(msgs))
+	s.pendingBytes.Store(int64(size))
+}
+
+func (s *consumeStats) recordMissedHeartbeat() {
+	if s == nil {
+		return
+	}
+	s.missedHeartbeats.Add(1)
+}
+
+func (s *consumeStats) recordPullRequest() {
+	if s == nil {
+		return
+	}
+	s.pullRequests.Add(1)
+}
+
+func (s *consumeStats) recordReconnect() {
+	if s == nil {
+		return
+	}
+	s.reconnects.Add(1)
+}
+
+func (s *consumeStats) recordReset() {
+	if s == nil {
+		return
+	}
+	s.resets.Add(1)
+}
+
+// snapshot returns current statistics with the given number of buffered
+// messages.
+func (s *consumeStats) snapshot(buffered int) ConsumeStats {
+	if s == nil {
+		return ConsumeStats{Buffered: buffered}
+	}
+	stats := ConsumeStats{
+		Delivered:         s.delivered.Load(),
+		Redelivered:       s.redelivered.Load(),
+		Acked:             s.acked.Load(),
+		Naked:             s.naked.Load(),
+		Termed:            s.termed.Load(),
+		PendingMsgs:       int(s.pendingMsgs.Load()),
+		PendingBytes:      int(s.pendingBytes.Load()),
+		Buffered:          buffered,
+		MissedHeartbeats:  s.missedHeartbeats.Load(),
+		PullRequests:      s.pullRequests.Load(),
+		Reconnects:        s.reconnects.Load(),
+		Resets:            s.resets.Load(),
+		MaxHandlerLatency: time.Duration(s.maxHandlerTime.Load()),
+	}
+	if handled := s.handled.Load(); handled > 0 {
+		stats.HandlerLatency = time.Duration(s.handlerTime.Load() / int64(handled))
+	}
+	return stats
+}
+
+// consumeWithStats makes the subscription record statistics in stats
+// instead of creating its own collector. It is used by ordered consumers
+// to keep statistics across resets.
+func consumeWithStats(stats *consumeStats) pullOptFunc {
+	return pullOptFunc(func(opts *consumeOpts) error {
+		opts.stats = stats
+		return nil
+	})
+}
@@ -162,7 +162,7 @@ func (p *pullConsumer) Info(ctx context.Context) (*ConsumerInfo, error) {
 	infoSubject := fmt.Sprintf(apiConsumerInfoT, p.stream, p.name)
 	var resp consumerInfoResponse
 
-	if _, err := p.js.apiRequestJSON(ctx, infoSubject, &resp); err != nil {
+	if _, err := p.js.idempotentAPIRequestJSON(ctx, infoSubject, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
@@ -187,6 +187,43 @@ func (p *pullConsumer) CachedInfo() *ConsumerInfo {
 }
 
 func upsertConsumer(ctx context.Context, js *jetStream, stream string, cfg ConsumerConfig, action string) (Consumer, error) {
+	info, err := sendConsumerCreateRequest(ctx, js, stream, cfg, action)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pullConsumer{
+		js:      js,
+		stream:  stream,
+		name:    info.Name,
+		durable: cfg.Durable != "",
+		info:    info,
+		subs:    syncx.Map[string, *pullSubscription]{},
+	}, nil
+}
+
+func upsertPushConsumer(ctx context.Context, js *jetStream, stream string, cfg ConsumerConfig, action string) (PushConsumer, error) {
+	if cfg.DeliverSubject == "" {
+		return nil, ErrNotPushConsumer
+	}
+	if err := validateSubject(cfg.DeliverSubject); err != nil {
+		return nil, err
+	}
+	info, err := sendConsumerCreateRequest(ctx, js, stream, cfg, action)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pushConsumer{
+		js:     js,
+		stream: stream,
+		name:   info.Name,
+		info:   info,
+		subs:   syncx.Map[string, *pushSubscription]{},
+	}, nil
+}
+
+func sendConsumerCreateRequest(ctx context.Context, js *jetStream, stream string, cfg ConsumerConfig, action string) (*ConsumerInfo, error) {
 	ctx, cancel := js.wrapContextWithoutDeadline(ctx)
 	if cancel != nil {
 		defer cancel()
@@ -224,7 +261,7 @@ func upsertConsumer(ctx context.Context, js *jetStream, stream string, cfg Consu
 	}
 	var resp consumerInfoResponse
 
-	if _, err := js.apiRequestJSON(ctx, ccSubj, &resp, reqJSON); err != nil {
+	if _, err := js.idempotentAPIRequestJSON(ctx, ccSubj, &resp, reqJSON); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
@@ -239,14 +276,7 @@ func upsertConsumer(ctx context.Context, js *jetStream, stream string, cfg Consu
 		return nil, ErrConsumerMultipleFilterSubjectsNotSupported
 	}
 
-	return &pullConsumer{
-		js:      js,
-		stream:  stream,
-		name:    resp.Name,
-		durable: cfg.Durable != "",
-		info:    resp.ConsumerInfo,
-		subs:    syncx.Map[string, *pullSubscription]{},
-	}, nil
+	return resp.ConsumerInfo, nil
 }
 
 const (
@@ -267,6 +297,43 @@ func generateConsName() string {
 }
 
 func getConsumer(ctx context.Context, js *jetStream, stream, name string) (Consumer, error) {
+	info, err := fetchConsumerInfo(ctx, js, stream, name)
+	if err != nil {
+		return nil, err
+	}
+	cons := &pullConsumer{
+		js:      js,
+		stream:  stream,
+		name:    name,
+		durable: info.Config.Durable != "",
+		info:    info,
+		subs:    syncx.Map[string, *pullSubscription]{},
+	}
+
+	return cons, nil
+}
+
+func getPushConsumer(ctx context.Context, js *jetStream, stream, name string) (PushConsumer, error) {
+	info, err := fetchConsumerInfo(ctx, js, stream, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config.DeliverSubject == "" {
+		return nil, ErrNotPushConsumer
+	}
+
+	cons := &pushConsumer{
+		js:     js,
+		stream: stream,
+		name:   name,
+		info:   info,
+		subs:   syncx.Map[string, *pushSubscription]{},
+	}
+
+	return cons, nil
+}
+
+func fetchConsumerInfo(ctx context.Context, js *jetStream, stream, name string) (*ConsumerInfo, error) {
 	ctx, cancel := js.wrapContextWithoutDeadline(ctx)
 	if cancel != nil {
 		defer cancel()
@@ -278,7 +345,7 @@ func getConsumer(ctx context.Context, js *jetStream, stream, name string) (Consu
 
 	var resp consumerInfoResponse
 
-	if _, err := js.apiRequestJSON(ctx, infoSubject, &resp); err != nil {
+	if _, err := js.idempotentAPIRequestJSON(ctx, infoSubject, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
@@ -290,17 +357,7 @@ func getConsumer(ctx context.Context, js *jetStream, stream, name string) (Consu
 	if resp.Error == nil && resp.ConsumerInfo == nil {
 		return nil, ErrConsumerNotFound
 	}
-
-	cons := &pullConsumer{
-		js:      js,
-		stream:  stream,
-		name:    name,
-		durable: resp.Config.Durable != "",
-		info:    resp.ConsumerInfo,
-		subs:    syncx.Map[string, *pullSubscription]{},
-	}
-
-	return cons, nil
+	return resp.ConsumerInfo, nil
 }
 
 func deleteConsumer(ctx context.Context, js *jetStream, stream, consumer string) error {
@@ -217,6 +217,28 @@ type (
 		// associating metadata on the consumer. This feature requires
 		// nats-server v2.10.0 or later.
 		Metadata map[string]string `json:"metadata,omitempty"`
+
+		// DeliverSubject is the subject on which the server delivers messages
+		// to a push consumer. Setting it makes the consumer a push consumer,
+		// which has to be managed using CreatePushConsumer, PushConsumer and
+		// related methods.
+		DeliverSubject string `json:"deliver_subject,omitempty"`
+
+		// DeliverGroup is an optional queue group name for a push consumer.
+		// When set, messages are distributed between all subscriptions
+		// consuming with the same group. Only applicable to push consumers.
+		DeliverGroup string `json:"deliver_group,omitempty"`
+
+		// FlowControl enables flow control for a push consumer. The server
+		// will periodically send flow control messages which are answered by
+		// the client once all preceding messages were processed. Requires
+		// IdleHeartbeat to be set. Only applicable to push consumers.
+		FlowControl bool `json:"flow_control,omitempty"`
+
+		// IdleHeartbeat is the interval in which the server sends heartbeat
+		// messages to a push consumer when there are no new messages to
+		// deliver. Only applicable to push consumers.
+		IdleHeartbeat time.Duration `json:"idle_heartbeat,omitempty"`
 	}
 
 	// OrderedConsumerConfig is the configuration of an ordered JetStream
@@ -0,0 +1,215 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// DeadLetterForwarder republishes messages which could not be processed
+	// by a consumer to a dead letter subject. It is created using
+	// [NewDeadLetterForwarder].
+	DeadLetterForwarder interface {
+		// Stop stops listening for advisories. Messages for which an
+		// advisory was already received may still be forwarded.
+		Stop() error
+	}
+
+	// DeadLetterConfig is the configuration of a [DeadLetterForwarder].
+	DeadLetterConfig struct {
+		// Stream is the name of the stream whose consumers are monitored.
+		// Required.
+		Stream string
+
+		// Consumer is the name of the monitored consumer. If not set, all
+		// consumers on the stream are monitored.
+		Consumer string
+
+		// Subject is the subject to which dead letters are published. The
+		// subject should be bound to a stream so that publishing is
+		// acknowledged. Required.
+		Subject string
+
+		// ErrHandler is invoked when a message could not be forwarded, e.g.
+		// because it was already removed from the stream. Errors are
+		// wrapped with [ErrDeadLetterForward].
+		ErrHandler func(error)
+	}
+
+	deadLetterForwarder struct {
+		js      *jetStream
+		stream  *stream
+		cfg     DeadLetterConfig
+		watcher AdvisoryWatcher
+	}
+)
+
+// Headers set on messages published by the [DeadLetterForwarder]. Headers
+// of the original message are preserved, except for the ones controlling
+// publish expectations (e.g. [ExpectedStreamHeader]).
+const (
+	// DeadLetterStreamHeader contains the name of the stream the message
+	// was originally stored in.
+	DeadLetterStreamHeader = "Nats-DLQ-Stream"
+
+	// DeadLetterSequenceHeader contains the sequence of the message in the
+	// original stream.
+	DeadLetterSequenceHeader = "Nats-DLQ-Sequence"
+
+	// DeadLetterSubjectHeader contains the original subject of the message.
+	DeadLetterSubjectHeader = "Nats-DLQ-Subject"
+
+	// DeadLetterConsumerHeader contains the name of the consumer which
+	// failed to process the message.
+	DeadLetterConsumerHeader = "Nats-DLQ-Consumer"
+
+	// DeadLetterDeliveriesHeader contains the number of delivery attempts.
+	DeadLetterDeliveriesHeader = "Nats-DLQ-Deliveries"
+
+	// DeadLetterReasonHeader contains the reason the message was dead
+	// lettered. It is either [DeadLetterReasonMaxDeliveries] or the reason
+	// passed to [Msg.TermWithReason].
+	DeadLetterReasonHeader = "Nats-DLQ-Reason"
+
+	// DeadLetterReasonMaxDeliveries is the value of [DeadLetterReasonHeader]
+	// for messages which reached the MaxDeliver limit of the consumer.
+	DeadLetterReasonMaxDeliveries = "max deliveries exceeded"
+)
+
+// NewDeadLetterForwarder creates a [DeadLetterForwarder] and starts
+// listening for max deliveries and message terminated advisories of the
+// consumers on a stream. For each advisory, the original message is
+// retrieved using [Stream.GetMsg] and republished to the dead letter subject
+// with headers describing its origin (see [DeadLetterStreamHeader] and
+// related headers).
+//
+// The message has to be present in the stream when the advisory is
+// processed, which may not be the case for streams using
+// [WorkQueuePolicy] or [InterestPolicy] retention, as terminated messages
+// are removed from such streams.
+//
+// Forwarded messages have [MsgIDHeader] set to a value unique for the
+// stream, consumer and sequence, so that multiple forwarders can be used
+// for the same consumer if the dead letter stream has deduplication
+// enabled.
+func NewDeadLetterForwarder(js JetStream, cfg DeadLetterConfig) (DeadLetterForwarder, error) {
+	jsc, ok := js.(*jetStream)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported JetStream implementation", ErrInvalidOption)
+	}
+	return jsc.startDeadLetterForwarder(cfg)
+}
+
+func (js *jetStream) startDeadLetterForwarder(cfg DeadLetterConfig) (*deadLetterForwarder, error) {
+	if err := validateStreamName(cfg.Stream); err != nil {
+		return nil, err
+	}
+	if err := validateSubject(cfg.Subject); err != nil {
+		return nil, err
+	}
+
+	opts := []AdvisoryOpt{
+		WithAdvisoryTypes(AdvisoryMaxDeliveries, AdvisoryMsgTerminated),
+		WithAdvisoryStream(cfg.Stream),
+	}
+	if cfg.Consumer != "" {
+		opts = append(opts, WithAdvisoryConsumer(cfg.Consumer))
+	}
+	watcher, err := js.Advisories(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	f := &deadLetterForwarder{
+		js: js,
+		// stream info is not needed to retrieve messages, in which case
+		// the message is retrieved from the stream leader
+		stream:  &stream{name: cfg.Stream, js: js, info: &StreamInfo{}},
+		cfg:     cfg,
+		watcher: watcher,
+	}
+	go f.run()
+	return f, nil
+}
+
+// Stop stops listening for advisories.
+func (f *deadLetterForwarder) Stop() error {
+	return f.watcher.Stop()
+}
+
+func (f *deadLetterForwarder) run() {
+	for event := range f.watcher.Events() {
+		var (
+			seq, deliveries uint64
+			reason          string
+		)
+		switch e := event.(type) {
+		case *ConsumerMaxDeliveriesAdvisory:
+			seq, deliveries, reason = e.StreamSeq, e.Deliveries, DeadLetterReasonMaxDeliveries
+		case *ConsumerMsgTerminatedAdvisory:
+			seq, deliveries, reason = e.StreamSeq, e.Deliveries, e.Reason
+		default:
+			continue
+		}
+		meta := event.Meta()
+		if err := f.forward(meta.Stream, meta.Consumer, seq, deliveries, reason); err != nil {
+			f.reportErr(fmt.Errorf("%w: stream %q, sequence %d: %w", ErrDeadLetterForward, meta.Stream, seq, err))
+		}
+	}
+}
+
+func (f *deadLetterForwarder) forward(streamName, consumer string, seq, deliveries uint64, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultAPITimeout)
+	defer cancel()
+
+	orig, err := f.stream.GetMsg(ctx, seq)
+	if err != nil {
+		return err
+	}
+
+	hdr := make(nats.Header, len(orig.Header)+7)
+	for k, v := range orig.Header {
+		if strings.HasPrefix(k, "Nats-Expected-") || k == MsgIDHeader {
+			continue
+		}
+		hdr[k] = v
+	}
+	hdr.Set(MsgIDHeader, fmt.Sprintf("%s.%s.%d", streamName, consumer, seq))
+	hdr.Set(DeadLetterStreamHeader, streamName)
+	hdr.Set(DeadLetterSequenceHeader, strconv.FormatUint(seq, 10))
+	hdr.Set(DeadLetterSubjectHeader, orig.Subject)
+	hdr.Set(DeadLetterConsumerHeader, consumer)
+	hdr.Set(DeadLetterDeliveriesHeader, strconv.FormatUint(deliveries, 10))
+	if reason != "" {
+		hdr.Set(DeadLetterReasonHeader, reason)
+	}
+
+	_, err = f.js.PublishMsg(ctx, &nats.Msg{
+		Subject: f.cfg.Subject,
+		Header:  hdr,
+		Data:    orig.Data,
+	})
+	return err
+}
+
+func (f *deadLetterForwarder) reportErr(err error) {
+	if f.cfg.ErrHandler != nil {
+		f.cfg.ErrHandler(err)
+	}
+}
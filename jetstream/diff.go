@@ -0,0 +1,300 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type (
+	// ConfigChange describes a difference between the current and the
+	// desired value of a single configuration field.
+	ConfigChange struct {
+		// Field is the JSON name of the changed field.
+		Field string
+
+		// Current is the current value of the field.
+		Current any
+
+		// Desired is the requested value of the field.
+		Desired any
+
+		// Mutability determines whether the change can be applied to an
+		// existing resource.
+		Mutability Mutability
+	}
+
+	// Mutability determines how a configuration change can be applied.
+	Mutability int
+)
+
+const (
+	// MutabilityEditable means the field can be changed by updating the
+	// resource.
+	MutabilityEditable Mutability = iota
+
+	// MutabilityRecreate means the field cannot be updated, but the change
+	// can be applied by deleting and recreating the resource (losing its
+	// state, e.g. messages or delivery progress).
+	MutabilityRecreate
+
+	// MutabilityImmutable means the change cannot be applied, e.g. the name
+	// of the resource differs.
+	MutabilityImmutable
+)
+
+func (m Mutability) String() string {
+	switch m {
+	case MutabilityEditable:
+		return "Editable"
+	case MutabilityRecreate:
+		return "Recreate"
+	case MutabilityImmutable:
+		return "Immutable"
+	default:
+		return "Unknown Mutability"
+	}
+}
+
+// String returns a human readable description of the change, suitable for
+// logging.
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s: %v -> %v (%s)", c.Field, c.Current, c.Desired, c.Mutability)
+}
+
+// Diff returns the list of changes required to turn cfg into other, e.g.
+// s.CachedInfo().Config.Diff(desired). Fields not set in either config are
+// compared against the defaults applied by the server, so that a config
+// returned from the server can be compared with a config which relies on
+// defaults.
+func (cfg StreamConfig) Diff(other StreamConfig) []ConfigChange {
+	current := streamConfigWithDefaults(cfg)
+	changes := diffConfigs(current, streamConfigWithDefaults(other), streamFieldMutability)
+	for i, change := range changes {
+		// A sealed stream cannot be unsealed, and the same applies to
+		// other restrictions which can only be enabled.
+		if enabled, ok := change.Current.(bool); ok && enabled && oneWayStreamFields[change.Field] {
+			changes[i].Mutability = MutabilityRecreate
+		}
+	}
+	return changes
+}
+
+// Diff returns the list of changes required to turn cfg into other, e.g.
+// c.CachedInfo().Config.Diff(desired). Fields not set in either config are
+// compared against the defaults applied by the server, so that a config
+// returned from the server can be compared with a config which relies on
+// defaults.
+func (cfg ConsumerConfig) Diff(other ConsumerConfig) []ConfigChange {
+	current := consumerConfigWithDefaults(cfg, cfg)
+	changes := diffConfigs(current, consumerConfigWithDefaults(current, other), consumerFieldMutability)
+	for i, change := range changes {
+		// Deliver subject can be changed, but a consumer cannot be
+		// converted between push and pull.
+		if change.Field == "deliver_subject" && (current.DeliverSubject == "" || other.DeliverSubject == "") {
+			changes[i].Mutability = MutabilityRecreate
+		}
+	}
+	return changes
+}
+
+const (
+	// serverMetadataPrefix is the prefix of metadata keys set by the server.
+	serverMetadataPrefix = "_nats."
+
+	defaultConsumerAckWait       = 30 * time.Second
+	defaultConsumerMaxAckPending = 1000
+	defaultConsumerMaxWaiting    = 512
+	defaultConsumerInactive      = 5 * time.Second
+	defaultStreamDuplicates      = 2 * time.Minute
+)
+
+var (
+	// streamFieldMutability contains fields which cannot be changed when
+	// updating a stream. Other fields are editable.
+	streamFieldMutability = map[string]Mutability{
+		"name":           MutabilityImmutable,
+		"template_owner": MutabilityImmutable,
+		"storage":        MutabilityRecreate,
+		"retention":      MutabilityRecreate,
+		"max_consumers":  MutabilityRecreate,
+		"mirror":         MutabilityRecreate,
+		"first_seq":      MutabilityRecreate,
+	}
+
+	// oneWayStreamFields contains boolean stream fields which can be
+	// enabled, but not disabled when updating a stream.
+	oneWayStreamFields = map[string]bool{
+		"sealed":        true,
+		"deny_delete":   true,
+		"deny_purge":    true,
+		"allow_msg_ttl": true,
+	}
+
+	// consumerFieldMutability contains fields which cannot be changed when
+	// updating a consumer. Other fields are editable.
+	consumerFieldMutability = map[string]Mutability{
+		"name":           MutabilityImmutable,
+		"durable_name":   MutabilityImmutable,
+		"deliver_policy": MutabilityRecreate,
+		"opt_start_seq":  MutabilityRecreate,
+		"opt_start_time": MutabilityRecreate,
+		"ack_policy":     MutabilityRecreate,
+		"replay_policy":  MutabilityRecreate,
+		"max_waiting":    MutabilityRecreate,
+		"flow_control":   MutabilityRecreate,
+		"idle_heartbeat": MutabilityRecreate,
+	}
+)
+
+func stripServerMetadata(md map[string]string) map[string]string {
+	if len(md) == 0 {
+		return md
+	}
+	res := make(map[string]string, len(md))
+	for k, v := range md {
+		if !strings.HasPrefix(k, serverMetadataPrefix) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// streamConfigWithDefaults sets the values the server uses for fields
+// which are not set in the config.
+func streamConfigWithDefaults(cfg StreamConfig) StreamConfig {
+	cfg.Metadata = stripServerMetadata(cfg.Metadata)
+	if cfg.MaxConsumers == 0 {
+		cfg.MaxConsumers = -1
+	}
+	if cfg.MaxMsgs == 0 {
+		cfg.MaxMsgs = -1
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = -1
+	}
+	if cfg.MaxMsgSize == 0 {
+		cfg.MaxMsgSize = -1
+	}
+	if cfg.MaxMsgsPerSubject == 0 {
+		cfg.MaxMsgsPerSubject = -1
+	}
+	if cfg.Replicas == 0 {
+		cfg.Replicas = 1
+	}
+	if cfg.Duplicates == 0 && cfg.Mirror == nil {
+		cfg.Duplicates = defaultStreamDuplicates
+		if cfg.MaxAge > 0 && cfg.MaxAge < defaultStreamDuplicates {
+			cfg.Duplicates = cfg.MaxAge
+		}
+	}
+	if len(cfg.Subjects) == 0 && cfg.Mirror == nil && len(cfg.Sources) == 0 {
+		cfg.Subjects = []string{cfg.Name}
+	}
+	return cfg
+}
+
+// consumerConfigWithDefaults sets the values the server uses for fields
+// which are not set in the config. Replicas are inherited from the stream
+// if not set, so the current value is used in that case.
+func consumerConfigWithDefaults(current, cfg ConsumerConfig) ConsumerConfig {
+	cfg.Metadata = stripServerMetadata(cfg.Metadata)
+	if cfg.Name == "" {
+		cfg.Name = cfg.Durable
+	}
+	if cfg.MaxDeliver == 0 {
+		cfg.MaxDeliver = -1
+	}
+	if cfg.AckWait == 0 {
+		cfg.AckWait = defaultConsumerAckWait
+		if len(cfg.BackOff) > 0 {
+			cfg.AckWait = cfg.BackOff[0]
+		}
+	}
+	if cfg.MaxAckPending == 0 && cfg.AckPolicy != AckNonePolicy {
+		cfg.MaxAckPending = defaultConsumerMaxAckPending
+	}
+	if cfg.MaxWaiting == 0 && cfg.DeliverSubject == "" {
+		cfg.MaxWaiting = defaultConsumerMaxWaiting
+	}
+	if cfg.InactiveThreshold == 0 && cfg.Durable == "" {
+		cfg.InactiveThreshold = defaultConsumerInactive
+	}
+	if cfg.Replicas == 0 {
+		cfg.Replicas = current.Replicas
+	}
+	return cfg
+}
+
+// diffConfigs compares exported fields of two values of the same struct
+// type. Fields are identified by their JSON names.
+func diffConfigs(current, desired any, mutability map[string]Mutability) []ConfigChange {
+	cv, dv := reflect.ValueOf(current), reflect.ValueOf(desired)
+	t := cv.Type()
+	var changes []ConfigChange
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := configFieldName(field)
+		if name == "" {
+			continue
+		}
+		c, d := cv.Field(i).Interface(), dv.Field(i).Interface()
+		if configValuesEqual(c, d) {
+			continue
+		}
+		changes = append(changes, ConfigChange{
+			Field:      name,
+			Current:    c,
+			Desired:    d,
+			Mutability: mutability[name],
+		})
+	}
+	return changes
+}
+
+func configFieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func configValuesEqual(a, b any) bool {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch av.Kind() {
+	case reflect.Slice, reflect.Map:
+		if av.Len() == 0 && bv.Len() == 0 {
+			return true
+		}
+	case reflect.Pointer:
+		if at, ok := a.(*time.Time); ok {
+			bt := b.(*time.Time)
+			if at == nil || bt == nil {
+				return at == bt
+			}
+			return at.Equal(*bt)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
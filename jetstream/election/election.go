@@ -0,0 +1,383 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package election implements leader election on top of a
+// [jetstream.KeyValue] bucket.
+//
+// Candidates campaign for a key in a bucket created with a TTL. The
+// candidate which creates the key becomes the leader and keeps updating it
+// using revision checks. If the leader crashes or is partitioned from the
+// server, its key expires and another candidate is elected.
+//
+// A partitioned leader steps down once it was not able to update the key
+// for the TTL of the bucket, before the key expires on the server, so at
+// most one candidate considers itself the leader at any time (assuming
+// clocks advance at the same rate). As leadership may still be lost while
+// work is in progress, resources should be protected using the fencing
+// token returned by [Election.Term].
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Election is a campaign of a single candidate, started using [Campaign].
+type Election struct {
+	kv        jetstream.KeyValue
+	key       string
+	candidate string
+	ttl       time.Duration
+
+	watcher  jetstream.KeyWatcher
+	stop     chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{}
+
+	mu        sync.Mutex
+	leader    bool
+	term      uint64
+	revision  uint64
+	deadline  time.Time
+	current   string
+	observers []chan bool
+	closed    bool
+}
+
+var (
+	// ErrNoBucketTTL is returned by [Campaign] when the bucket was created
+	// without a TTL, as leadership could not be taken over from a crashed
+	// leader.
+	ErrNoBucketTTL = errors.New("election: bucket has no ttl")
+
+	// ErrInvalidCandidate is returned by [Campaign] when the candidate ID is
+	// empty.
+	ErrInvalidCandidate = errors.New("election: invalid candidate id")
+)
+
+// Campaign starts campaigning for leadership of key in kv, which has to be
+// a bucket with a TTL. candidateID identifies the candidate and has to be
+// unique among all candidates.
+//
+// Campaign makes a first attempt to become the leader before returning, and
+// keeps campaigning in the background until ctx is done or
+// [Election.Resign] is called. The leader updates the key every third of
+// the bucket TTL; followers try to create it as soon as it is deleted, and
+// every half of the TTL to notice expiration.
+func Campaign(ctx context.Context, kv jetstream.KeyValue, key, candidateID string) (*Election, error) {
+	if candidateID == "" {
+		return nil, ErrInvalidCandidate
+	}
+	status, err := kv.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.TTL() == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoBucketTTL, kv.Bucket())
+	}
+
+	// the watcher has to be created before the first attempt so that
+	// changes made by other candidates are not missed
+	watcher, err := kv.Watch(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	e := &Election{
+		kv:        kv,
+		key:       key,
+		candidate: candidateID,
+		ttl:       status.TTL(),
+		watcher:   watcher,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	// load the current leader, a nil entry marks the end of initial values
+	for loaded := false; !loaded; {
+		select {
+		case entry := <-watcher.Updates():
+			if entry == nil {
+				loaded = true
+				continue
+			}
+			e.observe(entry)
+		case <-ctx.Done():
+			watcher.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	e.campaign(ctx)
+	go e.run(ctx)
+	return e, nil
+}
+
+// run keeps the leadership or campaigns for it until the election is
+// stopped.
+func (e *Election) run(ctx context.Context) {
+	defer close(e.stopped)
+	defer e.watcher.Stop()
+
+	timer := time.NewTimer(e.interval())
+	defer timer.Stop()
+	updates := e.watcher.Updates()
+	for {
+		select {
+		case entry, ok := <-updates:
+			if !ok {
+				// watcher stopped, expiration is checked on interval
+				updates = nil
+				continue
+			}
+			if entry == nil || !e.observe(entry) {
+				continue
+			}
+			// the key was deleted, campaign without waiting
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(0)
+		case <-timer.C:
+			if e.isLeader() {
+				e.refresh(ctx)
+			} else {
+				e.campaign(ctx)
+			}
+			timer.Reset(e.interval())
+		case <-ctx.Done():
+			resignCtx, cancel := context.WithTimeout(context.Background(), e.ttl/3)
+			e.resign(resignCtx)
+			cancel()
+			return
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// interval returns the time until the next refresh or campaign attempt.
+func (e *Election) interval() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.leader {
+		return e.ttl / 2
+	}
+	// wake up on the deadline at the latest to step down in time
+	return min(e.ttl/3, time.Until(e.deadline))
+}
+
+// campaign tries to become the leader by creating the key.
+func (e *Election) campaign(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/3)
+	defer cancel()
+	sent := time.Now()
+	revision, err := e.kv.Create(ctx, e.key, []byte(e.candidate))
+	if err != nil {
+		// the key exists or the server is not available, retry on interval
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.leader = true
+	e.term = revision
+	e.revision = revision
+	e.deadline = sent.Add(e.ttl)
+	e.current = e.candidate
+	e.notify(true)
+}
+
+// refresh updates the key, extending the leadership by the bucket TTL.
+func (e *Election) refresh(ctx context.Context) {
+	e.mu.Lock()
+	revision, deadline := e.revision, e.deadline
+	e.mu.Unlock()
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	sent := time.Now()
+	revision, err := e.kv.Update(ctx, e.key, []byte(e.candidate), revision)
+	var entry jetstream.KeyValueEntry
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// the reply of a previous update may have been lost, in which case
+		// the key still holds the candidate at a newer revision
+		entry, _ = e.kv.Get(ctx, e.key)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case err == nil:
+		e.revision = revision
+		e.deadline = sent.Add(e.ttl)
+	case entry != nil && string(entry.Value()) == e.candidate && entry.Revision() > e.revision:
+		// keep the deadline as the time the update was applied is unknown,
+		// the next refresh uses the adopted revision
+		e.revision = entry.Revision()
+	case errors.Is(err, jetstream.ErrKeyExists), !time.Now().Before(e.deadline):
+		// the key was modified by another candidate, or could not be
+		// updated before it expires on the server
+		e.stepDown()
+	}
+}
+
+// observe records the leader from an update of the key, returning true if
+// the key was deleted.
+func (e *Election) observe(entry jetstream.KeyValueEntry) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	deleted := entry.Operation() != jetstream.KeyValuePut
+	holder := string(entry.Value())
+	switch {
+	case deleted:
+		e.current = ""
+	case holder == e.candidate && !e.leader:
+		// key of a previous term which will expire
+		e.current = ""
+	default:
+		e.current = holder
+	}
+	// updates older than the leader's own revision were already handled
+	if e.leader && entry.Revision() > e.revision {
+		if deleted || holder != e.candidate {
+			e.stepDown()
+		} else {
+			// an update was applied on the server but its reply was lost
+			e.revision = entry.Revision()
+		}
+	}
+	return deleted
+}
+
+// stepDown gives up leadership. Lock should be held.
+func (e *Election) stepDown() {
+	if !e.leader {
+		return
+	}
+	e.leader = false
+	e.term = 0
+	if e.current == e.candidate {
+		e.current = ""
+	}
+	e.notify(false)
+}
+
+// notify sends the leadership state to all observers, replacing values not
+// yet received. Lock should be held.
+func (e *Election) notify(leader bool) {
+	for _, ch := range e.observers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- leader
+	}
+}
+
+func (e *Election) isLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// IsLeader returns true if the candidate is the leader. Leadership ends
+// once the key could not be updated for the TTL of the bucket, even if
+// the step down was not yet observed by the background campaign.
+func (e *Election) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader && time.Now().Before(e.deadline)
+}
+
+// Term returns the revision of the key at which the candidate became the
+// leader, or 0 if it is not the leader. Terms increase with each election,
+// so they can be used as fencing tokens.
+func (e *Election) Term() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.leader || !time.Now().Before(e.deadline) {
+		return 0
+	}
+	return e.term
+}
+
+// Leader returns the ID of the current leader as last observed, or an
+// empty string if there is none.
+func (e *Election) Leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.current
+}
+
+// Observe returns a channel receiving leadership changes of the candidate:
+// true when it becomes the leader and false when it steps down. The
+// current state is sent immediately. Only the latest state is buffered, so
+// slow receivers skip intermediate changes. The channel is closed when the
+// campaign ends.
+func (e *Election) Observe() <-chan bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ch := make(chan bool, 1)
+	if e.closed {
+		close(ch)
+		return ch
+	}
+	ch <- e.leader
+	e.observers = append(e.observers, ch)
+	return ch
+}
+
+// Resign stops the campaign. If the candidate is the leader, the key is
+// deleted so that another candidate can be elected without waiting for it
+// to expire.
+func (e *Election) Resign(ctx context.Context) error {
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.stopped
+	return e.resign(ctx)
+}
+
+// resign ends the campaign, deleting the key if the candidate is the
+// leader.
+func (e *Election) resign(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	leader, revision := e.leader, e.revision
+	e.stepDown()
+	e.closed = true
+	for _, ch := range e.observers {
+		close(ch)
+	}
+	e.observers = nil
+	e.mu.Unlock()
+
+	if !leader {
+		return nil
+	}
+	err := e.kv.Delete(ctx, e.key, jetstream.LastRevision(revision))
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		// leadership was already taken over
+		return nil
+	}
+	return err
+}
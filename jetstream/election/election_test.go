@@ -0,0 +1,295 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/jetstream/jetstreamtest"
+)
+
+// partitionedKV fails writes while partitioned, simulating a candidate
+// which cannot reach the server.
+type partitionedKV struct {
+	jetstream.KeyValue
+	partitioned atomic.Bool
+}
+
+func (kv *partitionedKV) Create(ctx context.Context, key string, value []byte) (uint64, error) {
+	if kv.partitioned.Load() {
+		<-ctx.Done()
+		return 0, nats.ErrTimeout
+	}
+	return kv.KeyValue.Create(ctx, key, value)
+}
+
+func (kv *partitionedKV) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	if kv.partitioned.Load() {
+		<-ctx.Done()
+		return 0, nats.ErrTimeout
+	}
+	return kv.KeyValue.Update(ctx, key, value, revision)
+}
+
+// lostReplyKV applies the next update but fails it as if its reply was
+// lost.
+type lostReplyKV struct {
+	jetstream.KeyValue
+	loseReply atomic.Bool
+}
+
+func (kv *lostReplyKV) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	revision, err := kv.KeyValue.Update(ctx, key, value, revision)
+	if err == nil && kv.loseReply.CompareAndSwap(true, false) {
+		return 0, nats.ErrTimeout
+	}
+	return revision, err
+}
+
+func newBucket(t *testing.T, ttl time.Duration) jetstream.KeyValue {
+	t.Helper()
+	js := jetstreamtest.New()
+	kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: "ELECTIONS", TTL: ttl})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return kv
+}
+
+func expectLeadership(t *testing.T, ch <-chan bool, expected bool, timeout time.Duration) {
+	t.Helper()
+	select {
+	case leader, ok := <-ch:
+		if !ok {
+			t.Fatalf("Observe channel closed")
+		}
+		if leader != expected {
+			t.Fatalf("Expected leadership to be %v", expected)
+		}
+	case <-time.After(timeout):
+		t.Fatalf("Did not receive leadership change to %v", expected)
+	}
+}
+
+func TestCampaign(t *testing.T) {
+	ctx := context.Background()
+	kv := newBucket(t, time.Minute)
+
+	a, err := Campaign(ctx, kv, "singleton", "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer a.Resign(ctx)
+	if !a.IsLeader() || a.Leader() != "a" || a.Term() == 0 {
+		t.Fatalf("Expected a to be the leader; got %q, term %d", a.Leader(), a.Term())
+	}
+
+	b, err := Campaign(ctx, kv, "singleton", "b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer b.Resign(ctx)
+	observeB := b.Observe()
+	expectLeadership(t, observeB, false, time.Second)
+	if b.IsLeader() || b.Term() != 0 {
+		t.Fatalf("Expected b not to be the leader")
+	}
+	if b.Leader() != "a" {
+		t.Fatalf("Expected b to observe a as the leader; got %q", b.Leader())
+	}
+
+	// a resigns voluntarily, b takes over without waiting for the TTL
+	observeA := a.Observe()
+	expectLeadership(t, observeA, true, time.Second)
+	termA := a.Term()
+	if err := a.Resign(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectLeadership(t, observeA, false, time.Second)
+	if _, ok := <-observeA; ok {
+		t.Fatalf("Expected observe channel to be closed after resign")
+	}
+	if a.IsLeader() {
+		t.Fatalf("Expected a not to be the leader after resign")
+	}
+	expectLeadership(t, observeB, true, time.Second)
+	if b.Term() <= termA {
+		t.Fatalf("Expected term to increase; got %d after %d", b.Term(), termA)
+	}
+	if err := a.Resign(ctx); err != nil {
+		t.Fatalf("Expected second resign to be a no-op; got: %v", err)
+	}
+}
+
+func TestCampaignContextDone(t *testing.T) {
+	kv := newBucket(t, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a, err := Campaign(ctx, kv, "singleton", "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	observeA := a.Observe()
+	expectLeadership(t, observeA, true, time.Second)
+
+	b, err := Campaign(context.Background(), kv, "singleton", "b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer b.Resign(context.Background())
+	observeB := b.Observe()
+	expectLeadership(t, observeB, false, time.Second)
+
+	cancel()
+	expectLeadership(t, observeA, false, time.Second)
+	expectLeadership(t, observeB, true, time.Second)
+	checkFor(t, time.Second, func() bool { return b.IsLeader() })
+}
+
+func TestCampaignKeyModified(t *testing.T) {
+	ctx := context.Background()
+	kv := newBucket(t, time.Minute)
+
+	a, err := Campaign(ctx, kv, "singleton", "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer a.Resign(ctx)
+	observeA := a.Observe()
+	expectLeadership(t, observeA, true, time.Second)
+
+	if _, err := kv.PutString(ctx, "singleton", "intruder"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectLeadership(t, observeA, false, time.Second)
+	checkFor(t, time.Second, func() bool { return a.Leader() == "intruder" })
+}
+
+func TestCampaignPartition(t *testing.T) {
+	ctx := context.Background()
+	ttl := 300 * time.Millisecond
+	kv := newBucket(t, ttl)
+
+	partitioned := &partitionedKV{KeyValue: kv}
+	a, err := Campaign(ctx, partitioned, "singleton", "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer a.Resign(ctx)
+	observeA := a.Observe()
+	expectLeadership(t, observeA, true, time.Second)
+
+	b, err := Campaign(ctx, kv, "singleton", "b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer b.Resign(ctx)
+	observeB := b.Observe()
+	expectLeadership(t, observeB, false, time.Second)
+
+	// the leader keeps its leadership past the TTL while connected
+	time.Sleep(2 * ttl)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("Expected a to stay the leader")
+	}
+
+	// the partitioned leader steps down before its key expires, and b is
+	// elected once it expired
+	partitioned.partitioned.Store(true)
+	partitionedAt := time.Now()
+	expectLeadership(t, observeA, false, 2*ttl)
+	expectLeadership(t, observeB, true, 3*ttl)
+	if a.IsLeader() {
+		t.Fatalf("Expected a not to be the leader while partitioned")
+	}
+	if time.Since(partitionedAt) < ttl/2 {
+		t.Fatalf("Leadership changed before the key could expire")
+	}
+
+	// after the partition heals, a stays a follower
+	partitioned.partitioned.Store(false)
+	time.Sleep(2 * ttl)
+	if a.IsLeader() || !b.IsLeader() {
+		t.Fatalf("Expected b to stay the leader after the partition healed")
+	}
+	if a.Leader() != "b" {
+		t.Fatalf("Expected a to observe b as the leader; got %q", a.Leader())
+	}
+}
+
+func TestCampaignLostReply(t *testing.T) {
+	ctx := context.Background()
+	ttl := 300 * time.Millisecond
+	kv := newBucket(t, ttl)
+
+	lossy := &lostReplyKV{KeyValue: kv}
+	a, err := Campaign(ctx, lossy, "singleton", "a")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer a.Resign(ctx)
+	observeA := a.Observe()
+	expectLeadership(t, observeA, true, time.Second)
+	term := a.Term()
+
+	b, err := Campaign(ctx, kv, "singleton", "b")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer b.Resign(ctx)
+
+	// the update is applied on the server, so a keeps its leadership at
+	// the newer revision
+	lossy.loseReply.Store(true)
+	time.Sleep(3 * ttl)
+	if lossy.loseReply.Load() {
+		t.Fatalf("Expected an update to be made")
+	}
+	select {
+	case <-observeA:
+		t.Fatalf("Expected a not to step down")
+	default:
+	}
+	if !a.IsLeader() || a.Term() != term || b.IsLeader() {
+		t.Fatalf("Expected a to stay the leader")
+	}
+}
+
+func TestCampaignNoBucketTTL(t *testing.T) {
+	kv := newBucket(t, 0)
+	if _, err := Campaign(context.Background(), kv, "singleton", "a"); !errors.Is(err, ErrNoBucketTTL) {
+		t.Fatalf("Expected error: %v; got: %v", ErrNoBucketTTL, err)
+	}
+	if _, err := Campaign(context.Background(), kv, "singleton", ""); !errors.Is(err, ErrInvalidCandidate) {
+		t.Fatalf("Expected error: %v; got: %v", ErrInvalidCandidate, err)
+	}
+}
+
+func checkFor(t *testing.T, timeout time.Duration, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if f() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Condition not met within %v", timeout)
+}
@@ -16,6 +16,8 @@ package jetstream
 import (
 	"errors"
 	"fmt"
+
+	"github.com/nats-io/nats.go"
 )
 
 type (
@@ -46,8 +48,9 @@ const (
 	JSErrCodeJetStreamNotEnabledForAccount ErrorCode = 10039
 	JSErrCodeJetStreamNotEnabled           ErrorCode = 10076
 
-	JSErrCodeStreamNotFound  ErrorCode = 10059
-	JSErrCodeStreamNameInUse ErrorCode = 10058
+	JSErrCodeStreamNotFound         ErrorCode = 10059
+	JSErrCodeStreamNameInUse        ErrorCode = 10058
+	JSErrCodeStreamNameInUseRestore ErrorCode = 10130
 
 	JSErrCodeConsumerCreate            ErrorCode = 10012
 	JSErrCodeConsumerNotFound          ErrorCode = 10014
@@ -64,6 +67,11 @@ const (
 	JSErrCodeBadRequest ErrorCode = 10003
 
 	JSErrCodeStreamWrongLastSequence ErrorCode = 10071
+
+	JSErrCodeClusterNotAvailable ErrorCode = 10008
+	JSErrCodeClusterNotLeader    ErrorCode = 10009
+	JSErrCodeStreamOffline       ErrorCode = 10118
+	JSErrCodeConsumerOffline     ErrorCode = 10119
 )
 
 var (
@@ -228,6 +236,48 @@ var (
 	// subscribed to a stream.
 	ErrConsumerHasActiveSubscription JetStreamError = &jsError{message: "consumer has active subscription"}
 
+	// ErrNotPushConsumer is returned when attempting to use push consumer
+	// methods on a consumer without a deliver subject.
+	ErrNotPushConsumer JetStreamError = &jsError{message: "consumer is not a push consumer"}
+
+	// ErrNotPullConsumer is returned when attempting to consume messages
+	// using pull consumer methods (e.g. Fetch or Consume) on a consumer with
+	// a deliver subject.
+	ErrNotPullConsumer JetStreamError = &jsError{message: "consumer is not a pull consumer"}
+
+	// ErrSnapshotTimeout is returned when a snapshot chunk is not received
+	// in time or the snapshot was aborted by the server.
+	ErrSnapshotTimeout JetStreamError = &jsError{message: "timeout waiting for snapshot chunk"}
+
+	// ErrRestoreTimeout is returned when the server does not confirm a
+	// restore chunk in time or the restored stream does not become
+	// available.
+	ErrRestoreTimeout JetStreamError = &jsError{message: "timeout waiting for stream restore"}
+
+	// ErrInvalidSnapshot is returned when the stream configuration cannot be
+	// read from the snapshot passed to RestoreStream.
+	ErrInvalidSnapshot JetStreamError = &jsError{message: "invalid stream snapshot"}
+
+	// ErrNotUpdatable is returned by Apply when the manifest requires
+	// changes to immutable fields of existing resources.
+	ErrNotUpdatable JetStreamError = &jsError{message: "manifest contains changes which cannot be applied to existing resources"}
+
+	// ErrDeadLetterForward is passed to the error handler when a message
+	// could not be forwarded to the dead letter subject.
+	ErrDeadLetterForward JetStreamError = &jsError{message: "failed to forward message to dead letter subject"}
+
+	// ErrAckWaitExceeded is returned when acknowledging a message handled
+	// with DeadlineMiddleware after the deadline was exceeded.
+	ErrAckWaitExceeded JetStreamError = &jsError{message: "ack wait exceeded"}
+
+	// ErrAckPipelineClosed is returned when acknowledging a message using
+	// an AckPipeline of a stopped consumer, and is passed to the error
+	// handler for acknowledgements which were not confirmed before closing.
+	ErrAckPipelineClosed JetStreamError = &jsError{message: "ack pipeline closed"}
+
+	// ErrOutboxClosed is returned when publishing using a closed Outbox.
+	ErrOutboxClosed JetStreamError = &jsError{message: "outbox closed"}
+
 	// ErrMsgNotBound is returned when given message is not bound to any
 	// subscription.
 	ErrMsgNotBound JetStreamError = &jsError{message: "message is not bound to subscription/connection"}
@@ -244,6 +294,18 @@ var (
 	// async message publish.
 	ErrAsyncPublishReplySubjectSet JetStreamError = &jsError{message: "reply subject should be empty"}
 
+	// ErrAsyncPublishTimeout is returned when the ack of an async publish is
+	// not received within the timeout set using WithPublishAsyncTimeout.
+	ErrAsyncPublishTimeout JetStreamError = &jsError{message: "timeout waiting for async publish acknowledgement"}
+
+	// ErrMsgEncode is returned when a value published using TypedPublisher
+	// could not be encoded.
+	ErrMsgEncode JetStreamError = &jsError{message: "failed to encode message"}
+
+	// ErrMsgDecode is returned when a message consumed using TypedConsumer
+	// could not be decoded.
+	ErrMsgDecode JetStreamError = &jsError{message: "failed to decode message"}
+
 	// ErrTooManyStalledMsgs is returned when too many outstanding async
 	// messages are waiting for ack.
 	ErrTooManyStalledMsgs JetStreamError = &jsError{message: "stalled with too many outstanding async published messages"}
@@ -323,6 +385,15 @@ var (
 	// ErrNoKeysFound is returned when no keys are found.
 	ErrNoKeysFound JetStreamError = &jsError{message: "no keys found"}
 
+	// ErrInvalidCounter is returned by counter helpers such as
+	// [IncrementCounter] when the value of a key is not a valid integer.
+	ErrInvalidCounter JetStreamError = &jsError{message: "value is not a valid counter"}
+
+	// ErrKeyValueCacheStopped is returned when a [KeyValueCache] is stopped
+	// while waiting for a revision, or before its initial values were
+	// loaded.
+	ErrKeyValueCacheStopped JetStreamError = &jsError{message: "key value cache stopped"}
+
 	// ErrObjectConfigRequired is returned when attempting to create an object
 	// without a config.
 	ErrObjectConfigRequired JetStreamError = &jsError{message: "object-store config required"}
@@ -409,6 +480,39 @@ func (e *APIError) Is(err error) bool {
 	return e.ErrorCode == aerr.ErrorCode
 }
 
+// Retryable returns true if the error is transient, e.g. caused by a
+// leader election or the JetStream cluster being temporarily unavailable.
+// API errors with code 503 are considered retryable.
+func (e *APIError) Retryable() bool {
+	if e == nil {
+		return false
+	}
+	switch e.ErrorCode {
+	case JSErrCodeClusterNotAvailable, JSErrCodeClusterNotLeader, JSErrCodeStreamOffline, JSErrCodeConsumerOffline:
+		return true
+	}
+	return e.Code == 503
+}
+
+// IsRetryableError returns true if a JetStream API request which failed
+// with err can be retried: if err is a retryable [APIError] (see
+// [APIError.Retryable]), a request timeout or no responders error.
+// Errors caused by an invalid request or missing resources (e.g.
+// [ErrStreamNotFound]) are terminal, and so are context errors.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoResponders) {
+		return true
+	}
+	var aerr *APIError
+	if errors.As(err, &aerr) {
+		return aerr.Retryable()
+	}
+	return false
+}
+
 func (err *jsError) APIError() *APIError {
 	return err.apiErr
 }
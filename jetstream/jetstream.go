@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"strings"
 	"time"
@@ -56,6 +57,11 @@ type (
 		// when making requests to JetStream.
 		Options() JetStreamOptions
 
+		// Advisories subscribes to JetStream advisories and metrics, returning
+		// an [AdvisoryWatcher] delivering typed events. Events can be
+		// filtered using [AdvisoryOpt] options.
+		Advisories(ctx context.Context, opts ...AdvisoryOpt) (AdvisoryWatcher, error)
+
 		StreamConsumerManager
 		StreamManager
 		Publisher
@@ -109,6 +115,12 @@ type (
 		// server.
 		PublishAsyncComplete() <-chan struct{}
 
+		// PublishAsyncStats returns statistics of async publishing, such as
+		// the current maximum number of outstanding async publishes (which
+		// changes over time when using [WithPublishAsyncAdaptive]) and
+		// PubAck latency.
+		PublishAsyncStats() PublishAsyncStats
+
 		// CleanupPublisher will cleanup the publishing side of JetStreamContext.
 		//
 		// This will unsubscribe from the internal reply subject if needed.
@@ -162,6 +174,19 @@ type (
 		// StreamNames returns a  StreamNameLister, enabling iterating over a
 		// channel of stream names.
 		StreamNames(context.Context, ...StreamListOpt) StreamNameLister
+
+		// RestoreStream creates a stream with given name from a snapshot
+		// read from r (see [Stream.Snapshot]). Unless WithRestoreConfig
+		// option is used, the stream configuration is read from the
+		// snapshot. If stream with given name already exists,
+		// ErrStreamNameAlreadyInUse is returned.
+		//
+		// If the server does not confirm a chunk in time, ErrRestoreTimeout
+		// is returned and the partial restore is discarded by the server,
+		// so RestoreStream can be safely retried. Restoring large snapshots
+		// may take longer than the request timeout, in which case
+		// RestoreStream waits for the stream to become available.
+		RestoreStream(ctx context.Context, stream string, r io.Reader, opts ...RestoreOpt) (Stream, error)
 	}
 
 	// StreamConsumerManager provides CRUD API for managing consumers. It is
@@ -204,6 +229,30 @@ type (
 		// DeleteConsumer removes a consumer with given name from a stream.
 		// If consumer does not exist, ErrConsumerNotFound is returned.
 		DeleteConsumer(ctx context.Context, stream string, consumer string) error
+
+		// CreateOrUpdatePushConsumer creates a push consumer on a given stream
+		// with given config. If consumer already exists, it will be updated
+		// (if possible). DeliverSubject has to be set in the config.
+		// PushConsumer interface is returned, allowing to consume messages.
+		CreateOrUpdatePushConsumer(ctx context.Context, stream string, cfg ConsumerConfig) (PushConsumer, error)
+
+		// CreatePushConsumer creates a push consumer on a given stream with
+		// given config. If consumer already exists and the provided
+		// configuration differs from its configuration, ErrConsumerExists is
+		// returned. DeliverSubject has to be set in the config. PushConsumer
+		// interface is returned, allowing to consume messages.
+		CreatePushConsumer(ctx context.Context, stream string, cfg ConsumerConfig) (PushConsumer, error)
+
+		// UpdatePushConsumer updates an existing push consumer. If consumer
+		// does not exist, ErrConsumerDoesNotExist is returned. PushConsumer
+		// interface is returned, allowing to consume messages.
+		UpdatePushConsumer(ctx context.Context, stream string, cfg ConsumerConfig) (PushConsumer, error)
+
+		// PushConsumer returns an interface to an existing push consumer,
+		// allowing processing of messages. If consumer does not exist,
+		// ErrConsumerNotFound is returned. If the consumer is not a push
+		// consumer, ErrNotPushConsumer is returned.
+		PushConsumer(ctx context.Context, stream string, consumer string) (PushConsumer, error)
 	}
 
 	// StreamListOpt is a functional option for [StreamManager.ListStreams] and
@@ -306,6 +355,7 @@ type (
 		replyPrefix    string
 		replyPrefixLen int
 		clientTrace    *ClientTrace
+		apiRetry       *APIRetryPolicy
 	}
 
 	// ClientTrace can be used to trace API interactions for [JetStream].
@@ -395,6 +445,12 @@ var subjectRegexp = regexp.MustCompile(`^[^ >]*[>]?$`)
 //   - [WithPublishAsyncErrHandler] - sets error handler for async message publish.
 //   - [WithPublishAsyncMaxPending] - sets the maximum outstanding async publishes
 //     that can be inflight at one time.
+//   - [WithPublishAsyncTimeout] - sets the maximum time to wait for an ack
+//     of an async publish.
+//   - [WithPublishAsyncAdaptive] - enables adaptive flow control of async
+//     publishing.
+//   - [WithAPIRetry] - enables retrying of idempotent API requests failed
+//     with retryable errors.
 func New(nc *nats.Conn, opts ...JetStreamOpt) (JetStream, error) {
 	jsOpts := JetStreamOptions{
 		apiPrefix: DefaultAPIPrefix,
@@ -440,6 +496,12 @@ func setReplyPrefix(nc *nats.Conn, jsOpts *JetStreamOptions) {
 //   - [WithPublishAsyncErrHandler] - sets error handler for async message publish.
 //   - [WithPublishAsyncMaxPending] - sets the maximum outstanding async publishes
 //     that can be inflight at one time.
+//   - [WithPublishAsyncTimeout] - sets the maximum time to wait for an ack
+//     of an async publish.
+//   - [WithPublishAsyncAdaptive] - enables adaptive flow control of async
+//     publishing.
+//   - [WithAPIRetry] - enables retrying of idempotent API requests failed
+//     with retryable errors.
 func NewWithAPIPrefix(nc *nats.Conn, apiPrefix string, opts ...JetStreamOpt) (JetStream, error) {
 	jsOpts := JetStreamOptions{
 		publisherOpts: asyncPublisherOpts{
@@ -477,6 +539,12 @@ func NewWithAPIPrefix(nc *nats.Conn, apiPrefix string, opts ...JetStreamOpt) (Je
 //   - [WithPublishAsyncErrHandler] - sets error handler for async message publish.
 //   - [WithPublishAsyncMaxPending] - sets the maximum outstanding async publishes
 //     that can be inflight at one time.
+//   - [WithPublishAsyncTimeout] - sets the maximum time to wait for an ack
+//     of an async publish.
+//   - [WithPublishAsyncAdaptive] - enables adaptive flow control of async
+//     publishing.
+//   - [WithAPIRetry] - enables retrying of idempotent API requests failed
+//     with retryable errors.
 func NewWithDomain(nc *nats.Conn, domain string, opts ...JetStreamOpt) (JetStream, error) {
 	jsOpts := JetStreamOptions{
 		publisherOpts: asyncPublisherOpts{
@@ -553,7 +621,7 @@ func (js *jetStream) CreateStream(ctx context.Context, cfg StreamConfig) (Stream
 	createSubject := fmt.Sprintf(apiStreamCreateT, cfg.Name)
 	var resp streamInfoResponse
 
-	if _, err = js.apiRequestJSON(ctx, createSubject, &resp, req); err != nil {
+	if _, err = js.idempotentAPIRequestJSON(ctx, createSubject, &resp, req); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
@@ -633,7 +701,7 @@ func (js *jetStream) UpdateStream(ctx context.Context, cfg StreamConfig) (Stream
 	updateSubject := fmt.Sprintf(apiStreamUpdateT, cfg.Name)
 	var resp streamInfoResponse
 
-	if _, err = js.apiRequestJSON(ctx, updateSubject, &resp, req); err != nil {
+	if _, err = js.idempotentAPIRequestJSON(ctx, updateSubject, &resp, req); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
@@ -694,7 +762,7 @@ func (js *jetStream) Stream(ctx context.Context, name string) (Stream, error) {
 
 	var resp streamInfoResponse
 
-	if _, err := js.apiRequestJSON(ctx, infoSubject, &resp); err != nil {
+	if _, err := js.idempotentAPIRequestJSON(ctx, infoSubject, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
@@ -812,6 +880,49 @@ func (js *jetStream) DeleteConsumer(ctx context.Context, stream string, name str
 	return deleteConsumer(ctx, js, stream, name)
 }
 
+// CreateOrUpdatePushConsumer creates a push consumer on a given stream
+// with given config. If consumer already exists, it will be updated
+// (if possible). PushConsumer interface is returned, allowing to consume
+// messages.
+func (js *jetStream) CreateOrUpdatePushConsumer(ctx context.Context, stream string, cfg ConsumerConfig) (PushConsumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	return upsertPushConsumer(ctx, js, stream, cfg, consumerActionCreateOrUpdate)
+}
+
+// CreatePushConsumer creates a push consumer on a given stream with
+// given config. If consumer already exists and the provided
+// configuration differs from its configuration, ErrConsumerExists is
+// returned. PushConsumer interface is returned, allowing to consume
+// messages.
+func (js *jetStream) CreatePushConsumer(ctx context.Context, stream string, cfg ConsumerConfig) (PushConsumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	return upsertPushConsumer(ctx, js, stream, cfg, consumerActionCreate)
+}
+
+// UpdatePushConsumer updates an existing push consumer. If consumer
+// does not exist, ErrConsumerDoesNotExist is returned. PushConsumer
+// interface is returned, allowing to consume messages.
+func (js *jetStream) UpdatePushConsumer(ctx context.Context, stream string, cfg ConsumerConfig) (PushConsumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	return upsertPushConsumer(ctx, js, stream, cfg, consumerActionUpdate)
+}
+
+// PushConsumer returns an interface to an existing push consumer,
+// allowing processing of messages. If consumer does not exist,
+// ErrConsumerNotFound is returned.
+func (js *jetStream) PushConsumer(ctx context.Context, stream string, name string) (PushConsumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	return getPushConsumer(ctx, js, stream, name)
+}
+
 func validateStreamName(stream string) error {
 	if stream == "" {
 		return ErrStreamNameRequired
@@ -846,7 +957,7 @@ func (js *jetStream) AccountInfo(ctx context.Context) (*AccountInfo, error) {
 	}
 	var resp accountInfoResponse
 
-	if _, err := js.apiRequestJSON(ctx, apiAccountInfo, &resp); err != nil {
+	if _, err := js.idempotentAPIRequestJSON(ctx, apiAccountInfo, &resp); err != nil {
 		if errors.Is(err, nats.ErrNoResponders) {
 			return nil, ErrJetStreamNotEnabled
 		}
@@ -981,7 +1092,7 @@ func (js *jetStream) StreamNameBySubject(ctx context.Context, subject string) (s
 		return "", err
 	}
 	var resp streamNamesResponse
-	_, err = js.apiRequestJSON(ctx, apiStreams, &resp, req)
+	_, err = js.idempotentAPIRequestJSON(ctx, apiStreams, &resp, req)
 	if err != nil {
 		return "", err
 	}
@@ -1018,7 +1129,7 @@ func (s *streamLister) streamInfos(ctx context.Context, streamsReq streamsReques
 	}
 
 	var resp streamListResponse
-	_, err = s.js.apiRequestJSON(ctx, apiStreamListT, &resp, reqJSON)
+	_, err = s.js.idempotentAPIRequestJSON(ctx, apiStreamListT, &resp, reqJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -1049,7 +1160,7 @@ func (s *streamLister) streamNames(ctx context.Context, streamsReq streamsReques
 	}
 
 	var resp streamNamesResponse
-	_, err = s.js.apiRequestJSON(ctx, apiStreams, &resp, reqJSON)
+	_, err = s.js.idempotentAPIRequestJSON(ctx, apiStreams, &resp, reqJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -1092,10 +1203,14 @@ func (js *jetStream) CleanupPublisher() {
 		if paf.errCh != nil {
 			paf.errCh <- paf.err
 		}
+		paf.stopTimeout()
 		if errCb != nil {
 			// call error handler after releasing the mutex to avoid contention
 			defer errCb(js, paf.msg, ErrJetStreamPublisherClosed)
 		}
+		if paf.ackHandler != nil {
+			defer paf.ackHandler(nil, ErrJetStreamPublisherClosed)
+		}
 		delete(js.publisher.acks, id)
 	}
 	if js.publisher.doneCh != nil {
@@ -56,6 +56,82 @@ func WithPublishAsyncMaxPending(max int) JetStreamOpt {
 	}
 }
 
+// WithPublishAsyncTimeout sets the maximum time to wait for an ack of an
+// async publish. If the ack is not received in time, the [PubAckFuture] is
+// failed with [ErrAsyncPublishTimeout]. The timeout starts once the message
+// is published, so time spent stalled (see [WithStallWait]) is not
+// included. By default, there is no timeout.
+func WithPublishAsyncTimeout(dur time.Duration) JetStreamOpt {
+	return func(opts *JetStreamOptions) error {
+		if dur <= 0 {
+			return fmt.Errorf("%w: async publish timeout should be greater than 0", ErrInvalidOption)
+		}
+		opts.publisherOpts.timeout = dur
+		return nil
+	}
+}
+
+// WithPublishAsyncAdaptive enables adaptive flow control of async
+// publishing. Instead of using a fixed limit of outstanding async publishes
+// (see [WithPublishAsyncMaxPending]), the limit is adjusted based on
+// PubAck latency and errors (see [PublishAsyncAdaptiveConfig]). The current
+// limit is available using [Publisher.PublishAsyncStats].
+func WithPublishAsyncAdaptive(cfg PublishAsyncAdaptiveConfig) JetStreamOpt {
+	return func(opts *JetStreamOptions) error {
+		if cfg.MinPending < 0 || cfg.MaxPending < 0 || cfg.InitialPending < 0 {
+			return fmt.Errorf("%w: adaptive pending limits cannot be negative", ErrInvalidOption)
+		}
+		if cfg.TargetLatency < 0 {
+			return fmt.Errorf("%w: adaptive target latency cannot be negative", ErrInvalidOption)
+		}
+		if cfg.MaxPending > 0 && cfg.MinPending > cfg.MaxPending {
+			return fmt.Errorf("%w: adaptive min pending cannot be greater than max pending", ErrInvalidOption)
+		}
+		if cfg.InitialPending > 0 && (cfg.InitialPending < cfg.MinPending || cfg.MaxPending > 0 && cfg.InitialPending > cfg.MaxPending) {
+			return fmt.Errorf("%w: adaptive initial pending should be between min and max pending", ErrInvalidOption)
+		}
+		opts.publisherOpts.adaptive = &cfg
+		return nil
+	}
+}
+
+// WithAPIRetry enables retrying of idempotent JetStream API requests which
+// failed with a retryable error, e.g. during leader elections (see
+// [APIRetryPolicy] and [IsRetryableError]). Unset fields of the policy are
+// set to their defaults. Requests which are not idempotent (e.g. deleting
+// streams or purging messages) are never retried.
+func WithAPIRetry(policy APIRetryPolicy) JetStreamOpt {
+	return func(opts *JetStreamOptions) error {
+		if policy.MaxAttempts < 0 || policy.InitialBackoff < 0 || policy.MaxBackoff < 0 || policy.AttemptTimeout < 0 {
+			return fmt.Errorf("%w: api retry policy values cannot be negative", ErrInvalidOption)
+		}
+		if policy.Jitter > 1 {
+			return fmt.Errorf("%w: api retry jitter cannot be greater than 1", ErrInvalidOption)
+		}
+		if policy.MaxAttempts == 0 {
+			policy.MaxAttempts = defaultAPIRetryMaxAttempts
+		}
+		if policy.InitialBackoff == 0 {
+			policy.InitialBackoff = defaultAPIRetryInitialBackoff
+		}
+		if policy.MaxBackoff == 0 {
+			policy.MaxBackoff = max(defaultAPIRetryMaxBackoff, policy.InitialBackoff)
+		}
+		switch {
+		case policy.Jitter == 0:
+			policy.Jitter = defaultAPIRetryJitter
+		case policy.Jitter < 0:
+			// negative jitter disables it
+			policy.Jitter = 0
+		}
+		if policy.InitialBackoff > policy.MaxBackoff {
+			return fmt.Errorf("%w: api retry initial backoff cannot be greater than max backoff", ErrInvalidOption)
+		}
+		opts.apiRetry = &policy
+		return nil
+	}
+}
+
 // WithPurgeSubject sets a specific subject for which messages on a stream will
 // be purged
 func WithPurgeSubject(subject string) StreamPurgeOpt {
@@ -101,6 +177,129 @@ func WithGetMsgSubject(subject string) GetMsgOpt {
 	}
 }
 
+// WithSnapshotConsumers sets whether consumers should be included in the
+// stream snapshot. By default, consumers are included.
+func WithSnapshotConsumers(include bool) SnapshotOpt {
+	return func(opts *snapshotOpts) error {
+		opts.req.NoConsumers = !include
+		return nil
+	}
+}
+
+// WithSnapshotChunkSize sets the size of a single chunk sent by the server.
+// Chunk size has to be between 1KB and 1MB.
+func WithSnapshotChunkSize(size int) SnapshotOpt {
+	return func(opts *snapshotOpts) error {
+		if size < minSnapshotChunkSize || size > maxSnapshotChunkSize {
+			return fmt.Errorf("%w: chunk size has to be between %d and %d bytes", ErrInvalidOption, minSnapshotChunkSize, maxSnapshotChunkSize)
+		}
+		opts.req.ChunkSize = size
+		return nil
+	}
+}
+
+// WithSnapshotHealthCheck instructs the server to check the stream data for
+// consistency before creating the snapshot.
+func WithSnapshotHealthCheck() SnapshotOpt {
+	return func(opts *snapshotOpts) error {
+		opts.req.CheckMsgs = true
+		return nil
+	}
+}
+
+// WithSnapshotProgress sets a callback invoked after each snapshot chunk is
+// written.
+func WithSnapshotProgress(cb func(SnapshotProgress)) SnapshotOpt {
+	return func(opts *snapshotOpts) error {
+		opts.progress = cb
+		return nil
+	}
+}
+
+// WithRestoreConfig sets the configuration of the restored stream. By
+// default, the configuration stored in the snapshot is used. The stream name
+// is always set to the name passed to RestoreStream.
+func WithRestoreConfig(cfg StreamConfig) RestoreOpt {
+	return func(opts *restoreOpts) error {
+		opts.config = &cfg
+		return nil
+	}
+}
+
+// WithRestoreChunkSize sets the size of a single chunk sent to the server.
+// Chunk size has to be between 1KB and 1MB, 128KB is used by default.
+func WithRestoreChunkSize(size int) RestoreOpt {
+	return func(opts *restoreOpts) error {
+		if size < minSnapshotChunkSize || size > maxSnapshotChunkSize {
+			return fmt.Errorf("%w: chunk size has to be between %d and %d bytes", ErrInvalidOption, minSnapshotChunkSize, maxSnapshotChunkSize)
+		}
+		opts.chunkSize = size
+		return nil
+	}
+}
+
+// WithRestoreProgress sets a callback invoked after each chunk is confirmed
+// by the server.
+func WithRestoreProgress(cb func(SnapshotProgress)) RestoreOpt {
+	return func(opts *restoreOpts) error {
+		opts.progress = cb
+		return nil
+	}
+}
+
+// WithBrowseStartSeq sets the sequence from which stream messages are
+// returned. When browsing backward, it is the highest sequence returned.
+// By default, browsing starts at the first (or last, if browsing backward)
+// message in the stream.
+func WithBrowseStartSeq(seq uint64) StreamBrowseOpt {
+	return func(opts *streamBrowseOpts) error {
+		opts.startSeq = seq
+		return nil
+	}
+}
+
+// WithBrowseEndSeq sets the sequence (inclusive) at which browsing stream
+// messages stops. When browsing backward, it is the lowest sequence
+// returned.
+func WithBrowseEndSeq(seq uint64) StreamBrowseOpt {
+	return func(opts *streamBrowseOpts) error {
+		opts.endSeq = seq
+		return nil
+	}
+}
+
+// WithBrowseSubject limits browsed stream messages to the ones stored on
+// subjects matching the provided filter. Wildcards are supported.
+func WithBrowseSubject(subject string) StreamBrowseOpt {
+	return func(opts *streamBrowseOpts) error {
+		if err := validateSubject(subject); err != nil {
+			return err
+		}
+		opts.subject = subject
+		return nil
+	}
+}
+
+// WithBrowseMaxMsgs limits the number of returned stream messages.
+func WithBrowseMaxMsgs(max int) StreamBrowseOpt {
+	return func(opts *streamBrowseOpts) error {
+		if max <= 0 {
+			return fmt.Errorf("%w: max messages must be greater than 0", ErrInvalidOption)
+		}
+		opts.maxMsgs = max
+		return nil
+	}
+}
+
+// WithBrowseDirection sets the order in which stream messages are returned.
+// By default, messages are returned in ascending sequence order.
+func WithBrowseDirection(direction BrowseDirection) StreamBrowseOpt {
+	return func(opts *streamBrowseOpts) error {
+		opts.direction = direction
+		return nil
+	}
+}
+
 // PullMaxMessages limits the number of messages to be buffered in the client.
 // If not provided, a default of 500 messages will be used.
 // This option is exclusive with PullMaxBytes.
@@ -306,8 +505,9 @@ func (hb PullHeartbeat) configureMessages(opts *consumeOpts) error {
 // StopAfter sets the number of messages after which the consumer is
 // automatically stopped and no more messages are pulled from the server.
 //
-// StopAfter implements both PullConsumeOpt and PullMessagesOpt, allowing
-// it to configure Consumer.Consume and Consumer.Messages.
+// StopAfter implements PullConsumeOpt, PullMessagesOpt and PushConsumeOpt,
+// allowing it to configure Consumer.Consume, Consumer.Messages and
+// PushConsumer.Consume.
 type StopAfter int
 
 func (nMsgs StopAfter) configureConsume(opts *consumeOpts) error {
@@ -326,15 +526,208 @@ func (nMsgs StopAfter) configureMessages(opts *consumeOpts) error {
 	return nil
 }
 
+func (nMsgs StopAfter) configurePushConsume(opts *pushConsumeOpts) error {
+	if nMsgs <= 0 {
+		return fmt.Errorf("%w: auto stop after value cannot be less than 1", ErrInvalidOption)
+	}
+	opts.StopAfter = int(nMsgs)
+	return nil
+}
+
+type consumeErrHandler ConsumeErrHandlerFunc
+
 // ConsumeErrHandler sets custom error handler invoked when an error was
 // encountered while consuming messages It will be invoked for both terminal
 // (Consumer Deleted, invalid request body) and non-terminal (e.g. missing
-// heartbeats) errors.
+// heartbeats) errors. Use [PushConsumeErrHandler] for [PushConsumer.Consume].
 func ConsumeErrHandler(cb ConsumeErrHandlerFunc) PullConsumeOpt {
-	return pullOptFunc(func(cfg *consumeOpts) error {
-		cfg.ErrHandler = cb
-		return nil
-	})
+	return consumeErrHandler(cb)
+}
+
+// PushConsumeErrHandler sets custom error handler invoked when an error was
+// encountered while consuming messages from a push consumer, same as
+// [ConsumeErrHandler] for pull consumers.
+func PushConsumeErrHandler(cb ConsumeErrHandlerFunc) PushConsumeOpt {
+	return consumeErrHandler(cb)
+}
+
+func (cb consumeErrHandler) configureConsume(opts *consumeOpts) error {
+	opts.ErrHandler = ConsumeErrHandlerFunc(cb)
+	return nil
+}
+
+func (cb consumeErrHandler) configurePushConsume(opts *pushConsumeOpts) error {
+	opts.ErrHandler = ConsumeErrHandlerFunc(cb)
+	return nil
+}
+
+// WithConsumeWorkers sets the number of goroutines used to handle messages
+// in Consume. By default, the handler is called sequentially on a single
+// goroutine.
+//
+// Messages are distributed between workers based on the key returned by
+// keyFunc (by default, the message subject). Messages with the same key
+// are handled by the same worker, in the order they were received. New
+// messages are requested only once messages are handled, so in-flight
+// messages count towards [PullMaxMessages], [PullMaxBytes] and
+// [PullThresholdMessages].
+//
+// Workers cannot be used with ordered consumers.
+func WithConsumeWorkers(n int, keyFunc MsgKeyFunc) PullConsumeOpt {
+	return consumeWorkers{n: n, keyFunc: keyFunc}
+}
+
+type consumeWorkers struct {
+	n       int
+	keyFunc MsgKeyFunc
+}
+
+func (w consumeWorkers) configureConsume(opts *consumeOpts) error {
+	if w.n < 1 {
+		return fmt.Errorf("%w: number of workers should be at least 1", ErrInvalidOption)
+	}
+	opts.Workers = w.n
+	opts.WorkerKey = w.keyFunc
+	return nil
+}
+
+// WithConsumeMiddleware wraps the handler passed to Consume with the
+// provided middleware (see [ChainMiddleware]). When used multiple times,
+// only the last set of middleware is applied.
+//
+// With Messages, the middleware is applied to each message returned by
+// [MessagesContext.Next], until Next is called again (see
+// [ChainMessagesMiddleware]).
+//
+// WithConsumeMiddleware implements PullConsumeOpt, PullMessagesOpt and
+// PushConsumeOpt.
+func WithConsumeMiddleware(middleware ...Middleware) consumeMiddleware {
+	return consumeMiddleware(middleware)
+}
+
+type consumeMiddleware []Middleware
+
+func (m consumeMiddleware) configureConsume(opts *consumeOpts) error {
+	opts.Middleware = m
+	return nil
+}
+
+func (m consumeMiddleware) configureMessages(opts *consumeOpts) error {
+	opts.Middleware = m
+	return nil
+}
+
+func (m consumeMiddleware) configurePushConsume(opts *pushConsumeOpts) error {
+	opts.Middleware = m
+	return nil
+}
+
+// WithAutoInProgress periodically sends [Msg.InProgress] for messages
+// being handled in Consume, until the message is acknowledged or the
+// handler returns. This prevents redelivery of messages which take longer
+// than AckWait to process (see [InProgressMiddleware]).
+//
+// If interval is 0, half of the AckWait of the consumer (read from
+// [Consumer.CachedInfo]) is used. Otherwise, the interval has to be lower
+// than AckWait. Use [WithAutoInProgressMaxExtension] to limit the total
+// time for which a message can be extended.
+//
+// WithAutoInProgress implements both PullConsumeOpt and PushConsumeOpt and
+// cannot be used with ordered consumers.
+func WithAutoInProgress(interval time.Duration) autoInProgress {
+	return autoInProgress(interval)
+}
+
+type autoInProgress time.Duration
+
+func (interval autoInProgress) configureConsume(opts *consumeOpts) error {
+	if interval < 0 {
+		return fmt.Errorf("%w: auto in progress interval cannot be negative", ErrInvalidOption)
+	}
+	opts.AutoInProgress = true
+	opts.AutoInProgressInterval = time.Duration(interval)
+	return nil
+}
+
+func (interval autoInProgress) configurePushConsume(opts *pushConsumeOpts) error {
+	if interval < 0 {
+		return fmt.Errorf("%w: auto in progress interval cannot be negative", ErrInvalidOption)
+	}
+	opts.AutoInProgress = true
+	opts.AutoInProgressInterval = time.Duration(interval)
+	return nil
+}
+
+// WithAutoInProgressMaxExtension limits the time for which
+// [WithAutoInProgress] keeps extending a message. Once exceeded, the
+// message is redelivered after AckWait, unless acknowledged. By default,
+// messages are extended until the handler returns.
+//
+// WithAutoInProgressMaxExtension implements both PullConsumeOpt and
+// PushConsumeOpt.
+func WithAutoInProgressMaxExtension(max time.Duration) autoInProgressMax {
+	return autoInProgressMax(max)
+}
+
+type autoInProgressMax time.Duration
+
+func (max autoInProgressMax) configureConsume(opts *consumeOpts) error {
+	if max <= 0 {
+		return fmt.Errorf("%w: auto in progress max extension should be greater than 0", ErrInvalidOption)
+	}
+	opts.AutoInProgressMax = time.Duration(max)
+	return nil
+}
+
+func (max autoInProgressMax) configurePushConsume(opts *pushConsumeOpts) error {
+	if max <= 0 {
+		return fmt.Errorf("%w: auto in progress max extension should be greater than 0", ErrInvalidOption)
+	}
+	opts.AutoInProgressMax = time.Duration(max)
+	return nil
+}
+
+// WithAckPipeline configures the [AckPipeline] returned by
+// [ConsumeContext.Acks]. If not set, the pipeline uses default
+// [AckPipelineConfig] values.
+//
+// WithAckPipeline implements both PullConsumeOpt and PushConsumeOpt and
+// cannot be used with ordered consumers.
+func WithAckPipeline(cfg AckPipelineConfig) ackPipelineOpt {
+	return ackPipelineOpt(cfg)
+}
+
+type ackPipelineOpt AckPipelineConfig
+
+func (cfg ackPipelineOpt) validate() error {
+	if cfg.MaxPending < 0 {
+		return fmt.Errorf("%w: ack pipeline max pending cannot be negative", ErrInvalidOption)
+	}
+	if cfg.FlushInterval < 0 || cfg.AckTimeout < 0 {
+		return fmt.Errorf("%w: ack pipeline intervals cannot be negative", ErrInvalidOption)
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("%w: ack pipeline max retries cannot be negative", ErrInvalidOption)
+	}
+	return nil
+}
+
+func (cfg ackPipelineOpt) configureConsume(opts *consumeOpts) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	ackCfg := AckPipelineConfig(cfg)
+	opts.AckPipeline = &ackCfg
+	return nil
+}
+
+func (cfg ackPipelineOpt) configurePushConsume(opts *pushConsumeOpts) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	ackCfg := AckPipelineConfig(cfg)
+	opts.AckPipeline = &ackCfg
+	return nil
 }
 
 // WithMessagesErrOnMissingHeartbeat sets whether a missing heartbeat error
@@ -346,6 +739,36 @@ func WithMessagesErrOnMissingHeartbeat(hbErr bool) PullMessagesOpt {
 	})
 }
 
+// WithDeadLetter forwards messages which reached the MaxDeliver limit of the
+// consumer or were terminated using [Msg.TermWithReason] to the provided
+// subject. The forwarder is started along with Consume or Messages and
+// stopped once consuming is stopped or drained.
+//
+// Forwarding errors are wrapped with [ErrDeadLetterForward] and passed to
+// [ConsumeErrHandler] when using Consume. They are not reported when using
+// Messages.
+//
+// See [NewDeadLetterForwarder] for details on how messages are forwarded.
+//
+// WithDeadLetter implements both PullConsumeOpt and PullMessagesOpt.
+func WithDeadLetter(subject string) deadLetter {
+	return deadLetter(subject)
+}
+
+type deadLetter string
+
+func (subject deadLetter) configureConsume(opts *consumeOpts) error {
+	if err := validateSubject(string(subject)); err != nil {
+		return fmt.Errorf("%w: invalid dead letter subject: %s", ErrInvalidOption, err)
+	}
+	opts.DeadLetterSubject = string(subject)
+	return nil
+}
+
+func (subject deadLetter) configureMessages(opts *consumeOpts) error {
+	return subject.configureConsume(opts)
+}
+
 // FetchMaxWait sets custom timeout for fetching predefined batch of messages.
 //
 // If not provided, a default of 30 seconds will be used.
@@ -493,3 +916,30 @@ func WithStallWait(ttl time.Duration) PublishOpt {
 		return nil
 	}
 }
+
+// WithAckHandler sets a handler called with the result of an async publish,
+// once the ack is received or the publish fails. It can be used instead of
+// waiting on [PubAckFuture.Ok] and [PubAckFuture.Err]. The handler is called
+// from the goroutine processing acks, so it should not block.
+//
+// WithAckHandler cannot be used with synchronous publish.
+func WithAckHandler(handler PubAckHandler) PublishOpt {
+	return func(opts *pubOpts) error {
+		opts.ackHandler = handler
+		return nil
+	}
+}
+
+// WithDecodeErrHandler sets a handler for messages which could not be
+// decoded by a [TypedConsumer]. By default, such messages are terminated
+// using [Msg.TermWithReason]. The handler is responsible for acknowledging
+// the message.
+func WithDecodeErrHandler(handler DecodeErrHandler) TypedConsumerOpt {
+	return func(opts *typedConsumerOpts) error {
+		if handler == nil {
+			return fmt.Errorf("%w: decode error handler cannot be nil", ErrInvalidOption)
+		}
+		opts.errHandler = handler
+		return nil
+	}
+}
@@ -14,8 +14,12 @@
 package jetstream
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -548,3 +552,990 @@ func TestKV_bucketValid(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamConfigDiff(t *testing.T) {
+	// config as returned by the server, with defaults filled in
+	current := StreamConfig{
+		Name:              "foo",
+		Subjects:          []string{"foo"},
+		MaxConsumers:      -1,
+		MaxMsgs:           -1,
+		MaxBytes:          -1,
+		MaxMsgSize:        -1,
+		MaxMsgsPerSubject: -1,
+		Replicas:          1,
+		Duplicates:        2 * time.Minute,
+		Metadata:          map[string]string{"_nats.req.level": "0"},
+	}
+
+	tests := []struct {
+		name     string
+		desired  StreamConfig
+		expected map[string]Mutability
+	}{
+		{
+			name:     "no changes with server defaults",
+			desired:  StreamConfig{Name: "foo"},
+			expected: map[string]Mutability{},
+		},
+		{
+			name:    "editable changes",
+			desired: StreamConfig{Name: "foo", Subjects: []string{"foo", "bar"}, MaxAge: time.Hour, Description: "desc"},
+			expected: map[string]Mutability{
+				"subjects":    MutabilityEditable,
+				"max_age":     MutabilityEditable,
+				"description": MutabilityEditable,
+			},
+		},
+		{
+			name:    "duplicates default follows max age",
+			desired: StreamConfig{Name: "foo", MaxAge: time.Minute},
+			expected: map[string]Mutability{
+				"max_age":          MutabilityEditable,
+				"duplicate_window": MutabilityEditable,
+			},
+		},
+		{
+			name:    "requires recreate",
+			desired: StreamConfig{Name: "foo", Storage: MemoryStorage, Retention: WorkQueuePolicy},
+			expected: map[string]Mutability{
+				"storage":   MutabilityRecreate,
+				"retention": MutabilityRecreate,
+			},
+		},
+		{
+			name:    "immutable",
+			desired: StreamConfig{Name: "bar", Subjects: []string{"foo"}},
+			expected: map[string]Mutability{
+				"name": MutabilityImmutable,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := current.Diff(test.desired)
+			if len(changes) != len(test.expected) {
+				t.Fatalf("Invalid number of changes; want: %d; got: %d (%v)", len(test.expected), len(changes), changes)
+			}
+			for _, change := range changes {
+				mutability, ok := test.expected[change.Field]
+				if !ok {
+					t.Fatalf("Unexpected change: %s", change)
+				}
+				if change.Mutability != mutability {
+					t.Fatalf("Invalid mutability for %q; want: %s; got: %s", change.Field, mutability, change.Mutability)
+				}
+			}
+		})
+	}
+
+	t.Run("one way fields", func(t *testing.T) {
+		enabled := current
+		enabled.Sealed = true
+		enabled.DenyDelete = true
+		enabled.DenyPurge = true
+		enabled.AllowMsgTTL = true
+		fields := []string{"sealed", "deny_delete", "deny_purge", "allow_msg_ttl"}
+
+		check := func(changes []ConfigChange, mutability Mutability) {
+			t.Helper()
+			if len(changes) != len(fields) {
+				t.Fatalf("Invalid number of changes; want: %d; got: %d (%v)", len(fields), len(changes), changes)
+			}
+			for i, change := range changes {
+				if change.Field != fields[i] || change.Mutability != mutability {
+					t.Fatalf("Invalid change; want: %s (%s); got: %s", fields[i], mutability, change)
+				}
+			}
+		}
+		// enabling is an update, disabling requires recreating the stream
+		check(current.Diff(enabled), MutabilityEditable)
+		check(enabled.Diff(current), MutabilityRecreate)
+	})
+}
+
+func TestConsumerConfigDiff(t *testing.T) {
+	// config as returned by the server, with defaults filled in
+	current := ConsumerConfig{
+		Name:          "cons",
+		Durable:       "cons",
+		AckWait:       30 * time.Second,
+		MaxDeliver:    -1,
+		MaxAckPending: 1000,
+		MaxWaiting:    512,
+		Replicas:      1,
+	}
+
+	tests := []struct {
+		name     string
+		desired  ConsumerConfig
+		expected map[string]Mutability
+	}{
+		{
+			name:     "no changes with server defaults",
+			desired:  ConsumerConfig{Durable: "cons"},
+			expected: map[string]Mutability{},
+		},
+		{
+			name:    "editable changes",
+			desired: ConsumerConfig{Durable: "cons", MaxDeliver: 5, FilterSubject: "foo"},
+			expected: map[string]Mutability{
+				"max_deliver":    MutabilityEditable,
+				"filter_subject": MutabilityEditable,
+			},
+		},
+		{
+			name:    "ack wait follows backoff",
+			desired: ConsumerConfig{Durable: "cons", BackOff: []time.Duration{time.Second, 5 * time.Second}},
+			expected: map[string]Mutability{
+				"backoff":  MutabilityEditable,
+				"ack_wait": MutabilityEditable,
+			},
+		},
+		{
+			name:    "requires recreate",
+			desired: ConsumerConfig{Durable: "cons", DeliverPolicy: DeliverNewPolicy, AckPolicy: AckAllPolicy},
+			expected: map[string]Mutability{
+				"deliver_policy": MutabilityRecreate,
+				"ack_policy":     MutabilityRecreate,
+			},
+		},
+		{
+			name:    "convert to push consumer",
+			desired: ConsumerConfig{Durable: "cons", DeliverSubject: "deliver", MaxWaiting: 512},
+			expected: map[string]Mutability{
+				"deliver_subject": MutabilityRecreate,
+			},
+		},
+		{
+			name:    "immutable",
+			desired: ConsumerConfig{Durable: "other"},
+			expected: map[string]Mutability{
+				"name":         MutabilityImmutable,
+				"durable_name": MutabilityImmutable,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := current.Diff(test.desired)
+			if len(changes) != len(test.expected) {
+				t.Fatalf("Invalid number of changes; want: %d; got: %d (%v)", len(test.expected), len(changes), changes)
+			}
+			for _, change := range changes {
+				mutability, ok := test.expected[change.Field]
+				if !ok {
+					t.Fatalf("Unexpected change: %s", change)
+				}
+				if change.Mutability != mutability {
+					t.Fatalf("Invalid mutability for %q; want: %s; got: %s", change.Field, mutability, change.Mutability)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		delivered uint64
+		expected  time.Duration
+	}{
+		{name: "first delivery", delivered: 1, expected: 100 * time.Millisecond},
+		{name: "second delivery", delivered: 2, expected: 200 * time.Millisecond},
+		{name: "fourth delivery", delivered: 4, expected: 800 * time.Millisecond},
+		{name: "capped at max", delivered: 10, expected: time.Second},
+		{name: "many deliveries", delivered: 1000, expected: time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delay := backoffDelay(100*time.Millisecond, time.Second, test.delivered)
+			if delay != test.expected {
+				t.Fatalf("Invalid delay; want: %s; got: %s", test.expected, delay)
+			}
+		})
+	}
+}
+
+func TestChainMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(msg Msg) {
+				calls = append(calls, name+" before")
+				next(msg)
+				calls = append(calls, name+" after")
+			}
+		}
+	}
+	handler := ChainMiddleware(func(msg Msg) {
+		calls = append(calls, "handler")
+	}, record("first"), record("second"))
+	handler(nil)
+
+	expected := []string{"first before", "second before", "handler", "second after", "first after"}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("Invalid call order; want: %v; got: %v", expected, calls)
+	}
+}
+
+type stubMessages struct {
+	msgs    []Msg
+	stopped bool
+}
+
+func (s *stubMessages) Next() (Msg, error) {
+	if s.stopped || len(s.msgs) == 0 {
+		return nil, ErrMsgIteratorClosed
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func (s *stubMessages) Stop()               { s.stopped = true }
+func (s *stubMessages) Drain()              {}
+func (s *stubMessages) Stats() ConsumeStats { return ConsumeStats{} }
+
+func TestChainMessagesMiddleware(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []string
+	)
+	record := func(call string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, call)
+	}
+	newMsg := func(subject string) Msg {
+		return &jetStreamMsg{msg: nats.NewMsg(subject)}
+	}
+	// messages on subject SKIP are not passed to the handler
+	skip := func(next MessageHandler) MessageHandler {
+		return func(msg Msg) {
+			if msg.Subject() == "SKIP" {
+				record("skip")
+				return
+			}
+			record("before " + msg.Subject())
+			next(msg)
+			record("after " + msg.Subject())
+		}
+	}
+	stub := &stubMessages{msgs: []Msg{newMsg("A"), newMsg("SKIP"), newMsg("B"), newMsg("C")}}
+	msgs := ChainMessagesMiddleware(stub, skip, DeadlineMiddleware(time.Minute))
+
+	msg, err := msgs.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.Subject() != "A" {
+		t.Fatalf("Invalid message: %s", msg.Subject())
+	}
+	if _, ok := MsgContext(msg).Deadline(); !ok {
+		t.Fatalf("Expected deadline on message context")
+	}
+	msg, err = msgs.Next()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msg.Subject() != "B" {
+		t.Fatalf("Invalid message: %s", msg.Subject())
+	}
+	msgs.Stop()
+	if _, err := msgs.Next(); !errors.Is(err, ErrMsgIteratorClosed) {
+		t.Fatalf("Expected error: %v; got: %v", ErrMsgIteratorClosed, err)
+	}
+
+	expected := []string{"before A", "after A", "skip", "before B", "after B"}
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Fatalf("Invalid calls; want: %v; got: %v", expected, calls)
+	}
+}
+
+func TestAutoInProgressInterval(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		ackWait   time.Duration
+		expected  time.Duration
+		withError error
+	}{
+		{name: "default interval", ackWait: 10 * time.Second, expected: 5 * time.Second},
+		{name: "default ack wait", expected: 15 * time.Second},
+		{name: "custom interval", interval: time.Second, ackWait: 10 * time.Second, expected: time.Second},
+		{name: "interval equal to ack wait", interval: time.Second, ackWait: time.Second, withError: ErrInvalidOption},
+		{name: "interval greater than ack wait", interval: 2 * time.Second, ackWait: time.Second, withError: ErrInvalidOption},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			interval, err := autoInProgressInterval(test.interval, test.ackWait)
+			if test.withError != nil {
+				if !errors.Is(err, test.withError) {
+					t.Fatalf("Expected error: %v; got: %v", test.withError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if interval != test.expected {
+				t.Fatalf("Invalid interval; want: %s; got: %s", test.expected, interval)
+			}
+		})
+	}
+}
+
+func TestReadOutboxLog(t *testing.T) {
+	var buf bytes.Buffer
+	for _, id := range []string{"1", "2", "3"} {
+		payload, err := json.Marshal(&outboxEntry{ID: id, Subject: "FOO", Data: []byte("msg " + id)})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		buf.Write(encodeOutboxRecord(outboxOpPublish, payload))
+	}
+	buf.Write(encodeOutboxRecord(outboxOpAck, []byte("2")))
+	validSize := int64(buf.Len())
+	// partially written record
+	buf.Write(encodeOutboxRecord(outboxOpAck, []byte("3"))[:5])
+
+	entries, acked, size, err := readOutboxLog(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if size != validSize {
+		t.Fatalf("Invalid log size; want: %d; got: %d", validSize, size)
+	}
+	if acked != 1 {
+		t.Fatalf("Invalid number of acked messages; want: %d; got: %d", 1, acked)
+	}
+	if len(entries) != 2 || entries[0].ID != "1" || entries[1].ID != "3" {
+		t.Fatalf("Invalid pending entries: %+v", entries)
+	}
+	if string(entries[1].Data) != "msg 3" {
+		t.Fatalf("Invalid data; want: %q; got: %q", "msg 3", entries[1].Data)
+	}
+
+	// corrupted checksum
+	record := encodeOutboxRecord(outboxOpAck, []byte("1"))
+	record[len(record)-1] = 'x'
+	entries, _, size, err = readOutboxLog(bytes.NewReader(record))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if size != 0 || len(entries) != 0 {
+		t.Fatalf("Expected corrupted record to be discarded")
+	}
+}
+
+func TestPublishWindow(t *testing.T) {
+	w := newPublishWindow(asyncPublisherOpts{
+		maxpa:    100,
+		adaptive: &PublishAsyncAdaptiveConfig{MinPending: 4, TargetLatency: 10 * time.Millisecond},
+	})
+	if w.maxPending(100) != 4 {
+		t.Fatalf("Invalid initial window; want: %d; got: %d", 4, w.maxPending(100))
+	}
+
+	// additive increase, window grows by roughly 1 per window of acks
+	for i := 0; i < 5; i++ {
+		w.onAck(time.Millisecond)
+	}
+	if w.maxPending(100) != 5 {
+		t.Fatalf("Invalid window after acks; want: %d; got: %d", 5, w.maxPending(100))
+	}
+	for i := 0; i < 10000; i++ {
+		w.onAck(time.Millisecond)
+	}
+	if w.maxPending(100) != 100 {
+		t.Fatalf("Expected window to be capped at max pending; got: %d", w.maxPending(100))
+	}
+
+	// multiplicative decrease on timeout
+	w.onError(ErrAsyncPublishTimeout)
+	if w.maxPending(100) != 50 {
+		t.Fatalf("Invalid window after timeout; want: %d; got: %d", 50, w.maxPending(100))
+	}
+	// errors which are not caused by overload do not change the window
+	w.lastDecrease = time.Time{}
+	w.onError(ErrMsgNotFound)
+	if w.maxPending(100) != 50 {
+		t.Fatalf("Invalid window after error; want: %d; got: %d", 50, w.maxPending(100))
+	}
+
+	// latency above target decreases the window, down to min pending
+	for i := 0; i < 10; i++ {
+		w.lastDecrease = time.Time{}
+		w.onAck(time.Second)
+	}
+	if w.maxPending(100) != 4 {
+		t.Fatalf("Expected window to be limited by min pending; got: %d", w.maxPending(100))
+	}
+	stats := w.stats(1, 100)
+	if !stats.Adaptive || stats.Acks != 10015 || stats.Errors != 2 || stats.MinLatency != time.Millisecond {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+
+	// without adaptive config, the fixed limit is used
+	w = newPublishWindow(asyncPublisherOpts{maxpa: 100})
+	w.onError(ErrAsyncPublishTimeout)
+	if w.maxPending(100) != 100 {
+		t.Fatalf("Invalid window; want: %d; got: %d", 100, w.maxPending(100))
+	}
+}
+
+func TestWorkerPool(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var processed []string
+	pool := newWorkerPool(2, nil, func(msg *jetStreamMsg) {
+		<-release
+		mu.Lock()
+		processed = append(processed, string(msg.msg.Data))
+		mu.Unlock()
+	})
+
+	// dispatch does not block while workers are busy
+	dispatched := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			pool.dispatch(&jetStreamMsg{msg: &nats.Msg{Subject: "FOO", Data: []byte(fmt.Sprint(i))}})
+		}
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(time.Second):
+		t.Fatalf("Dispatch blocked on busy workers")
+	}
+	if queued := pool.queued(); queued < 999 {
+		t.Fatalf("Expected messages to be queued; got: %d", queued)
+	}
+
+	pool.close()
+	if pool.finished() {
+		t.Fatalf("Expected workers to process queued messages before finishing")
+	}
+	close(release)
+	select {
+	case <-pool.done:
+	case <-time.After(time.Second):
+		t.Fatalf("Workers did not finish")
+	}
+	if len(processed) != 1000 {
+		t.Fatalf("Invalid number of processed messages; want: %d; got: %d", 1000, len(processed))
+	}
+	for i, data := range processed {
+		if data != fmt.Sprint(i) {
+			t.Fatalf("Messages with the same key out of order at %d: %s", i, data)
+		}
+	}
+}
+
+func TestConsumeStats(t *testing.T) {
+	var nilStats *consumeStats
+	nilStats.recordAck(ackAck)
+	nilStats.recordHandled(time.Second)
+	if stats := nilStats.snapshot(3); stats != (ConsumeStats{Buffered: 3}) {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+
+	s := &consumeStats{}
+	s.recordDelivered(&nats.Msg{Reply: "$JS.ACK.TEST.cons.1.1.1.1709150000000000000.2"})
+	s.recordDelivered(&nats.Msg{Reply: "$JS.ACK.TEST.cons.2.1.2.1709150000000000000.1"})
+	s.recordHandled(10 * time.Millisecond)
+	s.recordHandled(30 * time.Millisecond)
+	s.recordAck(ackAck)
+	s.recordAck(ackNak)
+	s.recordAck(ackProgress)
+	s.recordAck(ackTerm)
+	s.setPending(5, 100)
+	s.recordPullRequest()
+	s.recordMissedHeartbeat()
+	s.recordReconnect()
+	s.recordReset()
+
+	expected := ConsumeStats{
+		Delivered:         2,
+		Redelivered:       1,
+		Acked:             1,
+		Naked:             1,
+		Termed:            1,
+		PendingMsgs:       5,
+		PendingBytes:      100,
+		Buffered:          7,
+		MissedHeartbeats:  1,
+		PullRequests:      1,
+		Reconnects:        1,
+		Resets:            1,
+		HandlerLatency:    20 * time.Millisecond,
+		MaxHandlerLatency: 30 * time.Millisecond,
+	}
+	if stats := s.snapshot(7); stats != expected {
+		t.Fatalf("Invalid stats; want: %+v; got: %+v", expected, stats)
+	}
+}
+
+func TestTypedConsumerDecode(t *testing.T) {
+	type order struct {
+		ID  string
+		Qty int
+	}
+	newMsg := func(contentType string, data []byte) Msg {
+		m := nats.NewMsg("FOO")
+		if contentType != "" {
+			m.Header.Set(ContentTypeHeader, contentType)
+		}
+		m.Data = data
+		return &jetStreamMsg{msg: m}
+	}
+
+	t.Run("value type", func(t *testing.T) {
+		c, err := NewTypedConsumer[order](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		v, err := c.Decode(newMsg("application/json", []byte(`{"ID":"abc","Qty":2}`)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if v != (order{ID: "abc", Qty: 2}) {
+			t.Fatalf("Invalid value: %+v", v)
+		}
+	})
+
+	t.Run("pointer type without content type", func(t *testing.T) {
+		c, err := NewTypedConsumer[*order](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		v, err := c.Decode(newMsg("", []byte(`{"ID":"abc","Qty":2}`)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if v == nil || *v != (order{ID: "abc", Qty: 2}) {
+			t.Fatalf("Invalid value: %+v", v)
+		}
+	})
+
+	t.Run("content type mismatch", func(t *testing.T) {
+		c, err := NewTypedConsumer[order](nil, GobCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Decode(newMsg("application/json", []byte(`{"ID":"abc","Qty":2}`)))
+		if !errors.Is(err, ErrMsgDecode) {
+			t.Fatalf("Expected error: %v; got: %v", ErrMsgDecode, err)
+		}
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		c, err := NewTypedConsumer[order](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Decode(newMsg("application/json", []byte(`{`)))
+		if !errors.Is(err, ErrMsgDecode) {
+			t.Fatalf("Expected error: %v; got: %v", ErrMsgDecode, err)
+		}
+	})
+}
+
+func TestTypedRoundTrip(t *testing.T) {
+	t.Run("string", func(t *testing.T) {
+		p, err := NewTypedPublisher[string](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := NewTypedConsumer[string](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, v := range []string{"abc", `a"b`, `a\b`, "a\nb", ""} {
+			m, err := p.encode("FOO", v)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := c.Decode(&jetStreamMsg{msg: m})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != v {
+				t.Fatalf("Invalid value; want: %q; got: %q", v, got)
+			}
+		}
+	})
+
+	t.Run("byte slice", func(t *testing.T) {
+		p, err := NewTypedPublisher[[]byte](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := NewTypedConsumer[[]byte](nil, JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		v := []byte{0, 1, '"', 0xff}
+		m, err := p.encode("FOO", v)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		got, err := c.Decode(&jetStreamMsg{msg: m})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !bytes.Equal(got, v) {
+			t.Fatalf("Invalid value; want: %v; got: %v", v, got)
+		}
+	})
+}
+
+type stubKeyWatcher struct {
+	updates chan KeyValueEntry
+}
+
+func (w *stubKeyWatcher) Updates() <-chan KeyValueEntry { return w.updates }
+
+func (w *stubKeyWatcher) Stop() error {
+	close(w.updates)
+	return nil
+}
+
+func TestTypedKeyValueWatcher(t *testing.T) {
+	type order struct {
+		ID  string
+		Qty int
+	}
+	kv, err := NewTypedKeyValue[order](&kvs{}, JSONCodec)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stub := &stubKeyWatcher{updates: make(chan KeyValueEntry, 10)}
+	stub.updates <- &kve{key: "a", value: []byte(`{"ID":"a","Qty":1}`), revision: 1}
+	stub.updates <- &kve{key: "b", value: []byte(`{`), revision: 2}
+	stub.updates <- &kve{key: "a", revision: 3, op: KeyValueDelete}
+	stub.updates <- nil
+	stub.updates <- &kve{key: "c", value: []byte(`{"ID":"c","Qty":3}`), revision: 4}
+
+	w, err := kv.watch(stub, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	next := func() *TypedKeyValueEntry[order] {
+		t.Helper()
+		select {
+		case e := <-w.Updates():
+			return e
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive an update like expected")
+		}
+		return nil
+	}
+
+	if e := next(); e.Err() != nil || e.Value() != (order{ID: "a", Qty: 1}) || e.Revision() != 1 {
+		t.Fatalf("Invalid entry: %+v", e)
+	}
+	// decode errors are reported on the entry without stopping the watcher
+	if e := next(); !errors.Is(e.Err(), ErrMsgDecode) || e.Key() != "b" || string(e.RawValue()) != "{" {
+		t.Fatalf("Expected decode error; got: %+v", e)
+	}
+	if e := next(); e.Err() != nil || e.Operation() != KeyValueDelete || e.Value() != (order{}) {
+		t.Fatalf("Invalid delete entry: %+v", e)
+	}
+	if e := next(); e != nil {
+		t.Fatalf("Expected nil marker; got: %+v", e)
+	}
+	if e := next(); e.Err() != nil || e.Value() != (order{ID: "c", Qty: 3}) {
+		t.Fatalf("Invalid entry: %+v", e)
+	}
+
+	if err := w.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case _, ok := <-w.Updates():
+		if ok {
+			t.Fatalf("Expected updates channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Updates channel was not closed")
+	}
+
+	if _, err := NewTypedKeyValue[order](nil, JSONCodec); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", ErrInvalidOption, err)
+	}
+	if _, err := NewTypedKeyValue[order](&kvs{}, nil); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", ErrInvalidOption, err)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "nil", err: nil, expected: false},
+		{name: "timeout", err: nats.ErrTimeout, expected: true},
+		{name: "no responders", err: nats.ErrNoResponders, expected: true},
+		{name: "jetstream not enabled", err: ErrJetStreamNotEnabled, expected: true},
+		{name: "cluster not available", err: &APIError{Code: 503, ErrorCode: JSErrCodeClusterNotAvailable}, expected: true},
+		{name: "stream offline", err: fmt.Errorf("nats: %w", &APIError{Code: 500, ErrorCode: JSErrCodeStreamOffline}), expected: true},
+		{name: "stream not found", err: ErrStreamNotFound, expected: false},
+		{name: "bad request", err: &APIError{Code: 400, ErrorCode: JSErrCodeBadRequest}, expected: false},
+		{name: "client error", err: ErrInvalidOption, expected: false},
+		{name: "context deadline", err: context.DeadlineExceeded, expected: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if res := IsRetryableError(test.err); res != test.expected {
+				t.Fatalf("Invalid result; want: %v; got: %v", test.expected, res)
+			}
+		})
+	}
+}
+
+func TestAPIRetryPolicyBackoff(t *testing.T) {
+	policy := APIRetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, delay := range expected {
+		if res := policy.backoff(i + 1); res != delay {
+			t.Fatalf("Invalid backoff for attempt %d; want: %s; got: %s", i+1, delay, res)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if res := policy.backoff(2); res < 100*time.Millisecond || res > 300*time.Millisecond {
+			t.Fatalf("Backoff out of jitter bounds: %s", res)
+		}
+	}
+	tests := []struct {
+		name     string
+		jitter   float64
+		expected float64
+	}{
+		{name: "default jitter", jitter: 0, expected: defaultAPIRetryJitter},
+		{name: "custom jitter", jitter: 0.5, expected: 0.5},
+		{name: "jitter disabled", jitter: -1, expected: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var opts JetStreamOptions
+			if err := WithAPIRetry(APIRetryPolicy{Jitter: test.jitter})(&opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if opts.apiRetry.Jitter != test.expected {
+				t.Fatalf("Invalid jitter; want: %v; got: %v", test.expected, opts.apiRetry.Jitter)
+			}
+		})
+	}
+}
+
+func TestCounterValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     KeyValueEntry
+		withValue int64
+		withError error
+	}{
+		{
+			name:      "nil entry",
+			entry:     nil,
+			withValue: 0,
+		},
+		{
+			name:      "valid value",
+			entry:     &kve{key: "a", value: []byte("42")},
+			withValue: 42,
+		},
+		{
+			name:      "negative value",
+			entry:     &kve{key: "a", value: []byte("-7")},
+			withValue: -7,
+		},
+		{
+			name:      "empty value",
+			entry:     &kve{key: "a"},
+			withValue: 0,
+		},
+		{
+			name:      "delete marker",
+			entry:     &kve{key: "a", value: []byte("abc"), op: KeyValueDelete},
+			withValue: 0,
+		},
+		{
+			name:      "invalid value",
+			entry:     &kve{key: "a", value: []byte("abc")},
+			withError: ErrInvalidCounter,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := CounterValue(test.entry)
+			if test.withError != nil {
+				if !errors.Is(err, test.withError) {
+					t.Fatalf("Expected error: %v; got: %v", test.withError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if v != test.withValue {
+				t.Fatalf("Expected value %d; got %d", test.withValue, v)
+			}
+		})
+	}
+}
+
+func TestKeyValueCacheStale(t *testing.T) {
+	stub := &stubKeyWatcher{updates: make(chan KeyValueEntry, 10)}
+	staleChanges := make(chan bool, 10)
+	changes := make(chan string, 10)
+	c := &kvCache{
+		watcher: stub,
+		opts: cacheOpts{
+			maxPending:    5,
+			staleHandler:  func(stale bool) { staleChanges <- stale },
+			changeHandler: func(entry KeyValueEntry) { changes <- entry.Key() },
+		},
+		entries: make(map[string]KeyValueEntry),
+		notify:  make(chan struct{}),
+	}
+	connStatus := make(chan nats.Status, 10)
+	released := make(chan struct{})
+	go c.run(connStatus, func() { close(released) })
+
+	expectStale := func(expected bool) {
+		t.Helper()
+		select {
+		case stale := <-staleChanges:
+			if stale != expected {
+				t.Fatalf("Expected stale to be %v", expected)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive stale change")
+		}
+		if c.Stale() != expected {
+			t.Fatalf("Expected Stale() to return %v", expected)
+		}
+	}
+
+	// lagging watcher
+	stub.updates <- &kve{key: "a", value: []byte("1"), revision: 1, delta: 10}
+	expectStale(true)
+	stub.updates <- &kve{key: "b", value: []byte("2"), revision: 12, delta: 0}
+	expectStale(false)
+	if err := c.WaitForRevision(context.Background(), 12); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stub.updates <- &kve{key: "a", revision: 13, op: KeyValueDelete}
+	if err := c.WaitForRevision(context.Background(), 13); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := c.Get("a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Expected error: %v; got: %v", ErrKeyNotFound, err)
+	}
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+	for _, key := range []string{"a", "b", "a"} {
+		select {
+		case changed := <-changes:
+			if changed != key {
+				t.Fatalf("Expected change of key %q; got %q", key, changed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive change")
+		}
+	}
+
+	// disconnect
+	connStatus <- nats.RECONNECTING
+	expectStale(true)
+	connStatus <- nats.CONNECTED
+	expectStale(false)
+
+	// watcher stopped
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- c.WaitForRevision(ctx, 20)
+	}()
+	stub.Stop()
+	expectStale(true)
+	if err := <-errs; !errors.Is(err, ErrKeyValueCacheStopped) {
+		t.Fatalf("Expected error: %v; got: %v", ErrKeyValueCacheStopped, err)
+	}
+	if entry, err := c.Get("b"); err != nil || string(entry.Value()) != "2" {
+		t.Fatalf("Expected cached value to be available after stop; got %v", err)
+	}
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected status listener to be released after stop")
+	}
+}
+
+func TestStatusChangedRelease(t *testing.T) {
+	nc := &nats.Conn{}
+	listeners := func() int {
+		connStatusListeners.Lock()
+		defer connStatusListeners.Unlock()
+		return len(connStatusListeners.conns[nc])
+	}
+
+	_, release1 := statusChanged(nc, nats.CONNECTED)
+	_, release2 := statusChanged(nc, nats.RECONNECTING)
+	if n := listeners(); n != 2 {
+		t.Fatalf("Expected 2 listeners; got: %d", n)
+	}
+	release1()
+	if n := listeners(); n != 1 {
+		t.Fatalf("Expected 1 listener; got: %d", n)
+	}
+	release2()
+	release2()
+	if n := listeners(); n != 0 {
+		t.Fatalf("Expected no listeners; got: %d", n)
+	}
+}
+
+func TestResolveOpts(t *testing.T) {
+	watch, err := ResolveWatchOpts(IgnoreDeletes(), nil, ResumeFromRevision(5))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !watch.IgnoreDeletes || watch.ResumeFromRevision != 5 || watch.UpdatesOnly {
+		t.Fatalf("Unexpected watch options: %+v", watch)
+	}
+
+	consume, err := ResolvePullConsumeOpts(StopAfter(10), WithConsumeWorkers(4, nil), WithDeadLetter("dlq"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if consume.StopAfter != 10 || consume.Workers != 4 || consume.DeadLetterSubject != "dlq" || consume.AutoInProgress {
+		t.Fatalf("Unexpected consume options: %+v", consume)
+	}
+	if _, err := ResolvePullConsumeOpts(PullMaxMessages(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", ErrInvalidOption, err)
+	}
+
+	m := nats.NewMsg("foo")
+	if _, err := ResolvePublishOpts(m, WithMsgID("1")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id := m.Header.Get(MsgIDHeader); id != "1" {
+		t.Fatalf("Invalid message ID; want: %s; got: %s", "1", id)
+	}
+}
@@ -0,0 +1,1003 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+)
+
+type (
+	consumerAction int
+
+	// consumer holds the state of a consumer. All fields are protected by
+	// the mutex of the owning jetStream.
+	consumer struct {
+		s       *stream
+		name    string
+		cfg     jetstream.ConsumerConfig
+		created time.Time
+		push    bool
+		deleted bool
+
+		// sseq is the last stream sequence considered for delivery and
+		// dseq is the last consumer (delivery) sequence.
+		sseq uint64
+		dseq uint64
+
+		// lastPerSubject holds the stream sequences initially delivered
+		// by consumers using DeliverLastPerSubjectPolicy.
+		lastPerSubject []uint64
+
+		pending    map[uint64]*pendingMsg
+		deliveries map[uint64]uint64
+		ackFloor   jetstream.SequenceInfo
+		lastActive time.Time
+
+		// bound is the number of active push consumer subscriptions.
+		bound int
+	}
+
+	pendingMsg struct {
+		dseq     uint64
+		deadline time.Time
+	}
+
+	// consumerHandle looks up the consumer by stream and consumer name on
+	// each operation, the same way the client does.
+	consumerHandle struct {
+		js     *jetStream
+		stream string
+		name   string
+
+		mu   sync.Mutex
+		info *jetstream.ConsumerInfo
+	}
+
+	pullConsumer struct {
+		*consumerHandle
+	}
+
+	pushConsumer struct {
+		*consumerHandle
+	}
+
+	ackKind int
+
+	fetchResult struct {
+		sync.Mutex
+		msgs chan jetstream.Msg
+		err  error
+	}
+
+	consumeContext struct {
+		h          *consumerHandle
+		handler    jetstream.MessageHandler
+		errHandler jetstream.ConsumeErrHandlerFunc
+		stopAfter  int
+		push       bool
+		stop       chan struct{}
+		closed     chan struct{}
+		stopOnce   sync.Once
+		stats      consumeStats
+	}
+
+	messagesContext struct {
+		h         *consumerHandle
+		stopAfter int
+		stop      chan struct{}
+		stopOnce  sync.Once
+
+		mu        sync.Mutex
+		delivered int
+		stats     consumeStats
+	}
+
+	// ackPipeline acknowledges messages synchronously.
+	ackPipeline struct{}
+)
+
+const (
+	actionCreateOrUpdate consumerAction = iota
+	actionCreate
+	actionUpdate
+)
+
+const (
+	ackAck ackKind = iota
+	ackNak
+	ackProgress
+	ackTerm
+)
+
+const (
+	defaultAckWait       = 30 * time.Second
+	defaultMaxAckPending = 1000
+	defaultMaxWaiting    = 512
+	defaultInactive      = 5 * time.Second
+
+	// fetchBytesBatch is the batch size used by FetchBytes.
+	fetchBytesBatch = 1_000_000
+)
+
+var (
+	errStopped    = errors.New("jetstreamtest: stopped")
+	errMaxBytes   = errors.New("jetstreamtest: max bytes exceeded")
+	errNoConsumer = errors.New("jetstreamtest: consumer deleted")
+)
+
+func (s *stream) upsertConsumer(cfg jetstream.ConsumerConfig, action consumerAction) (*consumer, error) {
+	name := cfg.Name
+	if name == "" {
+		name = cfg.Durable
+	}
+	if name == "" {
+		id := nuid.Next()
+		name = id[len(id)-8:]
+	}
+	if err := validateConsumerName(name); err != nil {
+		return nil, err
+	}
+	if err := s.validateFilters(cfg); err != nil {
+		return nil, err
+	}
+	cfg = normalizeConsumerConfig(cfg, name)
+	if err := s.checkWorkQueue(cfg); err != nil {
+		return nil, err
+	}
+
+	c, ok := s.consumers[name]
+	switch {
+	case !ok && action == actionUpdate:
+		return nil, jetstream.ErrConsumerDoesNotExist
+	case ok && action == actionCreate:
+		if !reflect.DeepEqual(c.cfg, cfg) {
+			return nil, jetstream.ErrConsumerExists
+		}
+		return c, nil
+	case ok:
+		if err := c.update(cfg); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if s.cfg.MaxConsumers > 0 && len(s.consumers) >= s.cfg.MaxConsumers {
+		return nil, apiError(400, 10026, "maximum consumers limit reached")
+	}
+	c = newConsumer(s, name, cfg)
+	s.consumers[name] = c
+	return c, nil
+}
+
+func (s *stream) validateFilters(cfg jetstream.ConsumerConfig) error {
+	if cfg.FilterSubject != "" && len(cfg.FilterSubjects) > 0 {
+		return jetstream.ErrDuplicateFilterSubjects
+	}
+	if cfg.FilterSubject != "" {
+		if err := validateSubject(cfg.FilterSubject); err != nil {
+			return err
+		}
+	}
+	filters := consumerFilters(cfg)
+	for i, filter := range filters {
+		if filter == "" {
+			return jetstream.ErrEmptyFilter
+		}
+		for _, other := range filters[i+1:] {
+			if subjectsOverlap(filter, other) {
+				return jetstream.ErrOverlappingFilterSubjects
+			}
+		}
+		if !s.overlaps(filter) {
+			return apiError(400, 10093, "consumer filter subject is not a valid subset of the interest subjects")
+		}
+	}
+	return nil
+}
+
+func (s *stream) checkWorkQueue(cfg jetstream.ConsumerConfig) error {
+	if s.cfg.Retention != jetstream.WorkQueuePolicy {
+		return nil
+	}
+	if cfg.AckPolicy != jetstream.AckExplicitPolicy {
+		return apiError(400, 10098, "consumer in work queue stream must be explicit ack")
+	}
+	filters := consumerFilters(cfg)
+	for _, c := range s.consumers {
+		if c.name == cfg.Name {
+			continue
+		}
+		other := consumerFilters(c.cfg)
+		if len(filters) == 0 || len(other) == 0 {
+			return apiError(400, 10099, "multiple non-filtered consumers not allowed on workqueue stream")
+		}
+		for _, filter := range filters {
+			for _, o := range other {
+				if subjectsOverlap(filter, o) {
+					return apiError(400, 10100, "filtered consumer not unique on workqueue stream")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeConsumerConfig sets defaults the same way the server does.
+func normalizeConsumerConfig(cfg jetstream.ConsumerConfig, name string) jetstream.ConsumerConfig {
+	cfg.Name = name
+	if cfg.AckWait == 0 {
+		cfg.AckWait = defaultAckWait
+	}
+	if cfg.MaxDeliver == 0 {
+		cfg.MaxDeliver = -1
+	}
+	if cfg.MaxAckPending == 0 && cfg.AckPolicy != jetstream.AckNonePolicy {
+		cfg.MaxAckPending = defaultMaxAckPending
+	}
+	if cfg.DeliverSubject == "" && cfg.MaxWaiting == 0 {
+		cfg.MaxWaiting = defaultMaxWaiting
+	}
+	if cfg.Durable == "" && cfg.InactiveThreshold == 0 {
+		cfg.InactiveThreshold = defaultInactive
+	}
+	if len(cfg.FilterSubjects) > 0 {
+		cfg.FilterSubjects = append([]string(nil), cfg.FilterSubjects...)
+	}
+	return cfg
+}
+
+func consumerFilters(cfg jetstream.ConsumerConfig) []string {
+	if cfg.FilterSubject != "" {
+		return []string{cfg.FilterSubject}
+	}
+	return cfg.FilterSubjects
+}
+
+func newConsumer(s *stream, name string, cfg jetstream.ConsumerConfig) *consumer {
+	c := &consumer{
+		s:          s,
+		name:       name,
+		cfg:        cfg,
+		created:    time.Now().UTC(),
+		push:       cfg.DeliverSubject != "",
+		pending:    make(map[uint64]*pendingMsg),
+		deliveries: make(map[uint64]uint64),
+	}
+	s.expire(time.Now())
+	switch cfg.DeliverPolicy {
+	case jetstream.DeliverAllPolicy:
+		if first := s.firstSeq(); first > 0 {
+			c.sseq = first - 1
+		}
+	case jetstream.DeliverLastPolicy:
+		c.sseq = s.last
+		for i := len(s.msgs) - 1; i >= 0; i-- {
+			if c.matches(s.msgs[i].subject) {
+				c.sseq = s.msgs[i].seq - 1
+				break
+			}
+		}
+	case jetstream.DeliverNewPolicy:
+		c.sseq = s.last
+	case jetstream.DeliverByStartSequencePolicy:
+		if cfg.OptStartSeq > 0 {
+			c.sseq = cfg.OptStartSeq - 1
+		}
+	case jetstream.DeliverByStartTimePolicy:
+		c.sseq = s.last
+		if cfg.OptStartTime != nil {
+			for _, m := range s.msgs {
+				if !m.time.Before(*cfg.OptStartTime) {
+					c.sseq = m.seq - 1
+					break
+				}
+			}
+		}
+	case jetstream.DeliverLastPerSubjectPolicy:
+		last := make(map[string]uint64)
+		for _, m := range s.msgs {
+			if c.matches(m.subject) {
+				last[m.subject] = m.seq
+			}
+		}
+		for _, seq := range last {
+			c.lastPerSubject = append(c.lastPerSubject, seq)
+		}
+		sort.Slice(c.lastPerSubject, func(i, j int) bool {
+			return c.lastPerSubject[i] < c.lastPerSubject[j]
+		})
+		c.sseq = s.last
+	}
+	c.ackFloor.Stream = c.sseq
+	return c
+}
+
+func (c *consumer) update(cfg jetstream.ConsumerConfig) error {
+	switch {
+	case cfg.DeliverPolicy != c.cfg.DeliverPolicy:
+		return apiError(400, jetstream.JSErrCodeConsumerCreate, "deliver policy can not be updated")
+	case cfg.AckPolicy != c.cfg.AckPolicy:
+		return apiError(400, jetstream.JSErrCodeConsumerCreate, "ack policy can not be updated")
+	case (cfg.DeliverSubject != "") != c.push:
+		return apiError(400, jetstream.JSErrCodeConsumerCreate, "can not update push consumer to pull based")
+	}
+	c.cfg = cfg
+	c.s.notify()
+	return nil
+}
+
+func (c *consumer) handle() *consumerHandle {
+	return &consumerHandle{js: c.s.js, stream: c.s.cfg.Name, name: c.name, info: c.info()}
+}
+
+func (c *consumer) matches(subject string) bool {
+	filters := consumerFilters(c.cfg)
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if subjectMatchesFilter(subject, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// ackWait returns the time to wait for an ack after the given delivery.
+func (c *consumer) ackWait(deliveries uint64) time.Duration {
+	if len(c.cfg.BackOff) == 0 {
+		return c.cfg.AckWait
+	}
+	i := int(deliveries) - 1
+	if i >= len(c.cfg.BackOff) {
+		i = len(c.cfg.BackOff) - 1
+	}
+	return c.cfg.BackOff[i]
+}
+
+// peek returns the next message to deliver, and whether it is a
+// redelivery. Messages due for redelivery are returned first.
+func (c *consumer) peek(now time.Time) (*storedMsg, bool) {
+	s := c.s
+	s.expire(now)
+	if c.cfg.AckPolicy != jetstream.AckNonePolicy {
+		for {
+			seq, ok := c.dueRedelivery(now)
+			if !ok {
+				break
+			}
+			m := s.msg(seq)
+			if m == nil || (c.cfg.MaxDeliver > 0 && c.deliveries[seq] >= uint64(c.cfg.MaxDeliver)) {
+				delete(c.pending, seq)
+				delete(c.deliveries, seq)
+				c.updateAckFloor()
+				continue
+			}
+			return m, true
+		}
+		if c.cfg.MaxAckPending > 0 && len(c.pending) >= c.cfg.MaxAckPending {
+			return nil, false
+		}
+	}
+	for len(c.lastPerSubject) > 0 {
+		if m := s.msg(c.lastPerSubject[0]); m != nil {
+			return m, false
+		}
+		c.lastPerSubject = c.lastPerSubject[1:]
+	}
+	return s.nextMsg(c.sseq+1, func(m *storedMsg) bool {
+		return c.matches(m.subject)
+	}), false
+}
+
+// dueRedelivery returns the lowest pending sequence with an expired ack
+// deadline.
+func (c *consumer) dueRedelivery(now time.Time) (uint64, bool) {
+	var due uint64
+	for seq, p := range c.pending {
+		if !p.deadline.After(now) && (due == 0 || seq < due) {
+			due = seq
+		}
+	}
+	return due, due != 0
+}
+
+// nextDeadline returns the earliest ack deadline of pending messages, or
+// zero time if there are none.
+func (c *consumer) nextDeadline() time.Time {
+	var next time.Time
+	for _, p := range c.pending {
+		if next.IsZero() || p.deadline.Before(next) {
+			next = p.deadline
+		}
+	}
+	return next
+}
+
+func (c *consumer) deliver(m *storedMsg, redelivery bool, now time.Time) *msg {
+	if !redelivery {
+		if len(c.lastPerSubject) > 0 && c.lastPerSubject[0] == m.seq {
+			c.lastPerSubject = c.lastPerSubject[1:]
+		} else {
+			c.sseq = m.seq
+		}
+	}
+	c.dseq++
+	c.deliveries[m.seq]++
+	deliveries := c.deliveries[m.seq]
+	c.lastActive = now.UTC()
+	res := newMsg(c, m, c.dseq, deliveries, c.numPending())
+	if c.cfg.AckPolicy == jetstream.AckNonePolicy {
+		delete(c.deliveries, m.seq)
+		c.updateAckFloor()
+		c.s.acked(m.seq)
+	} else {
+		c.pending[m.seq] = &pendingMsg{dseq: c.dseq, deadline: now.Add(c.ackWait(deliveries))}
+	}
+	return res
+}
+
+func (c *consumer) numPending() uint64 {
+	var pending uint64
+	for _, seq := range c.lastPerSubject {
+		if c.s.msg(seq) != nil {
+			pending++
+		}
+	}
+	for i := c.s.index(c.sseq + 1); i < len(c.s.msgs); i++ {
+		if c.matches(c.s.msgs[i].subject) {
+			pending++
+		}
+	}
+	return pending
+}
+
+// acked checks whether the message was delivered and acknowledged.
+func (c *consumer) acked(seq uint64) bool {
+	if _, ok := c.pending[seq]; ok {
+		return false
+	}
+	for _, s := range c.lastPerSubject {
+		if s == seq {
+			return false
+		}
+	}
+	return seq <= c.sseq
+}
+
+func (c *consumer) processAck(kind ackKind, seq uint64, delay time.Duration, now time.Time) {
+	p, ok := c.pending[seq]
+	switch kind {
+	case ackAck, ackTerm:
+		var acked []uint64
+		if kind == ackAck && c.cfg.AckPolicy == jetstream.AckAllPolicy {
+			for pseq := range c.pending {
+				if pseq <= seq {
+					acked = append(acked, pseq)
+				}
+			}
+			sort.Slice(acked, func(i, j int) bool { return acked[i] < acked[j] })
+		} else if ok {
+			acked = append(acked, seq)
+		}
+		for _, aseq := range acked {
+			delete(c.pending, aseq)
+			delete(c.deliveries, aseq)
+		}
+		c.updateAckFloor()
+		for _, aseq := range acked {
+			c.s.acked(aseq)
+		}
+		if len(acked) > 0 {
+			c.s.notify()
+		}
+	case ackNak:
+		if ok {
+			p.deadline = now.Add(delay)
+			c.s.notify()
+		}
+	case ackProgress:
+		if ok {
+			p.deadline = now.Add(c.ackWait(c.deliveries[seq]))
+		}
+	}
+}
+
+func (c *consumer) updateAckFloor() {
+	if len(c.pending) == 0 {
+		c.ackFloor.Consumer, c.ackFloor.Stream = c.dseq, c.sseq
+		return
+	}
+	var low uint64
+	for seq := range c.pending {
+		if low == 0 || seq < low {
+			low = seq
+		}
+	}
+	c.ackFloor.Consumer, c.ackFloor.Stream = c.pending[low].dseq-1, low-1
+}
+
+// removed is called when a message is removed from the stream.
+func (c *consumer) removed(seq uint64) {
+	if _, ok := c.pending[seq]; ok {
+		delete(c.pending, seq)
+		delete(c.deliveries, seq)
+		c.updateAckFloor()
+	}
+}
+
+// purged is called when the stream was purged, skipping purged messages.
+func (c *consumer) purged(first uint64) {
+	if first > 0 && c.sseq < first-1 {
+		c.sseq = first - 1
+		c.updateAckFloor()
+	}
+}
+
+func (c *consumer) info() *jetstream.ConsumerInfo {
+	var redelivered int
+	for _, n := range c.deliveries {
+		if n > 1 {
+			redelivered++
+		}
+	}
+	delivered := jetstream.SequenceInfo{Consumer: c.dseq, Stream: c.sseq}
+	ackFloor := c.ackFloor
+	if !c.lastActive.IsZero() {
+		last := c.lastActive
+		delivered.Last = &last
+		ackFloor.Last = &last
+	}
+	cfg := c.cfg
+	if len(cfg.FilterSubjects) > 0 {
+		cfg.FilterSubjects = append([]string(nil), cfg.FilterSubjects...)
+	}
+	return &jetstream.ConsumerInfo{
+		Stream:         c.s.cfg.Name,
+		Name:           c.name,
+		Created:        c.created,
+		Config:         cfg,
+		Delivered:      delivered,
+		AckFloor:       ackFloor,
+		NumAckPending:  len(c.pending),
+		NumRedelivered: redelivered,
+		NumPending:     c.numPending(),
+		PushBound:      c.push && c.bound > 0,
+		TimeStamp:      time.Now().UTC(),
+	}
+}
+
+// consumer returns the consumer, or an error if it was deleted. It has to
+// be called with the jetStream mutex held.
+func (h *consumerHandle) consumer() (*consumer, error) {
+	s, ok := h.js.streams[h.stream]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	c, ok := s.consumers[h.name]
+	if !ok {
+		return nil, jetstream.ErrConsumerNotFound
+	}
+	return c, nil
+}
+
+func (h *consumerHandle) Info(_ context.Context) (*jetstream.ConsumerInfo, error) {
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	c, err := h.consumer()
+	if err != nil {
+		return nil, err
+	}
+	info := c.info()
+	h.mu.Lock()
+	h.info = info
+	h.mu.Unlock()
+	return info, nil
+}
+
+func (h *consumerHandle) CachedInfo() *jetstream.ConsumerInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.info
+}
+
+// next returns the next message, waiting for it until the deadline (if
+// set) or until stop is closed. If no message is available, nil is
+// returned. If maxBytes is set and the next message is larger, errMaxBytes
+// is returned.
+func (h *consumerHandle) next(deadline time.Time, noWait bool, stop <-chan struct{}, maxBytes int) (*msg, error) {
+	js := h.js
+	for {
+		select {
+		case <-stop:
+			return nil, errStopped
+		default:
+		}
+		js.mu.Lock()
+		c, err := h.consumer()
+		if err != nil {
+			js.mu.Unlock()
+			return nil, errNoConsumer
+		}
+		now := time.Now()
+		if m, redelivery := c.peek(now); m != nil {
+			if maxBytes > 0 && int(m.size()) > maxBytes {
+				js.mu.Unlock()
+				return nil, errMaxBytes
+			}
+			res := c.deliver(m, redelivery, now)
+			js.mu.Unlock()
+			return res, nil
+		}
+		if noWait || (!deadline.IsZero() && !now.Before(deadline)) {
+			js.mu.Unlock()
+			return nil, nil
+		}
+		changed := c.s.changed
+		wake := c.nextDeadline()
+		js.mu.Unlock()
+
+		wait := time.Hour
+		if !deadline.IsZero() {
+			wait = deadline.Sub(now)
+		}
+		if !wake.IsZero() && wake.Sub(now) < wait {
+			wait = wake.Sub(now)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return nil, errStopped
+		}
+		timer.Stop()
+	}
+}
+
+// checkPull returns ErrNotPullConsumer for consumers with a deliver
+// subject, as messages of push consumers cannot be pulled.
+func (p *pullConsumer) checkPull() error {
+	p.js.mu.Lock()
+	defer p.js.mu.Unlock()
+	if c, err := p.consumer(); err == nil && c.push {
+		return jetstream.ErrNotPullConsumer
+	}
+	return nil
+}
+
+func (p *pullConsumer) Fetch(batch int, opts ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
+	if batch < 1 {
+		return nil, fmt.Errorf("%w: batch size must be at least 1", jetstream.ErrInvalidOption)
+	}
+	o, err := jetstream.ResolveFetchOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return p.fetch(batch, 0, o), nil
+}
+
+func (p *pullConsumer) FetchBytes(maxBytes int, opts ...jetstream.FetchOpt) (jetstream.MessageBatch, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
+	if maxBytes < 1 {
+		return nil, fmt.Errorf("%w: max bytes must be at least 1", jetstream.ErrInvalidOption)
+	}
+	o, err := jetstream.ResolveFetchOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return p.fetch(fetchBytesBatch, maxBytes, o), nil
+}
+
+func (p *pullConsumer) FetchNoWait(batch int) (jetstream.MessageBatch, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
+	if batch < 1 {
+		return nil, fmt.Errorf("%w: batch size must be at least 1", jetstream.ErrInvalidOption)
+	}
+	return p.fetch(batch, 0, jetstream.FetchOptions{NoWait: true}), nil
+}
+
+func (p *pullConsumer) fetch(batch, maxBytes int, o jetstream.FetchOptions) *fetchResult {
+	res := &fetchResult{msgs: make(chan jetstream.Msg, min(batch, 1024))}
+	deadline := time.Now().Add(o.Expires)
+	go func() {
+		defer close(res.msgs)
+		remaining := maxBytes
+		for i := 0; i < batch; i++ {
+			m, err := p.next(deadline, o.NoWait, nil, remaining)
+			switch {
+			case errors.Is(err, errMaxBytes):
+				if i == 0 {
+					res.setErr(jetstream.ErrMaxBytesExceeded)
+				}
+				return
+			case errors.Is(err, errNoConsumer):
+				res.setErr(jetstream.ErrConsumerDeleted)
+				return
+			case m == nil:
+				return
+			}
+			if maxBytes > 0 {
+				remaining -= m.size
+			}
+			res.msgs <- m
+		}
+	}()
+	return res
+}
+
+func (p *pullConsumer) Next(opts ...jetstream.FetchOpt) (jetstream.Msg, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
+	o, err := jetstream.ResolveFetchOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	m, err := p.next(time.Now().Add(o.Expires), o.NoWait, nil, 0)
+	if err != nil {
+		return nil, jetstream.ErrConsumerDeleted
+	}
+	if m == nil {
+		return nil, nats.ErrTimeout
+	}
+	return m, nil
+}
+
+func (p *pullConsumer) Consume(handler jetstream.MessageHandler, opts ...jetstream.PullConsumeOpt) (jetstream.ConsumeContext, error) {
+	if handler == nil {
+		return nil, jetstream.ErrHandlerRequired
+	}
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
+	o, err := jetstream.ResolvePullConsumeOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConsumeOpts(o); err != nil {
+		return nil, err
+	}
+	p.js.mu.Lock()
+	_, err = p.consumer()
+	p.js.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	cc := newConsumeContext(p.consumerHandle, handler, o, false)
+	go cc.run()
+	return cc, nil
+}
+
+func (p *pullConsumer) Messages(opts ...jetstream.PullMessagesOpt) (jetstream.MessagesContext, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
+	o, err := jetstream.ResolvePullMessagesOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConsumeOpts(o); err != nil {
+		return nil, err
+	}
+	p.js.mu.Lock()
+	_, err = p.consumer()
+	p.js.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var msgs jetstream.MessagesContext = &messagesContext{h: p.consumerHandle, stopAfter: o.StopAfter, stop: make(chan struct{})}
+	if len(o.Middleware) > 0 {
+		msgs = jetstream.ChainMessagesMiddleware(msgs, o.Middleware...)
+	}
+	return msgs, nil
+}
+
+func (p *pushConsumer) Consume(handler jetstream.MessageHandler, opts ...jetstream.PushConsumeOpt) (jetstream.ConsumeContext, error) {
+	if handler == nil {
+		return nil, jetstream.ErrHandlerRequired
+	}
+	o, err := jetstream.ResolvePushConsumeOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", jetstream.ErrInvalidOption, err)
+	}
+	if err := checkConsumeOpts(o); err != nil {
+		return nil, err
+	}
+	p.js.mu.Lock()
+	c, err := p.consumer()
+	if err != nil {
+		p.js.mu.Unlock()
+		return nil, err
+	}
+	if c.cfg.DeliverGroup == "" && c.bound > 0 {
+		p.js.mu.Unlock()
+		return nil, jetstream.ErrConsumerHasActiveSubscription
+	}
+	c.bound++
+	p.js.mu.Unlock()
+	cc := newConsumeContext(p.consumerHandle, handler, o, true)
+	go cc.run()
+	return cc, nil
+}
+
+func (r *fetchResult) Messages() <-chan jetstream.Msg {
+	return r.msgs
+}
+
+func (r *fetchResult) Error() error {
+	r.Lock()
+	defer r.Unlock()
+	return r.err
+}
+
+func (r *fetchResult) setErr(err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.err = err
+}
+
+// checkConsumeOpts returns ErrInvalidOption for consume options which are
+// not implemented, rather than silently ignoring them.
+func checkConsumeOpts(o jetstream.ConsumeOptions) error {
+	switch {
+	case o.Workers > 0:
+		return fmt.Errorf("%w: consume workers are not supported", jetstream.ErrInvalidOption)
+	case o.AutoInProgress:
+		return fmt.Errorf("%w: auto in progress is not supported", jetstream.ErrInvalidOption)
+	case o.DeadLetterSubject != "":
+		return fmt.Errorf("%w: dead letter subject is not supported", jetstream.ErrInvalidOption)
+	}
+	return nil
+}
+
+func newConsumeContext(h *consumerHandle, handler jetstream.MessageHandler, o jetstream.ConsumeOptions, push bool) *consumeContext {
+	if len(o.Middleware) > 0 {
+		handler = jetstream.ChainMiddleware(handler, o.Middleware...)
+	}
+	return &consumeContext{
+		h:          h,
+		handler:    handler,
+		errHandler: o.ErrHandler,
+		stopAfter:  o.StopAfter,
+		push:       push,
+		stop:       make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
+}
+
+func (cc *consumeContext) run() {
+	defer close(cc.closed)
+	if cc.push {
+		defer cc.unbind()
+	}
+	for delivered := 0; cc.stopAfter == 0 || delivered < cc.stopAfter; delivered++ {
+		m, err := cc.h.next(time.Time{}, false, cc.stop, 0)
+		if errors.Is(err, errStopped) {
+			return
+		}
+		if err != nil {
+			if cc.errHandler != nil {
+				cc.errHandler(cc, jetstream.ErrConsumerDeleted)
+			}
+			return
+		}
+		cc.stats.recordDelivered(m)
+		start := time.Now()
+		cc.handler(m)
+		cc.stats.recordHandled(time.Since(start))
+	}
+}
+
+func (cc *consumeContext) unbind() {
+	cc.h.js.mu.Lock()
+	defer cc.h.js.mu.Unlock()
+	if c, err := cc.h.consumer(); err == nil {
+		c.bound--
+	}
+}
+
+func (cc *consumeContext) Stop() {
+	cc.stopOnce.Do(func() {
+		close(cc.stop)
+	})
+}
+
+// Drain stops consuming. As messages are not buffered, it is the same as
+// Stop.
+func (cc *consumeContext) Drain() {
+	cc.Stop()
+}
+
+func (cc *consumeContext) Closed() <-chan struct{} {
+	return cc.closed
+}
+
+func (cc *consumeContext) Acks() jetstream.AckPipeline {
+	return ackPipeline{}
+}
+
+// Stats returns delivery, acknowledgement and handler statistics. As
+// messages are not requested or buffered, pending counts are always 0.
+func (cc *consumeContext) Stats() jetstream.ConsumeStats {
+	return cc.stats.snapshot()
+}
+
+func (mc *messagesContext) Next() (jetstream.Msg, error) {
+	mc.mu.Lock()
+	if mc.stopAfter > 0 && mc.delivered >= mc.stopAfter {
+		mc.mu.Unlock()
+		return nil, jetstream.ErrMsgIteratorClosed
+	}
+	mc.mu.Unlock()
+	m, err := mc.h.next(time.Time{}, false, mc.stop, 0)
+	if errors.Is(err, errStopped) {
+		return nil, jetstream.ErrMsgIteratorClosed
+	}
+	if err != nil {
+		return nil, jetstream.ErrConsumerDeleted
+	}
+	mc.mu.Lock()
+	mc.delivered++
+	mc.mu.Unlock()
+	mc.stats.recordDelivered(m)
+	return m, nil
+}
+
+func (mc *messagesContext) Stop() {
+	mc.stopOnce.Do(func() {
+		close(mc.stop)
+	})
+}
+
+// Drain stops the iterator. As messages are not buffered, it is the same as
+// Stop.
+func (mc *messagesContext) Drain() {
+	mc.Stop()
+}
+
+// Stats returns delivery and acknowledgement statistics. As messages are
+// not requested or buffered, pending counts are always 0.
+func (mc *messagesContext) Stats() jetstream.ConsumeStats {
+	return mc.stats.snapshot()
+}
+
+func (ackPipeline) Ack(msg jetstream.Msg) error {
+	return msg.Ack()
+}
+
+func (ackPipeline) Flush(_ context.Context) error {
+	return nil
+}
+
+func (ackPipeline) Pending() int {
+	return 0
+}
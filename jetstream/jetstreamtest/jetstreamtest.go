@@ -0,0 +1,672 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jetstreamtest provides an in-memory implementation of
+// [jetstream.JetStream], allowing code using streams, consumers, KeyValue
+// stores and object stores to be unit tested without a NATS server.
+//
+// The implementation models the server behavior relied upon by most
+// applications:
+//   - stream subjects, retention policies (limits, interest and work queue),
+//     MaxMsgs, MaxBytes, MaxAge, MaxMsgsPerSubject, MaxMsgSize and discard
+//     policies, sealed streams, rollups and purges,
+//   - message deduplication using [jetstream.MsgIDHeader] within the
+//     duplicates window, and expected stream, last sequence, last subject
+//     sequence and last message ID headers,
+//   - pull and push consumers with deliver policies, subject filters, ack
+//     policies, ack, nak (with delay), in progress and term, redelivery
+//     after AckWait or BackOff, MaxDeliver and MaxAckPending,
+//   - KeyValue stores with revisions, history, deletes, purges and watches,
+//   - object stores with chunked objects, digests, links and watches.
+//
+// It is not a replacement for integration tests against a server. Known
+// differences:
+//   - [jetstream.JetStream.Conn] returns nil; advisories, snapshots, restores,
+//     mirrors, sources, subject transforms and republish are not supported
+//     and return [ErrNotSupported],
+//   - [jetstream.Apply] only supports JetStream instances created using
+//     [jetstream.New] and returns [jetstream.ErrInvalidOption] for this
+//     implementation,
+//   - message sizes used for MaxBytes and MaxMsgSize are approximations of
+//     the sizes computed by the server,
+//   - expired messages are removed lazily, on the next operation on the
+//     stream,
+//   - messages do not expose their acknowledgement state to middleware, so
+//     e.g. [jetstream.NakBackoffMiddleware] does not nak unacknowledged
+//     messages,
+//   - async publishing completes synchronously,
+//   - [jetstream.Outbox] is always considered connected, so messages are
+//     only re-published when the outbox is opened,
+//   - consume statistics only track deliveries, acknowledgements and
+//     handler latency, as messages are not requested or buffered.
+//   - [jetstream.WithConsumeWorkers], [jetstream.WithAutoInProgress] and
+//     [jetstream.WithDeadLetter] are not supported; Consume and Messages
+//     return [jetstream.ErrInvalidOption] when they are set.
+package jetstreamtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ErrNotSupported is returned for operations which are not supported by the
+// in-memory implementation.
+var ErrNotSupported = errors.New("jetstreamtest: operation not supported")
+
+type jetStream struct {
+	mu      sync.Mutex
+	streams map[string]*stream
+
+	// async publish stats
+	acks   uint64
+	errors uint64
+}
+
+// New returns an in-memory implementation of [jetstream.JetStream]. Each
+// call returns an independent instance without any streams.
+func New() jetstream.JetStream {
+	return &jetStream{streams: make(map[string]*stream)}
+}
+
+// AccountInfo returns usage of the in-memory account. Limits are not
+// enforced and reported as unlimited.
+func (js *jetStream) AccountInfo(_ context.Context) (*jetstream.AccountInfo, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	info := &jetstream.AccountInfo{
+		Tier: jetstream.Tier{
+			Limits: jetstream.AccountLimits{MaxMemory: -1, MaxStore: -1, MaxStreams: -1, MaxConsumers: -1},
+		},
+	}
+	for _, s := range js.streams {
+		info.Streams++
+		info.Consumers += len(s.consumers)
+		if s.cfg.Storage == jetstream.MemoryStorage {
+			info.Memory += s.bytes
+		} else {
+			info.Store += s.bytes
+		}
+	}
+	return info, nil
+}
+
+// Conn returns nil, as there is no underlying connection.
+func (js *jetStream) Conn() *nats.Conn {
+	return nil
+}
+
+// Options returns the default options.
+func (js *jetStream) Options() jetstream.JetStreamOptions {
+	return jetstream.JetStreamOptions{APIPrefix: jetstream.DefaultAPIPrefix}
+}
+
+// Advisories is not supported.
+func (js *jetStream) Advisories(_ context.Context, _ ...jetstream.AdvisoryOpt) (jetstream.AdvisoryWatcher, error) {
+	return nil, fmt.Errorf("%w: advisories", ErrNotSupported)
+}
+
+func (js *jetStream) CreateStream(_ context.Context, cfg jetstream.StreamConfig) (jetstream.Stream, error) {
+	if err := validateStreamName(cfg.Name); err != nil {
+		return nil, err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, err := js.createStream(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return s.handle(), nil
+}
+
+func (js *jetStream) UpdateStream(_ context.Context, cfg jetstream.StreamConfig) (jetstream.Stream, error) {
+	if err := validateStreamName(cfg.Name); err != nil {
+		return nil, err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[cfg.Name]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	if err := s.update(cfg); err != nil {
+		return nil, err
+	}
+	return s.handle(), nil
+}
+
+func (js *jetStream) CreateOrUpdateStream(ctx context.Context, cfg jetstream.StreamConfig) (jetstream.Stream, error) {
+	s, err := js.UpdateStream(ctx, cfg)
+	if err != nil {
+		if !errors.Is(err, jetstream.ErrStreamNotFound) {
+			return nil, err
+		}
+		return js.CreateStream(ctx, cfg)
+	}
+	return s, nil
+}
+
+func (js *jetStream) Stream(_ context.Context, name string) (jetstream.Stream, error) {
+	if err := validateStreamName(name); err != nil {
+		return nil, err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[name]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	return s.handle(), nil
+}
+
+func (js *jetStream) StreamNameBySubject(_ context.Context, subject string) (string, error) {
+	if err := validateSubject(subject); err != nil {
+		return "", err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	for _, s := range js.sortedStreams() {
+		if s.overlaps(subject) {
+			return s.cfg.Name, nil
+		}
+	}
+	return "", jetstream.ErrStreamNotFound
+}
+
+func (js *jetStream) DeleteStream(_ context.Context, name string) error {
+	if err := validateStreamName(name); err != nil {
+		return err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[name]
+	if !ok {
+		return jetstream.ErrStreamNotFound
+	}
+	delete(js.streams, name)
+	s.deleted = true
+	s.notify()
+	return nil
+}
+
+func (js *jetStream) ListStreams(_ context.Context, opts ...jetstream.StreamListOpt) jetstream.StreamInfoLister {
+	l := &streamLister{}
+	o, err := jetstream.ResolveStreamListOpts(opts...)
+	if err != nil {
+		l.err = err
+		l.infos = closedChan[*jetstream.StreamInfo]()
+		return l
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	streams := js.filterStreams(o.Subject)
+	l.infos = make(chan *jetstream.StreamInfo, len(streams))
+	for _, s := range streams {
+		l.infos <- s.info(jetstream.StreamInfoOptions{})
+	}
+	close(l.infos)
+	return l
+}
+
+func (js *jetStream) StreamNames(_ context.Context, opts ...jetstream.StreamListOpt) jetstream.StreamNameLister {
+	l := &streamLister{}
+	o, err := jetstream.ResolveStreamListOpts(opts...)
+	if err != nil {
+		l.err = err
+		l.names = closedChan[string]()
+		return l
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	streams := js.filterStreams(o.Subject)
+	l.names = make(chan string, len(streams))
+	for _, s := range streams {
+		l.names <- s.cfg.Name
+	}
+	close(l.names)
+	return l
+}
+
+// RestoreStream is not supported.
+func (js *jetStream) RestoreStream(_ context.Context, _ string, _ io.Reader, _ ...jetstream.RestoreOpt) (jetstream.Stream, error) {
+	return nil, fmt.Errorf("%w: stream restore", ErrNotSupported)
+}
+
+func (js *jetStream) CreateOrUpdateConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	return js.upsertConsumer(stream, cfg, actionCreateOrUpdate)
+}
+
+func (js *jetStream) CreateConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	return js.upsertConsumer(stream, cfg, actionCreate)
+}
+
+func (js *jetStream) UpdateConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	return js.upsertConsumer(stream, cfg, actionUpdate)
+}
+
+func (js *jetStream) OrderedConsumer(_ context.Context, stream string, cfg jetstream.OrderedConsumerConfig) (jetstream.Consumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	ccfg := jetstream.ConsumerConfig{
+		DeliverPolicy:     cfg.DeliverPolicy,
+		OptStartSeq:       cfg.OptStartSeq,
+		OptStartTime:      cfg.OptStartTime,
+		AckPolicy:         jetstream.AckNonePolicy,
+		MaxDeliver:        -1,
+		ReplayPolicy:      cfg.ReplayPolicy,
+		InactiveThreshold: cfg.InactiveThreshold,
+		HeadersOnly:       cfg.HeadersOnly,
+		MemoryStorage:     true,
+		Replicas:          1,
+		Metadata:          cfg.Metadata,
+	}
+	if len(cfg.FilterSubjects) == 1 {
+		ccfg.FilterSubject = cfg.FilterSubjects[0]
+	} else {
+		ccfg.FilterSubjects = cfg.FilterSubjects
+	}
+	return js.upsertConsumer(stream, ccfg, actionCreate)
+}
+
+func (js *jetStream) Consumer(_ context.Context, stream string, name string) (jetstream.Consumer, error) {
+	h, err := js.consumerHandle(stream, name, false)
+	if err != nil {
+		return nil, err
+	}
+	return &pullConsumer{h}, nil
+}
+
+func (js *jetStream) DeleteConsumer(_ context.Context, stream string, name string) error {
+	if err := validateStreamName(stream); err != nil {
+		return err
+	}
+	if err := validateConsumerName(name); err != nil {
+		return err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[stream]
+	if !ok {
+		return jetstream.ErrStreamNotFound
+	}
+	return s.deleteConsumer(name)
+}
+
+func (js *jetStream) CreateOrUpdatePushConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.PushConsumer, error) {
+	return js.upsertPushConsumer(stream, cfg, actionCreateOrUpdate)
+}
+
+func (js *jetStream) CreatePushConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.PushConsumer, error) {
+	return js.upsertPushConsumer(stream, cfg, actionCreate)
+}
+
+func (js *jetStream) UpdatePushConsumer(_ context.Context, stream string, cfg jetstream.ConsumerConfig) (jetstream.PushConsumer, error) {
+	return js.upsertPushConsumer(stream, cfg, actionUpdate)
+}
+
+func (js *jetStream) PushConsumer(_ context.Context, stream string, name string) (jetstream.PushConsumer, error) {
+	h, err := js.consumerHandle(stream, name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &pushConsumer{h}, nil
+}
+
+func (js *jetStream) upsertConsumer(stream string, cfg jetstream.ConsumerConfig, action consumerAction) (jetstream.Consumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[stream]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	c, err := s.upsertConsumer(cfg, action)
+	if err != nil {
+		return nil, err
+	}
+	return &pullConsumer{c.handle()}, nil
+}
+
+func (js *jetStream) upsertPushConsumer(stream string, cfg jetstream.ConsumerConfig, action consumerAction) (jetstream.PushConsumer, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	if cfg.DeliverSubject == "" {
+		return nil, jetstream.ErrNotPushConsumer
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[stream]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	c, err := s.upsertConsumer(cfg, action)
+	if err != nil {
+		return nil, err
+	}
+	return &pushConsumer{c.handle()}, nil
+}
+
+func (js *jetStream) consumerHandle(stream, name string, push bool) (*consumerHandle, error) {
+	if err := validateStreamName(stream); err != nil {
+		return nil, err
+	}
+	if err := validateConsumerName(name); err != nil {
+		return nil, err
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s, ok := js.streams[stream]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	c, ok := s.consumers[name]
+	if !ok {
+		return nil, jetstream.ErrConsumerNotFound
+	}
+	if push && !c.push {
+		return nil, jetstream.ErrNotPushConsumer
+	}
+	return c.handle(), nil
+}
+
+// createStream creates a stream with the provided config. Creating a stream
+// with the same config as an existing one returns the existing stream.
+func (js *jetStream) createStream(cfg jetstream.StreamConfig) (*stream, error) {
+	if cfg.Mirror != nil || len(cfg.Sources) > 0 {
+		return nil, fmt.Errorf("%w: mirrors and sources", ErrNotSupported)
+	}
+	if cfg.SubjectTransform != nil || cfg.RePublish != nil {
+		return nil, fmt.Errorf("%w: subject transforms and republish", ErrNotSupported)
+	}
+	cfg = normalizeStreamConfig(cfg)
+	if s, ok := js.streams[cfg.Name]; ok {
+		if !streamConfigEqual(s.cfg, cfg) {
+			return nil, jetstream.ErrStreamNameAlreadyInUse
+		}
+		return s, nil
+	}
+	if err := js.checkSubjectsOverlap(cfg); err != nil {
+		return nil, err
+	}
+	s := newStream(js, cfg)
+	js.streams[cfg.Name] = s
+	return s, nil
+}
+
+func (js *jetStream) checkSubjectsOverlap(cfg jetstream.StreamConfig) error {
+	for _, s := range js.streams {
+		if s.cfg.Name == cfg.Name {
+			continue
+		}
+		for _, subject := range cfg.Subjects {
+			if s.overlaps(subject) {
+				return apiError(400, 10065, "subjects overlap with an existing stream")
+			}
+		}
+	}
+	return nil
+}
+
+// streamForSubject returns the stream storing messages published on the
+// subject, or nil.
+func (js *jetStream) streamForSubject(subject string) *stream {
+	for _, s := range js.streams {
+		if s.matchesSubject(subject) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (js *jetStream) sortedStreams() []*stream {
+	streams := make([]*stream, 0, len(js.streams))
+	for _, s := range js.streams {
+		streams = append(streams, s)
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].cfg.Name < streams[j].cfg.Name
+	})
+	return streams
+}
+
+func (js *jetStream) filterStreams(subject string) []*stream {
+	var streams []*stream
+	for _, s := range js.sortedStreams() {
+		if subject == "" || s.overlaps(subject) {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
+
+type streamLister struct {
+	infos chan *jetstream.StreamInfo
+	names chan string
+	err   error
+}
+
+func (l *streamLister) Info() <-chan *jetstream.StreamInfo {
+	return l.infos
+}
+
+func (l *streamLister) Name() <-chan string {
+	return l.names
+}
+
+func (l *streamLister) Err() error {
+	return l.err
+}
+
+func closedChan[T any]() chan T {
+	ch := make(chan T)
+	close(ch)
+	return ch
+}
+
+// apiError returns an error as returned by the client when the server
+// responds to a request with an error.
+func apiError(code int, errCode jetstream.ErrorCode, description string) error {
+	return &jetstream.APIError{Code: code, ErrorCode: errCode, Description: description}
+}
+
+func validateStreamName(stream string) error {
+	if stream == "" {
+		return jetstream.ErrStreamNameRequired
+	}
+	if strings.ContainsAny(stream, ">*. /\\") {
+		return fmt.Errorf("%w: '%s'", jetstream.ErrInvalidStreamName, stream)
+	}
+	return nil
+}
+
+func validateConsumerName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: '%s'", jetstream.ErrInvalidConsumerName, "name is required")
+	}
+	if strings.ContainsAny(name, ">*. /\\") {
+		return fmt.Errorf("%w: '%s'", jetstream.ErrInvalidConsumerName, name)
+	}
+	return nil
+}
+
+func validateSubject(subject string) error {
+	if subject == "" {
+		return fmt.Errorf("%w: %s", jetstream.ErrInvalidSubject, "subject cannot be empty")
+	}
+	if subject[0] == '.' || subject[len(subject)-1] == '.' || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("%w: %s", jetstream.ErrInvalidSubject, subject)
+	}
+	return nil
+}
+
+// subjectMatchesFilter checks whether subject matches the filter, which may
+// contain wildcards.
+func subjectMatchesFilter(subject, filter string) bool {
+	subjectTokens := strings.Split(subject, ".")
+	filterTokens := strings.Split(filter, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(subjectTokens) == len(filterTokens)
+}
+
+// subjectsOverlap checks whether there is a subject matching both filters.
+func subjectsOverlap(a, b string) bool {
+	aTokens := strings.Split(a, ".")
+	bTokens := strings.Split(b, ".")
+	for i := 0; i < len(aTokens) && i < len(bTokens); i++ {
+		if aTokens[i] == ">" || bTokens[i] == ">" {
+			return true
+		}
+		if aTokens[i] != bTokens[i] && aTokens[i] != "*" && bTokens[i] != "*" {
+			return false
+		}
+	}
+	return len(aTokens) == len(bTokens)
+}
+
+// Publish publishes a message to the stream with subjects matching the
+// subject and returns the PubAck. If no stream matches,
+// [jetstream.ErrNoStreamResponse] is returned.
+func (js *jetStream) Publish(ctx context.Context, subject string, payload []byte, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	return js.PublishMsg(ctx, &nats.Msg{Subject: subject, Data: payload}, opts...)
+}
+
+func (js *jetStream) PublishMsg(_ context.Context, m *nats.Msg, opts ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	if len(opts) > 0 {
+		o, err := jetstream.ResolvePublishOpts(m, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if o.AckHandler != nil {
+			return nil, fmt.Errorf("%w: ack handler cannot be set to sync publish", jetstream.ErrInvalidOption)
+		}
+	}
+	return js.publish(m)
+}
+
+// PublishAsync publishes the message synchronously, returning a completed
+// [jetstream.PubAckFuture].
+func (js *jetStream) PublishAsync(subject string, payload []byte, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	return js.PublishMsgAsync(&nats.Msg{Subject: subject, Data: payload}, opts...)
+}
+
+func (js *jetStream) PublishMsgAsync(m *nats.Msg, opts ...jetstream.PublishOpt) (jetstream.PubAckFuture, error) {
+	if m.Reply != "" {
+		return nil, jetstream.ErrAsyncPublishReplySubjectSet
+	}
+	var o jetstream.PublishOptions
+	if len(opts) > 0 {
+		var err error
+		if o, err = jetstream.ResolvePublishOpts(m, opts...); err != nil {
+			return nil, err
+		}
+	}
+	ack, err := js.publish(m)
+	js.mu.Lock()
+	if err != nil {
+		js.errors++
+	} else {
+		js.acks++
+	}
+	js.mu.Unlock()
+
+	paf := &pubAckFuture{msg: m, ok: make(chan *jetstream.PubAck, 1), err: make(chan error, 1)}
+	if err != nil {
+		paf.err <- err
+	} else {
+		paf.ok <- ack
+	}
+	if o.AckHandler != nil {
+		o.AckHandler(ack, err)
+	}
+	return paf, nil
+}
+
+// PublishAsyncPending always returns 0, as async publishes complete
+// synchronously.
+func (js *jetStream) PublishAsyncPending() int {
+	return 0
+}
+
+// PublishAsyncComplete returns a closed channel, as async publishes
+// complete synchronously.
+func (js *jetStream) PublishAsyncComplete() <-chan struct{} {
+	return closedChan[struct{}]()
+}
+
+func (js *jetStream) PublishAsyncStats() jetstream.PublishAsyncStats {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return jetstream.PublishAsyncStats{
+		Acks:   js.acks,
+		Errors: js.errors,
+	}
+}
+
+func (js *jetStream) CleanupPublisher() {}
+
+func (js *jetStream) publish(m *nats.Msg) (*jetstream.PubAck, error) {
+	if m.Subject == "" {
+		return nil, nats.ErrBadSubject
+	}
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	s := js.streamForSubject(m.Subject)
+	if s == nil {
+		return nil, jetstream.ErrNoStreamResponse
+	}
+	ack, err := s.store(m.Subject, m.Header, m.Data, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("nats: %w", err)
+	}
+	return ack, nil
+}
+
+type pubAckFuture struct {
+	msg *nats.Msg
+	ok  chan *jetstream.PubAck
+	err chan error
+}
+
+func (paf *pubAckFuture) Ok() <-chan *jetstream.PubAck {
+	return paf.ok
+}
+
+func (paf *pubAckFuture) Err() <-chan error {
+	return paf.err
+}
+
+func (paf *pubAckFuture) Msg() *nats.Msg {
+	return paf.msg
+}
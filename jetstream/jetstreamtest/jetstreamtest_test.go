@@ -0,0 +1,627 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestRetentionPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("limits with max msgs per subject", func(t *testing.T) {
+		js := New()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO.*"}, MaxMsgsPerSubject: 2})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte("a")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if _, err := js.Publish(ctx, "FOO.B", []byte("b")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := s.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.State.Msgs != 3 || info.State.FirstSeq != 4 || info.State.LastSeq != 6 {
+			t.Fatalf("Unexpected state: %+v", info.State)
+		}
+	})
+
+	t.Run("work queue", func(t *testing.T) {
+		js := New()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO.*"}, Retention: jetstream.WorkQueuePolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "cons", AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "other", AckPolicy: jetstream.AckExplicitPolicy}); err == nil {
+			t.Fatalf("Expected error creating second unfiltered consumer")
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte("a")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		msgs, err := c.FetchNoWait(3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for msg := range msgs.Messages() {
+			if err := msg.Ack(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		info, err := s.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.State.Msgs != 0 {
+			t.Fatalf("Expected acked messages to be removed; got %d", info.State.Msgs)
+		}
+	})
+
+	t.Run("interest", func(t *testing.T) {
+		js := New()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}, Retention: jetstream.InterestPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// no consumers, message is not retained
+		if _, err := js.Publish(ctx, "FOO", []byte("a")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c1, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "c1", AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c2, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "c2", AckPolicy: jetstream.AckExplicitPolicy})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO", []byte("b")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectMsgs := func(expected uint64) {
+			t.Helper()
+			info, err := s.Info(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if info.State.Msgs != expected {
+				t.Fatalf("Expected %d messages; got %d", expected, info.State.Msgs)
+			}
+		}
+		expectMsgs(1)
+		for _, c := range []jetstream.Consumer{c1, c2} {
+			msg, err := c.Next(jetstream.FetchMaxWait(time.Second))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := msg.Ack(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		expectMsgs(0)
+	})
+}
+
+func TestDeduplication(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ack, err := js.Publish(ctx, "FOO", []byte("a"), jetstream.WithMsgID("1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ack.Duplicate {
+		t.Fatalf("Expected first message not to be a duplicate")
+	}
+	ack, err = js.Publish(ctx, "FOO", []byte("a"), jetstream.WithMsgID("1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !ack.Duplicate || ack.Sequence != 1 {
+		t.Fatalf("Expected duplicate of sequence 1; got %+v", ack)
+	}
+
+	_, err = js.Publish(ctx, "FOO", []byte("b"), jetstream.WithExpectLastSequence(5))
+	var apiErr *jetstream.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != jetstream.JSErrCodeStreamWrongLastSequence {
+		t.Fatalf("Expected wrong last sequence error; got %v", err)
+	}
+}
+
+func TestAckNakRedelivery(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c, err := js.CreateConsumer(ctx, "TEST", jetstream.ConsumerConfig{
+		Durable:    "cons",
+		AckPolicy:  jetstream.AckExplicitPolicy,
+		AckWait:    50 * time.Millisecond,
+		MaxDeliver: 3,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.Publish(ctx, "FOO", []byte("a")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	msg, err := c.Next(jetstream.FetchMaxWait(time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := msg.Nak(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := msg.Ack(); !errors.Is(err, jetstream.ErrMsgAlreadyAckd) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrMsgAlreadyAckd, err)
+	}
+
+	// redelivered after nak
+	msg, err = c.Next(jetstream.FetchMaxWait(time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if meta.NumDelivered != 2 {
+		t.Fatalf("Expected 2 deliveries; got %d", meta.NumDelivered)
+	}
+
+	// redelivered after ack wait, not acked
+	start := time.Now()
+	msg, err = c.Next(jetstream.FetchMaxWait(time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatalf("Expected redelivery after ack wait")
+	}
+	meta, _ = msg.Metadata()
+	if meta.NumDelivered != 3 {
+		t.Fatalf("Expected 3 deliveries; got %d", meta.NumDelivered)
+	}
+
+	// max deliver reached
+	if _, err := c.Next(jetstream.FetchMaxWait(200 * time.Millisecond)); !errors.Is(err, nats.ErrTimeout) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrTimeout, err)
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.NumAckPending != 0 || info.NumPending != 0 {
+		t.Fatalf("Unexpected consumer info: %+v", info)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c, err := js.CreateConsumer(ctx, "TEST", jetstream.ConsumerConfig{
+		Durable:       "cons",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		FilterSubject: "FOO.A",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	received := make(chan string, 10)
+	cc, err := c.Consume(func(msg jetstream.Msg) {
+		received <- string(msg.Data())
+		msg.Ack()
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer cc.Stop()
+	for i := 0; i < 3; i++ {
+		if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("a%d", i))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.B", []byte("b")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case data := <-received:
+			if data != fmt.Sprintf("a%d", i) {
+				t.Fatalf("Unexpected message: %q", data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for messages")
+		}
+	}
+	cc.Stop()
+	select {
+	case <-cc.Closed():
+	case <-time.After(time.Second):
+		t.Fatalf("Consume context not closed")
+	}
+	if stats := cc.Stats(); stats.Delivered != 3 || stats.Acked != 3 || stats.Redelivered != 0 {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+}
+
+func TestConsumeUnsupportedOptions(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	c, err := js.CreateConsumer(ctx, "TEST", jetstream.ConsumerConfig{Durable: "cons", AckPolicy: jetstream.AckExplicitPolicy})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for name, opt := range map[string]jetstream.PullConsumeOpt{
+		"workers":          jetstream.WithConsumeWorkers(2, nil),
+		"auto in progress": jetstream.WithAutoInProgress(time.Second),
+		"dead letter":      jetstream.WithDeadLetter("DLQ"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.Consume(func(jetstream.Msg) {}, opt); !errors.Is(err, jetstream.ErrInvalidOption) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+			}
+		})
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TEST", History: 5})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w, err := kv.WatchAll(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer w.Stop()
+	expectUpdate := func(key string, revision uint64, op jetstream.KeyValueOp) {
+		t.Helper()
+		select {
+		case entry := <-w.Updates():
+			if key == "" {
+				if entry != nil {
+					t.Fatalf("Expected nil marker; got %v", entry)
+				}
+				return
+			}
+			if entry.Key() != key || entry.Revision() != revision || entry.Operation() != op {
+				t.Fatalf("Unexpected entry: %s %d %s", entry.Key(), entry.Revision(), entry.Operation())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for update")
+		}
+	}
+	expectUpdate("", 0, 0)
+
+	rev, err := kv.Put(ctx, "name", []byte("derek"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rev != 1 {
+		t.Fatalf("Expected revision 1; got %d", rev)
+	}
+	expectUpdate("name", 1, jetstream.KeyValuePut)
+	if _, err := kv.Create(ctx, "name", []byte("ivan")); !errors.Is(err, jetstream.ErrKeyExists) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrKeyExists, err)
+	}
+	if _, err := kv.Update(ctx, "name", []byte("ivan"), 5); !errors.Is(err, jetstream.ErrKeyExists) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrKeyExists, err)
+	}
+	if rev, err = kv.Update(ctx, "name", []byte("ivan"), 1); err != nil || rev != 2 {
+		t.Fatalf("Unexpected update result: %d, %v", rev, err)
+	}
+	expectUpdate("name", 2, jetstream.KeyValuePut)
+	if err := kv.Delete(ctx, "name"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectUpdate("name", 3, jetstream.KeyValueDelete)
+	if _, err := kv.Get(ctx, "name"); !errors.Is(err, jetstream.ErrKeyNotFound) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrKeyNotFound, err)
+	}
+	if rev, err = kv.Create(ctx, "name", []byte("derek")); err != nil || rev != 4 {
+		t.Fatalf("Unexpected create result: %d, %v", rev, err)
+	}
+	expectUpdate("name", 4, jetstream.KeyValuePut)
+
+	history, err := kv.History(ctx, "name")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("Expected 4 history entries; got %d", len(history))
+	}
+	if err := kv.Purge(ctx, "name"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectUpdate("name", 5, jetstream.KeyValuePurge)
+	if history, err = kv.History(ctx, "name"); err != nil || len(history) != 1 {
+		t.Fatalf("Expected only purge marker in history; got %d, %v", len(history), err)
+	}
+	if _, err := kv.Keys(ctx); !errors.Is(err, jetstream.ErrNoKeysFound) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNoKeysFound, err)
+	}
+}
+
+func TestKeyValueUpdateFunc(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TEST"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Run("concurrent increments", func(t *testing.T) {
+		const workers, increments = 5, 20
+		errs := make(chan error, workers)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < increments; j++ {
+					if _, err := jetstream.IncrementCounter(ctx, kv, "counter", 1); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		v, err := jetstream.GetCounter(ctx, kv, "counter")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if v != workers*increments {
+			t.Fatalf("Expected counter to be %d; got %d", workers*increments, v)
+		}
+	})
+
+	t.Run("deleted key", func(t *testing.T) {
+		if _, err := kv.PutString(ctx, "deleted", "5"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := kv.Delete(ctx, "deleted"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var calledWithNil bool
+		rev, err := kv.UpdateFunc(ctx, "deleted", func(entry jetstream.KeyValueEntry) ([]byte, error) {
+			calledWithNil = entry == nil
+			return []byte("1"), nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !calledWithNil {
+			t.Fatalf("Expected nil entry for deleted key")
+		}
+		entry, err := kv.Get(ctx, "deleted")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if entry.Revision() != rev || string(entry.Value()) != "1" {
+			t.Fatalf("Unexpected entry: %d %q", entry.Revision(), entry.Value())
+		}
+	})
+
+	t.Run("fn error", func(t *testing.T) {
+		rev, err := kv.PutString(ctx, "invalid", "abc")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := jetstream.IncrementCounter(ctx, kv, "invalid", 1); !errors.Is(err, jetstream.ErrInvalidCounter) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidCounter, err)
+		}
+		entry, err := kv.Get(ctx, "invalid")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if entry.Revision() != rev || string(entry.Value()) != "abc" {
+			t.Fatalf("Expected value to be unchanged; got %d %q", entry.Revision(), entry.Value())
+		}
+	})
+}
+
+func TestKeyValueCache(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TEST"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := kv.PutString(ctx, "a", "1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := kv.PutString(ctx, "other", "x"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	changes := make(chan jetstream.KeyValueEntry, 10)
+	cache, err := kv.Cache(ctx,
+		jetstream.CacheKeys("a", "b"),
+		jetstream.CacheChangeHandler(func(entry jetstream.KeyValueEntry) { changes <- entry }))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer cache.Stop()
+	if entry, err := cache.Get("a"); err != nil || string(entry.Value()) != "1" {
+		t.Fatalf("Unexpected cached value: %v", err)
+	}
+	if _, err := cache.Get("other"); !errors.Is(err, jetstream.ErrKeyNotFound) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrKeyNotFound, err)
+	}
+	if cache.Stale() {
+		t.Fatalf("Expected cache not to be stale")
+	}
+
+	rev, err := kv.PutString(ctx, "b", "2")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cache.WaitForRevision(ctx, rev); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entry, err := cache.Get("b"); err != nil || entry.Revision() != rev {
+		t.Fatalf("Unexpected cached value: %v", err)
+	}
+	select {
+	case entry := <-changes:
+		if entry.Key() != "b" {
+			t.Fatalf("Unexpected change: %s", entry.Key())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive change")
+	}
+
+	if err := kv.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := cache.WaitForRevision(ctx, rev+1); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if keys := cache.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Fatalf("Unexpected keys: %v", keys)
+	}
+
+	if err := cache.Stop(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cache.Stale() {
+		t.Fatalf("Expected cache to be stale after stop")
+	}
+	if err := cache.WaitForRevision(ctx, rev+10); !errors.Is(err, jetstream.ErrKeyValueCacheStopped) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrKeyValueCacheStopped, err)
+	}
+}
+
+func TestObjectStore(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	obs, err := js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "OBJS"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	info, err := obs.Put(ctx, jetstream.ObjectMeta{
+		Name: "blob",
+		Opts: &jetstream.ObjectMetaOptions{ChunkSize: 1024},
+	}, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if info.Chunks != 10 || info.Size != uint64(len(data)) {
+		t.Fatalf("Unexpected object info: %+v", info)
+	}
+	res, err := obs.GetBytes(ctx, "blob")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(res, data) {
+		t.Fatalf("Unexpected object data")
+	}
+
+	// replacing the object purges old chunks
+	if _, err := obs.PutString(ctx, "blob", "small"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := obs.Status(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if msgs := status.(interface{ StreamInfo() *jetstream.StreamInfo }).StreamInfo().State.Msgs; msgs != 2 {
+		t.Fatalf("Expected 2 messages (chunk and meta); got %d", msgs)
+	}
+
+	if err := obs.Delete(ctx, "blob"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := obs.GetBytes(ctx, "blob"); !errors.Is(err, jetstream.ErrObjectNotFound) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrObjectNotFound, err)
+	}
+	if _, err := obs.List(ctx); !errors.Is(err, jetstream.ErrNoObjectsFound) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNoObjectsFound, err)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	js := New()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ob, err := jetstream.NewOutbox(js, jetstream.OutboxConfig{Path: filepath.Join(t.TempDir(), "outbox.log")})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer ob.Close()
+
+	paf, err := ob.Publish("FOO.A", []byte("msg"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case ack := <-paf.Ok():
+		if ack.Stream != "foo" || ack.Sequence != 1 {
+			t.Fatalf("Invalid ack: %+v", ack)
+		}
+	case err := <-paf.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting for ack")
+	}
+	deadline := time.Now().Add(time.Second)
+	for ob.Pending() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected no pending messages; got %d", ob.Pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,676 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type (
+	// kv implements jetstream.KeyValue on top of a KV_<bucket> stream,
+	// using the same subjects and headers as the client.
+	kv struct {
+		js     *jetStream
+		name   string
+		stream *streamHandle
+		pre    string
+	}
+
+	kvEntry struct {
+		bucket   string
+		key      string
+		value    []byte
+		revision uint64
+		delta    uint64
+		created  time.Time
+		op       jetstream.KeyValueOp
+	}
+
+	kvLister struct {
+		statuses chan jetstream.KeyValueStatus
+		names    chan string
+		err      error
+	}
+
+	keyLister struct {
+		watcher jetstream.KeyWatcher
+		keys    chan string
+	}
+)
+
+const (
+	kvBucketNamePre   = "KV_"
+	kvBucketNameTmpl  = "KV_%s"
+	kvSubjectsTmpl    = "$KV.%s.>"
+	kvSubjectsPreTmpl = "$KV.%s."
+
+	kvop    = "KV-Operation"
+	kvdel   = "DEL"
+	kvpurge = "PURGE"
+
+	kvDefaultPurgeDeletesMarkerThreshold = 30 * time.Minute
+)
+
+var (
+	validBucketRe    = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	validKeyRe       = regexp.MustCompile(`^[-/_=\.a-zA-Z0-9]+$`)
+	validSearchKeyRe = regexp.MustCompile(`^[-/_=\.a-zA-Z0-9*]*[>]?$`)
+)
+
+func (js *jetStream) KeyValue(ctx context.Context, bucket string) (jetstream.KeyValue, error) {
+	if !bucketValid(bucket) {
+		return nil, jetstream.ErrInvalidBucketName
+	}
+	s, err := js.Stream(ctx, fmt.Sprintf(kvBucketNameTmpl, bucket))
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = jetstream.ErrBucketNotFound
+		}
+		return nil, err
+	}
+	if s.CachedInfo().Config.MaxMsgsPerSubject < 1 {
+		return nil, jetstream.ErrBadBucket
+	}
+	return js.newKV(s), nil
+}
+
+func (js *jetStream) CreateKeyValue(ctx context.Context, cfg jetstream.KeyValueConfig) (jetstream.KeyValue, error) {
+	scfg, err := prepareKeyValueConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := js.CreateStream(ctx, scfg)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+			err = errors.Join(fmt.Errorf("%w: %s", jetstream.ErrBucketExists, cfg.Bucket), err)
+		}
+		return nil, err
+	}
+	return js.newKV(s), nil
+}
+
+func (js *jetStream) UpdateKeyValue(ctx context.Context, cfg jetstream.KeyValueConfig) (jetstream.KeyValue, error) {
+	scfg, err := prepareKeyValueConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := js.UpdateStream(ctx, scfg)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = fmt.Errorf("%w: %s", jetstream.ErrBucketNotFound, cfg.Bucket)
+		}
+		return nil, err
+	}
+	return js.newKV(s), nil
+}
+
+func (js *jetStream) CreateOrUpdateKeyValue(ctx context.Context, cfg jetstream.KeyValueConfig) (jetstream.KeyValue, error) {
+	scfg, err := prepareKeyValueConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := js.CreateOrUpdateStream(ctx, scfg)
+	if err != nil {
+		return nil, err
+	}
+	return js.newKV(s), nil
+}
+
+// prepareKeyValueConfig creates the stream config the same way the client
+// does.
+func prepareKeyValueConfig(cfg jetstream.KeyValueConfig) (jetstream.StreamConfig, error) {
+	if !bucketValid(cfg.Bucket) {
+		return jetstream.StreamConfig{}, jetstream.ErrInvalidBucketName
+	}
+	if cfg.Mirror != nil || len(cfg.Sources) > 0 {
+		return jetstream.StreamConfig{}, fmt.Errorf("%w: mirrors and sources", ErrNotSupported)
+	}
+	history := int64(1)
+	if cfg.History > 0 {
+		if cfg.History > jetstream.KeyValueMaxHistory {
+			return jetstream.StreamConfig{}, jetstream.ErrHistoryTooLarge
+		}
+		history = int64(cfg.History)
+	}
+	replicas := cfg.Replicas
+	if replicas == 0 {
+		replicas = 1
+	}
+	maxBytes := cfg.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = -1
+	}
+	maxMsgSize := cfg.MaxValueSize
+	if maxMsgSize == 0 {
+		maxMsgSize = -1
+	}
+	duplicateWindow := 2 * time.Minute
+	if cfg.TTL > 0 && cfg.TTL < duplicateWindow {
+		duplicateWindow = cfg.TTL
+	}
+	var compression jetstream.StoreCompression
+	if cfg.Compression {
+		compression = jetstream.S2Compression
+	}
+	return jetstream.StreamConfig{
+		Name:              fmt.Sprintf(kvBucketNameTmpl, cfg.Bucket),
+		Description:       cfg.Description,
+		Subjects:          []string{fmt.Sprintf(kvSubjectsTmpl, cfg.Bucket)},
+		MaxMsgsPerSubject: history,
+		MaxBytes:          maxBytes,
+		MaxAge:            cfg.TTL,
+		MaxMsgSize:        maxMsgSize,
+		Storage:           cfg.Storage,
+		Replicas:          replicas,
+		Placement:         cfg.Placement,
+		AllowRollup:       true,
+		DenyDelete:        true,
+		Duplicates:        duplicateWindow,
+		MaxMsgs:           -1,
+		MaxConsumers:      -1,
+		AllowDirect:       true,
+		RePublish:         cfg.RePublish,
+		Compression:       compression,
+		Discard:           jetstream.DiscardNew,
+	}, nil
+}
+
+func (js *jetStream) DeleteKeyValue(ctx context.Context, bucket string) error {
+	if !bucketValid(bucket) {
+		return jetstream.ErrInvalidBucketName
+	}
+	if err := js.DeleteStream(ctx, fmt.Sprintf(kvBucketNameTmpl, bucket)); err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = errors.Join(fmt.Errorf("%w: %s", jetstream.ErrBucketNotFound, bucket), err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (js *jetStream) KeyValueStoreNames(_ context.Context) jetstream.KeyValueNamesLister {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	streams := js.filterStreams(fmt.Sprintf(kvSubjectsTmpl, "*"))
+	l := &kvLister{names: make(chan string, len(streams))}
+	for _, s := range streams {
+		if strings.HasPrefix(s.cfg.Name, kvBucketNamePre) {
+			l.names <- strings.TrimPrefix(s.cfg.Name, kvBucketNamePre)
+		}
+	}
+	close(l.names)
+	return l
+}
+
+func (js *jetStream) KeyValueStores(_ context.Context) jetstream.KeyValueLister {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	streams := js.filterStreams(fmt.Sprintf(kvSubjectsTmpl, "*"))
+	l := &kvLister{statuses: make(chan jetstream.KeyValueStatus, len(streams))}
+	for _, s := range streams {
+		if strings.HasPrefix(s.cfg.Name, kvBucketNamePre) {
+			l.statuses <- jetstream.NewKeyValueBucketStatus(s.info(jetstream.StreamInfoOptions{}), strings.TrimPrefix(s.cfg.Name, kvBucketNamePre))
+		}
+	}
+	close(l.statuses)
+	return l
+}
+
+func (js *jetStream) newKV(s jetstream.Stream) *kv {
+	name := s.CachedInfo().Config.Name
+	bucket := strings.TrimPrefix(name, kvBucketNamePre)
+	return &kv{
+		js:     js,
+		name:   bucket,
+		stream: &streamHandle{js: js, name: name},
+		pre:    fmt.Sprintf(kvSubjectsPreTmpl, bucket),
+	}
+}
+
+func bucketValid(bucket string) bool {
+	return len(bucket) > 0 && validBucketRe.MatchString(bucket)
+}
+
+func keyValid(key string) bool {
+	if len(key) == 0 || key[0] == '.' || key[len(key)-1] == '.' {
+		return false
+	}
+	return validKeyRe.MatchString(key)
+}
+
+func searchKeyValid(key string) bool {
+	if len(key) == 0 || key[0] == '.' || key[len(key)-1] == '.' {
+		return false
+	}
+	return validSearchKeyRe.MatchString(key)
+}
+
+func (kv *kv) get(ctx context.Context, key string, revision uint64) (jetstream.KeyValueEntry, error) {
+	if !keyValid(key) {
+		return nil, jetstream.ErrInvalidKey
+	}
+	subject := kv.pre + key
+	var m *jetstream.RawStreamMsg
+	var err error
+	if revision == 0 {
+		m, err = kv.stream.GetLastMsgForSubject(ctx, subject)
+	} else {
+		m, err = kv.stream.GetMsg(ctx, revision)
+		if err == nil && m.Subject != subject {
+			return nil, jetstream.ErrKeyNotFound
+		}
+	}
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			err = jetstream.ErrKeyNotFound
+		}
+		return nil, err
+	}
+	entry := &kvEntry{
+		bucket:   kv.name,
+		key:      key,
+		value:    m.Data,
+		revision: m.Sequence,
+		created:  m.Time,
+		op:       kvOperation(m.Header),
+	}
+	if entry.op != jetstream.KeyValuePut {
+		return entry, jetstream.ErrKeyDeleted
+	}
+	return entry, nil
+}
+
+func kvOperation(hdr nats.Header) jetstream.KeyValueOp {
+	switch hdr.Get(kvop) {
+	case kvdel:
+		return jetstream.KeyValueDelete
+	case kvpurge:
+		return jetstream.KeyValuePurge
+	}
+	return jetstream.KeyValuePut
+}
+
+func (kv *kv) Get(ctx context.Context, key string) (jetstream.KeyValueEntry, error) {
+	e, err := kv.get(ctx, key, 0)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyDeleted) {
+			return nil, jetstream.ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+func (kv *kv) GetRevision(ctx context.Context, key string, revision uint64) (jetstream.KeyValueEntry, error) {
+	e, err := kv.get(ctx, key, revision)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyDeleted) {
+			return nil, jetstream.ErrKeyNotFound
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+func (kv *kv) Put(ctx context.Context, key string, value []byte) (uint64, error) {
+	if !keyValid(key) {
+		return 0, jetstream.ErrInvalidKey
+	}
+	pa, err := kv.js.Publish(ctx, kv.pre+key, value)
+	if err != nil {
+		return 0, err
+	}
+	return pa.Sequence, nil
+}
+
+func (kv *kv) PutString(ctx context.Context, key string, value string) (uint64, error) {
+	return kv.Put(ctx, key, []byte(value))
+}
+
+func (kv *kv) Create(ctx context.Context, key string, value []byte) (uint64, error) {
+	v, err := kv.Update(ctx, key, value, 0)
+	if err == nil {
+		return v, nil
+	}
+	if e, err := kv.get(ctx, key, 0); errors.Is(err, jetstream.ErrKeyDeleted) {
+		return kv.Update(ctx, key, value, e.Revision())
+	}
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return 0, fmt.Errorf("%w: %s", err, "key exists")
+	}
+	return 0, err
+}
+
+func (kv *kv) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	if !keyValid(key) {
+		return 0, jetstream.ErrInvalidKey
+	}
+	m := nats.Msg{Subject: kv.pre + key, Header: nats.Header{}, Data: value}
+	m.Header.Set(jetstream.ExpectedLastSubjSeqHeader, strconv.FormatUint(revision, 10))
+	pa, err := kv.js.PublishMsg(ctx, &m)
+	if err != nil {
+		return 0, err
+	}
+	return pa.Sequence, nil
+}
+
+func (kv *kv) UpdateFunc(ctx context.Context, key string, fn func(entry jetstream.KeyValueEntry) ([]byte, error)) (uint64, error) {
+	if !keyValid(key) {
+		return 0, jetstream.ErrInvalidKey
+	}
+	backoff := time.Millisecond
+	for {
+		revision, err := kv.updateFunc(ctx, key, fn)
+		if !errors.Is(err, jetstream.ErrKeyExists) {
+			return revision, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 100*time.Millisecond)
+	}
+}
+
+func (kv *kv) updateFunc(ctx context.Context, key string, fn func(entry jetstream.KeyValueEntry) ([]byte, error)) (uint64, error) {
+	var last uint64
+	entry, err := kv.get(ctx, key, 0)
+	switch {
+	case err == nil:
+		last = entry.Revision()
+	case errors.Is(err, jetstream.ErrKeyDeleted):
+		last = entry.Revision()
+		entry = nil
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+		entry = nil
+	default:
+		return 0, err
+	}
+	value, err := fn(entry)
+	if err != nil {
+		return 0, err
+	}
+	return kv.Update(ctx, key, value, last)
+}
+
+func (kv *kv) Delete(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	if !keyValid(key) {
+		return jetstream.ErrInvalidKey
+	}
+	o, err := jetstream.ResolveKVDeleteOpts(opts...)
+	if err != nil {
+		return err
+	}
+	return kv.delete(ctx, key, o)
+}
+
+func (kv *kv) delete(ctx context.Context, key string, o jetstream.KVDeleteOptions) error {
+	m := nats.NewMsg(kv.pre + key)
+	if o.Purge {
+		m.Header.Set(kvop, kvpurge)
+		m.Header.Set(jetstream.MsgRollup, jetstream.MsgRollupSubject)
+	} else {
+		m.Header.Set(kvop, kvdel)
+	}
+	if o.Revision != 0 {
+		m.Header.Set(jetstream.ExpectedLastSubjSeqHeader, strconv.FormatUint(o.Revision, 10))
+	}
+	_, err := kv.js.PublishMsg(ctx, m)
+	return err
+}
+
+func (kv *kv) Purge(ctx context.Context, key string, opts ...jetstream.KVDeleteOpt) error {
+	if !keyValid(key) {
+		return jetstream.ErrInvalidKey
+	}
+	o, err := jetstream.ResolveKVDeleteOpts(opts...)
+	if err != nil {
+		return err
+	}
+	o.Purge = true
+	return kv.delete(ctx, key, o)
+}
+
+func (kv *kv) WatchFiltered(ctx context.Context, keys []string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	for _, key := range keys {
+		if !searchKeyValid(key) {
+			return nil, fmt.Errorf("%w: %s", jetstream.ErrInvalidKey, "key cannot be empty and must be a valid NATS subject")
+		}
+	}
+	o, err := jetstream.ResolveWatchOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]string, 0, len(keys))
+	for _, key := range keys {
+		filters = append(filters, kv.pre+key)
+	}
+	if len(filters) == 0 {
+		filters = append(filters, kv.pre+jetstream.AllKeys)
+	}
+
+	kv.js.mu.Lock()
+	defer kv.js.mu.Unlock()
+	s, err := kv.stream.stream()
+	if err != nil {
+		return nil, err
+	}
+	return newFollower(ctx, s, filters, o, 256, func(m *storedMsg, delta uint64) (jetstream.KeyValueEntry, bool) {
+		e := kv.entry(m, delta, o)
+		return e, e != nil
+	}), nil
+}
+
+// entry converts a stored message to an entry, returning nil for delete
+// markers if they are ignored.
+func (kv *kv) entry(m *storedMsg, delta uint64, o jetstream.WatchOptions) *kvEntry {
+	op := kvOperation(m.header)
+	if o.IgnoreDeletes && op != jetstream.KeyValuePut {
+		return nil
+	}
+	e := &kvEntry{
+		bucket:   kv.name,
+		key:      m.subject[len(kv.pre):],
+		revision: m.seq,
+		created:  m.time,
+		delta:    delta,
+		op:       op,
+	}
+	if !o.MetaOnly {
+		e.value = append([]byte(nil), m.data...)
+	}
+	return e
+}
+
+func (kv *kv) Watch(ctx context.Context, keys string, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	return kv.WatchFiltered(ctx, []string{keys}, opts...)
+}
+
+func (kv *kv) WatchAll(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyWatcher, error) {
+	return kv.Watch(ctx, jetstream.AllKeys, opts...)
+}
+
+func (kv *kv) Cache(ctx context.Context, opts ...jetstream.KVCacheOpt) (jetstream.KeyValueCache, error) {
+	return jetstream.NewKeyValueCache(ctx, kv, opts...)
+}
+
+func (kv *kv) Keys(ctx context.Context, opts ...jetstream.WatchOpt) ([]string, error) {
+	opts = append(opts, jetstream.IgnoreDeletes(), jetstream.MetaOnly())
+	watcher, err := kv.WatchAll(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Stop()
+
+	var keys []string
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		keys = append(keys, entry.Key())
+	}
+	if len(keys) == 0 {
+		return nil, jetstream.ErrNoKeysFound
+	}
+	return keys, nil
+}
+
+func (kv *kv) ListKeys(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.KeyLister, error) {
+	opts = append(opts, jetstream.IgnoreDeletes(), jetstream.MetaOnly())
+	watcher, err := kv.WatchAll(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyLister(ctx, watcher), nil
+}
+
+func (kv *kv) ListKeysFiltered(ctx context.Context, filters ...string) (jetstream.KeyLister, error) {
+	watcher, err := kv.WatchFiltered(ctx, filters)
+	if err != nil {
+		return nil, err
+	}
+	return newKeyLister(ctx, watcher), nil
+}
+
+func newKeyLister(ctx context.Context, watcher jetstream.KeyWatcher) *keyLister {
+	kl := &keyLister{watcher: watcher, keys: make(chan string, 256)}
+	go func() {
+		defer close(kl.keys)
+		defer watcher.Stop()
+		for {
+			select {
+			case entry := <-watcher.Updates():
+				if entry == nil {
+					return
+				}
+				kl.keys <- entry.Key()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return kl
+}
+
+func (kl *keyLister) Keys() <-chan string {
+	return kl.keys
+}
+
+func (kl *keyLister) Stop() error {
+	return kl.watcher.Stop()
+}
+
+func (kv *kv) History(ctx context.Context, key string, opts ...jetstream.WatchOpt) ([]jetstream.KeyValueEntry, error) {
+	opts = append(opts, jetstream.IncludeHistory())
+	watcher, err := kv.Watch(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Stop()
+
+	var entries []jetstream.KeyValueEntry
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, jetstream.ErrKeyNotFound
+	}
+	return entries, nil
+}
+
+func (kv *kv) Bucket() string {
+	return kv.name
+}
+
+func (kv *kv) PurgeDeletes(ctx context.Context, opts ...jetstream.KVPurgeOpt) error {
+	o, err := jetstream.ResolveKVPurgeOpts(opts...)
+	if err != nil {
+		return err
+	}
+	watcher, err := kv.WatchAll(ctx)
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	var limit time.Time
+	olderThan := o.DeleteMarkersOlderThan
+	if olderThan == 0 {
+		olderThan = kvDefaultPurgeDeletesMarkerThreshold
+	}
+	if olderThan > 0 {
+		limit = time.Now().Add(-olderThan)
+	}
+
+	var deleteMarkers []jetstream.KeyValueEntry
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		if op := entry.Operation(); op == jetstream.KeyValueDelete || op == jetstream.KeyValuePurge {
+			deleteMarkers = append(deleteMarkers, entry)
+		}
+	}
+	for _, entry := range deleteMarkers {
+		purgeOpts := []jetstream.StreamPurgeOpt{jetstream.WithPurgeSubject(kv.pre + entry.Key())}
+		if olderThan > 0 && entry.Created().After(limit) {
+			purgeOpts = append(purgeOpts, jetstream.WithPurgeKeep(1))
+		}
+		if err := kv.stream.Purge(ctx, purgeOpts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (kv *kv) Status(ctx context.Context) (jetstream.KeyValueStatus, error) {
+	info, err := kv.stream.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return jetstream.NewKeyValueBucketStatus(info, kv.name), nil
+}
+
+func (e *kvEntry) Bucket() string                  { return e.bucket }
+func (e *kvEntry) Key() string                     { return e.key }
+func (e *kvEntry) Value() []byte                   { return e.value }
+func (e *kvEntry) Revision() uint64                { return e.revision }
+func (e *kvEntry) Created() time.Time              { return e.created }
+func (e *kvEntry) Delta() uint64                   { return e.delta }
+func (e *kvEntry) Operation() jetstream.KeyValueOp { return e.op }
+
+func (l *kvLister) Status() <-chan jetstream.KeyValueStatus {
+	return l.statuses
+}
+
+func (l *kvLister) Name() <-chan string {
+	return l.names
+}
+
+func (l *kvLister) Error() error {
+	return l.err
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// msg is a message delivered by a consumer. Acknowledgements are applied
+// directly to the consumer state.
+type msg struct {
+	c       *consumer
+	subject string
+	reply   string
+	header  nats.Header
+	data    []byte
+	size    int
+	meta    jetstream.MsgMetadata
+
+	mu    sync.Mutex
+	acked bool
+	stats *consumeStats
+}
+
+// newMsg creates a message delivered by the consumer. It has to be called
+// with the jetStream mutex held.
+func newMsg(c *consumer, m *storedMsg, dseq, deliveries, pending uint64) *msg {
+	header := copyHeader(m.header)
+	data := append([]byte(nil), m.data...)
+	if c.cfg.HeadersOnly {
+		if header == nil {
+			header = nats.Header{}
+		}
+		header.Set("Nats-Msg-Size", strconv.Itoa(len(m.data)))
+		data = nil
+	}
+	stream := c.s.cfg.Name
+	return &msg{
+		c:       c,
+		subject: m.subject,
+		reply: fmt.Sprintf("$JS.ACK.%s.%s.%d.%d.%d.%d.%d",
+			stream, c.name, deliveries, m.seq, dseq, m.time.UnixNano(), pending),
+		header: header,
+		data:   data,
+		size:   int(m.size()),
+		meta: jetstream.MsgMetadata{
+			Sequence:     jetstream.SequencePair{Consumer: dseq, Stream: m.seq},
+			NumDelivered: deliveries,
+			NumPending:   pending,
+			Timestamp:    m.time,
+			Stream:       stream,
+			Consumer:     c.name,
+		},
+	}
+}
+
+func (m *msg) Metadata() (*jetstream.MsgMetadata, error) {
+	meta := m.meta
+	return &meta, nil
+}
+
+func (m *msg) Data() []byte {
+	return m.data
+}
+
+func (m *msg) Headers() nats.Header {
+	return m.header
+}
+
+func (m *msg) Subject() string {
+	return m.subject
+}
+
+func (m *msg) Reply() string {
+	return m.reply
+}
+
+func (m *msg) Ack() error {
+	return m.ack(ackAck, 0)
+}
+
+func (m *msg) DoubleAck(_ context.Context) error {
+	return m.ack(ackAck, 0)
+}
+
+func (m *msg) Nak() error {
+	return m.ack(ackNak, 0)
+}
+
+func (m *msg) NakWithDelay(delay time.Duration) error {
+	return m.ack(ackNak, delay)
+}
+
+func (m *msg) InProgress() error {
+	return m.ack(ackProgress, 0)
+}
+
+func (m *msg) Term() error {
+	return m.ack(ackTerm, 0)
+}
+
+func (m *msg) TermWithReason(_ string) error {
+	return m.ack(ackTerm, 0)
+}
+
+func (m *msg) ack(kind ackKind, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.acked {
+		return jetstream.ErrMsgAlreadyAckd
+	}
+	js := m.c.s.js
+	js.mu.Lock()
+	if !m.c.deleted && !m.c.s.deleted && m.c.cfg.AckPolicy != jetstream.AckNonePolicy {
+		m.c.processAck(kind, m.meta.Sequence.Stream, delay, time.Now())
+	}
+	js.mu.Unlock()
+	if kind != ackProgress {
+		m.acked = true
+	}
+	m.stats.recordAck(kind)
+	return nil
+}
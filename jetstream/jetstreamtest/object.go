@@ -0,0 +1,730 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+)
+
+type (
+	// obs implements jetstream.ObjectStore on top of an OBJ_<bucket>
+	// stream, storing chunks and meta information the same way the client
+	// does.
+	obs struct {
+		js     *jetStream
+		name   string
+		stream *streamHandle
+	}
+
+	objResult struct {
+		sync.Mutex
+		info *jetstream.ObjectInfo
+		r    *bytes.Reader
+		ctx  context.Context
+		err  error
+	}
+
+	obsLister struct {
+		statuses chan jetstream.ObjectStoreStatus
+		names    chan string
+		err      error
+	}
+)
+
+const (
+	objNamePre          = "OBJ_"
+	objNameTmpl         = "OBJ_%s"
+	objAllChunksPreTmpl = "$O.%s.C.>"
+	objAllMetaPreTmpl   = "$O.%s.M.>"
+	objChunksPreTmpl    = "$O.%s.C.%s"
+	objMetaPreTmpl      = "$O.%s.M.%s"
+	objDefaultChunkSize = uint32(128 * 1024)
+)
+
+func (js *jetStream) ObjectStore(ctx context.Context, bucket string) (jetstream.ObjectStore, error) {
+	if !validBucketRe.MatchString(bucket) {
+		return nil, jetstream.ErrInvalidStoreName
+	}
+	s, err := js.Stream(ctx, fmt.Sprintf(objNameTmpl, bucket))
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = jetstream.ErrBucketNotFound
+		}
+		return nil, err
+	}
+	return js.newObjectStore(bucket, s), nil
+}
+
+func (js *jetStream) CreateObjectStore(ctx context.Context, cfg jetstream.ObjectStoreConfig) (jetstream.ObjectStore, error) {
+	scfg, err := prepareObjectStoreConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := js.CreateStream(ctx, scfg)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+			err = errors.Join(fmt.Errorf("%w: %s", jetstream.ErrBucketExists, cfg.Bucket), err)
+		}
+		return nil, err
+	}
+	return js.newObjectStore(cfg.Bucket, s), nil
+}
+
+func (js *jetStream) UpdateObjectStore(ctx context.Context, cfg jetstream.ObjectStoreConfig) (jetstream.ObjectStore, error) {
+	scfg, err := prepareObjectStoreConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := js.UpdateStream(ctx, scfg)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			return nil, fmt.Errorf("%w: %s", jetstream.ErrBucketNotFound, cfg.Bucket)
+		}
+		return nil, err
+	}
+	return js.newObjectStore(cfg.Bucket, s), nil
+}
+
+func (js *jetStream) CreateOrUpdateObjectStore(ctx context.Context, cfg jetstream.ObjectStoreConfig) (jetstream.ObjectStore, error) {
+	scfg, err := prepareObjectStoreConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := js.CreateOrUpdateStream(ctx, scfg)
+	if err != nil {
+		return nil, err
+	}
+	return js.newObjectStore(cfg.Bucket, s), nil
+}
+
+// prepareObjectStoreConfig creates the stream config the same way the
+// client does.
+func prepareObjectStoreConfig(cfg jetstream.ObjectStoreConfig) (jetstream.StreamConfig, error) {
+	if !validBucketRe.MatchString(cfg.Bucket) {
+		return jetstream.StreamConfig{}, jetstream.ErrInvalidStoreName
+	}
+	replicas := cfg.Replicas
+	if replicas == 0 {
+		replicas = 1
+	}
+	maxBytes := cfg.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = -1
+	}
+	var compression jetstream.StoreCompression
+	if cfg.Compression {
+		compression = jetstream.S2Compression
+	}
+	return jetstream.StreamConfig{
+		Name:        fmt.Sprintf(objNameTmpl, cfg.Bucket),
+		Description: cfg.Description,
+		Subjects: []string{
+			fmt.Sprintf(objAllChunksPreTmpl, cfg.Bucket),
+			fmt.Sprintf(objAllMetaPreTmpl, cfg.Bucket),
+		},
+		MaxAge:      cfg.TTL,
+		MaxBytes:    maxBytes,
+		Storage:     cfg.Storage,
+		Replicas:    replicas,
+		Placement:   cfg.Placement,
+		Discard:     jetstream.DiscardNew,
+		AllowRollup: true,
+		AllowDirect: true,
+		Metadata:    cfg.Metadata,
+		Compression: compression,
+	}, nil
+}
+
+func (js *jetStream) DeleteObjectStore(ctx context.Context, bucket string) error {
+	if !validBucketRe.MatchString(bucket) {
+		return jetstream.ErrInvalidStoreName
+	}
+	if err := js.DeleteStream(ctx, fmt.Sprintf(objNameTmpl, bucket)); err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = errors.Join(fmt.Errorf("%w: %s", jetstream.ErrBucketNotFound, bucket), err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (js *jetStream) ObjectStoreNames(_ context.Context) jetstream.ObjectStoreNamesLister {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	streams := js.filterStreams(fmt.Sprintf(objAllChunksPreTmpl, "*"))
+	l := &obsLister{names: make(chan string, len(streams))}
+	for _, s := range streams {
+		if strings.HasPrefix(s.cfg.Name, objNamePre) {
+			l.names <- strings.TrimPrefix(s.cfg.Name, objNamePre)
+		}
+	}
+	close(l.names)
+	return l
+}
+
+func (js *jetStream) ObjectStores(_ context.Context) jetstream.ObjectStoresLister {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	streams := js.filterStreams(fmt.Sprintf(objAllChunksPreTmpl, "*"))
+	l := &obsLister{statuses: make(chan jetstream.ObjectStoreStatus, len(streams))}
+	for _, s := range streams {
+		if strings.HasPrefix(s.cfg.Name, objNamePre) {
+			l.statuses <- jetstream.NewObjectBucketStatus(s.info(jetstream.StreamInfoOptions{}), strings.TrimPrefix(s.cfg.Name, objNamePre))
+		}
+	}
+	close(l.statuses)
+	return l
+}
+
+func (js *jetStream) newObjectStore(bucket string, s jetstream.Stream) *obs {
+	return &obs{
+		js:     js,
+		name:   bucket,
+		stream: &streamHandle{js: js, name: s.CachedInfo().Config.Name},
+	}
+}
+
+func encodeName(name string) string {
+	return base64.URLEncoding.EncodeToString([]byte(name))
+}
+
+func isLink(info *jetstream.ObjectInfo) bool {
+	return info.ObjectMeta.Opts != nil && info.ObjectMeta.Opts.Link != nil
+}
+
+func (obs *obs) Put(ctx context.Context, meta jetstream.ObjectMeta, r io.Reader) (*jetstream.ObjectInfo, error) {
+	if meta.Name == "" {
+		return nil, jetstream.ErrBadObjectMeta
+	}
+	if meta.Opts == nil {
+		meta.Opts = &jetstream.ObjectMetaOptions{ChunkSize: objDefaultChunkSize}
+	} else if meta.Opts.Link != nil {
+		return nil, jetstream.ErrLinkNotAllowed
+	} else if meta.Opts.ChunkSize == 0 {
+		meta.Opts.ChunkSize = objDefaultChunkSize
+	}
+
+	id := nuid.Next()
+	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, id)
+	einfo, err := obs.GetInfo(ctx, meta.Name, jetstream.GetObjectInfoShowDeleted())
+	if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, err
+	}
+	purgePartial := func() {
+		_ = obs.stream.Purge(ctx, jetstream.WithPurgeSubject(chunkSubj))
+	}
+
+	h := sha256.New()
+	chunk, sent, total := make([]byte, meta.Opts.ChunkSize), 0, uint64(0)
+	info := &jetstream.ObjectInfo{Bucket: obs.name, NUID: id, ObjectMeta: meta}
+	for r != nil {
+		if err := ctx.Err(); err != nil {
+			purgePartial()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = nats.ErrTimeout
+			}
+			return nil, err
+		}
+		n, readErr := r.Read(chunk)
+		if readErr != nil && readErr != io.EOF {
+			purgePartial()
+			return nil, readErr
+		}
+		if n > 0 {
+			h.Write(chunk[:n])
+			if _, err := obs.js.PublishMsg(ctx, &nats.Msg{Subject: chunkSubj, Data: chunk[:n]}); err != nil {
+				purgePartial()
+				return nil, err
+			}
+			sent++
+			total += uint64(n)
+		}
+		if readErr == io.EOF {
+			info.Size, info.Chunks = total, uint32(sent)
+			info.Digest = jetstream.GetObjectDigestValue(h)
+			break
+		}
+	}
+
+	if err := publishMeta(ctx, info, obs.js); err != nil {
+		if r != nil {
+			purgePartial()
+		}
+		return nil, err
+	}
+	if einfo != nil && !einfo.Deleted {
+		echunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, einfo.NUID)
+		_ = obs.stream.Purge(ctx, jetstream.WithPurgeSubject(echunkSubj))
+	}
+	return info, nil
+}
+
+func publishMeta(ctx context.Context, info *jetstream.ObjectInfo, js *jetStream) error {
+	info.ModTime = time.Time{}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	mm := nats.NewMsg(fmt.Sprintf(objMetaPreTmpl, info.Bucket, encodeName(info.ObjectMeta.Name)))
+	mm.Header.Set(jetstream.MsgRollup, jetstream.MsgRollupSubject)
+	mm.Data = data
+	if _, err := js.PublishMsg(ctx, mm); err != nil {
+		return err
+	}
+	info.ModTime = time.Now().UTC()
+	return nil
+}
+
+func (obs *obs) Get(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) (jetstream.ObjectResult, error) {
+	o, err := jetstream.ResolveGetObjectOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var infoOpts []jetstream.GetObjectInfoOpt
+	if o.ShowDeleted {
+		infoOpts = append(infoOpts, jetstream.GetObjectInfoShowDeleted())
+	}
+	info, err := obs.GetInfo(ctx, name, infoOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if info.NUID == "" {
+		return nil, jetstream.ErrBadObjectMeta
+	}
+	if isLink(info) {
+		if info.ObjectMeta.Opts.Link.Name == "" {
+			return nil, jetstream.ErrCantGetBucket
+		}
+		lbuck := info.ObjectMeta.Opts.Link.Bucket
+		if lbuck == obs.name {
+			return obs.Get(ctx, info.ObjectMeta.Opts.Link.Name)
+		}
+		lobs, err := obs.js.ObjectStore(ctx, lbuck)
+		if err != nil {
+			return nil, err
+		}
+		return lobs.Get(ctx, info.ObjectMeta.Opts.Link.Name)
+	}
+
+	result := &objResult{info: info, ctx: ctx}
+	if info.Size == 0 {
+		return result, nil
+	}
+	data, err := obs.chunks(info.NUID)
+	if err != nil {
+		return nil, err
+	}
+	result.r = bytes.NewReader(data)
+	return result, nil
+}
+
+// chunks returns the contents of all chunks of the object.
+func (obs *obs) chunks(id string) ([]byte, error) {
+	obs.js.mu.Lock()
+	defer obs.js.mu.Unlock()
+	s, err := obs.stream.stream()
+	if err != nil {
+		return nil, err
+	}
+	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, id)
+	var data []byte
+	for _, m := range s.msgs {
+		if m.subject == chunkSubj {
+			data = append(data, m.data...)
+		}
+	}
+	return data, nil
+}
+
+func (obs *obs) Delete(ctx context.Context, name string) error {
+	info, err := obs.GetInfo(ctx, name, jetstream.GetObjectInfoShowDeleted())
+	if err != nil {
+		return err
+	}
+	if info.NUID == "" {
+		return jetstream.ErrBadObjectMeta
+	}
+	info.Deleted = true
+	info.Size, info.Chunks, info.Digest = 0, 0, ""
+	if err = publishMeta(ctx, info, obs.js); err != nil {
+		return err
+	}
+	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, info.NUID)
+	return obs.stream.Purge(ctx, jetstream.WithPurgeSubject(chunkSubj))
+}
+
+func (obs *obs) AddLink(ctx context.Context, name string, obj *jetstream.ObjectInfo) (*jetstream.ObjectInfo, error) {
+	if name == "" {
+		return nil, jetstream.ErrNameRequired
+	}
+	if obj == nil || obj.Name == "" {
+		return nil, jetstream.ErrObjectRequired
+	}
+	if obj.Deleted {
+		return nil, jetstream.ErrNoLinkToDeleted
+	}
+	if isLink(obj) {
+		return nil, jetstream.ErrNoLinkToLink
+	}
+	if err := obs.checkLinkName(ctx, name); err != nil {
+		return nil, err
+	}
+	info := &jetstream.ObjectInfo{
+		Bucket:  obs.name,
+		NUID:    nuid.Next(),
+		ModTime: time.Now().UTC(),
+		ObjectMeta: jetstream.ObjectMeta{
+			Name: name,
+			Opts: &jetstream.ObjectMetaOptions{Link: &jetstream.ObjectLink{Bucket: obj.Bucket, Name: obj.Name}},
+		},
+	}
+	if err := publishMeta(ctx, info, obs.js); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (ob *obs) AddBucketLink(ctx context.Context, name string, bucket jetstream.ObjectStore) (*jetstream.ObjectInfo, error) {
+	if name == "" {
+		return nil, jetstream.ErrNameRequired
+	}
+	if bucket == nil {
+		return nil, jetstream.ErrBucketRequired
+	}
+	bos, ok := bucket.(*obs)
+	if !ok {
+		return nil, jetstream.ErrBucketMalformed
+	}
+	if err := ob.checkLinkName(ctx, name); err != nil {
+		return nil, err
+	}
+	info := &jetstream.ObjectInfo{
+		Bucket: ob.name,
+		NUID:   nuid.Next(),
+		ObjectMeta: jetstream.ObjectMeta{
+			Name: name,
+			Opts: &jetstream.ObjectMetaOptions{Link: &jetstream.ObjectLink{Bucket: bos.name}},
+		},
+	}
+	if err := publishMeta(ctx, info, ob.js); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// checkLinkName returns an error if an object which is not a link already
+// uses the name.
+func (obs *obs) checkLinkName(ctx context.Context, name string) error {
+	einfo, err := obs.GetInfo(ctx, name, jetstream.GetObjectInfoShowDeleted())
+	if einfo != nil {
+		if !isLink(einfo) {
+			return jetstream.ErrObjectAlreadyExists
+		}
+		return nil
+	}
+	if !errors.Is(err, jetstream.ErrObjectNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (obs *obs) PutBytes(ctx context.Context, name string, data []byte) (*jetstream.ObjectInfo, error) {
+	return obs.Put(ctx, jetstream.ObjectMeta{Name: name}, bytes.NewReader(data))
+}
+
+func (obs *obs) GetBytes(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) ([]byte, error) {
+	result, err := obs.Get(ctx, name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	var b bytes.Buffer
+	if _, err := b.ReadFrom(result); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (obs *obs) PutString(ctx context.Context, name string, data string) (*jetstream.ObjectInfo, error) {
+	return obs.Put(ctx, jetstream.ObjectMeta{Name: name}, strings.NewReader(data))
+}
+
+func (obs *obs) GetString(ctx context.Context, name string, opts ...jetstream.GetObjectOpt) (string, error) {
+	data, err := obs.GetBytes(ctx, name, opts...)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (obs *obs) PutFile(ctx context.Context, file string) (*jetstream.ObjectInfo, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return obs.Put(ctx, jetstream.ObjectMeta{Name: file}, f)
+}
+
+func (obs *obs) GetFile(ctx context.Context, name, file string, opts ...jetstream.GetObjectOpt) error {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	result, err := obs.Get(ctx, name, opts...)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	defer result.Close()
+
+	_, err = io.Copy(f, result)
+	return err
+}
+
+func (obs *obs) GetInfo(ctx context.Context, name string, opts ...jetstream.GetObjectInfoOpt) (*jetstream.ObjectInfo, error) {
+	if name == "" {
+		return nil, jetstream.ErrNameRequired
+	}
+	o, err := jetstream.ResolveGetObjectInfoOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name))
+	m, err := obs.stream.GetLastMsgForSubject(ctx, metaSubj)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			err = jetstream.ErrObjectNotFound
+		}
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = jetstream.ErrBucketNotFound
+		}
+		return nil, err
+	}
+	var info jetstream.ObjectInfo
+	if err := json.Unmarshal(m.Data, &info); err != nil {
+		return nil, jetstream.ErrBadObjectMeta
+	}
+	if !o.ShowDeleted && info.Deleted {
+		return nil, jetstream.ErrObjectNotFound
+	}
+	info.ModTime = m.Time
+	return &info, nil
+}
+
+func (obs *obs) UpdateMeta(ctx context.Context, name string, meta jetstream.ObjectMeta) error {
+	info, err := obs.GetInfo(ctx, name)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrObjectNotFound) {
+			return jetstream.ErrUpdateMetaDeleted
+		}
+		return err
+	}
+	if name != meta.Name {
+		existingInfo, err := obs.GetInfo(ctx, meta.Name, jetstream.GetObjectInfoShowDeleted())
+		if err != nil && !errors.Is(err, jetstream.ErrObjectNotFound) {
+			return err
+		}
+		if err == nil && !existingInfo.Deleted {
+			return jetstream.ErrObjectAlreadyExists
+		}
+	}
+	info.Name = meta.Name
+	info.Description = meta.Description
+	info.Headers = meta.Headers
+	info.Metadata = meta.Metadata
+	if err = publishMeta(ctx, info, obs.js); err != nil {
+		return err
+	}
+	if name != meta.Name {
+		metaSubj := fmt.Sprintf(objMetaPreTmpl, obs.name, encodeName(name))
+		return obs.stream.Purge(ctx, jetstream.WithPurgeSubject(metaSubj))
+	}
+	return nil
+}
+
+func (obs *obs) Seal(ctx context.Context) error {
+	si, err := obs.stream.Info(ctx)
+	if err != nil {
+		return err
+	}
+	cfg := si.Config
+	cfg.Sealed = true
+	_, err = obs.js.UpdateStream(ctx, cfg)
+	return err
+}
+
+func (obs *obs) Watch(ctx context.Context, opts ...jetstream.WatchOpt) (jetstream.ObjectWatcher, error) {
+	o, err := jetstream.ResolveWatchOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Object watchers always start from the last meta of each object.
+	o.ResumeFromRevision, o.MetaOnly = 0, false
+
+	obs.js.mu.Lock()
+	defer obs.js.mu.Unlock()
+	s, err := obs.stream.stream()
+	if err != nil {
+		return nil, err
+	}
+	filters := []string{fmt.Sprintf(objAllMetaPreTmpl, obs.name)}
+	return newFollower(ctx, s, filters, o, 32, func(m *storedMsg, _ uint64) (*jetstream.ObjectInfo, bool) {
+		var info jetstream.ObjectInfo
+		if err := json.Unmarshal(m.data, &info); err != nil {
+			return nil, false
+		}
+		if o.IgnoreDeletes && info.Deleted {
+			return nil, false
+		}
+		info.ModTime = m.time
+		return &info, true
+	}), nil
+}
+
+func (obs *obs) List(ctx context.Context, opts ...jetstream.ListObjectsOpt) ([]*jetstream.ObjectInfo, error) {
+	o, err := jetstream.ResolveListObjectsOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var watchOpts []jetstream.WatchOpt
+	if !o.ShowDeleted {
+		watchOpts = append(watchOpts, jetstream.IgnoreDeletes())
+	}
+	watcher, err := obs.Watch(ctx, watchOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Stop()
+
+	var objs []*jetstream.ObjectInfo
+	updates := watcher.Updates()
+Updates:
+	for {
+		select {
+		case entry := <-updates:
+			if entry == nil {
+				break Updates
+			}
+			objs = append(objs, entry)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if len(objs) == 0 {
+		return nil, jetstream.ErrNoObjectsFound
+	}
+	return objs, nil
+}
+
+func (obs *obs) Status(ctx context.Context) (jetstream.ObjectStoreStatus, error) {
+	info, err := obs.stream.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return jetstream.NewObjectBucketStatus(info, obs.name), nil
+}
+
+func (o *objResult) Read(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+	if ctx := o.ctx; ctx != nil {
+		if err := ctx.Err(); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = nats.ErrTimeout
+			}
+			o.err = err
+		}
+	}
+	if o.err != nil {
+		return 0, o.err
+	}
+	if o.r == nil {
+		return 0, io.EOF
+	}
+	n, err := o.r.Read(p)
+	if err == io.EOF {
+		if err := o.checkDigest(); err != nil {
+			o.err = err
+			return 0, err
+		}
+	}
+	return n, err
+}
+
+// checkDigest makes sure the digest of the object data matches the meta
+// information.
+func (o *objResult) checkDigest() error {
+	h := sha256.New()
+	if _, err := o.r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := o.r.WriteTo(h); err != nil {
+		return err
+	}
+	rsha, err := jetstream.DecodeObjectDigest(o.info.Digest)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), rsha) {
+		return jetstream.ErrDigestMismatch
+	}
+	return nil
+}
+
+func (o *objResult) Close() error {
+	return nil
+}
+
+func (o *objResult) Info() (*jetstream.ObjectInfo, error) {
+	o.Lock()
+	defer o.Unlock()
+	return o.info, o.err
+}
+
+func (o *objResult) Error() error {
+	o.Lock()
+	defer o.Unlock()
+	return o.err
+}
+
+func (l *obsLister) Status() <-chan jetstream.ObjectStoreStatus {
+	return l.statuses
+}
+
+func (l *obsLister) Name() <-chan string {
+	return l.names
+}
+
+func (l *obsLister) Error() error {
+	return l.err
+}
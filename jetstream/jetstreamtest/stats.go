@@ -0,0 +1,84 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// consumeStats collects statistics of a consume or messages context. As
+// messages are not requested or buffered, only delivery, acknowledgement
+// and handler statistics are tracked. All methods are safe to call on a
+// nil receiver.
+type consumeStats struct {
+	delivered      atomic.Uint64
+	redelivered    atomic.Uint64
+	acked          atomic.Uint64
+	naked          atomic.Uint64
+	termed         atomic.Uint64
+	handled        atomic.Uint64
+	handlerTime    atomic.Int64
+	maxHandlerTime atomic.Int64
+}
+
+func (s *consumeStats) recordDelivered(m *msg) {
+	s.delivered.Add(1)
+	if m.meta.NumDelivered > 1 {
+		s.redelivered.Add(1)
+	}
+	m.stats = s
+}
+
+func (s *consumeStats) recordHandled(d time.Duration) {
+	s.handled.Add(1)
+	s.handlerTime.Add(int64(d))
+	for {
+		cur := s.maxHandlerTime.Load()
+		if int64(d) <= cur || s.maxHandlerTime.CompareAndSwap(cur, int64(d)) {
+			return
+		}
+	}
+}
+
+func (s *consumeStats) recordAck(kind ackKind) {
+	if s == nil {
+		return
+	}
+	switch kind {
+	case ackAck:
+		s.acked.Add(1)
+	case ackNak:
+		s.naked.Add(1)
+	case ackTerm:
+		s.termed.Add(1)
+	}
+}
+
+func (s *consumeStats) snapshot() jetstream.ConsumeStats {
+	stats := jetstream.ConsumeStats{
+		Delivered:         s.delivered.Load(),
+		Redelivered:       s.redelivered.Load(),
+		Acked:             s.acked.Load(),
+		Naked:             s.naked.Load(),
+		Termed:            s.termed.Load(),
+		MaxHandlerLatency: time.Duration(s.maxHandlerTime.Load()),
+	}
+	if handled := s.handled.Load(); handled > 0 {
+		stats.HandlerLatency = time.Duration(s.handlerTime.Load() / int64(handled))
+	}
+	return stats
+}
@@ -0,0 +1,802 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type (
+	// stream holds the state of a stream. All fields are protected by the
+	// mutex of the owning jetStream.
+	stream struct {
+		js        *jetStream
+		cfg       jetstream.StreamConfig
+		created   time.Time
+		msgs      []*storedMsg
+		last      uint64
+		lastTime  time.Time
+		bytes     uint64
+		ids       map[string]msgID
+		lastMsgID string
+		consumers map[string]*consumer
+		deleted   bool
+
+		// changed is closed and replaced whenever messages are added or
+		// consumers need to reevaluate their state.
+		changed chan struct{}
+	}
+
+	storedMsg struct {
+		subject string
+		seq     uint64
+		header  nats.Header
+		data    []byte
+		time    time.Time
+	}
+
+	msgID struct {
+		seq  uint64
+		time time.Time
+	}
+
+	// streamHandle implements jetstream.Stream, looking up the stream by
+	// name on each operation, the same way the client does.
+	streamHandle struct {
+		js   *jetStream
+		name string
+		info *jetstream.StreamInfo
+	}
+
+	consumerLister struct {
+		infos chan *jetstream.ConsumerInfo
+		names chan string
+		err   error
+	}
+)
+
+const defaultDuplicatesWindow = 2 * time.Minute
+
+func newStream(js *jetStream, cfg jetstream.StreamConfig) *stream {
+	s := &stream{
+		js:        js,
+		cfg:       cfg,
+		created:   time.Now().UTC(),
+		ids:       make(map[string]msgID),
+		consumers: make(map[string]*consumer),
+		changed:   make(chan struct{}),
+	}
+	if cfg.FirstSeq > 0 {
+		s.last = cfg.FirstSeq - 1
+	}
+	return s
+}
+
+// normalizeStreamConfig sets defaults the same way the server does.
+func normalizeStreamConfig(cfg jetstream.StreamConfig) jetstream.StreamConfig {
+	if len(cfg.Subjects) == 0 {
+		cfg.Subjects = []string{cfg.Name}
+	} else {
+		cfg.Subjects = append([]string(nil), cfg.Subjects...)
+	}
+	if cfg.MaxMsgs == 0 {
+		cfg.MaxMsgs = -1
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = -1
+	}
+	if cfg.MaxMsgsPerSubject == 0 {
+		cfg.MaxMsgsPerSubject = -1
+	}
+	if cfg.MaxConsumers == 0 {
+		cfg.MaxConsumers = -1
+	}
+	if cfg.MaxMsgSize == 0 {
+		cfg.MaxMsgSize = -1
+	}
+	if cfg.Replicas == 0 {
+		cfg.Replicas = 1
+	}
+	if cfg.Duplicates == 0 {
+		cfg.Duplicates = defaultDuplicatesWindow
+		if cfg.MaxAge > 0 && cfg.MaxAge < cfg.Duplicates {
+			cfg.Duplicates = cfg.MaxAge
+		}
+	}
+	return cfg
+}
+
+func streamConfigEqual(a, b jetstream.StreamConfig) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func (s *stream) handle() *streamHandle {
+	return &streamHandle{js: s.js, name: s.cfg.Name, info: s.info(jetstream.StreamInfoOptions{})}
+}
+
+func (s *stream) update(cfg jetstream.StreamConfig) error {
+	if cfg.Mirror != nil || len(cfg.Sources) > 0 {
+		return fmt.Errorf("%w: mirrors and sources", ErrNotSupported)
+	}
+	if cfg.SubjectTransform != nil || cfg.RePublish != nil {
+		return fmt.Errorf("%w: subject transforms and republish", ErrNotSupported)
+	}
+	cfg = normalizeStreamConfig(cfg)
+	switch {
+	case cfg.Storage != s.cfg.Storage:
+		return apiError(500, 10052, "stream configuration update can not change storage type")
+	case cfg.Retention != s.cfg.Retention:
+		return apiError(500, 10052, "stream configuration update can not change retention policy")
+	case s.cfg.Sealed && !cfg.Sealed:
+		return apiError(500, 10052, "stream configuration update can not unseal a sealed stream")
+	}
+	if err := s.js.checkSubjectsOverlap(cfg); err != nil {
+		return err
+	}
+	s.cfg = cfg
+	s.enforceLimits()
+	s.notify()
+	return nil
+}
+
+// notify wakes up consumers and watchers waiting for changes.
+func (s *stream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *stream) matchesSubject(subject string) bool {
+	for _, filter := range s.cfg.Subjects {
+		if subjectMatchesFilter(subject, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stream) overlaps(filter string) bool {
+	for _, subject := range s.cfg.Subjects {
+		if subjectsOverlap(subject, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stream) firstSeq() uint64 {
+	if len(s.msgs) > 0 {
+		return s.msgs[0].seq
+	}
+	if s.last == 0 {
+		return 0
+	}
+	return s.last + 1
+}
+
+// index returns the index of the first message with sequence >= seq.
+func (s *stream) index(seq uint64) int {
+	return sort.Search(len(s.msgs), func(i int) bool {
+		return s.msgs[i].seq >= seq
+	})
+}
+
+func (s *stream) msg(seq uint64) *storedMsg {
+	if i := s.index(seq); i < len(s.msgs) && s.msgs[i].seq == seq {
+		return s.msgs[i]
+	}
+	return nil
+}
+
+// nextMsg returns the first message with sequence >= seq matching the
+// predicate, or nil.
+func (s *stream) nextMsg(seq uint64, match func(*storedMsg) bool) *storedMsg {
+	for i := s.index(seq); i < len(s.msgs); i++ {
+		if match(s.msgs[i]) {
+			return s.msgs[i]
+		}
+	}
+	return nil
+}
+
+// lastMsg returns the last message on subjects matching the filter, or nil.
+func (s *stream) lastMsg(filter string) *storedMsg {
+	for i := len(s.msgs) - 1; i >= 0; i-- {
+		if subjectMatchesFilter(s.msgs[i].subject, filter) {
+			return s.msgs[i]
+		}
+	}
+	return nil
+}
+
+// store stores a published message, enforcing the stream configuration.
+func (s *stream) store(subject string, hdr nats.Header, data []byte, now time.Time) (*jetstream.PubAck, error) {
+	s.expire(now)
+	if s.cfg.Sealed {
+		return nil, apiError(400, 10109, "invalid operation on sealed stream")
+	}
+	m := &storedMsg{subject: subject, header: copyHeader(hdr), data: append([]byte(nil), data...), time: now.UTC()}
+	size := m.size()
+	if s.cfg.MaxMsgSize > 0 && size > uint64(s.cfg.MaxMsgSize) {
+		return nil, apiError(400, 10054, "message size exceeds maximum allowed")
+	}
+
+	id := hdr.Get(jetstream.MsgIDHeader)
+	if id != "" {
+		if dup, ok := s.ids[id]; ok {
+			return &jetstream.PubAck{Stream: s.cfg.Name, Sequence: dup.seq, Duplicate: true}, nil
+		}
+	}
+	if err := s.checkExpected(subject, hdr); err != nil {
+		return nil, err
+	}
+	rollup := hdr.Get(jetstream.MsgRollup)
+	if rollup != "" {
+		if !s.cfg.AllowRollup || s.cfg.DenyPurge {
+			return nil, apiError(400, 10115, "rollup not permitted")
+		}
+		if rollup != jetstream.MsgRollupSubject && rollup != jetstream.MsgRollupAll {
+			return nil, apiError(400, 10003, fmt.Sprintf("rollup value invalid: %q", rollup))
+		}
+	}
+	if s.cfg.Discard == jetstream.DiscardNew && rollup == "" {
+		if err := s.checkDiscardNew(subject, size); err != nil {
+			return nil, err
+		}
+	}
+
+	s.last++
+	m.seq = s.last
+	s.lastTime = m.time
+	s.msgs = append(s.msgs, m)
+	s.bytes += size
+	s.lastMsgID = id
+	if id != "" {
+		s.ids[id] = msgID{seq: m.seq, time: now}
+	}
+	switch rollup {
+	case jetstream.MsgRollupSubject:
+		s.removeWhere(func(sm *storedMsg) bool {
+			return sm.subject == subject && sm.seq != m.seq
+		})
+	case jetstream.MsgRollupAll:
+		s.removeWhere(func(sm *storedMsg) bool {
+			return sm.seq != m.seq
+		})
+	}
+	s.enforceLimits()
+	if s.cfg.Retention == jetstream.InterestPolicy && s.interestAcked(m) {
+		s.removeWhere(func(sm *storedMsg) bool { return sm == m })
+	}
+	s.notify()
+	return &jetstream.PubAck{Stream: s.cfg.Name, Sequence: m.seq}, nil
+}
+
+func (s *stream) checkExpected(subject string, hdr nats.Header) error {
+	if name := hdr.Get(jetstream.ExpectedStreamHeader); name != "" && name != s.cfg.Name {
+		return apiError(400, 10060, "expected stream does not match")
+	}
+	if v := hdr.Get(jetstream.ExpectedLastSeqHeader); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || seq != s.last {
+			return apiError(400, jetstream.JSErrCodeStreamWrongLastSequence, fmt.Sprintf("wrong last sequence: %d", s.last))
+		}
+	}
+	if v := hdr.Get(jetstream.ExpectedLastSubjSeqHeader); v != "" {
+		var last uint64
+		if m := s.lastMsg(subject); m != nil {
+			last = m.seq
+		}
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || seq != last {
+			return apiError(400, jetstream.JSErrCodeStreamWrongLastSequence, fmt.Sprintf("wrong last sequence: %d", last))
+		}
+	}
+	if id := hdr.Get(jetstream.ExpectedLastMsgIDHeader); id != "" && id != s.lastMsgID {
+		return apiError(400, 10070, fmt.Sprintf("wrong last msg ID: %s", s.lastMsgID))
+	}
+	return nil
+}
+
+func (s *stream) checkDiscardNew(subject string, size uint64) error {
+	if s.cfg.MaxMsgs > 0 && int64(len(s.msgs)) >= s.cfg.MaxMsgs {
+		return apiError(503, 10077, "maximum messages exceeded")
+	}
+	if s.cfg.MaxBytes > 0 && s.bytes+size > uint64(s.cfg.MaxBytes) {
+		return apiError(503, 10077, "maximum bytes exceeded")
+	}
+	if s.cfg.DiscardNewPerSubject && s.cfg.MaxMsgsPerSubject > 0 {
+		var count int64
+		for _, m := range s.msgs {
+			if m.subject == subject {
+				count++
+			}
+		}
+		if count >= s.cfg.MaxMsgsPerSubject {
+			return apiError(503, 10077, "maximum messages per subject exceeded")
+		}
+	}
+	return nil
+}
+
+// enforceLimits removes the oldest messages exceeding the stream limits.
+func (s *stream) enforceLimits() {
+	if s.cfg.MaxMsgsPerSubject > 0 {
+		counts := make(map[string]int64)
+		excess := make(map[uint64]struct{})
+		for i := len(s.msgs) - 1; i >= 0; i-- {
+			m := s.msgs[i]
+			counts[m.subject]++
+			if counts[m.subject] > s.cfg.MaxMsgsPerSubject {
+				excess[m.seq] = struct{}{}
+			}
+		}
+		if len(excess) > 0 {
+			s.removeWhere(func(m *storedMsg) bool {
+				_, ok := excess[m.seq]
+				return ok
+			})
+		}
+	}
+	var drop int
+	var bytes uint64
+	for i, m := range s.msgs {
+		msgsExceeded := s.cfg.MaxMsgs > 0 && int64(len(s.msgs)-i) > s.cfg.MaxMsgs
+		bytesExceeded := s.cfg.MaxBytes > 0 && s.bytes-bytes > uint64(s.cfg.MaxBytes)
+		if !msgsExceeded && !bytesExceeded {
+			break
+		}
+		bytes += m.size()
+		drop++
+	}
+	if drop > 0 {
+		cutoff := s.last + 1
+		if drop < len(s.msgs) {
+			cutoff = s.msgs[drop].seq
+		}
+		s.removeWhere(func(m *storedMsg) bool {
+			return m.seq < cutoff
+		})
+	}
+}
+
+// expire removes messages older than MaxAge and message IDs outside of the
+// duplicates window.
+func (s *stream) expire(now time.Time) {
+	if s.cfg.MaxAge > 0 && len(s.msgs) > 0 && now.Sub(s.msgs[0].time) > s.cfg.MaxAge {
+		cutoff := now.Add(-s.cfg.MaxAge)
+		s.removeWhere(func(m *storedMsg) bool {
+			return m.time.Before(cutoff)
+		})
+	}
+	for id, dup := range s.ids {
+		if now.Sub(dup.time) > s.cfg.Duplicates {
+			delete(s.ids, id)
+		}
+	}
+}
+
+// removeWhere removes messages matching the predicate, returning the
+// number of removed messages.
+func (s *stream) removeWhere(match func(*storedMsg) bool) uint64 {
+	var removed uint64
+	msgs := s.msgs[:0]
+	for _, m := range s.msgs {
+		if !match(m) {
+			msgs = append(msgs, m)
+			continue
+		}
+		removed++
+		s.bytes -= m.size()
+		for _, c := range s.consumers {
+			c.removed(m.seq)
+		}
+	}
+	for i := len(msgs); i < len(s.msgs); i++ {
+		s.msgs[i] = nil
+	}
+	s.msgs = msgs
+	return removed
+}
+
+// interestAcked checks whether all consumers interested in the message
+// acknowledged it.
+func (s *stream) interestAcked(m *storedMsg) bool {
+	for _, c := range s.consumers {
+		if c.matches(m.subject) && !c.acked(m.seq) {
+			return false
+		}
+	}
+	return true
+}
+
+// acked is called when a consumer acknowledged the message, removing it
+// if required by the retention policy.
+func (s *stream) acked(seq uint64) {
+	switch s.cfg.Retention {
+	case jetstream.WorkQueuePolicy:
+		s.removeWhere(func(m *storedMsg) bool { return m.seq == seq })
+	case jetstream.InterestPolicy:
+		if m := s.msg(seq); m != nil && s.interestAcked(m) {
+			s.removeWhere(func(sm *storedMsg) bool { return sm == m })
+		}
+	}
+}
+
+func (s *stream) purge(req jetstream.StreamPurgeRequest) (uint64, error) {
+	s.expire(time.Now())
+	if s.cfg.Sealed {
+		return 0, apiError(400, 10109, "invalid operation on sealed stream")
+	}
+	if s.cfg.DenyPurge {
+		return 0, apiError(400, 10083, "stream purge not permitted")
+	}
+	if req.Sequence > 0 && req.Keep > 0 {
+		return 0, apiError(400, jetstream.JSErrCodeBadRequest, "sequence and keep can not both be set")
+	}
+	match := func(m *storedMsg) bool {
+		return (req.Subject == "" || subjectMatchesFilter(m.subject, req.Subject)) &&
+			(req.Sequence == 0 || m.seq < req.Sequence)
+	}
+	if req.Keep > 0 {
+		var keep uint64
+		kept := make(map[uint64]struct{})
+		for i := len(s.msgs) - 1; i >= 0 && keep < req.Keep; i-- {
+			if match(s.msgs[i]) {
+				kept[s.msgs[i].seq] = struct{}{}
+				keep++
+			}
+		}
+		filter := match
+		match = func(m *storedMsg) bool {
+			_, ok := kept[m.seq]
+			return !ok && filter(m)
+		}
+	}
+	purged := s.removeWhere(match)
+	for _, c := range s.consumers {
+		c.purged(s.firstSeq())
+	}
+	s.notify()
+	return purged, nil
+}
+
+func (s *stream) deleteMsg(seq uint64) error {
+	s.expire(time.Now())
+	if s.cfg.Sealed {
+		return apiError(400, 10109, "invalid operation on sealed stream")
+	}
+	if s.cfg.DenyDelete {
+		return apiError(400, 10083, "message delete not permitted")
+	}
+	if s.removeWhere(func(m *storedMsg) bool { return m.seq == seq }) == 0 {
+		return apiError(400, 10057, "no message found")
+	}
+	s.notify()
+	return nil
+}
+
+func (s *stream) deleteConsumer(name string) error {
+	c, ok := s.consumers[name]
+	if !ok {
+		return jetstream.ErrConsumerNotFound
+	}
+	delete(s.consumers, name)
+	c.deleted = true
+	if s.cfg.Retention == jetstream.InterestPolicy {
+		s.removeWhere(s.interestAcked)
+	}
+	s.notify()
+	return nil
+}
+
+func (s *stream) info(o jetstream.StreamInfoOptions) *jetstream.StreamInfo {
+	now := time.Now()
+	s.expire(now)
+	state := jetstream.StreamState{
+		Msgs:      uint64(len(s.msgs)),
+		Bytes:     s.bytes,
+		FirstSeq:  s.firstSeq(),
+		LastSeq:   s.last,
+		LastTime:  s.lastTime,
+		Consumers: len(s.consumers),
+	}
+	subjects := make(map[string]uint64)
+	for _, m := range s.msgs {
+		subjects[m.subject]++
+	}
+	state.NumSubjects = uint64(len(subjects))
+	if len(s.msgs) > 0 {
+		state.FirstTime = s.msgs[0].time
+		state.NumDeleted = int(s.last-state.FirstSeq+1) - len(s.msgs)
+	}
+	if o.SubjectFilter != "" {
+		for subject := range subjects {
+			if !subjectMatchesFilter(subject, o.SubjectFilter) {
+				delete(subjects, subject)
+			}
+		}
+		if len(subjects) > 0 {
+			state.Subjects = subjects
+		}
+	}
+	if o.DeletedDetails && len(s.msgs) > 0 {
+		for seq, i := state.FirstSeq, 0; seq <= s.last; seq++ {
+			if i < len(s.msgs) && s.msgs[i].seq == seq {
+				i++
+				continue
+			}
+			state.Deleted = append(state.Deleted, seq)
+		}
+	}
+	cfg := s.cfg
+	cfg.Subjects = append([]string(nil), s.cfg.Subjects...)
+	return &jetstream.StreamInfo{
+		Config:    cfg,
+		Created:   s.created,
+		State:     state,
+		TimeStamp: now.UTC(),
+	}
+}
+
+func (m *storedMsg) size() uint64 {
+	size := len(m.subject) + len(m.data)
+	for key, values := range m.header {
+		for _, value := range values {
+			size += len(key) + len(value) + 4
+		}
+	}
+	return uint64(size)
+}
+
+func (m *storedMsg) raw() *jetstream.RawStreamMsg {
+	return &jetstream.RawStreamMsg{
+		Subject:  m.subject,
+		Sequence: m.seq,
+		Header:   copyHeader(m.header),
+		Data:     append([]byte(nil), m.data...),
+		Time:     m.time,
+	}
+}
+
+func copyHeader(hdr nats.Header) nats.Header {
+	if len(hdr) == 0 {
+		return nil
+	}
+	res := make(nats.Header, len(hdr))
+	for key, values := range hdr {
+		res[key] = append([]string(nil), values...)
+	}
+	return res
+}
+
+// stream returns the stream, or an error if it was deleted. It has to be
+// called with the jetStream mutex held.
+func (h *streamHandle) stream() (*stream, error) {
+	s, ok := h.js.streams[h.name]
+	if !ok {
+		return nil, jetstream.ErrStreamNotFound
+	}
+	return s, nil
+}
+
+func (h *streamHandle) Info(_ context.Context, opts ...jetstream.StreamInfoOpt) (*jetstream.StreamInfo, error) {
+	o, err := jetstream.ResolveStreamInfoOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		return nil, err
+	}
+	h.info = s.info(o)
+	return h.info, nil
+}
+
+func (h *streamHandle) CachedInfo() *jetstream.StreamInfo {
+	return h.info
+}
+
+func (h *streamHandle) Purge(_ context.Context, opts ...jetstream.StreamPurgeOpt) error {
+	var req jetstream.StreamPurgeRequest
+	for _, opt := range opts {
+		if err := opt(&req); err != nil {
+			return err
+		}
+	}
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		return err
+	}
+	_, err = s.purge(req)
+	return err
+}
+
+func (h *streamHandle) GetMsg(_ context.Context, seq uint64, opts ...jetstream.GetMsgOpt) (*jetstream.RawStreamMsg, error) {
+	o, err := jetstream.ResolveGetMsgOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		return nil, err
+	}
+	s.expire(time.Now())
+	var m *storedMsg
+	if o.NextFor != "" {
+		m = s.nextMsg(seq, func(m *storedMsg) bool {
+			return subjectMatchesFilter(m.subject, o.NextFor)
+		})
+	} else {
+		m = s.msg(seq)
+	}
+	if m == nil {
+		return nil, jetstream.ErrMsgNotFound
+	}
+	return m.raw(), nil
+}
+
+func (h *streamHandle) GetLastMsgForSubject(_ context.Context, subject string) (*jetstream.RawStreamMsg, error) {
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		return nil, err
+	}
+	s.expire(time.Now())
+	m := s.lastMsg(subject)
+	if m == nil {
+		return nil, jetstream.ErrMsgNotFound
+	}
+	return m.raw(), nil
+}
+
+func (h *streamHandle) DeleteMsg(_ context.Context, seq uint64) error {
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		return err
+	}
+	if err := s.deleteMsg(seq); err != nil {
+		return fmt.Errorf("%w: %s", jetstream.ErrMsgDeleteUnsuccessful, err)
+	}
+	return nil
+}
+
+// SecureDeleteMsg deletes the message. As messages are only stored in
+// memory, it is the same as DeleteMsg.
+func (h *streamHandle) SecureDeleteMsg(ctx context.Context, seq uint64) error {
+	return h.DeleteMsg(ctx, seq)
+}
+
+// Snapshot is not supported.
+func (h *streamHandle) Snapshot(_ context.Context, _ io.Writer, _ ...jetstream.SnapshotOpt) (*jetstream.SnapshotInfo, error) {
+	return nil, fmt.Errorf("%w: stream snapshot", ErrNotSupported)
+}
+
+func (h *streamHandle) CreateOrUpdateConsumer(ctx context.Context, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	return h.js.CreateOrUpdateConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) CreateConsumer(ctx context.Context, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	return h.js.CreateConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) UpdateConsumer(ctx context.Context, cfg jetstream.ConsumerConfig) (jetstream.Consumer, error) {
+	return h.js.UpdateConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) OrderedConsumer(ctx context.Context, cfg jetstream.OrderedConsumerConfig) (jetstream.Consumer, error) {
+	return h.js.OrderedConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) Consumer(ctx context.Context, name string) (jetstream.Consumer, error) {
+	return h.js.Consumer(ctx, h.name, name)
+}
+
+func (h *streamHandle) DeleteConsumer(ctx context.Context, name string) error {
+	return h.js.DeleteConsumer(ctx, h.name, name)
+}
+
+func (h *streamHandle) CreateOrUpdatePushConsumer(ctx context.Context, cfg jetstream.ConsumerConfig) (jetstream.PushConsumer, error) {
+	return h.js.CreateOrUpdatePushConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) CreatePushConsumer(ctx context.Context, cfg jetstream.ConsumerConfig) (jetstream.PushConsumer, error) {
+	return h.js.CreatePushConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) UpdatePushConsumer(ctx context.Context, cfg jetstream.ConsumerConfig) (jetstream.PushConsumer, error) {
+	return h.js.UpdatePushConsumer(ctx, h.name, cfg)
+}
+
+func (h *streamHandle) PushConsumer(ctx context.Context, name string) (jetstream.PushConsumer, error) {
+	return h.js.PushConsumer(ctx, h.name, name)
+}
+
+func (h *streamHandle) ListConsumers(_ context.Context) jetstream.ConsumerInfoLister {
+	l := &consumerLister{}
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		l.err = err
+		l.infos = closedChan[*jetstream.ConsumerInfo]()
+		return l
+	}
+	consumers := s.sortedConsumers()
+	l.infos = make(chan *jetstream.ConsumerInfo, len(consumers))
+	for _, c := range consumers {
+		l.infos <- c.info()
+	}
+	close(l.infos)
+	return l
+}
+
+func (h *streamHandle) ConsumerNames(_ context.Context) jetstream.ConsumerNameLister {
+	l := &consumerLister{}
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		l.err = err
+		l.names = closedChan[string]()
+		return l
+	}
+	consumers := s.sortedConsumers()
+	l.names = make(chan string, len(consumers))
+	for _, c := range consumers {
+		l.names <- c.name
+	}
+	close(l.names)
+	return l
+}
+
+func (s *stream) sortedConsumers() []*consumer {
+	consumers := make([]*consumer, 0, len(s.consumers))
+	for _, c := range s.consumers {
+		consumers = append(consumers, c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].name < consumers[j].name
+	})
+	return consumers
+}
+
+func (l *consumerLister) Info() <-chan *jetstream.ConsumerInfo {
+	return l.infos
+}
+
+func (l *consumerLister) Name() <-chan string {
+	return l.names
+}
+
+func (l *consumerLister) Err() error {
+	return l.err
+}
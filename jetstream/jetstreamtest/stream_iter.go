@@ -0,0 +1,80 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package jetstreamtest
+
+import (
+	"context"
+	"iter"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func (h *streamHandle) Messages(ctx context.Context, opts ...jetstream.StreamBrowseOpt) iter.Seq2[*jetstream.RawStreamMsg, error] {
+	return func(yield func(*jetstream.RawStreamMsg, error) bool) {
+		o, err := jetstream.ResolveStreamBrowseOpts(opts...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		msgs, err := h.browse(o)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, msg := range msgs {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// browse returns a snapshot of messages in the range set by the options.
+func (h *streamHandle) browse(o jetstream.StreamBrowseOptions) ([]*jetstream.RawStreamMsg, error) {
+	h.js.mu.Lock()
+	defer h.js.mu.Unlock()
+	s, err := h.stream()
+	if err != nil {
+		return nil, err
+	}
+	inRange := func(m *storedMsg) bool {
+		if o.Subject != "" && !subjectMatchesFilter(m.subject, o.Subject) {
+			return false
+		}
+		if o.Direction == jetstream.BrowseBackward {
+			return (o.StartSeq == 0 || m.seq <= o.StartSeq) && m.seq >= o.EndSeq
+		}
+		return m.seq >= o.StartSeq && (o.EndSeq == 0 || m.seq <= o.EndSeq)
+	}
+	var msgs []*jetstream.RawStreamMsg
+	for i := range s.msgs {
+		m := s.msgs[i]
+		if o.Direction == jetstream.BrowseBackward {
+			m = s.msgs[len(s.msgs)-1-i]
+		}
+		if o.MaxMsgs != 0 && len(msgs) >= o.MaxMsgs {
+			break
+		}
+		if inRange(m) {
+			msgs = append(msgs, m.raw())
+		}
+	}
+	return msgs, nil
+}
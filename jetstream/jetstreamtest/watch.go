@@ -0,0 +1,187 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstreamtest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// follower delivers messages matching the filters from a goroutine,
+// similar to the ordered consumer used by KeyValue and ObjectStore
+// watchers. Converted values are sent on updates, followed by the zero
+// value of T (a nil marker) once initial values were delivered.
+type follower[T any] struct {
+	updates  chan T
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	s       *stream
+	filters []string
+	convert func(m *storedMsg, delta uint64) (T, bool)
+}
+
+// newFollower creates a follower and starts delivering messages until it is
+// stopped or ctx is done. It has to be called with the jetStream mutex held.
+func newFollower[T any](ctx context.Context, s *stream, filters []string, o jetstream.WatchOptions, buffer int, convert func(*storedMsg, uint64) (T, bool)) *follower[T] {
+	f := &follower[T]{
+		updates: make(chan T, buffer),
+		stop:    make(chan struct{}),
+		s:       s,
+		filters: filters,
+		convert: convert,
+	}
+	s.expire(time.Now())
+	initial, next := f.initial(o)
+	go f.run(o, initial, next)
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				f.Stop()
+			case <-f.stop:
+			}
+		}()
+	}
+	return f
+}
+
+// initial returns values delivered when the follower is created and the
+// next stream sequence to follow from.
+func (f *follower[T]) initial(o jetstream.WatchOptions) ([]T, uint64) {
+	s := f.s
+	next := s.last + 1
+	if o.UpdatesOnly {
+		return nil, next
+	}
+	var msgs []*storedMsg
+	if o.IncludeHistory || o.ResumeFromRevision > 0 {
+		for i := s.index(o.ResumeFromRevision); i < len(s.msgs); i++ {
+			if f.matches(s.msgs[i]) {
+				msgs = append(msgs, s.msgs[i])
+			}
+		}
+	} else {
+		last := make(map[string]*storedMsg)
+		for _, m := range s.msgs {
+			if f.matches(m) {
+				last[m.subject] = m
+			}
+		}
+		for _, m := range last {
+			msgs = append(msgs, m)
+		}
+		sort.Slice(msgs, func(i, j int) bool { return msgs[i].seq < msgs[j].seq })
+	}
+	return f.convertAll(msgs), next
+}
+
+// next returns values for messages stored since the given sequence and the
+// next stream sequence to follow from.
+func (f *follower[T]) next(from uint64) ([]T, uint64) {
+	s := f.s
+	var msgs []*storedMsg
+	for i := s.index(from); i < len(s.msgs); i++ {
+		if f.matches(s.msgs[i]) {
+			msgs = append(msgs, s.msgs[i])
+		}
+	}
+	return f.convertAll(msgs), s.last + 1
+}
+
+func (f *follower[T]) convertAll(msgs []*storedMsg) []T {
+	res := make([]T, 0, len(msgs))
+	for i, m := range msgs {
+		if v, ok := f.convert(m, uint64(len(msgs)-i-1)); ok {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func (f *follower[T]) matches(m *storedMsg) bool {
+	for _, filter := range f.filters {
+		if subjectMatchesFilter(m.subject, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *follower[T]) run(o jetstream.WatchOptions, initial []T, next uint64) {
+	defer close(f.updates)
+	send := func(v T) bool {
+		select {
+		case f.updates <- v:
+			return true
+		case <-f.stop:
+			return false
+		}
+	}
+	for _, v := range initial {
+		if !send(v) {
+			return
+		}
+	}
+	var marker T
+	if !o.UpdatesOnly && !send(marker) {
+		return
+	}
+	js := f.s.js
+	for {
+		js.mu.Lock()
+		if f.s.deleted {
+			js.mu.Unlock()
+			return
+		}
+		var values []T
+		values, next = f.next(next)
+		changed := f.s.changed
+		js.mu.Unlock()
+
+		for _, v := range values {
+			if !send(v) {
+				return
+			}
+		}
+		if len(values) > 0 {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+func (f *follower[T]) Updates() <-chan T {
+	return f.updates
+}
+
+// Stop stops the follower, returning nats.ErrBadSubscription if it was
+// already stopped (same as watchers backed by a subscription).
+func (f *follower[T]) Stop() error {
+	err := nats.ErrBadSubscription
+	f.stopOnce.Do(func() {
+		close(f.stop)
+		err = nil
+	})
+	return err
+}
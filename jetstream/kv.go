@@ -25,7 +25,6 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
-	"github.com/nats-io/nats.go/internal/parser"
 )
 
 type (
@@ -126,6 +125,18 @@ type (
 		// Update also resets the TTL associated with the key (if any).
 		Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error)
 
+		// UpdateFunc atomically updates the value of the key using fn. The
+		// latest entry is passed to fn, which returns the new value. If the
+		// key does not exist or its latest revision is a delete or purge
+		// marker, fn is called with a nil entry and the key is created.
+		//
+		// If the key is modified concurrently, UpdateFunc retries with
+		// backoff, calling fn again with the new latest entry, until it
+		// succeeds or ctx is done. An error returned by fn is returned
+		// without retrying. On success, the revision of the new value is
+		// returned.
+		UpdateFunc(ctx context.Context, key string, fn func(entry KeyValueEntry) ([]byte, error)) (uint64, error)
+
 		// Delete will place a delete marker and leave all revisions. A history
 		// of a deleted key can still be retrieved by using the History method
 		// or a watch on the key. [Delete] is a non-destructive operation and
@@ -170,6 +181,22 @@ type (
 		// argument. It can be configured with the same options as Watch.
 		WatchFiltered(ctx context.Context, keys []string, opts ...WatchOpt) (KeyWatcher, error)
 
+		// Cache returns a local in-memory copy of the bucket, kept up to
+		// date by a watcher on all keys (or keys matching [CacheKeys]).
+		// Cache blocks until the current values were loaded. The cache is
+		// updated until it is stopped or ctx is done.
+		//
+		// Options:
+		//
+		// - CacheKeys limits the cache to keys matching the provided
+		// filters.
+		// - CacheChangeHandler sets a handler called for each update.
+		// - CacheStaleHandler sets a handler called when the cache becomes
+		// stale or up to date.
+		// - CacheMaxPending marks the cache stale when it lags behind by
+		// more than the provided number of updates.
+		Cache(ctx context.Context, opts ...KVCacheOpt) (KeyValueCache, error)
+
 		// Keys will return all keys.
 		// Deprecated: Use ListKeys instead to avoid memory issues.
 		Keys(ctx context.Context, opts ...WatchOpt) ([]string, error)
@@ -393,7 +420,6 @@ type kvs struct {
 	streamName string
 	pre        string
 	putPre     string
-	pushJS     nats.JetStreamContext
 	js         *jetStream
 	stream     Stream
 	// If true, it means that APIPrefix/Domain was set in the context
@@ -452,6 +478,9 @@ const (
 	kvop               = "KV-Operation"
 	kvdel              = "DEL"
 	kvpurge            = "PURGE"
+
+	kvUpdateFuncInitialBackoff = 10 * time.Millisecond
+	kvUpdateFuncMaxBackoff     = time.Second
 )
 
 // Regex for valid keys and buckets.
@@ -478,12 +507,7 @@ func (js *jetStream) KeyValue(ctx context.Context, bucket string) (KeyValue, err
 	if stream.CachedInfo().Config.MaxMsgsPerSubject < 1 {
 		return nil, ErrBadBucket
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
-
-	return mapStreamToKVS(js, pushJS, stream), nil
+	return mapStreamToKVS(js, stream), nil
 }
 
 func (js *jetStream) CreateKeyValue(ctx context.Context, cfg KeyValueConfig) (KeyValue, error) {
@@ -519,12 +543,7 @@ func (js *jetStream) CreateKeyValue(ctx context.Context, cfg KeyValueConfig) (Ke
 			return nil, err
 		}
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
-
-	return mapStreamToKVS(js, pushJS, stream), nil
+	return mapStreamToKVS(js, stream), nil
 }
 
 func (js *jetStream) UpdateKeyValue(ctx context.Context, cfg KeyValueConfig) (KeyValue, error) {
@@ -540,12 +559,7 @@ func (js *jetStream) UpdateKeyValue(ctx context.Context, cfg KeyValueConfig) (Ke
 		}
 		return nil, err
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
-
-	return mapStreamToKVS(js, pushJS, stream), nil
+	return mapStreamToKVS(js, stream), nil
 }
 
 func (js *jetStream) CreateOrUpdateKeyValue(ctx context.Context, cfg KeyValueConfig) (KeyValue, error) {
@@ -558,12 +572,7 @@ func (js *jetStream) CreateOrUpdateKeyValue(ctx context.Context, cfg KeyValueCon
 	if err != nil {
 		return nil, err
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
-
-	return mapStreamToKVS(js, pushJS, stream), nil
+	return mapStreamToKVS(js, stream), nil
 }
 
 func (js *jetStream) prepareKeyValueConfig(ctx context.Context, cfg KeyValueConfig) (StreamConfig, error) {
@@ -788,6 +797,86 @@ func (kl *kvLister) Error() error {
 	return kl.err
 }
 
+// watchSubscription delivers messages of an ordered consumer created using
+// watchOrdered.
+type watchSubscription struct {
+	cc   ConsumeContext
+	cons Consumer
+	sub  *nats.Subscription
+}
+
+// watchOrdered delivers messages of a stream matching cfg to handler, in
+// order. An ordered pull consumer is used, unless the JetStream API is
+// accessed using a custom prefix (e.g. when imported from another account).
+// Only the first response to a request is forwarded through a service
+// import, so in that case a push ordered consumer is created using the
+// legacy JetStream context, delivering messages on an inbox of the
+// connection.
+func (js *jetStream) watchOrdered(ctx context.Context, stream string, cfg OrderedConsumerConfig, handler MessageHandler) (*watchSubscription, error) {
+	if js.opts.apiPrefix == DefaultAPIPrefix {
+		cons, err := js.OrderedConsumer(ctx, stream, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cc, err := cons.Consume(handler)
+		if err != nil {
+			return nil, err
+		}
+		return &watchSubscription{cc: cc, cons: cons}, nil
+	}
+
+	pushJS, err := js.legacyJetStream()
+	if err != nil {
+		return nil, err
+	}
+	subOpts := []nats.SubOpt{nats.BindStream(stream), nats.OrderedConsumer(), nats.Context(ctx)}
+	switch cfg.DeliverPolicy {
+	case DeliverLastPerSubjectPolicy:
+		subOpts = append(subOpts, nats.DeliverLastPerSubject())
+	case DeliverNewPolicy:
+		subOpts = append(subOpts, nats.DeliverNew())
+	case DeliverByStartSequencePolicy:
+		subOpts = append(subOpts, nats.StartSequence(cfg.OptStartSeq))
+	}
+	if cfg.HeadersOnly {
+		subOpts = append(subOpts, nats.HeadersOnly())
+	}
+	var subj string
+	if len(cfg.FilterSubjects) == 1 {
+		subj = cfg.FilterSubjects[0]
+	} else {
+		subOpts = append(subOpts, nats.ConsumerFilterSubjects(cfg.FilterSubjects...))
+	}
+	sub, err := pushJS.Subscribe(subj, func(m *nats.Msg) {
+		handler(js.toJSMsg(m))
+	}, subOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &watchSubscription{sub: sub}, nil
+}
+
+// initialPending returns the number of messages pending when the consumer
+// was created.
+func (s *watchSubscription) initialPending() (uint64, error) {
+	if s.sub != nil {
+		return s.sub.InitialConsumerPending()
+	}
+	info := s.cons.CachedInfo()
+	if info == nil {
+		return 0, ErrConsumerNotFound
+	}
+	return info.NumPending, nil
+}
+
+func (s *watchSubscription) stop() {
+	if s.sub != nil {
+		s.sub.Unsubscribe()
+		return
+	}
+	s.cc.Stop()
+}
+
 func (js *jetStream) legacyJetStream() (nats.JetStreamContext, error) {
 	opts := make([]nats.JSOpt, 0)
 	if js.opts.apiPrefix != "" {
@@ -993,6 +1082,56 @@ func (kv *kvs) Update(ctx context.Context, key string, value []byte, revision ui
 	return pa.Sequence, err
 }
 
+// UpdateFunc atomically updates the value of the key using fn, retrying on
+// concurrent modifications.
+func (kv *kvs) UpdateFunc(ctx context.Context, key string, fn func(entry KeyValueEntry) ([]byte, error)) (uint64, error) {
+	if !keyValid(key) {
+		return 0, ErrInvalidKey
+	}
+	var revision uint64
+	err := retryWithBackoff(func(int) (bool, error) {
+		var err error
+		revision, err = kv.updateFunc(ctx, key, fn)
+		if errors.Is(err, ErrKeyExists) && ctx.Err() == nil {
+			return true, err
+		}
+		return false, err
+	}, backoffOpts{
+		attempts:        -1,
+		initialInterval: kvUpdateFuncInitialBackoff,
+		maxInterval:     kvUpdateFuncMaxBackoff,
+		cancel:          ctx.Done(),
+	})
+	if err == nil && revision == 0 {
+		// ctx was done while waiting to retry
+		return 0, ctx.Err()
+	}
+	return revision, err
+}
+
+// updateFunc performs a single read-modify-write cycle of UpdateFunc.
+func (kv *kvs) updateFunc(ctx context.Context, key string, fn func(entry KeyValueEntry) ([]byte, error)) (uint64, error) {
+	var last uint64
+	entry, err := kv.get(ctx, key, kvLatestRevision)
+	switch {
+	case err == nil:
+		last = entry.Revision()
+	case errors.Is(err, ErrKeyDeleted):
+		// the new value replaces the delete marker, same as in Create
+		last = entry.Revision()
+		entry = nil
+	case errors.Is(err, ErrKeyNotFound):
+		entry = nil
+	default:
+		return 0, err
+	}
+	value, err := fn(entry)
+	if err != nil {
+		return 0, err
+	}
+	return kv.Update(ctx, key, value, last)
+}
+
 // Delete will place a delete marker and leave all revisions.
 func (kv *kvs) Delete(ctx context.Context, key string, opts ...KVDeleteOpt) error {
 	if !keyValid(key) {
@@ -1054,7 +1193,10 @@ func purge() KVDeleteOpt {
 type watcher struct {
 	mu          sync.Mutex
 	updates     chan KeyValueEntry
-	sub         *nats.Subscription
+	sub         *watchSubscription
+	stop        chan struct{}
+	stopOnce    sync.Once
+	closed      bool
 	initDone    bool
 	initPending uint64
 	received    uint64
@@ -1068,12 +1210,41 @@ func (w *watcher) Updates() <-chan KeyValueEntry {
 	return w.updates
 }
 
-// Stop will unsubscribe from the watcher.
+// Stop will stop the underlying ordered consumer and close the updates
+// channel. Stopping a watcher which was already stopped, either directly
+// or by canceling its context, returns [nats.ErrBadSubscription].
 func (w *watcher) Stop() error {
 	if w == nil {
 		return nil
 	}
-	return w.sub.Unsubscribe()
+	err := nats.ErrBadSubscription
+	w.stopOnce.Do(func() {
+		err = nil
+		close(w.stop)
+		if w.sub != nil {
+			w.sub.stop()
+		}
+		w.mu.Lock()
+		w.closed = true
+		close(w.updates)
+		w.mu.Unlock()
+	})
+	return err
+}
+
+// send places an entry on the updates channel, blocking until it is
+// consumed or the watcher is stopped. It has to be called with the
+// watcher lock held.
+func (w *watcher) send(entry KeyValueEntry) bool {
+	if w.closed {
+		return false
+	}
+	select {
+	case w.updates <- entry:
+		return true
+	case <-w.stop:
+		return false
+	}
 }
 
 func (kv *kvs) WatchFiltered(ctx context.Context, keys []string, opts ...WatchOpt) (KeyWatcher, error) {
@@ -1108,41 +1279,46 @@ func (kv *kvs) WatchFiltered(ctx context.Context, keys []string, opts ...WatchOp
 	}
 
 	// We will block below on placing items on the chan. That is by design.
-	w := &watcher{updates: make(chan KeyValueEntry, 256)}
+	w := &watcher{
+		updates: make(chan KeyValueEntry, 256),
+		stop:    make(chan struct{}),
+	}
 
-	update := func(m *nats.Msg) {
-		tokens, err := parser.GetMetadataFields(m.Reply)
+	update := func(m Msg) {
+		meta, err := m.Metadata()
 		if err != nil {
 			return
 		}
-		if len(m.Subject) <= len(kv.pre) {
+		if len(m.Subject()) <= len(kv.pre) {
 			return
 		}
-		subj := m.Subject[len(kv.pre):]
+		subj := m.Subject()[len(kv.pre):]
 
 		var op KeyValueOp
-		if len(m.Header) > 0 {
-			switch m.Header.Get(kvop) {
+		if len(m.Headers()) > 0 {
+			switch m.Headers().Get(kvop) {
 			case kvdel:
 				op = KeyValueDelete
 			case kvpurge:
 				op = KeyValuePurge
 			}
 		}
-		delta := parser.ParseNum(tokens[parser.AckNumPendingTokenPos])
+		delta := meta.NumPending
 		w.mu.Lock()
 		defer w.mu.Unlock()
 		if !o.ignoreDeletes || (op != KeyValueDelete && op != KeyValuePurge) {
 			entry := &kve{
 				bucket:   kv.name,
 				key:      subj,
-				value:    m.Data,
-				revision: parser.ParseNum(tokens[parser.AckStreamSeqTokenPos]),
-				created:  time.Unix(0, int64(parser.ParseNum(tokens[parser.AckTimestampSeqTokenPos]))),
+				value:    m.Data(),
+				revision: meta.Sequence.Stream,
+				created:  meta.Timestamp,
 				delta:    delta,
 				op:       op,
 			}
-			w.updates <- entry
+			if !w.send(entry) {
+				return
+			}
 		}
 		// Check if done and initial values.
 		if !w.initDone {
@@ -1153,59 +1329,58 @@ func (kv *kvs) WatchFiltered(ctx context.Context, keys []string, opts ...WatchOp
 			}
 			if w.received > w.initPending || delta == 0 {
 				w.initDone = true
-				w.updates <- nil
+				w.send(nil)
 			}
 		}
 	}
 
-	// Used ordered consumer to deliver results.
-	subOpts := []nats.SubOpt{nats.BindStream(kv.streamName), nats.OrderedConsumer()}
-	if !o.includeHistory {
-		subOpts = append(subOpts, nats.DeliverLastPerSubject())
+	// Use ordered consumer to deliver results.
+	cfg := OrderedConsumerConfig{
+		FilterSubjects: keys,
+		DeliverPolicy:  DeliverLastPerSubjectPolicy,
+		HeadersOnly:    o.metaOnly,
 	}
-	if o.updatesOnly {
-		subOpts = append(subOpts, nats.DeliverNew())
+	if o.includeHistory {
+		cfg.DeliverPolicy = DeliverAllPolicy
 	}
-	if o.metaOnly {
-		subOpts = append(subOpts, nats.HeadersOnly())
+	if o.updatesOnly {
+		cfg.DeliverPolicy = DeliverNewPolicy
 	}
 	if o.resumeFromRevision > 0 {
-		subOpts = append(subOpts, nats.StartSequence(o.resumeFromRevision))
+		cfg.DeliverPolicy = DeliverByStartSequencePolicy
+		cfg.OptStartSeq = o.resumeFromRevision
 	}
-	subOpts = append(subOpts, nats.Context(ctx))
-	// Create the sub and rest of initialization under the lock.
+
+	// Start consuming and finish initialization under the lock.
 	// We want to prevent the race between this code and the
 	// update() callback.
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	var sub *nats.Subscription
-	var err error
-	if len(keys) == 1 {
-		sub, err = kv.pushJS.Subscribe(keys[0], update, subOpts...)
-	} else {
-		subOpts = append(subOpts, nats.ConsumerFilterSubjects(keys...))
-		sub, err = kv.pushJS.Subscribe("", update, subOpts...)
-	}
+	sub, err := kv.js.watchOrdered(ctx, kv.streamName, cfg, update)
 	if err != nil {
 		return nil, err
 	}
-	sub.SetClosedHandler(func(_ string) {
-		close(w.updates)
-	})
+	w.sub = sub
 	// If there were no pending messages at the time of the creation
 	// of the consumer, send the marker.
 	// Skip if UpdatesOnly() is set, since there will never be updates initially.
 	if !o.updatesOnly {
-		initialPending, err := sub.InitialConsumerPending()
-		if err == nil && initialPending == 0 {
+		if pending, err := sub.initialPending(); err == nil && pending == 0 {
 			w.initDone = true
-			w.updates <- nil
+			w.send(nil)
 		}
 	} else {
 		// if UpdatesOnly was used, mark initialization as complete
 		w.initDone = true
 	}
-	w.sub = sub
+	// Stop the watcher once the context is done.
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+		case <-w.stop:
+		}
+	}()
 	return w, nil
 }
 
@@ -1405,7 +1580,7 @@ func (kv *kvs) Status(ctx context.Context) (KeyValueStatus, error) {
 	return &KeyValueBucketStatus{nfo: nfo, bucket: kv.name}, nil
 }
 
-func mapStreamToKVS(js *jetStream, pushJS nats.JetStreamContext, stream Stream) *kvs {
+func mapStreamToKVS(js *jetStream, stream Stream) *kvs {
 	info := stream.CachedInfo()
 	bucket := strings.TrimPrefix(info.Config.Name, kvBucketNamePre)
 	kv := &kvs{
@@ -1413,7 +1588,6 @@ func mapStreamToKVS(js *jetStream, pushJS nats.JetStreamContext, stream Stream)
 		streamName: info.Config.Name,
 		pre:        fmt.Sprintf(kvSubjectsPreTmpl, bucket),
 		js:         js,
-		pushJS:     pushJS,
 		stream:     stream,
 		// Determine if we need to use the JS prefix in front of Put and Delete operations
 		useJSPfx:  js.opts.apiPrefix != DefaultAPIPrefix,
@@ -0,0 +1,296 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// KeyValueCache is a local, in-memory copy of the keys in a bucket,
+	// kept up to date by a watcher. It is created using [KeyValue.Cache].
+	//
+	// Reads are served from memory and may lag behind the bucket. Use
+	// WaitForRevision to read your own writes and Stale to check whether
+	// the cache is currently receiving updates.
+	KeyValueCache interface {
+		// Get returns the latest cached entry for the key. If the key does
+		// not exist or was deleted, ErrKeyNotFound is returned.
+		Get(key string) (KeyValueEntry, error)
+
+		// Keys returns all cached keys, sorted.
+		Keys() []string
+
+		// Revision returns the latest revision applied to the cache.
+		Revision() uint64
+
+		// WaitForRevision blocks until a revision greater or equal to the
+		// provided one is applied to the cache, e.g. the revision returned
+		// by Put. The revision has to belong to a key tracked by the cache.
+		// If the cache is stopped before the revision is reached,
+		// ErrKeyValueCacheStopped is returned.
+		WaitForRevision(ctx context.Context, revision uint64) error
+
+		// Stale returns true if the cached values may be outdated, either
+		// because the connection was lost, the watcher lags behind by more
+		// than [CacheMaxPending] updates, or the cache was stopped.
+		Stale() bool
+
+		// Stop stops updating the cache. Cached values can still be read.
+		Stop() error
+	}
+
+	// KVCacheOpt is used to configure a [KeyValueCache].
+	KVCacheOpt interface {
+		configureCache(opts *cacheOpts) error
+	}
+
+	cacheOpts struct {
+		// Keys to cache, all keys if empty.
+		keys []string
+		// Called for each update after the initial values were loaded.
+		changeHandler func(KeyValueEntry)
+		// Called when the stale state changes.
+		staleHandler func(stale bool)
+		// Updates pending on the server after which the cache is stale.
+		maxPending uint64
+	}
+
+	kvCache struct {
+		watcher KeyWatcher
+		opts    cacheOpts
+
+		mu           sync.RWMutex
+		entries      map[string]KeyValueEntry
+		revision     uint64
+		notify       chan struct{}
+		lagging      bool
+		disconnected bool
+		stopped      bool
+		stopOnce     sync.Once
+	}
+)
+
+// Cache creates a local cache of the bucket. It blocks until the current
+// values were loaded.
+func (kv *kvs) Cache(ctx context.Context, opts ...KVCacheOpt) (KeyValueCache, error) {
+	return newKeyValueCache(ctx, kv, kv.js.conn, opts)
+}
+
+// newKeyValueCache creates a cache of kv, loading the current values before
+// returning. If conn is not nil, the cache is stale while the connection is
+// not established.
+func newKeyValueCache(ctx context.Context, kv KeyValue, conn *nats.Conn, opts []KVCacheOpt) (*kvCache, error) {
+	var o cacheOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt.configureCache(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	var watcher KeyWatcher
+	var err error
+	if len(o.keys) > 0 {
+		watcher, err = kv.WatchFiltered(ctx, o.keys)
+	} else {
+		watcher, err = kv.WatchAll(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &kvCache{
+		watcher: watcher,
+		opts:    o,
+		entries: make(map[string]KeyValueEntry),
+		notify:  make(chan struct{}),
+	}
+	// the listener is registered before loading the values so that status
+	// changes are not missed, and removed once the cache stops
+	var connStatus chan nats.Status
+	release := func() {}
+	if conn != nil {
+		connStatus, release = statusChanged(conn, nats.CONNECTED, nats.RECONNECTING, nats.DISCONNECTED, nats.CLOSED)
+	}
+
+	// load initial values, a nil entry marks the end
+	for loaded := false; !loaded; {
+		select {
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				release()
+				return nil, ErrKeyValueCacheStopped
+			}
+			if entry == nil {
+				loaded = true
+				continue
+			}
+			c.apply(entry)
+		case <-ctx.Done():
+			watcher.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+
+	go c.run(connStatus, release)
+	return c, nil
+}
+
+// run applies updates until the watcher is stopped, then calls release.
+func (c *kvCache) run(connStatus <-chan nats.Status, release func()) {
+	defer release()
+	for {
+		select {
+		case entry, ok := <-c.watcher.Updates():
+			if !ok {
+				c.handleStale(c.update(func() { c.stopped = true }))
+				return
+			}
+			if entry == nil {
+				continue
+			}
+			stale, changed := c.apply(entry)
+			if c.opts.changeHandler != nil {
+				c.opts.changeHandler(entry)
+			}
+			c.handleStale(stale, changed)
+		case status, ok := <-connStatus:
+			if !ok {
+				connStatus = nil
+				continue
+			}
+			c.handleStale(c.update(func() { c.disconnected = status != nats.CONNECTED }))
+		}
+	}
+}
+
+// apply stores entry in the cache, removing the key for delete and purge
+// markers.
+func (c *kvCache) apply(entry KeyValueEntry) (bool, bool) {
+	return c.update(func() {
+		if entry.Operation() == KeyValuePut {
+			c.entries[entry.Key()] = entry
+		} else {
+			delete(c.entries, entry.Key())
+		}
+		if entry.Revision() > c.revision {
+			c.revision = entry.Revision()
+		}
+		c.lagging = c.opts.maxPending > 0 && entry.Delta() > c.opts.maxPending
+	})
+}
+
+// update runs fn with the lock held and wakes up all WaitForRevision calls.
+// It returns the stale state and whether it changed.
+func (c *kvCache) update(fn func()) (stale bool, changed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wasStale := c.isStale()
+	fn()
+	close(c.notify)
+	c.notify = make(chan struct{})
+	stale = c.isStale()
+	return stale, stale != wasStale
+}
+
+func (c *kvCache) handleStale(stale, changed bool) {
+	if changed && c.opts.staleHandler != nil {
+		c.opts.staleHandler(stale)
+	}
+}
+
+// isStale reports the stale state. Lock should be held.
+func (c *kvCache) isStale() bool {
+	return c.stopped || c.disconnected || c.lagging
+}
+
+// Get returns the latest cached entry for the key.
+func (c *kvCache) Get(key string) (KeyValueEntry, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return entry, nil
+}
+
+// Keys returns all cached keys, sorted.
+func (c *kvCache) Keys() []string {
+	c.mu.RLock()
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	c.mu.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// Revision returns the latest revision applied to the cache.
+func (c *kvCache) Revision() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.revision
+}
+
+// WaitForRevision blocks until the provided revision is applied to the
+// cache.
+func (c *kvCache) WaitForRevision(ctx context.Context, revision uint64) error {
+	for {
+		c.mu.RLock()
+		current, stopped, notify := c.revision, c.stopped, c.notify
+		c.mu.RUnlock()
+		if current >= revision {
+			return nil
+		}
+		if stopped {
+			return ErrKeyValueCacheStopped
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Stale returns true if the cached values may be outdated.
+func (c *kvCache) Stale() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isStale()
+}
+
+// Stop stops updating the cache. It is safe to call Stop multiple times.
+func (c *kvCache) Stop() error {
+	var err error
+	c.stopOnce.Do(func() {
+		c.mu.RLock()
+		stopped := c.stopped
+		c.mu.RUnlock()
+		if !stopped {
+			err = c.watcher.Stop()
+		}
+		c.update(func() { c.stopped = true })
+	})
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// IncrementCounter atomically adds delta (which may be negative) to the
+// counter stored under key, returning the new value. Counters are stored as
+// base 10 integers, so they can also be set using [KeyValue.PutString]. A
+// missing or deleted key is treated as a counter with value 0.
+//
+// If the current value is not a valid integer, an error wrapping
+// [ErrInvalidCounter] is returned and the value is left unchanged.
+func IncrementCounter(ctx context.Context, kv KeyValue, key string, delta int64) (int64, error) {
+	var value int64
+	_, err := kv.UpdateFunc(ctx, key, func(entry KeyValueEntry) ([]byte, error) {
+		current, err := CounterValue(entry)
+		if err != nil {
+			return nil, err
+		}
+		value = current + delta
+		return strconv.AppendInt(nil, value, 10), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// GetCounter returns the value of the counter stored under key. A missing
+// or deleted key is treated as a counter with value 0.
+func GetCounter(ctx context.Context, kv KeyValue, key string) (int64, error) {
+	entry, err := kv.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return CounterValue(entry)
+}
+
+// CounterValue parses the counter value of entry, e.g. one received from a
+// [KeyWatcher]. Nil entries, delete and purge markers and empty values are
+// treated as 0.
+func CounterValue(entry KeyValueEntry) (int64, error) {
+	if entry == nil || entry.Operation() != KeyValuePut || len(entry.Value()) == 0 {
+		return 0, nil
+	}
+	value, err := strconv.ParseInt(string(entry.Value()), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: key %q: %w", ErrInvalidCounter, entry.Key(), err)
+	}
+	return value, nil
+}
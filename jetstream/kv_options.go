@@ -101,3 +101,52 @@ func LastRevision(revision uint64) KVDeleteOpt {
 		return nil
 	})
 }
+
+type cacheOptFn func(opts *cacheOpts) error
+
+func (opt cacheOptFn) configureCache(opts *cacheOpts) error {
+	return opt(opts)
+}
+
+// CacheKeys limits a [KeyValueCache] to keys matching any of the provided
+// filters, which could include wildcards. By default, all keys are cached.
+func CacheKeys(keys ...string) KVCacheOpt {
+	return cacheOptFn(func(opts *cacheOpts) error {
+		if len(keys) == 0 {
+			return fmt.Errorf("%w: at least one key filter is required", ErrInvalidOption)
+		}
+		opts.keys = keys
+		return nil
+	})
+}
+
+// CacheChangeHandler sets a handler called for each update (including
+// delete and purge markers) applied to a [KeyValueCache] after the initial
+// values were loaded. The handler is called after the cache was updated,
+// and blocks further updates until it returns.
+func CacheChangeHandler(handler func(entry KeyValueEntry)) KVCacheOpt {
+	return cacheOptFn(func(opts *cacheOpts) error {
+		opts.changeHandler = handler
+		return nil
+	})
+}
+
+// CacheStaleHandler sets a handler called whenever a [KeyValueCache]
+// becomes stale or up to date again (see [KeyValueCache.Stale]). It is not
+// called when the cache is stopped using Stop.
+func CacheStaleHandler(handler func(stale bool)) KVCacheOpt {
+	return cacheOptFn(func(opts *cacheOpts) error {
+		opts.staleHandler = handler
+		return nil
+	})
+}
+
+// CacheMaxPending marks a [KeyValueCache] as stale while more than pending
+// updates are waiting on the server to be delivered to the cache. By
+// default, lag is not taken into account.
+func CacheMaxPending(pending uint64) KVCacheOpt {
+	return cacheOptFn(func(opts *cacheOpts) error {
+		opts.maxPending = pending
+		return nil
+	})
+}
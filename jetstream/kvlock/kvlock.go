@@ -0,0 +1,423 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kvlock provides distributed locks stored in a
+// [jetstream.KeyValue] bucket.
+//
+// A lock is a key in the bucket, created using [jetstream.KeyValue.Create].
+// The holder keeps the lock by updating the key before it expires, so the
+// bucket has to be created with a TTL: if the holder crashes, the key
+// expires and another process can acquire the lock.
+//
+// A [Lease] is lost when the key is modified or deleted by another process,
+// or when it could not be refreshed within its TTL (e.g. while
+// disconnected). Since a lost lease cannot stop work which is already in
+// progress, resources protected by a lock should check the fencing token
+// returned by [Lease.Token], rejecting requests with a token lower than
+// the highest one seen.
+package kvlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+)
+
+type (
+	// Lease is a held lock, refreshed in the background until it is
+	// released or lost.
+	Lease struct {
+		kv     jetstream.KeyValue
+		key    string
+		holder string
+		ttl    time.Duration
+		token  uint64
+
+		watcher  jetstream.KeyWatcher
+		stop     chan struct{}
+		stopOnce sync.Once
+		stopped  chan struct{}
+		done     chan struct{}
+
+		mu        sync.Mutex
+		revision  uint64
+		err       error
+		releasing bool
+	}
+
+	// Option configures [Acquire] and [TryAcquire].
+	Option func(*options) error
+
+	options struct {
+		holder        string
+		retryInterval time.Duration
+	}
+)
+
+var (
+	// ErrLocked is returned by [TryAcquire] when the lock is held by
+	// another holder.
+	ErrLocked = errors.New("kvlock: lock is held")
+
+	// ErrLeaseLost is returned by [Lease.Err] when the lock was acquired by
+	// another holder, deleted, or could not be refreshed within its TTL.
+	ErrLeaseLost = errors.New("kvlock: lease lost")
+
+	// ErrLeaseReleased is returned by [Lease.Err] after the lease was
+	// released.
+	ErrLeaseReleased = errors.New("kvlock: lease released")
+
+	// ErrInvalidTTL is returned when the lease TTL is not positive, the
+	// bucket has no TTL or the lease TTL exceeds the TTL of the bucket.
+	ErrInvalidTTL = errors.New("kvlock: invalid ttl")
+)
+
+// Holder sets the value stored in the lock key, identifying the holder.
+// It has to be unique for each acquisition, as lease loss is detected by
+// comparing the value of the key. By default, a unique ID is generated.
+func Holder(id string) Option {
+	return func(opts *options) error {
+		if id == "" {
+			return fmt.Errorf("%w: holder cannot be empty", jetstream.ErrInvalidOption)
+		}
+		opts.holder = id
+		return nil
+	}
+}
+
+// RetryInterval sets how often [Acquire] tries to acquire a held lock.
+// Deleted locks are acquired immediately, but expiration of a lock is not
+// observable and is only noticed on retry. Defaults to half of the TTL.
+func RetryInterval(interval time.Duration) Option {
+	return func(opts *options) error {
+		if interval <= 0 {
+			return fmt.Errorf("%w: retry interval has to be greater than 0", jetstream.ErrInvalidOption)
+		}
+		opts.retryInterval = interval
+		return nil
+	}
+}
+
+// Acquire blocks until the lock identified by name (a key in kv) is
+// acquired or ctx is done. The returned lease is refreshed every third of
+// ttl, which cannot exceed the TTL of the bucket. ctx is only used for the
+// acquisition, the lease is kept until it is released or lost.
+func Acquire(ctx context.Context, kv jetstream.KeyValue, name string, ttl time.Duration, opts ...Option) (*Lease, error) {
+	o, err := parseOptions(ctx, kv, ttl, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// watch for deletes of the lock to retry without waiting
+	watcher, err := kv.Watch(ctx, name, jetstream.UpdatesOnly())
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Stop()
+	updates := watcher.Updates()
+
+	for {
+		lease, err := acquire(ctx, kv, name, ttl, o)
+		if !errors.Is(err, ErrLocked) {
+			return lease, err
+		}
+		if err := waitForRetry(ctx, &updates, o.retryInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// waitForRetry waits until the lock is deleted or purged, the retry
+// interval elapses or ctx is done.
+func waitForRetry(ctx context.Context, updates *<-chan jetstream.KeyValueEntry, interval time.Duration) error {
+	retry := time.NewTimer(interval)
+	defer retry.Stop()
+	for {
+		select {
+		case entry, ok := <-*updates:
+			if !ok {
+				// watcher stopped, keep retrying on interval
+				*updates = nil
+				continue
+			}
+			if entry != nil && entry.Operation() != jetstream.KeyValuePut {
+				return nil
+			}
+		case <-retry.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// TryAcquire acquires the lock identified by name (a key in kv) if it is
+// not held, returning [ErrLocked] otherwise. See [Acquire].
+func TryAcquire(ctx context.Context, kv jetstream.KeyValue, name string, ttl time.Duration, opts ...Option) (*Lease, error) {
+	o, err := parseOptions(ctx, kv, ttl, opts)
+	if err != nil {
+		return nil, err
+	}
+	return acquire(ctx, kv, name, ttl, o)
+}
+
+// parseOptions applies opts and validates ttl against the TTL of the
+// bucket.
+func parseOptions(ctx context.Context, kv jetstream.KeyValue, ttl time.Duration, opts []Option) (options, error) {
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return o, err
+		}
+	}
+	if ttl <= 0 {
+		return o, fmt.Errorf("%w: ttl has to be greater than 0", ErrInvalidTTL)
+	}
+	status, err := kv.Status(ctx)
+	if err != nil {
+		return o, err
+	}
+	if status.TTL() == 0 {
+		return o, fmt.Errorf("%w: bucket %q has no ttl", ErrInvalidTTL, kv.Bucket())
+	}
+	if ttl > status.TTL() {
+		return o, fmt.Errorf("%w: ttl %v exceeds bucket ttl %v", ErrInvalidTTL, ttl, status.TTL())
+	}
+	if o.retryInterval == 0 {
+		o.retryInterval = ttl / 2
+	}
+	return o, nil
+}
+
+// acquire performs a single attempt to create the lock key.
+func acquire(ctx context.Context, kv jetstream.KeyValue, name string, ttl time.Duration, o options) (*Lease, error) {
+	holder := o.holder
+	if holder == "" {
+		holder = nuid.Next()
+	}
+	// the lease may only be assumed valid for ttl after the request was sent
+	sent := time.Now()
+	revision, err := kv.Create(ctx, name, []byte(holder))
+	if err != nil {
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	l := &Lease{
+		kv:       kv,
+		key:      name,
+		holder:   holder,
+		ttl:      ttl,
+		token:    revision,
+		revision: revision,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	// changes made before the watcher was created are detected on refresh
+	l.watcher, err = kv.Watch(context.Background(), name, jetstream.UpdatesOnly())
+	if err != nil {
+		kv.Delete(ctx, name, jetstream.LastRevision(revision))
+		return nil, err
+	}
+	go l.run(sent)
+	return l, nil
+}
+
+// run refreshes the lease and watches the lock key until the lease is
+// released or lost.
+func (l *Lease) run(acquired time.Time) {
+	defer close(l.stopped)
+	defer l.watcher.Stop()
+
+	refresh := time.NewTicker(l.ttl / 3)
+	defer refresh.Stop()
+	deadline := acquired.Add(l.ttl)
+	expire := time.NewTimer(time.Until(deadline))
+	defer expire.Stop()
+
+	updates := l.watcher.Updates()
+	for {
+		select {
+		case entry, ok := <-updates:
+			if !ok {
+				// watcher stopped, lease loss is detected on refresh
+				updates = nil
+				continue
+			}
+			if entry == nil {
+				continue
+			}
+			if !l.adopt(entry) {
+				l.finish(ErrLeaseLost)
+				return
+			}
+		case <-refresh.C:
+			sent := time.Now()
+			if err := l.refresh(deadline); err != nil {
+				if errors.Is(err, jetstream.ErrKeyExists) && l.adoptLatest(deadline) {
+					// the reply of a previous refresh was lost, retry on the
+					// next tick using the adopted revision
+					continue
+				}
+				if errors.Is(err, jetstream.ErrKeyExists) || !time.Now().Before(deadline) {
+					l.finish(ErrLeaseLost)
+					return
+				}
+				// retry on the next tick, until the lease expires
+				continue
+			}
+			deadline = sent.Add(l.ttl)
+			if !expire.Stop() {
+				select {
+				case <-expire.C:
+				default:
+				}
+			}
+			expire.Reset(time.Until(deadline))
+		case <-expire.C:
+			l.finish(ErrLeaseLost)
+			return
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// refresh updates the lock key, resetting its TTL. The request is canceled
+// once the lease expires, so that loss of the lease is not detected late.
+func (l *Lease) refresh(deadline time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+	defer cancel()
+	ctx, cancelDeadline := context.WithDeadline(ctx, deadline)
+	defer cancelDeadline()
+	l.mu.Lock()
+	revision := l.revision
+	l.mu.Unlock()
+	revision, err := l.kv.Update(ctx, l.key, []byte(l.holder), revision)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.revision = revision
+	l.mu.Unlock()
+	return nil
+}
+
+// adopt records the revision of an update of the lock key made by this
+// lease, which is newer than the lease revision if the reply of a refresh
+// was lost. It returns false if the key is no longer held by the lease.
+func (l *Lease) adopt(entry jetstream.KeyValueEntry) bool {
+	if entry.Operation() != jetstream.KeyValuePut || string(entry.Value()) != l.holder {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if entry.Revision() > l.revision {
+		l.revision = entry.Revision()
+	}
+	return true
+}
+
+// adoptLatest gets the lock key after a refresh failed on a revision
+// mismatch, adopting its revision if it is still held by the lease at a
+// newer revision than the lease revision.
+func (l *Lease) adoptLatest(deadline time.Time) bool {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	entry, err := l.kv.Get(ctx, l.key)
+	if err != nil || entry.Revision() <= l.Revision() {
+		return false
+	}
+	return l.adopt(entry)
+}
+
+// finish marks the lease as released or lost.
+func (l *Lease) finish(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+	l.err = err
+	close(l.done)
+}
+
+// Key returns the key of the lock.
+func (l *Lease) Key() string {
+	return l.key
+}
+
+// Token returns the fencing token of the lease: the revision at which the
+// lock was acquired. Tokens increase with each acquisition of the lock.
+func (l *Lease) Token() uint64 {
+	return l.token
+}
+
+// Revision returns the latest revision of the lock key, which changes on
+// each refresh.
+func (l *Lease) Revision() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.revision
+}
+
+// Done returns a channel which is closed when the lease is released or
+// lost.
+func (l *Lease) Done() <-chan struct{} {
+	return l.done
+}
+
+// Err returns nil while the lease is held, [ErrLeaseLost] if it was lost
+// and [ErrLeaseReleased] after it was released.
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release stops refreshing the lease and deletes the lock key if it was
+// not modified by another holder, so that the lock can be acquired without
+// waiting for it to expire. If the lease was lost, [ErrLeaseLost] is
+// returned. Calling Release on a released lease is a no-op.
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.stopped
+
+	l.mu.Lock()
+	err, revision, releasing := l.err, l.revision, l.releasing
+	l.releasing = true
+	l.mu.Unlock()
+	if errors.Is(err, ErrLeaseLost) {
+		return err
+	}
+	if err != nil || releasing {
+		return nil
+	}
+
+	err = l.kv.Delete(ctx, l.key, jetstream.LastRevision(revision))
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		l.finish(ErrLeaseLost)
+		return ErrLeaseLost
+	}
+	// if the delete failed otherwise, the lock expires as it is no longer
+	// refreshed
+	l.finish(ErrLeaseReleased)
+	return err
+}
@@ -0,0 +1,282 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvlock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/jetstream/jetstreamtest"
+)
+
+// lostReplyKV applies the next update but fails it as if its reply was
+// lost.
+type lostReplyKV struct {
+	jetstream.KeyValue
+	loseReply atomic.Bool
+}
+
+func (kv *lostReplyKV) Update(ctx context.Context, key string, value []byte, revision uint64) (uint64, error) {
+	revision, err := kv.KeyValue.Update(ctx, key, value, revision)
+	if err == nil && kv.loseReply.CompareAndSwap(true, false) {
+		return 0, nats.ErrTimeout
+	}
+	return revision, err
+}
+
+func newBucket(t *testing.T, ttl time.Duration) (jetstream.JetStream, jetstream.KeyValue) {
+	t.Helper()
+	js := jetstreamtest.New()
+	kv, err := js.CreateKeyValue(context.Background(), jetstream.KeyValueConfig{Bucket: "LOCKS", TTL: ttl})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return js, kv
+}
+
+func expectDone(t *testing.T, l *Lease, expected error) {
+	t.Helper()
+	select {
+	case <-l.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Lease was not done")
+	}
+	if err := l.Err(); !errors.Is(err, expected) {
+		t.Fatalf("Expected error: %v; got: %v", expected, err)
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	ctx := context.Background()
+	_, kv := newBucket(t, time.Second)
+
+	l, err := TryAcquire(ctx, kv, "job", time.Second, Holder("a"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if l.Key() != "job" || l.Err() != nil {
+		t.Fatalf("Invalid lease: %s %v", l.Key(), l.Err())
+	}
+	entry, err := kv.Get(ctx, "job")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(entry.Value()) != "a" || entry.Revision() != l.Token() {
+		t.Fatalf("Invalid lock entry: %q %d", entry.Value(), entry.Revision())
+	}
+
+	if _, err := TryAcquire(ctx, kv, "job", time.Second); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected error: %v; got: %v", ErrLocked, err)
+	}
+
+	if err := l.Release(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expectDone(t, l, ErrLeaseReleased)
+	if err := l.Release(ctx); err != nil {
+		t.Fatalf("Expected second release to be a no-op; got: %v", err)
+	}
+
+	l2, err := TryAcquire(ctx, kv, "job", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l2.Release(ctx)
+	if l2.Token() <= l.Token() {
+		t.Fatalf("Expected fencing token to increase; got %d after %d", l2.Token(), l.Token())
+	}
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, kv := newBucket(t, time.Minute)
+
+	l, err := Acquire(ctx, kv, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	acquired := make(chan *Lease)
+	errs := make(chan error, 1)
+	go func() {
+		l, err := Acquire(ctx, kv, "job", time.Minute)
+		if err != nil {
+			errs <- err
+			return
+		}
+		acquired <- l
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Lock should not be acquired while held")
+	case err := <-errs:
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// the default retry interval is 30s, so the lock is acquired due to
+	// the delete marker
+	if err := l.Release(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case l2 := <-acquired:
+		l2.Release(ctx)
+	case err := <-errs:
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Lock was not acquired after release")
+	}
+
+	// acquisition is canceled with ctx
+	l, err = Acquire(ctx, kv, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Release(ctx)
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	if _, err := Acquire(shortCtx, kv, "job", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected error: %v; got: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestLeaseRefresh(t *testing.T) {
+	ctx := context.Background()
+	_, kv := newBucket(t, 300*time.Millisecond)
+
+	l, err := TryAcquire(ctx, kv, "job", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Release(ctx)
+
+	// the lock key would have expired without refreshing
+	time.Sleep(700 * time.Millisecond)
+	if _, err := TryAcquire(ctx, kv, "job", 300*time.Millisecond); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Expected error: %v; got: %v", ErrLocked, err)
+	}
+	if l.Err() != nil {
+		t.Fatalf("Unexpected lease error: %v", l.Err())
+	}
+	if l.Revision() == l.Token() {
+		t.Fatalf("Expected revision to change on refresh")
+	}
+}
+
+func TestLeaseRefreshLostReply(t *testing.T) {
+	ctx := context.Background()
+	_, kv := newBucket(t, 300*time.Millisecond)
+
+	lossy := &lostReplyKV{KeyValue: kv}
+	l, err := TryAcquire(ctx, lossy, "job", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer l.Release(ctx)
+
+	// the refresh is applied on the server, so the lease is kept at the
+	// newer revision
+	lossy.loseReply.Store(true)
+	time.Sleep(700 * time.Millisecond)
+	if lossy.loseReply.Load() {
+		t.Fatalf("Expected a refresh to be made")
+	}
+	if l.Err() != nil {
+		t.Fatalf("Unexpected lease error: %v", l.Err())
+	}
+	entry, err := kv.Get(ctx, "job")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entry.Revision() != l.Revision() {
+		t.Fatalf("Expected lease revision %d to match the key; got %d", entry.Revision(), l.Revision())
+	}
+}
+
+func TestLeaseLost(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("key modified", func(t *testing.T) {
+		_, kv := newBucket(t, time.Minute)
+		l, err := TryAcquire(ctx, kv, "job", time.Minute)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := kv.PutString(ctx, "job", "other"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectDone(t, l, ErrLeaseLost)
+		if err := l.Release(ctx); !errors.Is(err, ErrLeaseLost) {
+			t.Fatalf("Expected error: %v; got: %v", ErrLeaseLost, err)
+		}
+		// the lock held by another holder is left intact
+		entry, err := kv.Get(ctx, "job")
+		if err != nil || string(entry.Value()) != "other" {
+			t.Fatalf("Expected lock of other holder to be kept; got %v", err)
+		}
+	})
+
+	t.Run("key deleted", func(t *testing.T) {
+		_, kv := newBucket(t, time.Minute)
+		l, err := TryAcquire(ctx, kv, "job", time.Minute)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := kv.Delete(ctx, "job"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectDone(t, l, ErrLeaseLost)
+	})
+
+	t.Run("refresh failing", func(t *testing.T) {
+		js, kv := newBucket(t, 300*time.Millisecond)
+		l, err := TryAcquire(ctx, kv, "job", 300*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := js.DeleteKeyValue(ctx, "LOCKS"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectDone(t, l, ErrLeaseLost)
+	})
+}
+
+func TestInvalidTTL(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		bucketTTL time.Duration
+		ttl       time.Duration
+	}{
+		{name: "no bucket ttl", bucketTTL: 0, ttl: time.Second},
+		{name: "ttl exceeds bucket ttl", bucketTTL: time.Second, ttl: time.Minute},
+		{name: "zero ttl", bucketTTL: time.Second, ttl: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, kv := newBucket(t, test.bucketTTL)
+			if _, err := TryAcquire(ctx, kv, "job", test.ttl); !errors.Is(err, ErrInvalidTTL) {
+				t.Fatalf("Expected error: %v; got: %v", ErrInvalidTTL, err)
+			}
+		})
+	}
+}
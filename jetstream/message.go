@@ -126,9 +126,10 @@ type (
 	}
 
 	jetStreamMsg struct {
-		msg  *nats.Msg
-		ackd bool
-		js   *jetStream
+		msg   *nats.Msg
+		ackd  bool
+		js    *jetStream
+		stats *consumeStats
 		sync.Mutex
 	}
 
@@ -373,6 +374,7 @@ func (m *jetStreamMsg) ackReply(ctx context.Context, ackType ackType, sync bool,
 		m.ackd = true
 		m.Unlock()
 	}
+	m.stats.recordAck(ackType)
 	return nil
 }
 
@@ -0,0 +1,406 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type (
+	// Middleware wraps a [MessageHandler], adding behavior before and/or
+	// after the message is handled. Middleware can be set on Consume and
+	// Messages using [WithConsumeMiddleware] or applied to a handler using
+	// [ChainMiddleware].
+	Middleware func(next MessageHandler) MessageHandler
+
+	// msgWithContext is passed to handlers wrapped with
+	// DeadlineMiddleware.
+	msgWithContext struct {
+		Msg
+		ctx context.Context
+	}
+
+	// msgWrapper is implemented by messages wrapping another message.
+	msgWrapper interface {
+		unwrap() Msg
+	}
+
+	// middlewareMessages applies middleware to messages returned by Next
+	// of the wrapped MessagesContext.
+	middlewareMessages struct {
+		MessagesContext
+		middleware []Middleware
+
+		sync.Mutex
+		// release ends handling of the message last returned by Next,
+		// handled is closed once the middleware returned
+		release chan struct{}
+		handled chan struct{}
+	}
+)
+
+// ChainMiddleware wraps handler with the provided middleware. The first
+// middleware is the outermost one, i.e. it is called first when handling a
+// message.
+//
+// To apply middleware to messages returned by [MessagesContext.Next], use
+// [WithConsumeMiddleware] or [ChainMessagesMiddleware].
+func ChainMiddleware(handler MessageHandler, middleware ...Middleware) MessageHandler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// ChainMessagesMiddleware returns a [MessagesContext] applying the provided
+// middleware to messages returned by Next of msgs, the same way as
+// [WithConsumeMiddleware] does for Messages.
+//
+// A message returned by Next is handled by the caller until Next is called
+// again or the MessagesContext is stopped, at which point the middleware
+// returns, e.g. logging the message or negatively acknowledging it if it
+// was not acknowledged. As the caller processes the message outside of the
+// middleware chain, panics in the caller are not recovered by
+// [RecoverMiddleware].
+func ChainMessagesMiddleware(msgs MessagesContext, middleware ...Middleware) MessagesContext {
+	if len(middleware) == 0 {
+		return msgs
+	}
+	return &middlewareMessages{MessagesContext: msgs, middleware: middleware}
+}
+
+// Next ends handling of the previous message and returns the next message
+// passed through the middleware. Messages which are not passed to the
+// handler by the middleware are skipped.
+func (m *middlewareMessages) Next() (Msg, error) {
+	m.finish()
+	for {
+		msg, err := m.MessagesContext.Next()
+		if err != nil {
+			return nil, err
+		}
+		if msg, ok := m.handle(msg); ok {
+			return msg, nil
+		}
+	}
+}
+
+// handle runs the middleware for msg in a separate goroutine, returning
+// the message passed to the handler. The handler blocks until handling of
+// the message is ended using finish.
+func (m *middlewareMessages) handle(msg Msg) (Msg, bool) {
+	out := make(chan Msg, 1)
+	release := make(chan struct{})
+	handled := make(chan struct{})
+	handler := ChainMiddleware(func(msg Msg) {
+		out <- msg
+		<-release
+	}, m.middleware...)
+	go func() {
+		defer close(handled)
+		handler(msg)
+	}()
+	select {
+	case msg := <-out:
+		m.Lock()
+		m.release, m.handled = release, handled
+		m.Unlock()
+		return msg, true
+	case <-handled:
+		return nil, false
+	}
+}
+
+// finish ends handling of the message last returned by Next and waits for
+// the middleware to return.
+func (m *middlewareMessages) finish() {
+	m.Lock()
+	release, handled := m.release, m.handled
+	m.release, m.handled = nil, nil
+	m.Unlock()
+	if release == nil {
+		return
+	}
+	close(release)
+	<-handled
+}
+
+// Stop unsubscribes from the stream and ends handling of the message last
+// returned by Next.
+func (m *middlewareMessages) Stop() {
+	m.MessagesContext.Stop()
+	m.finish()
+}
+
+// RecoverMiddleware recovers from panics in the handler and terminates the
+// message using [Msg.TermWithReason], so that it is not redelivered. If
+// set, onPanic is called with the message and the recovered value before
+// the message is terminated.
+func RecoverMiddleware(onPanic func(msg Msg, recovered any)) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg Msg) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if onPanic != nil {
+					onPanic(msg, r)
+				}
+				msg.TermWithReason(fmt.Sprintf("panic: %v", r))
+			}()
+			next(msg)
+		}
+	}
+}
+
+// NakBackoffMiddleware negatively acknowledges messages which were not
+// acknowledged by the handler, using [Msg.NakWithDelay]. The delay starts
+// at initial and is doubled with each delivery of the message, up to max.
+func NakBackoffMiddleware(initial, max time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg Msg) {
+			next(msg)
+			if msgAcked(msg) {
+				return
+			}
+			meta, err := msg.Metadata()
+			if err != nil {
+				return
+			}
+			msg.NakWithDelay(backoffDelay(initial, max, meta.NumDelivered))
+		}
+	}
+}
+
+func backoffDelay(initial, max time.Duration, delivered uint64) time.Duration {
+	delay := initial
+	for i := uint64(1); i < delivered && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// DeadlineMiddleware limits the time available to handle a message to
+// ackWait, which should be set to the AckWait of the consumer. The deadline
+// is available to the handler using [MsgContext]. Once the deadline is
+// exceeded, the server will redeliver the message, so acknowledgements sent
+// by the handler are rejected with [ErrAckWaitExceeded].
+func DeadlineMiddleware(ackWait time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg Msg) {
+			ctx, cancel := context.WithTimeout(MsgContext(msg), ackWait)
+			defer cancel()
+			next(&msgWithContext{Msg: msg, ctx: ctx})
+		}
+	}
+}
+
+// InProgressMiddleware periodically sends [Msg.InProgress] while the
+// handler is running, preventing redelivery of messages which take longer
+// than AckWait to process. Keep-alives are sent every interval until the
+// message is acknowledged (including Nak and Term) or the handler returns.
+// If maxExtension is greater than 0, keep-alives are no longer sent once
+// the message was handled for longer than maxExtension.
+//
+// The interval should be lower than the AckWait of the consumer.
+func InProgressMiddleware(interval, maxExtension time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(msg Msg) {
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				var deadline <-chan time.Time
+				if maxExtension > 0 {
+					timer := time.NewTimer(maxExtension)
+					defer timer.Stop()
+					deadline = timer.C
+				}
+				for {
+					select {
+					case <-ticker.C:
+						if msgAcked(msg) {
+							return
+						}
+						msg.InProgress()
+					case <-deadline:
+						return
+					case <-done:
+						return
+					}
+				}
+			}()
+			next(msg)
+		}
+	}
+}
+
+// autoInProgressInterval returns the interval used by WithAutoInProgress,
+// validating it against the AckWait of the consumer.
+func autoInProgressInterval(interval, ackWait time.Duration) (time.Duration, error) {
+	if ackWait == 0 {
+		ackWait = defaultConsumerAckWait
+	}
+	if interval == 0 {
+		return ackWait / 2, nil
+	}
+	if interval >= ackWait {
+		return 0, fmt.Errorf("%w: auto in progress interval should be lower than AckWait (%s)", ErrInvalidOption, ackWait)
+	}
+	return interval, nil
+}
+
+// LoggingMiddleware logs each handled message using the provided logger,
+// including message metadata and the time it took to handle the message.
+// If logger is nil, [slog.Default] is used.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(next MessageHandler) MessageHandler {
+		return func(msg Msg) {
+			start := time.Now()
+			next(msg)
+			attrs := []slog.Attr{
+				slog.String("subject", msg.Subject()),
+				slog.Duration("duration", time.Since(start)),
+				slog.Bool("acked", msgAcked(msg)),
+			}
+			if meta, err := msg.Metadata(); err == nil {
+				attrs = append(attrs,
+					slog.String("stream", meta.Stream),
+					slog.String("consumer", meta.Consumer),
+					slog.Uint64("stream_seq", meta.Sequence.Stream),
+					slog.Uint64("consumer_seq", meta.Sequence.Consumer),
+					slog.Uint64("num_delivered", meta.NumDelivered),
+				)
+			}
+			logger.LogAttrs(MsgContext(msg), slog.LevelInfo, "message handled", attrs...)
+		}
+	}
+}
+
+// MsgContext returns the context associated with the message by
+// [DeadlineMiddleware]. If no context is associated with the message,
+// [context.Background] is returned.
+func MsgContext(msg Msg) context.Context {
+	for msg != nil {
+		if m, ok := msg.(*msgWithContext); ok {
+			return m.ctx
+		}
+		w, ok := msg.(msgWrapper)
+		if !ok {
+			break
+		}
+		msg = w.unwrap()
+	}
+	return context.Background()
+}
+
+// msgAcked returns true if the message was acknowledged. Messages of
+// unknown implementations are considered acknowledged.
+func msgAcked(msg Msg) bool {
+	for {
+		switch m := msg.(type) {
+		case *jetStreamMsg:
+			m.Lock()
+			defer m.Unlock()
+			return m.ackd
+		case msgWrapper:
+			msg = m.unwrap()
+		default:
+			return true
+		}
+	}
+}
+
+func (m *msgWithContext) unwrap() Msg {
+	return m.Msg
+}
+
+func (m *msgWithContext) checkDeadline() error {
+	if m.ctx.Err() != nil {
+		return ErrAckWaitExceeded
+	}
+	return nil
+}
+
+// Ack acknowledges a message, unless the deadline is exceeded.
+func (m *msgWithContext) Ack() error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.Ack()
+}
+
+// DoubleAck acknowledges a message and waits for ack reply from the
+// server, unless the deadline is exceeded.
+func (m *msgWithContext) DoubleAck(ctx context.Context) error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.DoubleAck(ctx)
+}
+
+// Nak negatively acknowledges a message, unless the deadline is exceeded.
+func (m *msgWithContext) Nak() error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.Nak()
+}
+
+// NakWithDelay negatively acknowledges a message with delay, unless the
+// deadline is exceeded.
+func (m *msgWithContext) NakWithDelay(delay time.Duration) error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.NakWithDelay(delay)
+}
+
+// InProgress tells the server that this message is being worked on,
+// unless the deadline is exceeded.
+func (m *msgWithContext) InProgress() error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.InProgress()
+}
+
+// Term terminates a message, unless the deadline is exceeded.
+func (m *msgWithContext) Term() error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.Term()
+}
+
+// TermWithReason terminates a message with a reason, unless the deadline
+// is exceeded.
+func (m *msgWithContext) TermWithReason(reason string) error {
+	if err := m.checkDeadline(); err != nil {
+		return err
+	}
+	return m.Msg.TermWithReason(reason)
+}
@@ -0,0 +1,437 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// Monitor periodically polls info of streams and consumers and
+	// evaluates [MonitorRules] against it. It is created using
+	// [NewMonitor].
+	//
+	// An alert is emitted when a rule starts being violated, and a resolved
+	// alert is emitted once it is no longer violated. Alerts which are
+	// currently active are available in the snapshot returned by Snapshot.
+	Monitor interface {
+		// Alerts returns a channel on which alerts are delivered. The
+		// channel is closed when the monitor is stopped. Polling is blocked
+		// until alerts are received from the channel.
+		Alerts() <-chan MonitorAlert
+
+		// Snapshot returns the latest info of monitored streams and
+		// consumers, together with currently active alerts.
+		Snapshot() MonitorSnapshot
+
+		// Stop stops polling and closes the alerts channel.
+		Stop() error
+	}
+
+	// MonitorConfig is the configuration of a [Monitor].
+	MonitorConfig struct {
+		// Streams is the list of monitored streams. Stream info is used to
+		// evaluate the lag of stream mirrors and sources.
+		Streams []string
+
+		// Consumers is the list of monitored consumers.
+		Consumers []MonitorConsumer
+
+		// Interval is the interval at which consumer info is polled.
+		// Defaults to 10s.
+		Interval time.Duration
+
+		// StreamInterval is the interval at which stream info is polled.
+		// Defaults to Interval.
+		StreamInterval time.Duration
+
+		// Rules are the thresholds evaluated on each poll.
+		Rules MonitorRules
+	}
+
+	// MonitorConsumer identifies a consumer monitored by a [Monitor].
+	MonitorConsumer struct {
+		// Stream is the name of the stream of the consumer.
+		Stream string
+
+		// Consumer is the name of the consumer.
+		Consumer string
+	}
+
+	// MonitorRules contains thresholds evaluated by a [Monitor]. Rules set
+	// to 0 are disabled.
+	MonitorRules struct {
+		// MaxPending is the maximum number of messages pending for a
+		// consumer (NumPending in [ConsumerInfo]).
+		MaxPending uint64
+
+		// AckPendingRatio is the maximum ratio of messages pending
+		// acknowledgement to MaxAckPending of a consumer, e.g. 0.9. It is
+		// not evaluated for consumers without MaxAckPending.
+		AckPendingRatio float64
+
+		// MaxRedelivered is the maximum increase of the number of
+		// redelivered messages (NumRedelivered in [ConsumerInfo]) between
+		// two polls.
+		MaxRedelivered int
+
+		// MaxLag is the maximum lag of a stream mirror or source.
+		MaxLag uint64
+	}
+
+	// MonitorAlertType identifies the rule which triggered a
+	// [MonitorAlert].
+	MonitorAlertType string
+
+	// MonitorAlert is emitted by a [Monitor] when a rule is violated or
+	// resolved.
+	MonitorAlert struct {
+		// Type is the kind of the alert.
+		Type MonitorAlertType
+
+		// Stream is the name of the stream the alert relates to.
+		Stream string
+
+		// Consumer is the name of the consumer the alert relates to. It is
+		// empty for stream alerts.
+		Consumer string
+
+		// Source is the name of the mirrored or sourced stream, set for
+		// [MonitorAlertLag].
+		Source string
+
+		// Value is the value which violated the rule. For
+		// [MonitorAlertAckPending], it is the number of messages pending
+		// acknowledgement.
+		Value uint64
+
+		// Threshold is the threshold of the rule. For
+		// [MonitorAlertAckPending], it is the number of messages pending
+		// acknowledgement derived from the configured ratio.
+		Threshold uint64
+
+		// Err is the error returned when polling, set for
+		// [MonitorAlertUnavailable].
+		Err error
+
+		// Resolved is true if the rule is no longer violated.
+		Resolved bool
+
+		// Time is the time of the poll which triggered the alert.
+		Time time.Time
+	}
+
+	// MonitorSnapshot contains the latest state observed by a [Monitor].
+	MonitorSnapshot struct {
+		// Streams contains the latest info of monitored streams.
+		Streams map[string]*StreamInfo
+
+		// Consumers contains the latest info of monitored consumers.
+		Consumers map[MonitorConsumer]*ConsumerInfo
+
+		// Alerts contains currently active alerts.
+		Alerts []MonitorAlert
+
+		// Updated is the time of the latest poll.
+		Updated time.Time
+	}
+
+	monitor struct {
+		sync.Mutex
+		js        JetStream
+		cfg       MonitorConfig
+		alerts    chan MonitorAlert
+		streams   map[string]*StreamInfo
+		consumers map[MonitorConsumer]*ConsumerInfo
+		active    map[monitorAlertKey]MonitorAlert
+		updated   time.Time
+		done      chan struct{}
+		stopped   chan struct{}
+		stopOnce  sync.Once
+	}
+
+	monitorAlertKey struct {
+		alertType MonitorAlertType
+		stream    string
+		consumer  string
+		source    string
+	}
+)
+
+const (
+	// MonitorAlertPending is emitted when the number of messages pending
+	// for a consumer exceeds [MonitorRules.MaxPending].
+	MonitorAlertPending MonitorAlertType = "pending"
+
+	// MonitorAlertAckPending is emitted when the number of messages
+	// pending acknowledgement reaches [MonitorRules.AckPendingRatio] of
+	// MaxAckPending.
+	MonitorAlertAckPending MonitorAlertType = "ack_pending"
+
+	// MonitorAlertRedelivered is emitted when the number of redelivered
+	// messages increases by more than [MonitorRules.MaxRedelivered]
+	// between two polls.
+	MonitorAlertRedelivered MonitorAlertType = "redelivered"
+
+	// MonitorAlertLag is emitted when the lag of a stream mirror or
+	// source exceeds [MonitorRules.MaxLag].
+	MonitorAlertLag MonitorAlertType = "lag"
+
+	// MonitorAlertUnavailable is emitted when info of a stream or consumer
+	// could not be retrieved, e.g. because it was deleted.
+	MonitorAlertUnavailable MonitorAlertType = "unavailable"
+)
+
+const defaultMonitorInterval = 10 * time.Second
+
+// NewMonitor creates a [Monitor] and starts polling the configured streams
+// and consumers. The first poll is performed immediately.
+func NewMonitor(js JetStream, cfg MonitorConfig) (Monitor, error) {
+	if len(cfg.Streams) == 0 && len(cfg.Consumers) == 0 {
+		return nil, fmt.Errorf("%w: no streams or consumers to monitor", ErrInvalidOption)
+	}
+	for _, name := range cfg.Streams {
+		if err := validateStreamName(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range cfg.Consumers {
+		if err := validateStreamName(c.Stream); err != nil {
+			return nil, err
+		}
+		if err := validateConsumerName(c.Consumer); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Interval < 0 || cfg.StreamInterval < 0 {
+		return nil, fmt.Errorf("%w: monitor interval cannot be negative", ErrInvalidOption)
+	}
+	if cfg.Rules.AckPendingRatio < 0 || cfg.Rules.AckPendingRatio > 1 {
+		return nil, fmt.Errorf("%w: ack pending ratio should be between 0 and 1", ErrInvalidOption)
+	}
+	if cfg.Rules.MaxRedelivered < 0 {
+		return nil, fmt.Errorf("%w: max redelivered cannot be negative", ErrInvalidOption)
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = defaultMonitorInterval
+	}
+	if cfg.StreamInterval == 0 {
+		cfg.StreamInterval = cfg.Interval
+	}
+
+	m := &monitor{
+		js:        js,
+		cfg:       cfg,
+		alerts:    make(chan MonitorAlert, 256),
+		streams:   make(map[string]*StreamInfo),
+		consumers: make(map[MonitorConsumer]*ConsumerInfo),
+		active:    make(map[monitorAlertKey]MonitorAlert),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go m.run()
+	return m, nil
+}
+
+// Alerts returns a channel on which alerts are delivered.
+func (m *monitor) Alerts() <-chan MonitorAlert {
+	return m.alerts
+}
+
+// Snapshot returns the latest info of monitored streams and consumers.
+func (m *monitor) Snapshot() MonitorSnapshot {
+	m.Lock()
+	defer m.Unlock()
+	snapshot := MonitorSnapshot{
+		Streams:   make(map[string]*StreamInfo, len(m.streams)),
+		Consumers: make(map[MonitorConsumer]*ConsumerInfo, len(m.consumers)),
+		Alerts:    make([]MonitorAlert, 0, len(m.active)),
+		Updated:   m.updated,
+	}
+	for name, info := range m.streams {
+		snapshot.Streams[name] = info
+	}
+	for c, info := range m.consumers {
+		snapshot.Consumers[c] = info
+	}
+	for _, alert := range m.active {
+		snapshot.Alerts = append(snapshot.Alerts, alert)
+	}
+	sort.Slice(snapshot.Alerts, func(i, j int) bool {
+		return snapshot.Alerts[i].Time.Before(snapshot.Alerts[j].Time)
+	})
+	return snapshot
+}
+
+// Stop stops polling.
+func (m *monitor) Stop() error {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+	<-m.stopped
+	return nil
+}
+
+func (m *monitor) run() {
+	defer close(m.stopped)
+	defer close(m.alerts)
+
+	consumerTicker := time.NewTicker(m.cfg.Interval)
+	defer consumerTicker.Stop()
+	streamTicker := time.NewTicker(m.cfg.StreamInterval)
+	defer streamTicker.Stop()
+
+	m.pollStreams()
+	m.pollConsumers()
+	for {
+		select {
+		case <-streamTicker.C:
+			m.pollStreams()
+		case <-consumerTicker.C:
+			m.pollConsumers()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *monitor) pollStreams() {
+	for _, name := range m.cfg.Streams {
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.StreamInterval)
+		s, err := m.js.Stream(ctx, name)
+		cancel()
+		now := time.Now()
+		key := monitorAlertKey{alertType: MonitorAlertUnavailable, stream: name}
+		if err != nil {
+			m.fire(key, MonitorAlert{Err: err, Time: now})
+			continue
+		}
+		m.resolve(key, now)
+
+		info := s.CachedInfo()
+		m.Lock()
+		m.streams[name] = info
+		m.updated = now
+		m.Unlock()
+
+		sources := info.Sources
+		if info.Mirror != nil {
+			sources = append([]*StreamSourceInfo{info.Mirror}, sources...)
+		}
+		for _, source := range sources {
+			if source == nil {
+				continue
+			}
+			key := monitorAlertKey{alertType: MonitorAlertLag, stream: name, source: source.Name}
+			m.evaluate(key, m.cfg.Rules.MaxLag > 0 && source.Lag > m.cfg.Rules.MaxLag,
+				MonitorAlert{Value: source.Lag, Threshold: m.cfg.Rules.MaxLag, Time: now})
+		}
+	}
+}
+
+func (m *monitor) pollConsumers() {
+	for _, c := range m.cfg.Consumers {
+		ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Interval)
+		cons, err := m.js.Consumer(ctx, c.Stream, c.Consumer)
+		cancel()
+		now := time.Now()
+		key := monitorAlertKey{alertType: MonitorAlertUnavailable, stream: c.Stream, consumer: c.Consumer}
+		if err != nil {
+			m.fire(key, MonitorAlert{Err: err, Time: now})
+			continue
+		}
+		m.resolve(key, now)
+
+		info := cons.CachedInfo()
+		m.Lock()
+		prev := m.consumers[c]
+		m.consumers[c] = info
+		m.updated = now
+		m.Unlock()
+
+		rules := m.cfg.Rules
+		m.evaluate(monitorAlertKey{alertType: MonitorAlertPending, stream: c.Stream, consumer: c.Consumer},
+			rules.MaxPending > 0 && info.NumPending > rules.MaxPending,
+			MonitorAlert{Value: info.NumPending, Threshold: rules.MaxPending, Time: now})
+
+		if rules.AckPendingRatio > 0 && info.Config.MaxAckPending > 0 {
+			threshold := uint64(rules.AckPendingRatio * float64(info.Config.MaxAckPending))
+			m.evaluate(monitorAlertKey{alertType: MonitorAlertAckPending, stream: c.Stream, consumer: c.Consumer},
+				uint64(info.NumAckPending) >= threshold,
+				MonitorAlert{Value: uint64(info.NumAckPending), Threshold: threshold, Time: now})
+		}
+
+		if rules.MaxRedelivered > 0 && prev != nil {
+			increase := max(info.NumRedelivered-prev.NumRedelivered, 0)
+			m.evaluate(monitorAlertKey{alertType: MonitorAlertRedelivered, stream: c.Stream, consumer: c.Consumer},
+				increase > rules.MaxRedelivered,
+				MonitorAlert{Value: uint64(increase), Threshold: uint64(rules.MaxRedelivered), Time: now})
+		}
+	}
+}
+
+// evaluate fires the alert if violated is true, otherwise resolves it.
+func (m *monitor) evaluate(key monitorAlertKey, violated bool, alert MonitorAlert) {
+	if violated {
+		m.fire(key, alert)
+		return
+	}
+	m.resolve(key, alert.Time)
+}
+
+// fire emits the alert unless it is already active. The alert is updated
+// in the snapshot either way.
+func (m *monitor) fire(key monitorAlertKey, alert MonitorAlert) {
+	alert.Type = key.alertType
+	alert.Stream = key.stream
+	alert.Consumer = key.consumer
+	alert.Source = key.source
+
+	m.Lock()
+	prev, ok := m.active[key]
+	if ok {
+		// keep the time the alert was first fired
+		alert.Time = prev.Time
+	}
+	m.active[key] = alert
+	m.Unlock()
+	if !ok {
+		m.emit(alert)
+	}
+}
+
+// resolve emits a resolved alert if the alert is active.
+func (m *monitor) resolve(key monitorAlertKey, now time.Time) {
+	m.Lock()
+	alert, ok := m.active[key]
+	delete(m.active, key)
+	m.Unlock()
+	if !ok {
+		return
+	}
+	alert.Resolved = true
+	alert.Time = now
+	m.emit(alert)
+}
+
+func (m *monitor) emit(alert MonitorAlert) {
+	select {
+	case m.alerts <- alert:
+	case <-m.done:
+	}
+}
@@ -30,7 +30,6 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
-	"github.com/nats-io/nats.go/internal/parser"
 	"github.com/nats-io/nuid"
 )
 
@@ -460,7 +459,6 @@ type (
 		name       string
 		streamName string
 		stream     Stream
-		pushJS     nats.JetStreamContext
 		js         *jetStream
 	}
 
@@ -476,12 +474,11 @@ type (
 )
 
 const (
-	objNameTmpl         = "OBJ_%s"     // OBJ_<bucket> // stream name
-	objAllChunksPreTmpl = "$O.%s.C.>"  // $O.<bucket>.C.> // chunk stream subject
-	objAllMetaPreTmpl   = "$O.%s.M.>"  // $O.<bucket>.M.> // meta stream subject
-	objChunksPreTmpl    = "$O.%s.C.%s" // $O.<bucket>.C.<object-nuid> // chunk message subject
-	objMetaPreTmpl      = "$O.%s.M.%s" // $O.<bucket>.M.<name-encoded> // meta message subject
-	objNoPending        = "0"
+	objNameTmpl         = "OBJ_%s"           // OBJ_<bucket> // stream name
+	objAllChunksPreTmpl = "$O.%s.C.>"        // $O.<bucket>.C.> // chunk stream subject
+	objAllMetaPreTmpl   = "$O.%s.M.>"        // $O.<bucket>.M.> // meta stream subject
+	objChunksPreTmpl    = "$O.%s.C.%s"       // $O.<bucket>.C.<object-nuid> // chunk message subject
+	objMetaPreTmpl      = "$O.%s.M.%s"       // $O.<bucket>.M.<name-encoded> // meta message subject
 	objDefaultChunkSize = uint32(128 * 1024) // 128k
 	objDigestType       = "SHA-256="
 	objDigestTmpl       = objDigestType + "%s"
@@ -502,12 +499,8 @@ func (js *jetStream) CreateObjectStore(ctx context.Context, cfg ObjectStoreConfi
 		}
 		return nil, err
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
 
-	return mapStreamToObjectStore(js, pushJS, cfg.Bucket, stream), nil
+	return mapStreamToObjectStore(js, cfg.Bucket, stream), nil
 }
 
 func (js *jetStream) UpdateObjectStore(ctx context.Context, cfg ObjectStoreConfig) (ObjectStore, error) {
@@ -524,12 +517,8 @@ func (js *jetStream) UpdateObjectStore(ctx context.Context, cfg ObjectStoreConfi
 		}
 		return nil, err
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
 
-	return mapStreamToObjectStore(js, pushJS, cfg.Bucket, stream), nil
+	return mapStreamToObjectStore(js, cfg.Bucket, stream), nil
 }
 
 func (js *jetStream) CreateOrUpdateObjectStore(ctx context.Context, cfg ObjectStoreConfig) (ObjectStore, error) {
@@ -542,12 +531,8 @@ func (js *jetStream) CreateOrUpdateObjectStore(ctx context.Context, cfg ObjectSt
 	if err != nil {
 		return nil, err
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
 
-	return mapStreamToObjectStore(js, pushJS, cfg.Bucket, stream), nil
+	return mapStreamToObjectStore(js, cfg.Bucket, stream), nil
 }
 
 func (js *jetStream) prepareObjectStoreConfig(ctx context.Context, cfg ObjectStoreConfig) (StreamConfig, error) {
@@ -607,11 +592,7 @@ func (js *jetStream) ObjectStore(ctx context.Context, bucket string) (ObjectStor
 		}
 		return nil, err
 	}
-	pushJS, err := js.legacyJetStream()
-	if err != nil {
-		return nil, err
-	}
-	return mapStreamToObjectStore(js, pushJS, bucket, stream), nil
+	return mapStreamToObjectStore(js, bucket, stream), nil
 }
 
 // DeleteObjectStore will delete the underlying stream for the named object.
@@ -874,16 +855,24 @@ func (obs *obs) Get(ctx context.Context, name string, opts ...GetObjectOpt) (Obj
 	pr, pw := net.Pipe()
 	result.r = pr
 
-	gotErr := func(m *nats.Msg, err error) {
-		pw.Close()
-		m.Sub.Unsubscribe()
+	// done is closed once all chunks were read or an error occurred.
+	done := make(chan struct{})
+	var doneOnce sync.Once
+	finish := func() {
+		doneOnce.Do(func() {
+			pw.Close()
+			close(done)
+		})
+	}
+	gotErr := func(err error) {
 		result.setErr(err)
+		finish()
 	}
 
 	// For calculating sum256
 	result.digest = sha256.New()
 
-	processChunk := func(m *nats.Msg) {
+	processChunk := func(m Msg) {
 		var err error
 		if ctx != nil {
 			select {
@@ -896,47 +885,49 @@ func (obs *obs) Get(ctx context.Context, name string, opts ...GetObjectOpt) (Obj
 			default:
 			}
 			if err != nil {
-				gotErr(m, err)
+				gotErr(err)
 				return
 			}
 		}
 
-		tokens, err := parser.GetMetadataFields(m.Reply)
+		meta, err := m.Metadata()
 		if err != nil {
-			gotErr(m, err)
+			gotErr(err)
 			return
 		}
 
 		// Write to our pipe.
-		for b := m.Data; len(b) > 0; {
+		for b := m.Data(); len(b) > 0; {
 			n, err := pw.Write(b)
 			if err != nil {
-				gotErr(m, err)
+				gotErr(err)
 				return
 			}
 			b = b[n:]
 		}
 		// Update sha256
-		result.digest.Write(m.Data)
+		result.digest.Write(m.Data())
 
 		// Check if we are done.
-		if tokens[parser.AckNumPendingTokenPos] == objNoPending {
-			pw.Close()
-			m.Sub.Unsubscribe()
+		if meta.NumPending == 0 {
+			finish()
 		}
 	}
 
 	chunkSubj := fmt.Sprintf(objChunksPreTmpl, obs.name, info.NUID)
-	streamName := fmt.Sprintf(objNameTmpl, obs.name)
-	subscribeOpts := []nats.SubOpt{
-		nats.OrderedConsumer(),
-		nats.Context(ctx),
-		nats.BindStream(streamName),
-	}
-	_, err = obs.pushJS.Subscribe(chunkSubj, processChunk, subscribeOpts...)
+	sub, err := obs.js.watchOrdered(ctx, obs.streamName, OrderedConsumerConfig{
+		FilterSubjects: []string{chunkSubj},
+	}, processChunk)
 	if err != nil {
 		return nil, err
 	}
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		sub.stop()
+	}()
 
 	return result, nil
 }
@@ -1243,8 +1234,12 @@ func (obs *obs) Seal(ctx context.Context) error {
 
 // Implementation for Watch
 type objWatcher struct {
-	updates chan *ObjectInfo
-	sub     *nats.Subscription
+	mu       sync.Mutex
+	updates  chan *ObjectInfo
+	sub      *watchSubscription
+	stop     chan struct{}
+	stopOnce sync.Once
+	closed   bool
 }
 
 // Updates returns the interior channel.
@@ -1255,12 +1250,41 @@ func (w *objWatcher) Updates() <-chan *ObjectInfo {
 	return w.updates
 }
 
-// Stop will unsubscribe from the watcher.
+// Stop will stop the underlying ordered consumer and close the updates
+// channel. Stopping a watcher which was already stopped, either directly
+// or by canceling its context, returns [nats.ErrBadSubscription].
 func (w *objWatcher) Stop() error {
 	if w == nil {
 		return nil
 	}
-	return w.sub.Unsubscribe()
+	err := nats.ErrBadSubscription
+	w.stopOnce.Do(func() {
+		err = nil
+		close(w.stop)
+		if w.sub != nil {
+			w.sub.stop()
+		}
+		w.mu.Lock()
+		w.closed = true
+		close(w.updates)
+		w.mu.Unlock()
+	})
+	return err
+}
+
+// send places info on the updates channel, blocking until it is consumed
+// or the watcher is stopped. It has to be called with the watcher lock
+// held.
+func (w *objWatcher) send(info *ObjectInfo) bool {
+	if w.closed {
+		return false
+	}
+	select {
+	case w.updates <- info:
+		return true
+	case <-w.stop:
+		return false
+	}
 }
 
 // Watch for changes in the underlying store and receive meta information updates.
@@ -1276,11 +1300,14 @@ func (obs *obs) Watch(ctx context.Context, opts ...WatchOpt) (ObjectWatcher, err
 
 	var initDoneMarker bool
 
-	w := &objWatcher{updates: make(chan *ObjectInfo, 32)}
+	w := &objWatcher{
+		updates: make(chan *ObjectInfo, 32),
+		stop:    make(chan struct{}),
+	}
 
-	update := func(m *nats.Msg) {
+	update := func(m Msg) {
 		var info ObjectInfo
-		if err := json.Unmarshal(m.Data, &info); err != nil {
+		if err := json.Unmarshal(m.Data(), &info); err != nil {
 			return // TODO(dlc) - Communicate this upwards?
 		}
 		meta, err := m.Metadata()
@@ -1288,16 +1315,20 @@ func (obs *obs) Watch(ctx context.Context, opts ...WatchOpt) (ObjectWatcher, err
 			return
 		}
 
+		w.mu.Lock()
+		defer w.mu.Unlock()
 		if !o.ignoreDeletes || !info.Deleted {
 			info.ModTime = meta.Timestamp
-			w.updates <- &info
+			if !w.send(&info) {
+				return
+			}
 		}
 
 		// if UpdatesOnly is set, no not send nil to the channel
 		// as it would always be triggered after initializing the watcher
 		if !initDoneMarker && meta.NumPending == 0 {
 			initDoneMarker = true
-			w.updates <- nil
+			w.send(nil)
 		}
 	}
 
@@ -1316,21 +1347,32 @@ func (obs *obs) Watch(ctx context.Context, opts ...WatchOpt) (ObjectWatcher, err
 		initDoneMarker = true
 	}
 
-	// Used ordered consumer to deliver results.
-	streamName := fmt.Sprintf(objNameTmpl, obs.name)
-	subOpts := []nats.SubOpt{nats.OrderedConsumer(), nats.BindStream(streamName)}
-	if !o.includeHistory {
-		subOpts = append(subOpts, nats.DeliverLastPerSubject())
+	// Use ordered consumer to deliver results.
+	cfg := OrderedConsumerConfig{
+		FilterSubjects: []string{allMeta},
+		DeliverPolicy:  DeliverLastPerSubjectPolicy,
+	}
+	if o.includeHistory {
+		cfg.DeliverPolicy = DeliverAllPolicy
 	}
 	if o.updatesOnly {
-		subOpts = append(subOpts, nats.DeliverNew())
+		cfg.DeliverPolicy = DeliverNewPolicy
 	}
-	subOpts = append(subOpts, nats.Context(ctx))
-	sub, err := obs.pushJS.Subscribe(allMeta, update, subOpts...)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sub, err := obs.js.watchOrdered(ctx, obs.streamName, cfg, update)
 	if err != nil {
 		return nil, err
 	}
 	w.sub = sub
+	// Stop the watcher once the context is done.
+	go func() {
+		select {
+		case <-ctx.Done():
+			w.Stop()
+		case <-w.stop:
+		}
+	}()
 	return w, nil
 }
 
@@ -1601,13 +1643,12 @@ func (ol *obsLister) Error() error {
 	return ol.err
 }
 
-func mapStreamToObjectStore(js *jetStream, pushJS nats.JetStreamContext, bucket string, stream Stream) *obs {
+func mapStreamToObjectStore(js *jetStream, bucket string, stream Stream) *obs {
 	info := stream.CachedInfo()
 
 	obs := &obs{
 		name:       bucket,
 		js:         js,
-		pushJS:     pushJS,
 		streamName: info.Config.Name,
 		stream:     stream,
 	}
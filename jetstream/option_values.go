@@ -0,0 +1,344 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// The types and functions below expose the values set by options, so that
+// alternative implementations of the interfaces in this package (e.g.
+// jetstreamtest) can apply them. They are not needed when using the client.
+type (
+	// PublishOptions contains the values of publish options which are not
+	// sent as message headers.
+	PublishOptions struct {
+		AckHandler PubAckHandler
+	}
+
+	// FetchOptions contains the values of fetch options.
+	FetchOptions struct {
+		Expires  time.Duration
+		MaxBytes int
+		NoWait   bool
+	}
+
+	// ConsumeOptions contains the values of options of continuous
+	// consumption, for both pull and push consumers. Options which only
+	// affect how messages are requested from the server are not included.
+	ConsumeOptions struct {
+		ErrHandler        ConsumeErrHandlerFunc
+		Middleware        []Middleware
+		StopAfter         int
+		Workers           int
+		AutoInProgress    bool
+		DeadLetterSubject string
+	}
+
+	// WatchOptions contains the values of KeyValue and ObjectStore watch
+	// options.
+	WatchOptions struct {
+		IgnoreDeletes      bool
+		IncludeHistory     bool
+		UpdatesOnly        bool
+		MetaOnly           bool
+		ResumeFromRevision uint64
+	}
+
+	// KVDeleteOptions contains the values of KeyValue delete options.
+	KVDeleteOptions struct {
+		Purge    bool
+		Revision uint64
+	}
+
+	// KVPurgeOptions contains the values of KeyValue purge deletes
+	// options.
+	KVPurgeOptions struct {
+		DeleteMarkersOlderThan time.Duration
+	}
+
+	// ObjectOptions contains the values of object get, get info and list
+	// options.
+	ObjectOptions struct {
+		ShowDeleted bool
+	}
+
+	// GetMsgOptions contains the values of stream get message options.
+	GetMsgOptions struct {
+		NextFor string
+	}
+
+	// StreamInfoOptions contains the values of stream info options.
+	StreamInfoOptions struct {
+		SubjectFilter  string
+		DeletedDetails bool
+	}
+
+	// StreamListOptions contains the values of stream list options.
+	StreamListOptions struct {
+		Subject string
+	}
+
+	// StreamBrowseOptions contains the values of stream browse options.
+	StreamBrowseOptions struct {
+		StartSeq  uint64
+		EndSeq    uint64
+		Subject   string
+		MaxMsgs   int
+		Direction BrowseDirection
+	}
+)
+
+// ResolvePublishOpts applies opts to m, setting the headers of the options
+// on the message, and returns the remaining values.
+func ResolvePublishOpts(m *nats.Msg, opts ...PublishOpt) (PublishOptions, error) {
+	var o pubOpts
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return PublishOptions{}, err
+		}
+	}
+	if m.Header == nil {
+		m.Header = nats.Header{}
+	}
+	o.setHeaders(m)
+	return PublishOptions{AckHandler: o.ackHandler}, nil
+}
+
+// ResolveFetchOpts returns the values of fetch options.
+func ResolveFetchOpts(opts ...FetchOpt) (FetchOptions, error) {
+	req := pullRequest{Expires: DefaultExpires}
+	for _, opt := range opts {
+		if err := opt(&req); err != nil {
+			return FetchOptions{}, err
+		}
+	}
+	return FetchOptions{Expires: req.Expires, MaxBytes: req.MaxBytes, NoWait: req.NoWait}, nil
+}
+
+// ResolvePullConsumeOpts returns the values of options passed to
+// [Consumer.Consume].
+func ResolvePullConsumeOpts(opts ...PullConsumeOpt) (ConsumeOptions, error) {
+	o, err := parseConsumeOpts(false, opts...)
+	if err != nil {
+		return ConsumeOptions{}, fmt.Errorf("%w: %s", ErrInvalidOption, err)
+	}
+	return o.values(), nil
+}
+
+// ResolvePullMessagesOpts returns the values of options passed to
+// [Consumer.Messages].
+func ResolvePullMessagesOpts(opts ...PullMessagesOpt) (ConsumeOptions, error) {
+	o, err := parseMessagesOpts(false, opts...)
+	if err != nil {
+		return ConsumeOptions{}, fmt.Errorf("%w: %s", ErrInvalidOption, err)
+	}
+	return o.values(), nil
+}
+
+// ResolvePushConsumeOpts returns the values of options passed to
+// [PushConsumer.Consume].
+func ResolvePushConsumeOpts(opts ...PushConsumeOpt) (ConsumeOptions, error) {
+	o, err := parsePushConsumeOpts(opts...)
+	if err != nil {
+		return ConsumeOptions{}, err
+	}
+	return ConsumeOptions{
+		ErrHandler:     o.ErrHandler,
+		Middleware:     o.Middleware,
+		StopAfter:      o.StopAfter,
+		AutoInProgress: o.AutoInProgress,
+	}, nil
+}
+
+func (o *consumeOpts) values() ConsumeOptions {
+	res := ConsumeOptions{
+		ErrHandler:        o.ErrHandler,
+		Middleware:        o.Middleware,
+		AutoInProgress:    o.AutoInProgress,
+		DeadLetterSubject: o.DeadLetterSubject,
+	}
+	if o.StopAfter > 0 {
+		res.StopAfter = o.StopAfter
+	}
+	if o.Workers > 0 {
+		res.Workers = o.Workers
+	}
+	return res
+}
+
+// ResolveWatchOpts returns the values of KeyValue and ObjectStore watch
+// options.
+func ResolveWatchOpts(opts ...WatchOpt) (WatchOptions, error) {
+	var o watchOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt.configureWatcher(&o); err != nil {
+			return WatchOptions{}, err
+		}
+	}
+	return WatchOptions{
+		IgnoreDeletes:      o.ignoreDeletes,
+		IncludeHistory:     o.includeHistory,
+		UpdatesOnly:        o.updatesOnly,
+		MetaOnly:           o.metaOnly,
+		ResumeFromRevision: o.resumeFromRevision,
+	}, nil
+}
+
+// ResolveKVDeleteOpts returns the values of KeyValue delete options.
+func ResolveKVDeleteOpts(opts ...KVDeleteOpt) (KVDeleteOptions, error) {
+	var o deleteOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt.configureDelete(&o); err != nil {
+			return KVDeleteOptions{}, err
+		}
+	}
+	return KVDeleteOptions{Purge: o.purge, Revision: o.revision}, nil
+}
+
+// ResolveKVPurgeOpts returns the values of KeyValue purge deletes options.
+func ResolveKVPurgeOpts(opts ...KVPurgeOpt) (KVPurgeOptions, error) {
+	var o purgeOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt.configurePurge(&o); err != nil {
+			return KVPurgeOptions{}, err
+		}
+	}
+	return KVPurgeOptions{DeleteMarkersOlderThan: o.dmthr}, nil
+}
+
+// ResolveGetObjectOpts returns the values of object get options.
+func ResolveGetObjectOpts(opts ...GetObjectOpt) (ObjectOptions, error) {
+	var o getObjectOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&o); err != nil {
+			return ObjectOptions{}, err
+		}
+	}
+	return ObjectOptions{ShowDeleted: o.showDeleted}, nil
+}
+
+// ResolveGetObjectInfoOpts returns the values of object get info options.
+func ResolveGetObjectInfoOpts(opts ...GetObjectInfoOpt) (ObjectOptions, error) {
+	var o getObjectInfoOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&o); err != nil {
+			return ObjectOptions{}, err
+		}
+	}
+	return ObjectOptions{ShowDeleted: o.showDeleted}, nil
+}
+
+// ResolveListObjectsOpts returns the values of object list options.
+func ResolveListObjectsOpts(opts ...ListObjectsOpt) (ObjectOptions, error) {
+	var o listObjectOpts
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&o); err != nil {
+			return ObjectOptions{}, err
+		}
+	}
+	return ObjectOptions{ShowDeleted: o.showDeleted}, nil
+}
+
+// ResolveGetMsgOpts returns the values of stream get message options.
+func ResolveGetMsgOpts(opts ...GetMsgOpt) (GetMsgOptions, error) {
+	var req apiMsgGetRequest
+	for _, opt := range opts {
+		if err := opt(&req); err != nil {
+			return GetMsgOptions{}, err
+		}
+	}
+	return GetMsgOptions{NextFor: req.NextFor}, nil
+}
+
+// ResolveStreamInfoOpts returns the values of stream info options.
+func ResolveStreamInfoOpts(opts ...StreamInfoOpt) (StreamInfoOptions, error) {
+	var req streamInfoRequest
+	for _, opt := range opts {
+		if err := opt(&req); err != nil {
+			return StreamInfoOptions{}, err
+		}
+	}
+	return StreamInfoOptions{SubjectFilter: req.SubjectFilter, DeletedDetails: req.DeletedDetails}, nil
+}
+
+// ResolveStreamListOpts returns the values of stream list options.
+func ResolveStreamListOpts(opts ...StreamListOpt) (StreamListOptions, error) {
+	var req streamsRequest
+	for _, opt := range opts {
+		if err := opt(&req); err != nil {
+			return StreamListOptions{}, err
+		}
+	}
+	return StreamListOptions{Subject: req.Subject}, nil
+}
+
+// ResolveStreamBrowseOpts returns the values of stream browse options.
+func ResolveStreamBrowseOpts(opts ...StreamBrowseOpt) (StreamBrowseOptions, error) {
+	var o streamBrowseOpts
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return StreamBrowseOptions{}, err
+		}
+	}
+	return StreamBrowseOptions{
+		StartSeq:  o.startSeq,
+		EndSeq:    o.endSeq,
+		Subject:   o.subject,
+		MaxMsgs:   o.maxMsgs,
+		Direction: o.direction,
+	}, nil
+}
+
+// NewKeyValueCache creates a [KeyValueCache] of kv, so that alternative
+// KeyValue implementations can share the caching logic. As the connection
+// status is not known, the cache only becomes stale when the watcher lags
+// or stops.
+func NewKeyValueCache(ctx context.Context, kv KeyValue, opts ...KVCacheOpt) (KeyValueCache, error) {
+	return newKeyValueCache(ctx, kv, nil, opts)
+}
+
+// NewKeyValueBucketStatus creates the status of the bucket from the info
+// of its stream.
+func NewKeyValueBucketStatus(info *StreamInfo, bucket string) *KeyValueBucketStatus {
+	return &KeyValueBucketStatus{nfo: info, bucket: bucket}
+}
+
+// NewObjectBucketStatus creates the status of the bucket from the info of
+// its stream.
+func NewObjectBucketStatus(info *StreamInfo, bucket string) *ObjectBucketStatus {
+	return &ObjectBucketStatus{nfo: info, bucket: bucket}
+}
@@ -45,6 +45,7 @@ type (
 		withStopAfter     bool
 		runningFetch      *fetchResult
 		subscription      *orderedSubscription
+		stats             *consumeStats
 		sync.Mutex
 	}
 
@@ -96,9 +97,12 @@ func (c *orderedConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidOption, err)
 	}
+	c.stats = &consumeStats{}
 	c.userErrHandler = consumeOpts.ErrHandler
-	opts = append(opts, consumeReconnectNotify(),
-		ConsumeErrHandler(c.errHandler(c.serial)))
+	// middleware wraps the user handler only, not the ordering checks
+	handler = ChainMiddleware(handler, consumeOpts.Middleware...)
+	opts = append(opts, WithConsumeMiddleware(), consumeReconnectNotify(),
+		consumeWithStats(c.stats), ConsumeErrHandler(c.errHandler(c.serial)))
 	if consumeOpts.StopAfter > 0 {
 		c.withStopAfter = true
 		c.stopAfter = consumeOpts.StopAfter
@@ -240,9 +244,14 @@ func (c *orderedConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, er
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidOption, err)
 	}
+	c.stats = &consumeStats{}
+	// middleware is applied to messages of the ordered subscription, so
+	// that it is not removed on reset
 	opts = append(opts,
+		WithConsumeMiddleware(),
 		WithMessagesErrOnMissingHeartbeat(true),
-		messagesReconnectNotify())
+		messagesReconnectNotify(),
+		consumeWithStats(c.stats))
 	c.stopAfterMsgsLeft = make(chan int, 1)
 	if consumeOpts.StopAfter > 0 {
 		c.withStopAfter = true
@@ -265,7 +274,7 @@ func (c *orderedConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, er
 	}
 	c.subscription = sub
 
-	return sub, nil
+	return ChainMessagesMiddleware(sub, consumeOpts.Middleware...), nil
 }
 
 func (s *orderedSubscription) Next() (Msg, error) {
@@ -354,6 +363,26 @@ func (s *orderedSubscription) Drain() {
 	close(s.done)
 }
 
+// Acks returns nil, as ordered consumers do not acknowledge messages.
+func (s *orderedSubscription) Acks() AckPipeline {
+	return nil
+}
+
+// Stats returns runtime statistics of all consumers created by the
+// ordered consumer since Consume or Messages was called.
+func (s *orderedSubscription) Stats() ConsumeStats {
+	var buffered int
+	// the lock is held while the consumer is being reset, in which case
+	// there are no buffered messages
+	if s.consumer.TryLock() {
+		if s.consumer.currentSub != nil {
+			buffered = s.consumer.currentSub.Stats().Buffered
+		}
+		s.consumer.Unlock()
+	}
+	return s.consumer.stats.snapshot(buffered)
+}
+
 // Closed returns a channel that is closed when the consuming is
 // fully stopped/drained. When the channel is closed, no more messages
 // will be received and processing is complete.
@@ -535,6 +564,7 @@ func (c *orderedConsumer) reset() error {
 	defer c.Unlock()
 	defer c.resetInProgress.Store(0)
 	if c.currentConsumer != nil {
+		c.stats.recordReset()
 		c.currentConsumer.Lock()
 		if c.currentSub != nil {
 			c.currentSub.Stop()
@@ -691,7 +721,7 @@ func (c *orderedConsumer) Info(ctx context.Context) (*ConsumerInfo, error) {
 	infoSubject := fmt.Sprintf(apiConsumerInfoT, c.stream, c.currentConsumer.name)
 	var resp consumerInfoResponse
 
-	if _, err := c.js.apiRequestJSON(ctx, infoSubject, &resp); err != nil {
+	if _, err := c.js.idempotentAPIRequestJSON(ctx, infoSubject, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Error != nil {
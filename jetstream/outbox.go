@@ -0,0 +1,611 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nuid"
+)
+
+type (
+	// Outbox publishes messages asynchronously, persisting them in a local
+	// write-ahead log until they are acknowledged by the server. Messages
+	// which were not acknowledged are re-published when the outbox is
+	// opened again (e.g. after the process restarts) and after reconnecting
+	// to the server.
+	//
+	// Each message is published with [MsgIDHeader] (generated if not set),
+	// so re-published messages are discarded by the server as duplicates as
+	// long as they are within the [StreamConfig.Duplicates] window of the
+	// stream.
+	Outbox interface {
+		// Publish persists the message in the log and publishes it
+		// asynchronously. It accepts subject name (which must be bound to
+		// a stream) and message payload.
+		Publish(subj string, data []byte, opts ...PublishOpt) (PubAckFuture, error)
+
+		// PublishMsg persists the message in the log and publishes it
+		// asynchronously. It accepts subject name (which must be bound to
+		// a stream) and nats.Message.
+		//
+		// The returned [PubAckFuture] is resolved once the message is
+		// acknowledged by the server, or rejected with an API error (e.g.
+		// when expected last sequence does not match). Messages which
+		// could not be published due to connection errors are retried and
+		// do not resolve the future.
+		PublishMsg(m *nats.Msg, opts ...PublishOpt) (PubAckFuture, error)
+
+		// Pending returns the number of messages which were not yet
+		// acknowledged by the server.
+		Pending() int
+
+		// Close stops publishing and closes the log. Messages which were
+		// not acknowledged remain in the log and are re-published when the
+		// outbox is opened again.
+		Close() error
+	}
+
+	// OutboxConfig is used to configure [Outbox] created using
+	// [NewOutbox].
+	OutboxConfig struct {
+		// Path is the path to the write-ahead log file. The file is created
+		// if it does not exist. Required.
+		Path string
+
+		// DisableSync disables syncing the log to disk after each message.
+		// Messages may be lost if the machine crashes before the log is
+		// flushed by the operating system.
+		DisableSync bool
+
+		// RetryWait is the time to wait before re-publishing a message
+		// which could not be published while connected to the server.
+		// Defaults to 1s.
+		RetryWait time.Duration
+
+		// ErrHandler is called for messages rejected by the server, which
+		// are removed from the log.
+		ErrHandler func(msg *nats.Msg, err error)
+	}
+
+	outbox struct {
+		sync.Mutex
+		js        JetStream
+		cfg       OutboxConfig
+		file      *os.File
+		pending   map[string]*outboxEntry
+		seq       uint64
+		acked     int
+		closed    bool
+		done      chan struct{}
+		connState chan nats.Status
+		// releaseConnState removes connState from the connection
+		releaseConnState func()
+	}
+
+	outboxEntry struct {
+		ID      string      `json:"id"`
+		Subject string      `json:"subject"`
+		Header  nats.Header `json:"header,omitempty"`
+		Data    []byte      `json:"data,omitempty"`
+
+		seq        uint64
+		opts       []PublishOpt
+		ackHandler PubAckHandler
+		inFlight   bool
+		future     *outboxFuture
+	}
+
+	outboxFuture struct {
+		msg    *nats.Msg
+		doneCh chan *PubAck
+		errCh  chan error
+	}
+)
+
+const (
+	outboxOpPublish byte = 'P'
+	outboxOpAck     byte = 'A'
+
+	// outboxRecordHeaderSize is the size of record length and checksum
+	// preceding each record in the log.
+	outboxRecordHeaderSize = 8
+
+	// outboxMaxRecordSize is the upper limit of a record size, used to
+	// detect corrupted records. Messages cannot exceed max payload of the
+	// server, which is limited to 64MB.
+	outboxMaxRecordSize = 128 * 1024 * 1024
+
+	// outboxCompactThreshold is the number of acknowledged messages after
+	// which the log is rewritten to contain only pending messages.
+	outboxCompactThreshold = 1024
+
+	defaultOutboxRetryWait = time.Second
+)
+
+// NewOutbox opens the write-ahead log at the configured path and returns
+// an [Outbox] publishing messages using js. Messages which were not
+// acknowledged before the log was closed are re-published immediately.
+//
+// The log should not be shared between multiple outboxes.
+func NewOutbox(js JetStream, cfg OutboxConfig) (Outbox, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("%w: outbox path is required", ErrInvalidOption)
+	}
+	if cfg.RetryWait < 0 {
+		return nil, fmt.Errorf("%w: outbox retry wait cannot be negative", ErrInvalidOption)
+	}
+	if cfg.RetryWait == 0 {
+		cfg.RetryWait = defaultOutboxRetryWait
+	}
+	f, err := os.OpenFile(cfg.Path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	entries, acked, size, err := readOutboxLog(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// discard partially written records
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	ob := &outbox{
+		js:      js,
+		cfg:     cfg,
+		pending: make(map[string]*outboxEntry, len(entries)),
+		done:    make(chan struct{}),
+	}
+	for _, e := range entries {
+		ob.seq++
+		e.seq = ob.seq
+		e.future = newOutboxFuture(e.msg())
+		ob.pending[e.ID] = e
+	}
+	ob.acked = acked
+	if ob.acked > 0 {
+		err = ob.compact()
+	} else {
+		ob.file, err = os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND, 0640)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// without an underlying connection (e.g. jetstreamtest), the outbox is
+	// always considered connected and messages are only replayed on start
+	if nc := js.Conn(); nc != nil {
+		ob.connState, ob.releaseConnState = statusChanged(nc, nats.CONNECTED)
+		go ob.replayOnReconnect()
+	}
+	ob.replay()
+	return ob, nil
+}
+
+// readOutboxLog reads the log, returning messages which were not
+// acknowledged in order, the number of acknowledged messages and the size
+// of the valid part of the log.
+func readOutboxLog(r io.Reader) ([]*outboxEntry, int, int64, error) {
+	var (
+		entries []*outboxEntry
+		byID    = make(map[string]int)
+		acked   int
+		size    int64
+	)
+	br := bufio.NewReader(r)
+	hdr := make([]byte, outboxRecordHeaderSize)
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			break
+		}
+		n := binary.BigEndian.Uint32(hdr[:4])
+		if n == 0 || n > outboxMaxRecordSize {
+			break
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(br, body); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(hdr[4:]) {
+			break
+		}
+		switch body[0] {
+		case outboxOpPublish:
+			var e outboxEntry
+			if err := json.Unmarshal(body[1:], &e); err != nil {
+				return nil, 0, 0, fmt.Errorf("nats: invalid outbox record: %w", err)
+			}
+			byID[e.ID] = len(entries)
+			entries = append(entries, &e)
+		case outboxOpAck:
+			if i, ok := byID[string(body[1:])]; ok {
+				entries[i] = nil
+				delete(byID, string(body[1:]))
+				acked++
+			}
+		default:
+			return nil, 0, 0, fmt.Errorf("nats: invalid outbox record type: %q", body[0])
+		}
+		size += int64(len(hdr) + len(body))
+	}
+	pending := make([]*outboxEntry, 0, len(byID))
+	for _, e := range entries {
+		if e != nil {
+			pending = append(pending, e)
+		}
+	}
+	return pending, acked, size, nil
+}
+
+func encodeOutboxRecord(op byte, payload []byte) []byte {
+	buf := make([]byte, outboxRecordHeaderSize+1+len(payload))
+	body := buf[outboxRecordHeaderSize:]
+	body[0] = op
+	copy(body[1:], payload)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(body))
+	return buf
+}
+
+// Publish persists the message in the log and publishes it asynchronously.
+func (ob *outbox) Publish(subj string, data []byte, opts ...PublishOpt) (PubAckFuture, error) {
+	return ob.PublishMsg(&nats.Msg{Subject: subj, Data: data}, opts...)
+}
+
+// PublishMsg persists the message in the log and publishes it
+// asynchronously.
+func (ob *outbox) PublishMsg(m *nats.Msg, opts ...PublishOpt) (PubAckFuture, error) {
+	if m.Reply != "" {
+		return nil, ErrAsyncPublishReplySubjectSet
+	}
+	o := pubOpts{
+		retryWait:     DefaultPubRetryWait,
+		retryAttempts: DefaultPubRetryAttempts,
+	}
+	if m.Header == nil {
+		m.Header = nats.Header{}
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	o.setHeaders(m)
+	if m.Header.Get(MsgIDHeader) == "" {
+		m.Header.Set(MsgIDHeader, nuid.Next())
+	}
+	e := &outboxEntry{
+		ID:         m.Header.Get(MsgIDHeader),
+		Subject:    m.Subject,
+		Header:     m.Header,
+		Data:       m.Data,
+		opts:       []PublishOpt{WithRetryWait(o.retryWait), WithRetryAttempts(o.retryAttempts)},
+		ackHandler: o.ackHandler,
+		future:     newOutboxFuture(m),
+	}
+	if o.stallWait > 0 {
+		e.opts = append(e.opts, WithStallWait(o.stallWait))
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	ob.Lock()
+	if ob.closed {
+		ob.Unlock()
+		return nil, ErrOutboxClosed
+	}
+	if _, ok := ob.pending[e.ID]; ok {
+		ob.Unlock()
+		return nil, fmt.Errorf("%w: message with ID %q is already pending", ErrInvalidOption, e.ID)
+	}
+	if err := ob.write(outboxOpPublish, payload, !ob.cfg.DisableSync); err != nil {
+		ob.Unlock()
+		return nil, err
+	}
+	ob.seq++
+	e.seq = ob.seq
+	e.inFlight = true
+	ob.pending[e.ID] = e
+	ob.Unlock()
+
+	if err := ob.publish(e); err != nil {
+		// the message was not published, so it should not be replayed
+		ob.remove(e, nil, nil)
+		return nil, err
+	}
+	return e.future, nil
+}
+
+// Pending returns the number of messages which were not yet acknowledged.
+func (ob *outbox) Pending() int {
+	ob.Lock()
+	defer ob.Unlock()
+	return len(ob.pending)
+}
+
+// Close stops publishing and closes the log.
+func (ob *outbox) Close() error {
+	ob.Lock()
+	defer ob.Unlock()
+	if ob.closed {
+		return nil
+	}
+	ob.closed = true
+	close(ob.done)
+	if ob.releaseConnState != nil {
+		ob.releaseConnState()
+	}
+	return ob.file.Close()
+}
+
+// write appends a record to the log.
+// Lock should be held.
+func (ob *outbox) write(op byte, payload []byte, sync bool) error {
+	if _, err := ob.file.Write(encodeOutboxRecord(op, payload)); err != nil {
+		return err
+	}
+	if sync {
+		return ob.file.Sync()
+	}
+	return nil
+}
+
+// compact rewrites the log so that it contains only pending messages.
+// Lock should be held.
+func (ob *outbox) compact() error {
+	tmp := ob.cfg.Path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range ob.sortedEntries(false) {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := w.Write(encodeOutboxRecord(outboxOpPublish, payload)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, ob.cfg.Path); err != nil {
+		return err
+	}
+	if ob.file != nil {
+		ob.file.Close()
+	}
+	ob.file, err = os.OpenFile(ob.cfg.Path, os.O_WRONLY|os.O_APPEND, 0640)
+	ob.acked = 0
+	return err
+}
+
+// sortedEntries returns pending messages in the order they were published.
+// If notInFlight is set, only messages which are not being published are
+// returned.
+// Lock should be held.
+func (ob *outbox) sortedEntries(notInFlight bool) []*outboxEntry {
+	entries := make([]*outboxEntry, 0, len(ob.pending))
+	for _, e := range ob.pending {
+		if notInFlight && e.inFlight {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+	return entries
+}
+
+// replay publishes all messages which are not being published.
+func (ob *outbox) replay() {
+	ob.Lock()
+	if ob.closed {
+		ob.Unlock()
+		return
+	}
+	entries := ob.sortedEntries(true)
+	for _, e := range entries {
+		e.inFlight = true
+	}
+	ob.Unlock()
+	for _, e := range entries {
+		if err := ob.publish(e); err != nil {
+			ob.retryLater(e)
+		}
+	}
+}
+
+// connected returns true if the connection is established or there is no
+// underlying connection.
+func (ob *outbox) connected() bool {
+	nc := ob.js.Conn()
+	return nc == nil || nc.IsConnected()
+}
+
+func (ob *outbox) replayOnReconnect() {
+	for {
+		select {
+		case status, ok := <-ob.connState:
+			if !ok {
+				return
+			}
+			if status == nats.CONNECTED {
+				ob.replay()
+			}
+		case <-ob.done:
+			return
+		}
+	}
+}
+
+// publish publishes the message and waits for the ack in a separate
+// goroutine. Errors other than ErrTooManyStalledMsgs are retried.
+func (ob *outbox) publish(e *outboxEntry) error {
+	paf, err := ob.js.PublishMsgAsync(e.msg(), e.opts...)
+	if err != nil {
+		if errors.Is(err, ErrTooManyStalledMsgs) {
+			return err
+		}
+		ob.retryLater(e)
+		return nil
+	}
+	go func() {
+		select {
+		case ack := <-paf.Ok():
+			ob.remove(e, ack, nil)
+		case err := <-paf.Err():
+			var apiErr *APIError
+			if errors.As(err, &apiErr) || errors.Is(err, ErrInvalidJSAck) {
+				ob.remove(e, nil, err)
+				return
+			}
+			ob.retryLater(e)
+		case <-ob.done:
+		}
+	}()
+	return nil
+}
+
+// retryLater marks the message for re-publishing. If connected, the
+// message is re-published after RetryWait, otherwise it is re-published on
+// reconnect.
+func (ob *outbox) retryLater(e *outboxEntry) {
+	ob.Lock()
+	e.inFlight = false
+	closed := ob.closed
+	ob.Unlock()
+	if closed || !ob.connected() {
+		return
+	}
+	time.AfterFunc(ob.cfg.RetryWait, func() {
+		ob.Lock()
+		if ob.closed || e.inFlight || ob.pending[e.ID] != e {
+			ob.Unlock()
+			return
+		}
+		e.inFlight = true
+		ob.Unlock()
+		if err := ob.publish(e); err != nil {
+			ob.retryLater(e)
+		}
+	})
+}
+
+// remove removes the message from the log once it is acknowledged or
+// rejected by the server and resolves the future.
+func (ob *outbox) remove(e *outboxEntry, ack *PubAck, err error) {
+	ob.Lock()
+	if ob.pending[e.ID] != e {
+		ob.Unlock()
+		return
+	}
+	delete(ob.pending, e.ID)
+	if !ob.closed {
+		var writeErr error
+		if len(ob.pending) == 0 {
+			// all messages are acknowledged, so the log can be truncated
+			writeErr = ob.file.Truncate(0)
+			ob.acked = 0
+		} else {
+			writeErr = ob.write(outboxOpAck, []byte(e.ID), false)
+			ob.acked++
+			if writeErr == nil && ob.acked >= outboxCompactThreshold && ob.acked > len(ob.pending) {
+				writeErr = ob.compact()
+			}
+		}
+		if writeErr != nil && ob.cfg.ErrHandler != nil {
+			// the message may be re-published when the outbox is opened
+			// again, which is safe within the duplicates window
+			defer ob.cfg.ErrHandler(e.msg(), writeErr)
+		}
+	}
+	ob.Unlock()
+
+	if err != nil {
+		e.future.errCh <- err
+		if ob.cfg.ErrHandler != nil {
+			ob.cfg.ErrHandler(e.msg(), err)
+		}
+		if e.ackHandler != nil {
+			e.ackHandler(nil, err)
+		}
+		return
+	}
+	if ack != nil {
+		e.future.doneCh <- ack
+		if e.ackHandler != nil {
+			e.ackHandler(ack, nil)
+		}
+	}
+}
+
+func (e *outboxEntry) msg() *nats.Msg {
+	return &nats.Msg{Subject: e.Subject, Header: e.Header, Data: e.Data}
+}
+
+func newOutboxFuture(m *nats.Msg) *outboxFuture {
+	return &outboxFuture{
+		msg:    m,
+		doneCh: make(chan *PubAck, 1),
+		errCh:  make(chan error, 1),
+	}
+}
+
+// Ok returns a receive only channel that can be used to get a PubAck.
+func (f *outboxFuture) Ok() <-chan *PubAck {
+	return f.doneCh
+}
+
+// Err returns a receive only channel that can be used to get the error
+// from an async publish.
+func (f *outboxFuture) Err() <-chan error {
+	return f.errCh
+}
+
+// Msg returns the message that was sent to the server.
+func (f *outboxFuture) Msg() *nats.Msg {
+	return f.msg
+}
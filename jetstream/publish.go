@@ -35,6 +35,10 @@ type (
 		aecb MsgErrHandler
 		// Max async pub ack in flight
 		maxpa int
+		// Max time to wait for an async pub ack
+		timeout time.Duration
+		// Adaptive flow control config
+		adaptive *PublishAsyncAdaptiveConfig
 	}
 
 	// PublishOpt are the options that can be passed to Publish methods.
@@ -54,6 +58,9 @@ type (
 		// stallWait is the max wait of a async pub ack.
 		stallWait time.Duration
 
+		// ackHandler is called with the result of an async publish.
+		ackHandler PubAckHandler
+
 		// internal option to re-use existing paf in case of retry.
 		pafRetry *pubAckFuture
 	}
@@ -82,8 +89,15 @@ type (
 		errCh      chan error
 		doneCh     chan *PubAck
 		reply      string
+		ackHandler PubAckHandler
+		timeout    *time.Timer
+		sent       time.Time
 	}
 
+	// PubAckHandler is called with the result of an async publish, set
+	// using [WithAckHandler]. Either ack or err is set.
+	PubAckHandler func(ack *PubAck, err error)
+
 	jetStreamClient struct {
 		asyncPublishContext
 		asyncPublisherOpts
@@ -102,6 +116,7 @@ type (
 		stallCh     chan struct{}
 		doneCh      chan struct{}
 		rr          *rand.Rand
+		window      *publishWindow
 		// channel to signal when server is disconnected or conn is closed
 		connStatusCh chan (nats.Status)
 	}
@@ -175,23 +190,12 @@ func (js *jetStream) PublishMsg(ctx context.Context, m *nats.Msg, opts ...Publis
 	if o.stallWait > 0 {
 		return nil, fmt.Errorf("%w: stall wait cannot be set to sync publish", ErrInvalidOption)
 	}
-
-	if o.id != "" {
-		m.Header.Set(MsgIDHeader, o.id)
-	}
-	if o.lastMsgID != "" {
-		m.Header.Set(ExpectedLastMsgIDHeader, o.lastMsgID)
-	}
-	if o.stream != "" {
-		m.Header.Set(ExpectedStreamHeader, o.stream)
-	}
-	if o.lastSeq != nil {
-		m.Header.Set(ExpectedLastSeqHeader, strconv.FormatUint(*o.lastSeq, 10))
-	}
-	if o.lastSubjectSeq != nil {
-		m.Header.Set(ExpectedLastSubjSeqHeader, strconv.FormatUint(*o.lastSubjectSeq, 10))
+	if o.ackHandler != nil {
+		return nil, fmt.Errorf("%w: ack handler cannot be set to sync publish", ErrInvalidOption)
 	}
 
+	o.setHeaders(m)
+
 	var resp *nats.Msg
 	var err error
 
@@ -227,6 +231,25 @@ func (js *jetStream) PublishMsg(ctx context.Context, m *nats.Msg, opts ...Publis
 	return ackResp.PubAck, nil
 }
 
+// setHeaders sets the message headers based on publish options.
+func (o *pubOpts) setHeaders(m *nats.Msg) {
+	if o.id != "" {
+		m.Header.Set(MsgIDHeader, o.id)
+	}
+	if o.lastMsgID != "" {
+		m.Header.Set(ExpectedLastMsgIDHeader, o.lastMsgID)
+	}
+	if o.stream != "" {
+		m.Header.Set(ExpectedStreamHeader, o.stream)
+	}
+	if o.lastSeq != nil {
+		m.Header.Set(ExpectedLastSeqHeader, strconv.FormatUint(*o.lastSeq, 10))
+	}
+	if o.lastSubjectSeq != nil {
+		m.Header.Set(ExpectedLastSubjSeqHeader, strconv.FormatUint(*o.lastSubjectSeq, 10))
+	}
+}
+
 // PublishAsync performs an asynchronous publish to a stream and returns
 // [PubAckFuture] interface. It accepts subject name (which must be bound
 // to a stream) and message payload.
@@ -259,21 +282,7 @@ func (js *jetStream) PublishMsgAsync(m *nats.Msg, opts ...PublishOpt) (PubAckFut
 		stallWait = o.stallWait
 	}
 
-	if o.id != "" {
-		m.Header.Set(MsgIDHeader, o.id)
-	}
-	if o.lastMsgID != "" {
-		m.Header.Set(ExpectedLastMsgIDHeader, o.lastMsgID)
-	}
-	if o.stream != "" {
-		m.Header.Set(ExpectedStreamHeader, o.stream)
-	}
-	if o.lastSeq != nil {
-		m.Header.Set(ExpectedLastSeqHeader, strconv.FormatUint(*o.lastSeq, 10))
-	}
-	if o.lastSubjectSeq != nil {
-		m.Header.Set(ExpectedLastSubjSeqHeader, strconv.FormatUint(*o.lastSubjectSeq, 10))
-	}
+	o.setHeaders(m)
 
 	paf := o.pafRetry
 	if paf == nil && m.Reply != "" {
@@ -291,7 +300,7 @@ func (js *jetStream) PublishMsgAsync(m *nats.Msg, opts ...PublishOpt) (PubAckFut
 			return nil, fmt.Errorf("nats: error creating async reply handler: %s", err)
 		}
 		id = reply[js.opts.replyPrefixLen:]
-		paf = &pubAckFuture{msg: m, jsClient: js.publisher, maxRetries: o.retryAttempts, retryWait: o.retryWait, reply: reply}
+		paf = &pubAckFuture{msg: m, jsClient: js.publisher, maxRetries: o.retryAttempts, retryWait: o.retryWait, reply: reply, ackHandler: o.ackHandler}
 		numPending, maxPending := js.registerPAF(id, paf)
 
 		if maxPending > 0 && numPending > maxPending {
@@ -314,7 +323,7 @@ func (js *jetStream) PublishMsgAsync(m *nats.Msg, opts ...PublishOpt) (PubAckFut
 		Data:    m.Data,
 		Header:  m.Header,
 	}
-	if err := js.conn.PublishMsg(pubMsg); err != nil {
+	if err := js.publishPAF(id, paf, pubMsg); err != nil {
 		js.clearPAF(id)
 		return nil, err
 	}
@@ -322,6 +331,37 @@ func (js *jetStream) PublishMsgAsync(m *nats.Msg, opts ...PublishOpt) (PubAckFut
 	return paf, nil
 }
 
+// publishPAF publishes the message of a registered PubAckFuture, records
+// the time it was sent and arms the timeout set using
+// WithPublishAsyncTimeout, so that time spent stalled or waiting for a
+// retry does not count as PubAck latency and a message is never reported as
+// timed out before it is sent. The publisher lock is not held while
+// publishing, so the ack may be processed before the timeout is armed.
+func (js *jetStream) publishPAF(id string, paf *pubAckFuture, m *nats.Msg) error {
+	// set before publishing, so that the latency of an ack processed right
+	// away is measured from this attempt
+	js.publisher.Lock()
+	paf.sent = time.Now()
+	js.publisher.Unlock()
+
+	if err := js.conn.PublishMsg(m); err != nil {
+		return err
+	}
+
+	js.publisher.Lock()
+	defer js.publisher.Unlock()
+	// the future is no longer registered once it was acked or failed
+	if js.getPAF(id) != paf {
+		return nil
+	}
+	if timeout := js.publisher.asyncPublisherOpts.timeout; timeout > 0 && paf.timeout == nil {
+		paf.timeout = time.AfterFunc(timeout, func() {
+			js.handleAsyncTimeout(id)
+		})
+	}
+	return nil
+}
+
 // For quick token lookup etc.
 const (
 	aReplyTokensize = 6
@@ -380,7 +420,7 @@ func (js *jetStream) handleAsyncReply(m *nats.Msg) {
 
 	closeStc := func() {
 		// Check on anyone stalled and waiting.
-		if js.publisher.stallCh != nil && len(js.publisher.acks) < js.publisher.maxpa {
+		if js.publisher.stallCh != nil && len(js.publisher.acks) < js.publisher.maxPending() {
 			close(js.publisher.stallCh)
 			js.publisher.stallCh = nil
 		}
@@ -405,14 +445,19 @@ func (js *jetStream) handleAsyncReply(m *nats.Msg) {
 
 	doErr := func(err error) {
 		paf.err = err
+		js.publisher.flowWindow().onError(err)
 		if paf.errCh != nil {
 			paf.errCh <- paf.err
 		}
+		paf.stopTimeout()
 		cb := js.publisher.asyncPublisherOpts.aecb
 		js.publisher.Unlock()
 		if cb != nil {
 			cb(js, paf.msg, err)
 		}
+		if paf.ackHandler != nil {
+			paf.ackHandler(nil, err)
+		}
 	}
 
 	// Process no responders etc.
@@ -466,10 +511,55 @@ func (js *jetStream) handleAsyncReply(m *nats.Msg) {
 
 	// So here we have received a proper puback.
 	paf.ack = pa.PubAck
+	js.publisher.flowWindow().onAck(time.Since(paf.sent))
+	// the window may have grown
+	closeStc()
 	if paf.doneCh != nil {
 		paf.doneCh <- paf.ack
 	}
+	paf.stopTimeout()
+	js.publisher.Unlock()
+	if paf.ackHandler != nil {
+		paf.ackHandler(paf.ack, nil)
+	}
+}
+
+// handleAsyncTimeout fails the pub ack future if the ack was not received
+// within the timeout set using WithPublishAsyncTimeout.
+func (js *jetStream) handleAsyncTimeout(id string) {
+	js.publisher.Lock()
+	paf := js.getPAF(id)
+	if paf == nil {
+		js.publisher.Unlock()
+		return
+	}
+	delete(js.publisher.acks, id)
+	if js.publisher.stallCh != nil && len(js.publisher.acks) < js.publisher.maxPending() {
+		close(js.publisher.stallCh)
+		js.publisher.stallCh = nil
+	}
+	var dch chan struct{}
+	if js.publisher.doneCh != nil && len(js.publisher.acks) == 0 {
+		dch = js.publisher.doneCh
+		js.publisher.doneCh = nil
+	}
+	paf.err = ErrAsyncPublishTimeout
+	js.publisher.flowWindow().onError(paf.err)
+	if paf.errCh != nil {
+		paf.errCh <- paf.err
+	}
+	cb := js.publisher.asyncPublisherOpts.aecb
 	js.publisher.Unlock()
+
+	if cb != nil {
+		cb(js, paf.msg, paf.err)
+	}
+	if paf.ackHandler != nil {
+		paf.ackHandler(nil, paf.err)
+	}
+	if dch != nil {
+		close(dch)
+	}
 }
 
 func (js *jetStream) resetPendingAcksOnReconnect() {
@@ -483,14 +573,15 @@ func (js *jetStream) resetPendingAcksOnReconnect() {
 		}
 		js.publisher.Lock()
 		errCb := js.publisher.asyncPublisherOpts.aecb
+		failed := make([]*pubAckFuture, 0, len(js.publisher.acks))
 		for id, paf := range js.publisher.acks {
 			paf.err = nats.ErrDisconnected
+			js.publisher.flowWindow().onError(paf.err)
 			if paf.errCh != nil {
 				paf.errCh <- paf.err
 			}
-			if errCb != nil {
-				defer errCb(js, paf.msg, nats.ErrDisconnected)
-			}
+			paf.stopTimeout()
+			failed = append(failed, paf)
 			delete(js.publisher.acks, id)
 		}
 		if js.publisher.doneCh != nil {
@@ -498,6 +589,16 @@ func (js *jetStream) resetPendingAcksOnReconnect() {
 			js.publisher.doneCh = nil
 		}
 		js.publisher.Unlock()
+
+		// callbacks are invoked outside of the lock, once per reconnect
+		for _, paf := range failed {
+			if errCb != nil {
+				errCb(js, paf.msg, nats.ErrDisconnected)
+			}
+			if paf.ackHandler != nil {
+				paf.ackHandler(nil, nats.ErrDisconnected)
+			}
+		}
 	}
 }
 
@@ -509,11 +610,27 @@ func (js *jetStream) registerPAF(id string, paf *pubAckFuture) (int, int) {
 	}
 	js.publisher.acks[id] = paf
 	np := len(js.publisher.acks)
-	maxpa := js.publisher.asyncPublisherOpts.maxpa
+	maxpa := js.publisher.maxPending()
 	js.publisher.Unlock()
 	return np, maxpa
 }
 
+// flowWindow returns the window tracking PubAck latency, creating it on
+// first use.
+// Lock should be held.
+func (c *jetStreamClient) flowWindow() *publishWindow {
+	if c.window == nil {
+		c.window = newPublishWindow(c.asyncPublisherOpts)
+	}
+	return c.window
+}
+
+// maxPending returns the current limit of outstanding async publishes.
+// Lock should be held.
+func (c *jetStreamClient) maxPending() int {
+	return c.flowWindow().maxPending(c.maxpa)
+}
+
 // Lock should be held.
 func (js *jetStream) getPAF(id string) *pubAckFuture {
 	if js.publisher.acks == nil {
@@ -525,6 +642,9 @@ func (js *jetStream) getPAF(id string) *pubAckFuture {
 // clearPAF will remove a PubAckFuture that was registered.
 func (js *jetStream) clearPAF(id string) {
 	js.publisher.Lock()
+	if paf := js.getPAF(id); paf != nil {
+		paf.stopTimeout()
+	}
 	delete(js.publisher.acks, id)
 	js.publisher.Unlock()
 }
@@ -539,6 +659,14 @@ func (js *jetStream) asyncStall() <-chan struct{} {
 	return stc
 }
 
+// stopTimeout stops the timer set using WithPublishAsyncTimeout.
+// Publisher lock should be held.
+func (paf *pubAckFuture) stopTimeout() {
+	if paf.timeout != nil {
+		paf.timeout.Stop()
+	}
+}
+
 func (paf *pubAckFuture) Ok() <-chan *PubAck {
 	paf.jsClient.Lock()
 	defer paf.jsClient.Unlock()
@@ -581,6 +709,15 @@ func (js *jetStream) PublishAsyncPending() int {
 	return len(js.publisher.acks)
 }
 
+// PublishAsyncStats returns statistics of async publishing, including the
+// current maximum number of outstanding async publishes and PubAck
+// latency.
+func (js *jetStream) PublishAsyncStats() PublishAsyncStats {
+	js.publisher.Lock()
+	defer js.publisher.Unlock()
+	return js.publisher.flowWindow().stats(len(js.publisher.acks), js.publisher.maxpa)
+}
+
 // PublishAsyncComplete returns a channel that will be closed when all
 // outstanding asynchronously published messages are acknowledged by the
 // server.
@@ -0,0 +1,187 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+type (
+	// PublishAsyncAdaptiveConfig configures adaptive flow control of async
+	// publishing, enabled using [WithPublishAsyncAdaptive].
+	//
+	// The maximum number of outstanding async publishes (the window) is
+	// adjusted based on the measured PubAck latency and errors: the window
+	// grows by one for each window of acks received within TargetLatency
+	// (additive increase), and is halved when the latency exceeds
+	// TargetLatency or a publish times out or gets no response from the
+	// stream (multiplicative decrease).
+	PublishAsyncAdaptiveConfig struct {
+		// MinPending is the lower bound of the window. Defaults to 16.
+		MinPending int
+
+		// MaxPending is the upper bound of the window. Defaults to the value
+		// set using [WithPublishAsyncMaxPending] (4000 if not set).
+		MaxPending int
+
+		// InitialPending is the initial size of the window. Defaults to
+		// MinPending.
+		InitialPending int
+
+		// TargetLatency is the PubAck latency above which the window is
+		// decreased. Defaults to 4 times the lowest observed latency.
+		TargetLatency time.Duration
+	}
+
+	// PublishAsyncStats contains statistics of async publishing, returned
+	// by [Publisher.PublishAsyncStats].
+	PublishAsyncStats struct {
+		// Pending is the number of outstanding async publishes.
+		Pending int
+
+		// MaxPending is the current maximum number of outstanding async
+		// publishes. With adaptive flow control, this is the current size
+		// of the window.
+		MaxPending int
+
+		// Adaptive indicates whether adaptive flow control is enabled.
+		Adaptive bool
+
+		// Latency is the smoothed PubAck latency.
+		Latency time.Duration
+
+		// MinLatency is the lowest observed PubAck latency.
+		MinLatency time.Duration
+
+		// Acks is the number of acknowledged async publishes.
+		Acks uint64
+
+		// Errors is the number of failed async publishes.
+		Errors uint64
+	}
+
+	// publishWindow tracks PubAck latency and, in adaptive mode, the size
+	// of the window of outstanding async publishes.
+	publishWindow struct {
+		cfg          *PublishAsyncAdaptiveConfig
+		size         float64
+		latency      time.Duration
+		minLatency   time.Duration
+		lastDecrease time.Time
+		acks         uint64
+		errors       uint64
+	}
+)
+
+const (
+	defaultPublishWindowMin = 16
+
+	// publishLatencyWeight is the weight of a new sample in the smoothed
+	// latency (same as smoothed RTT in TCP).
+	publishLatencyWeight = 0.125
+)
+
+// newPublishWindow returns a window for the provided options. The adaptive
+// config is normalized, so it should be validated beforehand.
+func newPublishWindow(opts asyncPublisherOpts) *publishWindow {
+	w := &publishWindow{}
+	if opts.adaptive == nil {
+		return w
+	}
+	cfg := *opts.adaptive
+	if cfg.MinPending == 0 {
+		cfg.MinPending = defaultPublishWindowMin
+	}
+	if cfg.MaxPending == 0 {
+		cfg.MaxPending = max(opts.maxpa, cfg.MinPending)
+	}
+	if cfg.InitialPending == 0 {
+		cfg.InitialPending = cfg.MinPending
+	}
+	w.cfg = &cfg
+	w.size = float64(cfg.InitialPending)
+	return w
+}
+
+// maxPending returns the current limit of outstanding async publishes.
+func (w *publishWindow) maxPending(maxpa int) int {
+	if w.cfg == nil {
+		return maxpa
+	}
+	return int(w.size)
+}
+
+// onAck records the latency of a received PubAck and grows the window,
+// unless the latency exceeds the target.
+func (w *publishWindow) onAck(latency time.Duration) {
+	w.acks++
+	if w.latency == 0 {
+		w.latency = latency
+	} else {
+		w.latency += time.Duration(publishLatencyWeight * float64(latency-w.latency))
+	}
+	if w.minLatency == 0 || latency < w.minLatency {
+		w.minLatency = latency
+	}
+	if w.cfg == nil {
+		return
+	}
+	target := w.cfg.TargetLatency
+	if target == 0 {
+		target = 4 * w.minLatency
+	}
+	if w.latency > target {
+		w.decrease()
+		return
+	}
+	w.size = math.Min(w.size+1/w.size, float64(w.cfg.MaxPending))
+}
+
+// onError records a failed publish, shrinking the window if the error
+// indicates that the server is overloaded.
+func (w *publishWindow) onError(err error) {
+	w.errors++
+	if w.cfg == nil {
+		return
+	}
+	if errors.Is(err, ErrAsyncPublishTimeout) || errors.Is(err, ErrNoStreamResponse) {
+		w.decrease()
+	}
+}
+
+// decrease halves the window, at most once per smoothed latency so that
+// acks of messages sent before the previous decrease do not shrink the
+// window again.
+func (w *publishWindow) decrease() {
+	now := time.Now()
+	if now.Sub(w.lastDecrease) < w.latency {
+		return
+	}
+	w.lastDecrease = now
+	w.size = math.Max(w.size/2, float64(w.cfg.MinPending))
+}
+
+func (w *publishWindow) stats(pending, maxpa int) PublishAsyncStats {
+	return PublishAsyncStats{
+		Pending:    pending,
+		MaxPending: w.maxPending(maxpa),
+		Adaptive:   w.cfg != nil,
+		Latency:    w.latency,
+		MinLatency: w.minLatency,
+		Acks:       w.acks,
+		Errors:     w.errors,
+	}
+}
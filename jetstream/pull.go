@@ -46,6 +46,11 @@ type (
 		// subsequent calls to Next. After the buffer is drained, Next will
 		// return ErrMsgIteratorClosed error.
 		Drain()
+
+		// Stats returns runtime statistics, such as the number of delivered
+		// and acknowledged messages, pending pull request accounting and
+		// missed heartbeats.
+		Stats() ConsumeStats
 	}
 
 	// ConsumeContext supports processing incoming messages from a stream.
@@ -64,6 +69,18 @@ type (
 		// fully stopped/drained. When the channel is closed, no more messages
 		// will be received and processing is complete.
 		Closed() <-chan struct{}
+
+		// Acks returns the [AckPipeline] used to send confirmed
+		// acknowledgements asynchronously. The pipeline can be configured
+		// using [WithAckPipeline]. Pending acknowledgements are confirmed
+		// before Closed is signaled when draining. Ordered consumers do not
+		// acknowledge messages, so Acks returns nil for them.
+		Acks() AckPipeline
+
+		// Stats returns runtime statistics, such as the number of delivered
+		// and acknowledged messages, pending pull request accounting,
+		// missed heartbeats and handler latency.
+		Stats() ConsumeStats
 	}
 
 	// MessageHandler is a handler function used as callback in [Consume].
@@ -108,8 +125,17 @@ type (
 		ThresholdMessages       int
 		ThresholdBytes          int
 		StopAfter               int
+		DeadLetterSubject       string
+		Workers                 int
+		WorkerKey               MsgKeyFunc
+		Middleware              []Middleware
+		AutoInProgress          bool
+		AutoInProgressInterval  time.Duration
+		AutoInProgressMax       time.Duration
+		AckPipeline             *AckPipelineConfig
 		stopAfterMsgsLeft       chan int
 		notifyOnReconnect       bool
+		stats                   *consumeStats
 	}
 
 	ConsumeErrHandlerFunc func(consumeCtx ConsumeContext, err error)
@@ -124,14 +150,19 @@ type (
 		pending           pendingMsgs
 		hbMonitor         *hbMonitor
 		fetchInProgress   atomic.Uint32
+		deadLetter        *deadLetterForwarder
+		workers           *workerPool
+		acks              *ackPipeline
 		closed            atomic.Uint32
 		draining          atomic.Uint32
 		done              chan struct{}
 		connStatusChanged chan nats.Status
+		releaseConnStatus func()
 		fetchNext         chan *pullRequest
 		consumeOpts       *consumeOpts
 		delivered         int
 		closedCh          chan struct{}
+		stats             *consumeStats
 	}
 
 	pendingMsgs struct {
@@ -183,10 +214,21 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 	if handler == nil {
 		return nil, ErrHandlerRequired
 	}
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
 	consumeOpts, err := parseConsumeOpts(false, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidOption, err)
 	}
+	handler = ChainMiddleware(handler, consumeOpts.Middleware...)
+	if consumeOpts.AutoInProgress {
+		interval, err := autoInProgressInterval(consumeOpts.AutoInProgressInterval, p.CachedInfo().Config.AckWait)
+		if err != nil {
+			return nil, err
+		}
+		handler = InProgressMiddleware(interval, consumeOpts.AutoInProgressMax)(handler)
+	}
 	p.Lock()
 
 	subject := p.js.apiSubject(fmt.Sprintf(apiRequestNextT, p.stream, p.name))
@@ -199,8 +241,28 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 		done:        make(chan struct{}, 1),
 		fetchNext:   make(chan *pullRequest, 1),
 		consumeOpts: consumeOpts,
+		stats:       consumeOpts.stats,
+	}
+	if sub.stats == nil {
+		sub.stats = &consumeStats{}
 	}
-	sub.connStatusChanged = p.js.conn.StatusChanged(nats.CONNECTED, nats.RECONNECTING)
+	if consumeOpts.DeadLetterSubject != "" {
+		sub.deadLetter, err = p.js.startDeadLetterForwarder(DeadLetterConfig{
+			Stream:   p.stream,
+			Consumer: p.name,
+			Subject:  consumeOpts.DeadLetterSubject,
+			ErrHandler: func(err error) {
+				if sub.consumeOpts.ErrHandler != nil {
+					sub.consumeOpts.ErrHandler(sub, err)
+				}
+			},
+		})
+		if err != nil {
+			p.Unlock()
+			return nil, err
+		}
+	}
+	sub.connStatusChanged, sub.releaseConnStatus = statusChanged(p.js.conn, nats.CONNECTED, nats.RECONNECTING)
 
 	sub.hbMonitor = sub.scheduleHeartbeatCheck(consumeOpts.Heartbeat)
 
@@ -247,7 +309,13 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 			}
 			return
 		}
-		handler(p.js.toJSMsg(msg))
+		if sub.workers != nil {
+			// pending messages are decremented once the message is
+			// processed, so that pull requests account for in-flight work
+			sub.workers.dispatch(sub.toJSMsg(msg))
+			return
+		}
+		sub.handle(handler, sub.toJSMsg(msg))
 		sub.Lock()
 		sub.decrementPendingMsgs(msg)
 		sub.incrementDeliveredMsgs()
@@ -257,21 +325,64 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 			sub.Stop()
 		}
 	}
+	if consumeOpts.Workers > 0 {
+		sub.workers = newWorkerPool(consumeOpts.Workers, consumeOpts.WorkerKey, func(msg *jetStreamMsg) {
+			// messages which are already queued are discarded on Stop
+			if sub.closed.Load() == 1 && sub.draining.Load() == 0 {
+				return
+			}
+			sub.handle(handler, msg)
+			sub.Lock()
+			sub.decrementPendingMsgs(msg.msg)
+			sub.incrementDeliveredMsgs()
+			if sub.closed.Load() == 0 {
+				sub.checkPending()
+			}
+			stop := sub.consumeOpts.StopAfter > 0 && sub.consumeOpts.StopAfter == sub.delivered
+			sub.Unlock()
+
+			if stop {
+				sub.Stop()
+			}
+		})
+	}
 	inbox := p.js.conn.NewInbox()
 	sub.subscription, err = p.js.conn.Subscribe(inbox, internalHandler)
 	if err != nil {
+		sub.releaseConnStatus()
+		if sub.deadLetter != nil {
+			sub.deadLetter.Stop()
+		}
 		return nil, err
 	}
 	sub.subscription.SetClosedHandler(func(sid string) func(string) {
 		return func(subject string) {
 			p.subs.Delete(sid)
-			sub.draining.CompareAndSwap(1, 0)
-			sub.Lock()
-			if sub.closedCh != nil {
-				close(sub.closedCh)
-				sub.closedCh = nil
+			sub.releaseConnStatus()
+			finish := func() {
+				if acks := sub.ackPipeline(); acks != nil {
+					acks.close(sub.draining.Load() == 1)
+				}
+				sub.draining.CompareAndSwap(1, 0)
+				sub.Lock()
+				if sub.closedCh != nil {
+					close(sub.closedCh)
+					sub.closedCh = nil
+				}
+				sub.Unlock()
 			}
-			sub.Unlock()
+			if sub.workers == nil {
+				finish()
+				return
+			}
+			// workers may still be processing queued messages; waiting
+			// for them here would block the subscription, e.g. when a
+			// handler waits on the connection
+			sub.workers.close()
+			go func() {
+				<-sub.workers.done
+				finish()
+			}()
 		}
 	}(sub.id))
 
@@ -313,6 +424,7 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 					sub.Lock()
 					if !isConnected {
 						isConnected = true
+						sub.stats.recordReconnect()
 						if sub.consumeOpts.notifyOnReconnect {
 							sub.errs <- errConnected
 						}
@@ -369,6 +481,7 @@ func (p *pullConsumer) Consume(handler MessageHandler, opts ...PullConsumeOpt) (
 func (s *pullSubscription) resetPendingMsgs() {
 	s.pending.msgCount = s.consumeOpts.MaxMessages
 	s.pending.byteCount = s.consumeOpts.MaxBytes
+	s.stats.setPending(s.pending.msgCount, s.pending.byteCount)
 }
 
 // decrementPendingMsgs decrements pending message count and byte count
@@ -378,6 +491,7 @@ func (s *pullSubscription) decrementPendingMsgs(msg *nats.Msg) {
 	if s.consumeOpts.MaxBytes != 0 && !s.consumeOpts.LimitSize {
 		s.pending.byteCount -= msg.Size()
 	}
+	s.stats.setPending(s.pending.msgCount, s.pending.byteCount)
 }
 
 // incrementDeliveredMsgs increments delivered message count
@@ -421,6 +535,7 @@ func (s *pullSubscription) checkPending() {
 
 			s.pending.msgCount = s.consumeOpts.MaxMessages
 			s.pending.byteCount = s.consumeOpts.MaxBytes
+			s.stats.setPending(s.pending.msgCount, s.pending.byteCount)
 		}
 	}
 }
@@ -431,6 +546,9 @@ func (s *pullSubscription) checkPending() {
 //
 // See [Consumer.Messages] for more details.
 func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
 	consumeOpts, err := parseMessagesOpts(false, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", ErrInvalidOption, err)
@@ -450,11 +568,30 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 		errs:        make(chan error, 10),
 		fetchNext:   make(chan *pullRequest, 1),
 		consumeOpts: consumeOpts,
+		stats:       consumeOpts.stats,
+	}
+	if sub.stats == nil {
+		sub.stats = &consumeStats{}
+	}
+	if consumeOpts.DeadLetterSubject != "" {
+		sub.deadLetter, err = p.js.startDeadLetterForwarder(DeadLetterConfig{
+			Stream:   p.stream,
+			Consumer: p.name,
+			Subject:  consumeOpts.DeadLetterSubject,
+		})
+		if err != nil {
+			p.Unlock()
+			return nil, err
+		}
 	}
-	sub.connStatusChanged = p.js.conn.StatusChanged(nats.CONNECTED, nats.RECONNECTING)
+	sub.connStatusChanged, sub.releaseConnStatus = statusChanged(p.js.conn, nats.CONNECTED, nats.RECONNECTING)
 	inbox := p.js.conn.NewInbox()
 	sub.subscription, err = p.js.conn.ChanSubscribe(inbox, sub.msgs)
 	if err != nil {
+		sub.releaseConnStatus()
+		if sub.deadLetter != nil {
+			sub.deadLetter.Stop()
+		}
 		p.Unlock()
 		return nil, err
 	}
@@ -467,6 +604,7 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 				// in Next
 				p.subs.Delete(sid)
 			}
+			sub.releaseConnStatus()
 			close(msgs)
 		}
 	}(sub.id))
@@ -484,6 +622,7 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 					return
 				}
 				if status == nats.CONNECTED {
+					sub.stats.recordReconnect()
 					sub.errs <- errConnected
 				}
 				if status == nats.RECONNECTING {
@@ -495,7 +634,7 @@ func (p *pullConsumer) Messages(opts ...PullMessagesOpt) (MessagesContext, error
 		}
 	}()
 
-	return sub, nil
+	return ChainMessagesMiddleware(sub, consumeOpts.Middleware...), nil
 }
 
 var (
@@ -554,11 +693,13 @@ func (s *pullSubscription) Next() (Msg, error) {
 			}
 			s.decrementPendingMsgs(msg)
 			s.incrementDeliveredMsgs()
-			return s.consumer.js.toJSMsg(msg), nil
+			s.stats.recordDelivered(msg)
+			return s.toJSMsg(msg), nil
 		case err := <-s.errs:
 			if errors.Is(err, ErrNoHeartbeat) {
 				s.pending.msgCount = 0
 				s.pending.byteCount = 0
+				s.stats.setPending(0, 0)
 				if s.consumeOpts.ReportMissingHeartbeats {
 					return nil, err
 				}
@@ -575,6 +716,7 @@ func (s *pullSubscription) Next() (Msg, error) {
 					}
 					s.pending.msgCount = 0
 					s.pending.byteCount = 0
+					s.stats.setPending(0, 0)
 					if hbMonitor != nil {
 						hbMonitor.Reset(2 * s.consumeOpts.Heartbeat)
 					}
@@ -601,6 +743,7 @@ func (s *pullSubscription) handleStatusMsg(msg *nats.Msg, msgErr error) error {
 		if errors.Is(msgErr, ErrConsumerLeadershipChanged) {
 			s.pending.msgCount = 0
 			s.pending.byteCount = 0
+			s.stats.setPending(0, 0)
 		}
 		return nil
 	}
@@ -618,6 +761,7 @@ func (s *pullSubscription) handleStatusMsg(msg *nats.Msg, msgErr error) error {
 			s.pending.byteCount = 0
 		}
 	}
+	s.stats.setPending(s.pending.msgCount, s.pending.byteCount)
 	return nil
 }
 
@@ -680,13 +824,69 @@ func (s *pullSubscription) Closed() <-chan struct{} {
 		closedCh = make(chan struct{})
 		s.closedCh = closedCh
 	}
-	if !s.subscription.IsValid() {
+	if !s.subscription.IsValid() && (s.workers == nil || s.workers.finished()) {
 		close(s.closedCh)
 		s.closedCh = nil
 	}
 	return closedCh
 }
 
+// Acks returns the [AckPipeline] used to send confirmed acknowledgements
+// asynchronously. The pipeline is created on first use.
+func (s *pullSubscription) Acks() AckPipeline {
+	s.Lock()
+	defer s.Unlock()
+	if s.acks == nil {
+		var cfg AckPipelineConfig
+		if s.consumeOpts.AckPipeline != nil {
+			cfg = *s.consumeOpts.AckPipeline
+		}
+		ackAll := s.consumer.CachedInfo().Config.AckPolicy == AckAllPolicy
+		s.acks = newAckPipeline(s.consumer.js, cfg, ackAll)
+		if s.subscription != nil && !s.subscription.IsValid() {
+			s.acks.close(false)
+		}
+	}
+	return s.acks
+}
+
+func (s *pullSubscription) ackPipeline() *ackPipeline {
+	s.Lock()
+	defer s.Unlock()
+	return s.acks
+}
+
+// Stats returns runtime statistics of the subscription.
+func (s *pullSubscription) Stats() ConsumeStats {
+	var buffered int
+	if s.msgs != nil {
+		buffered = len(s.msgs)
+	} else if msgs, _, err := s.subscription.Pending(); err == nil {
+		buffered = msgs
+	}
+	if s.workers != nil {
+		buffered += s.workers.queued()
+	}
+	return s.stats.snapshot(buffered)
+}
+
+// toJSMsg converts msg, recording acknowledgements in the subscription
+// statistics.
+func (s *pullSubscription) toJSMsg(msg *nats.Msg) *jetStreamMsg {
+	m := s.consumer.js.toJSMsg(msg)
+	m.stats = s.stats
+	return m
+}
+
+// handle passes msg to the handler, recording the delivery and the time
+// spent in the handler.
+func (s *pullSubscription) handle(handler MessageHandler, msg *jetStreamMsg) {
+	s.stats.recordDelivered(msg.msg)
+	start := time.Now()
+	handler(msg)
+	s.stats.recordHandled(time.Since(start))
+}
+
 // Fetch sends a single request to retrieve given number of messages.
 // It will wait up to provided expiry time if not all messages are available.
 func (p *pullConsumer) Fetch(batch int, opts ...FetchOpt) (MessageBatch, error) {
@@ -758,6 +958,9 @@ func (p *pullConsumer) FetchNoWait(batch int) (MessageBatch, error) {
 }
 
 func (p *pullConsumer) fetch(req *pullRequest) (MessageBatch, error) {
+	if err := p.checkPull(); err != nil {
+		return nil, err
+	}
 	res := &fetchResult{
 		msgs: make(chan Msg, req.Batch),
 	}
@@ -860,6 +1063,15 @@ func (fr *fetchResult) closed() bool {
 // Next is used to retrieve the next message from the stream. This
 // method will block until the message is retrieved or timeout is
 // reached.
+// checkPull returns ErrNotPullConsumer for consumers with a deliver
+// subject, as messages of push consumers cannot be pulled.
+func (p *pullConsumer) checkPull() error {
+	if info := p.CachedInfo(); info != nil && info.Config.DeliverSubject != "" {
+		return ErrNotPullConsumer
+	}
+	return nil
+}
+
 func (p *pullConsumer) Next(opts ...FetchOpt) (Msg, error) {
 	res, err := p.Fetch(1, opts...)
 	if err != nil {
@@ -902,6 +1114,7 @@ func (s *pullSubscription) scheduleHeartbeatCheck(dur time.Duration) *hbMonitor
 	}
 	return &hbMonitor{
 		timer: time.AfterFunc(2*dur, func() {
+			s.stats.recordMissedHeartbeat()
 			s.errs <- ErrNoHeartbeat
 		}),
 	}
@@ -919,6 +1132,9 @@ func (s *pullSubscription) cleanup() {
 	if s.hbMonitor != nil {
 		s.hbMonitor.Stop()
 	}
+	if s.deadLetter != nil {
+		s.deadLetter.Stop()
+	}
 	drainMode := s.draining.Load() == 1
 	if drainMode {
 		s.subscription.Drain()
@@ -948,6 +1164,7 @@ func (s *pullSubscription) pull(req *pullRequest, subject string) error {
 	if err := s.consumer.js.conn.PublishRequest(subject, reply, reqJSON); err != nil {
 		return err
 	}
+	s.stats.recordPullRequest()
 	return nil
 }
 
@@ -1036,5 +1253,17 @@ func (consumeOpts *consumeOpts) setDefaults(ordered bool) error {
 	if consumeOpts.Heartbeat > consumeOpts.Expires/2 {
 		return errors.New("the value of Heartbeat must be less than 50%% of expiry")
 	}
+	if ordered && consumeOpts.Workers > 0 {
+		return errors.New("workers cannot be used with ordered consumer")
+	}
+	if ordered && consumeOpts.AutoInProgress {
+		return errors.New("auto in progress cannot be used with ordered consumer")
+	}
+	if ordered && consumeOpts.DeadLetterSubject != "" {
+		return errors.New("dead letter cannot be used with ordered consumer")
+	}
+	if ordered && consumeOpts.AckPipeline != nil {
+		return errors.New("ack pipeline cannot be used with ordered consumer")
+	}
 	return nil
 }
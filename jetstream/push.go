@@ -0,0 +1,423 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/internal/syncx"
+	"github.com/nats-io/nuid"
+)
+
+type (
+	// PushConsumer contains methods for receiving messages delivered by the
+	// server on the consumer's deliver subject, as well as fetching consumer
+	// info.
+	//
+	// Push consumers are created using CreatePushConsumer (and related)
+	// methods on [Stream] or [JetStream] interface. A push consumer requires
+	// DeliverSubject to be set in [ConsumerConfig]. If DeliverGroup is set,
+	// Consume can be called multiple times (also from different
+	// applications) to distribute messages between the members of the
+	// group.
+	PushConsumer interface {
+		// Consume subscribes to the consumer's deliver subject and handles
+		// incoming messages with the provided callback function. Consume can
+		// be configured using PushConsumeOpt options:
+		//
+		// - Error handling and monitoring can be configured using
+		//   PushConsumeErrHandler option, which provides information about errors
+		//   encountered during consumption (e.g. missing heartbeats).
+		// - Consume can be configured to stop after a certain number of
+		//   messages is received using StopAfter option.
+		//
+		// Flow control messages are answered automatically after all
+		// preceding messages were handled. If IdleHeartbeat is set on the
+		// consumer, a missing heartbeat is reported with [ErrNoHeartbeat].
+		//
+		// Unless DeliverGroup is set, only one Consume can be active at a
+		// time and ErrConsumerHasActiveSubscription is returned otherwise.
+		//
+		// Consume returns a ConsumeContext, which can be used to stop or drain
+		// the consumer.
+		Consume(handler MessageHandler, opts ...PushConsumeOpt) (ConsumeContext, error)
+
+		// Info fetches current ConsumerInfo from the server.
+		Info(context.Context) (*ConsumerInfo, error)
+
+		// CachedInfo returns ConsumerInfo currently cached on this consumer.
+		// This method does not perform any network requests. The cached
+		// ConsumerInfo is updated on every call to Info.
+		CachedInfo() *ConsumerInfo
+	}
+
+	// PushConsumeOpt represent additional options used in [PushConsumer.Consume].
+	PushConsumeOpt interface {
+		configurePushConsume(*pushConsumeOpts) error
+	}
+
+	pushConsumer struct {
+		sync.Mutex
+		js     *jetStream
+		stream string
+		name   string
+		info   *ConsumerInfo
+		subs   syncx.Map[string, *pushSubscription]
+	}
+
+	pushConsumeOpts struct {
+		ErrHandler ConsumeErrHandlerFunc
+		StopAfter  int
+		Middleware []Middleware
+
+		AutoInProgress         bool
+		AutoInProgressInterval time.Duration
+		AutoInProgressMax      time.Duration
+
+		AckPipeline *AckPipelineConfig
+	}
+
+	pushSubscription struct {
+		sync.Mutex
+		id                string
+		consumer          *pushConsumer
+		subscription      *nats.Subscription
+		hbMonitor         *hbMonitor
+		heartbeat         time.Duration
+		errs              chan error
+		done              chan struct{}
+		closed            atomic.Uint32
+		draining          atomic.Uint32
+		connStatusChanged chan nats.Status
+		releaseConnStatus func()
+		consumeOpts       *pushConsumeOpts
+		acks              *ackPipeline
+		delivered         int
+		closedCh          chan struct{}
+		stats             *consumeStats
+	}
+)
+
+const consumerStalledHdr = "Nats-Consumer-Stalled"
+
+// Consume subscribes to the consumer's deliver subject and handles
+// incoming messages with the provided callback function.
+//
+// See [PushConsumer.Consume] for more details.
+func (p *pushConsumer) Consume(handler MessageHandler, opts ...PushConsumeOpt) (ConsumeContext, error) {
+	if handler == nil {
+		return nil, ErrHandlerRequired
+	}
+	consumeOpts, err := parsePushConsumeOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOption, err)
+	}
+	handler = ChainMiddleware(handler, consumeOpts.Middleware...)
+	if consumeOpts.AutoInProgress {
+		interval, err := autoInProgressInterval(consumeOpts.AutoInProgressInterval, p.CachedInfo().Config.AckWait)
+		if err != nil {
+			return nil, err
+		}
+		handler = InProgressMiddleware(interval, consumeOpts.AutoInProgressMax)(handler)
+	}
+	p.Lock()
+	defer p.Unlock()
+
+	cfg := p.info.Config
+	if cfg.DeliverGroup == "" && p.hasActiveSubscription() {
+		return nil, ErrConsumerHasActiveSubscription
+	}
+
+	sub := &pushSubscription{
+		id:          nuid.Next(),
+		consumer:    p,
+		heartbeat:   cfg.IdleHeartbeat,
+		errs:        make(chan error, 10),
+		done:        make(chan struct{}),
+		consumeOpts: consumeOpts,
+		stats:       &consumeStats{},
+	}
+	sub.connStatusChanged, sub.releaseConnStatus = statusChanged(p.js.conn, nats.CONNECTED, nats.RECONNECTING)
+	if sub.heartbeat > 0 {
+		sub.hbMonitor = &hbMonitor{
+			timer: time.AfterFunc(2*sub.heartbeat, func() {
+				sub.stats.recordMissedHeartbeat()
+				select {
+				case sub.errs <- ErrNoHeartbeat:
+				default:
+				}
+			}),
+		}
+	}
+
+	internalHandler := func(msg *nats.Msg) {
+		if sub.closed.Load() == 1 {
+			return
+		}
+		if sub.hbMonitor != nil {
+			sub.hbMonitor.Reset(2 * sub.heartbeat)
+		}
+		userMsg, msgErr := checkMsg(msg)
+		if !userMsg {
+			if msgErr != nil {
+				if sub.consumeOpts.ErrHandler != nil {
+					sub.consumeOpts.ErrHandler(sub, msgErr)
+				}
+				return
+			}
+			sub.handleControlMsg(msg)
+			return
+		}
+		jsMsg := p.js.toJSMsg(msg)
+		jsMsg.stats = sub.stats
+		sub.stats.recordDelivered(msg)
+		start := time.Now()
+		handler(jsMsg)
+		sub.stats.recordHandled(time.Since(start))
+
+		sub.Lock()
+		sub.delivered++
+		delivered := sub.delivered
+		sub.Unlock()
+		if sub.consumeOpts.StopAfter > 0 && delivered >= sub.consumeOpts.StopAfter {
+			sub.Stop()
+		}
+	}
+
+	if cfg.DeliverGroup != "" {
+		sub.subscription, err = p.js.conn.QueueSubscribe(cfg.DeliverSubject, cfg.DeliverGroup, internalHandler)
+	} else {
+		sub.subscription, err = p.js.conn.Subscribe(cfg.DeliverSubject, internalHandler)
+	}
+	if err != nil {
+		sub.releaseConnStatus()
+		if sub.hbMonitor != nil {
+			sub.hbMonitor.Stop()
+		}
+		return nil, err
+	}
+	sub.subscription.SetClosedHandler(func(sid string) func(string) {
+		return func(subject string) {
+			p.subs.Delete(sid)
+			sub.releaseConnStatus()
+			if acks := sub.ackPipeline(); acks != nil {
+				acks.close(sub.draining.Load() == 1)
+			}
+			sub.Lock()
+			if sub.closedCh != nil {
+				close(sub.closedCh)
+				sub.closedCh = nil
+			}
+			sub.Unlock()
+		}
+	}(sub.id))
+	p.subs.Store(sub.id, sub)
+
+	go sub.monitor()
+
+	return sub, nil
+}
+
+// handleControlMsg responds to flow control requests and to heartbeats
+// indicating that the consumer is stalled.
+// Flow control messages are handled on the subscription's goroutine,
+// so all messages delivered before were already processed by the handler.
+func (s *pushSubscription) handleControlMsg(msg *nats.Msg) {
+	var fcReply string
+	descr := msg.Header.Get("Description")
+	switch {
+	case strings.HasPrefix(descr, "Flow"):
+		fcReply = msg.Reply
+	case strings.HasPrefix(descr, "Idle"):
+		fcReply = msg.Header.Get(consumerStalledHdr)
+	}
+	if fcReply == "" {
+		return
+	}
+	if err := s.consumer.js.conn.Publish(fcReply, nil); err != nil && s.consumeOpts.ErrHandler != nil {
+		s.consumeOpts.ErrHandler(s, err)
+	}
+}
+
+// monitor reports missing heartbeats and pauses heartbeat monitoring while
+// the connection is being re-established.
+func (s *pushSubscription) monitor() {
+	for {
+		select {
+		case status, ok := <-s.connStatusChanged:
+			if !ok {
+				return
+			}
+			if status == nats.CONNECTED {
+				s.stats.recordReconnect()
+			}
+			if s.hbMonitor == nil {
+				continue
+			}
+			if status == nats.RECONNECTING {
+				s.hbMonitor.Stop()
+			}
+			if status == nats.CONNECTED {
+				s.hbMonitor.Reset(2 * s.heartbeat)
+			}
+		case err := <-s.errs:
+			if s.consumeOpts.ErrHandler != nil {
+				s.consumeOpts.ErrHandler(s, err)
+			}
+			if s.hbMonitor != nil {
+				s.hbMonitor.Reset(2 * s.heartbeat)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Stop unsubscribes from the deliver subject.
+// No more messages will be received after calling this method.
+func (s *pushSubscription) Stop() {
+	if !s.closed.CompareAndSwap(0, 1) {
+		return
+	}
+	close(s.done)
+	s.cleanup(false)
+}
+
+// Drain unsubscribes from the deliver subject. All messages that are already
+// in the buffer will be processed in callback function.
+func (s *pushSubscription) Drain() {
+	if !s.closed.CompareAndSwap(0, 1) {
+		return
+	}
+	s.draining.Store(1)
+	close(s.done)
+	s.cleanup(true)
+}
+
+func (s *pushSubscription) cleanup(drain bool) {
+	if s.hbMonitor != nil {
+		s.hbMonitor.Stop()
+	}
+	if !s.subscription.IsValid() {
+		return
+	}
+	if drain {
+		s.subscription.Drain()
+	} else {
+		s.subscription.Unsubscribe()
+	}
+}
+
+// Closed returns a channel that is closed when consuming is
+// fully stopped/drained. When the channel is closed, no more messages
+// will be received and processing is complete.
+func (s *pushSubscription) Closed() <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+	closedCh := s.closedCh
+	if closedCh == nil {
+		closedCh = make(chan struct{})
+		s.closedCh = closedCh
+	}
+	if !s.subscription.IsValid() {
+		close(s.closedCh)
+		s.closedCh = nil
+	}
+	return closedCh
+}
+
+// Acks returns the [AckPipeline] used to send confirmed acknowledgements
+// asynchronously. The pipeline is created on first use.
+func (s *pushSubscription) Acks() AckPipeline {
+	s.Lock()
+	defer s.Unlock()
+	if s.acks == nil {
+		var cfg AckPipelineConfig
+		if s.consumeOpts.AckPipeline != nil {
+			cfg = *s.consumeOpts.AckPipeline
+		}
+		ackAll := s.consumer.CachedInfo().Config.AckPolicy == AckAllPolicy
+		s.acks = newAckPipeline(s.consumer.js, cfg, ackAll)
+		if !s.subscription.IsValid() {
+			s.acks.close(false)
+		}
+	}
+	return s.acks
+}
+
+func (s *pushSubscription) ackPipeline() *ackPipeline {
+	s.Lock()
+	defer s.Unlock()
+	return s.acks
+}
+
+// Stats returns runtime statistics of the subscription. Push consumers do
+// not send pull requests, so pending counts are always 0.
+func (s *pushSubscription) Stats() ConsumeStats {
+	var buffered int
+	if msgs, _, err := s.subscription.Pending(); err == nil {
+		buffered = msgs
+	}
+	return s.stats.snapshot(buffered)
+}
+
+// hasActiveSubscription returns true if Consume is currently running on the
+// consumer.
+func (p *pushConsumer) hasActiveSubscription() bool {
+	var active bool
+	p.subs.Range(func(_ string, sub *pushSubscription) bool {
+		active = sub.closed.Load() == 0
+		return !active
+	})
+	return active
+}
+
+// Info fetches current ConsumerInfo from the server.
+func (p *pushConsumer) Info(ctx context.Context) (*ConsumerInfo, error) {
+	info, err := fetchConsumerInfo(ctx, p.js, p.stream, p.name)
+	if err != nil {
+		return nil, err
+	}
+	p.Lock()
+	p.info = info
+	p.Unlock()
+	return info, nil
+}
+
+// CachedInfo returns ConsumerInfo currently cached on this consumer.
+// This method does not perform any network requests. The cached
+// ConsumerInfo is updated on every call to Info.
+func (p *pushConsumer) CachedInfo() *ConsumerInfo {
+	p.Lock()
+	defer p.Unlock()
+	return p.info
+}
+
+func parsePushConsumeOpts(opts ...PushConsumeOpt) (*pushConsumeOpts, error) {
+	consumeOpts := &pushConsumeOpts{
+		StopAfter: unset,
+	}
+	for _, opt := range opts {
+		if err := opt.configurePushConsume(consumeOpts); err != nil {
+			return nil, err
+		}
+	}
+	return consumeOpts, nil
+}
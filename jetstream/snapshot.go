@@ -0,0 +1,396 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// SnapshotOpt is a function setting options for [Stream.Snapshot].
+	SnapshotOpt func(*snapshotOpts) error
+
+	// RestoreOpt is a function setting options for
+	// [StreamManager.RestoreStream].
+	RestoreOpt func(*restoreOpts) error
+
+	// SnapshotInfo contains information about a completed stream snapshot.
+	SnapshotInfo struct {
+		// Config is the configuration of the stream at the time the snapshot
+		// was taken.
+		Config StreamConfig
+
+		// State is the state of the stream at the time the snapshot was
+		// taken.
+		State StreamState
+
+		// Chunks is the number of chunks received from the server.
+		Chunks int
+
+		// Bytes is the size of the snapshot written to the writer.
+		Bytes uint64
+	}
+
+	// SnapshotProgress is passed to the progress callback set using
+	// [WithSnapshotProgress] or [WithRestoreProgress] after each chunk is
+	// transferred.
+	SnapshotProgress struct {
+		// Chunks is the number of chunks transferred so far.
+		Chunks int
+
+		// Bytes is the number of bytes transferred so far.
+		Bytes uint64
+	}
+
+	snapshotOpts struct {
+		req      streamSnapshotRequest
+		progress func(SnapshotProgress)
+	}
+
+	restoreOpts struct {
+		config    *StreamConfig
+		chunkSize int
+		progress  func(SnapshotProgress)
+	}
+
+	streamSnapshotRequest struct {
+		// DeliverSubject is the subject on which snapshot chunks are sent.
+		DeliverSubject string `json:"deliver_subject"`
+		// NoConsumers excludes consumers from the snapshot.
+		NoConsumers bool `json:"no_consumers,omitempty"`
+		// ChunkSize is the size of a single snapshot chunk.
+		ChunkSize int `json:"chunk_size,omitempty"`
+		// CheckMsgs runs a health check on the stream before snapshotting.
+		CheckMsgs bool `json:"jsck,omitempty"`
+	}
+
+	streamSnapshotResponse struct {
+		apiResponse
+		Config *StreamConfig `json:"config"`
+		State  *StreamState  `json:"state"`
+	}
+
+	streamRestoreRequest struct {
+		Config StreamConfig `json:"config"`
+		State  StreamState  `json:"state"`
+	}
+
+	streamRestoreResponse struct {
+		apiResponse
+		DeliverSubject string `json:"deliver_subject"`
+	}
+)
+
+const (
+	// defaultSnapshotChunkSize is the chunk size used for restore if not
+	// provided.
+	defaultSnapshotChunkSize = 128 * 1024
+
+	minSnapshotChunkSize = 1024
+	maxSnapshotChunkSize = 1024 * 1024
+
+	// snapshotMetaFile is the archive entry containing the stream
+	// configuration.
+	snapshotMetaFile = "meta.inf"
+
+	// restoreStatusInterval is the interval in which the stream status is
+	// checked if the final restore response was not received in time.
+	restoreStatusInterval = 250 * time.Millisecond
+)
+
+// Snapshot creates a snapshot of the stream and writes it to w.
+func (s *stream) Snapshot(ctx context.Context, w io.Writer, opts ...SnapshotOpt) (*SnapshotInfo, error) {
+	if w == nil {
+		return nil, fmt.Errorf("%w: writer is required", ErrInvalidOption)
+	}
+	var o snapshotOpts
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	// Subscribe before sending the request, server waits for interest on
+	// the deliver subject before sending the first chunk.
+	o.req.DeliverSubject = s.js.conn.NewInbox()
+	sub, err := s.js.conn.SubscribeSync(o.req.DeliverSubject)
+	if err != nil {
+		return nil, err
+	}
+	// Unsubscribing signals the server that there is no more interest, so
+	// the snapshot is aborted on the server side in case of an error.
+	defer sub.Unsubscribe()
+
+	req, err := json.Marshal(o.req)
+	if err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel := s.js.wrapContextWithoutDeadline(ctx)
+	if cancel != nil {
+		defer cancel()
+	}
+	var resp streamSnapshotResponse
+	snapshotSubject := fmt.Sprintf(apiStreamSnapshotT, s.name)
+	if _, err := s.js.apiRequestJSON(reqCtx, snapshotSubject, &resp, req); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		if resp.Error.ErrorCode == JSErrCodeStreamNotFound {
+			return nil, ErrStreamNotFound
+		}
+		return nil, resp.Error
+	}
+
+	info := &SnapshotInfo{}
+	if resp.Config != nil {
+		info.Config = *resp.Config
+	}
+	if resp.State != nil {
+		info.State = *resp.State
+	}
+
+	for {
+		msg, err := nextSnapshotChunk(ctx, sub)
+		if err != nil {
+			return nil, err
+		}
+		// An empty message marks the end of the snapshot. It may contain
+		// a status header if the server aborted the snapshot.
+		if len(msg.Data) == 0 {
+			if msg.Header.Get(statusHdr) == reqTimeout {
+				return nil, fmt.Errorf("%w: %s", ErrSnapshotTimeout, msg.Header.Get("Description"))
+			}
+			return info, nil
+		}
+		if _, err := w.Write(msg.Data); err != nil {
+			return nil, err
+		}
+		info.Chunks++
+		info.Bytes += uint64(len(msg.Data))
+
+		// Ack the chunk only after it was written, so that the server
+		// does not send more data than the writer is able to handle.
+		if msg.Reply != "" {
+			if err := s.js.conn.Publish(msg.Reply, nil); err != nil {
+				return nil, err
+			}
+		}
+		if o.progress != nil {
+			o.progress(SnapshotProgress{Chunks: info.Chunks, Bytes: info.Bytes})
+		}
+	}
+}
+
+func nextSnapshotChunk(ctx context.Context, sub *nats.Subscription) (*nats.Msg, error) {
+	chunkCtx, cancel := context.WithTimeout(ctx, defaultAPITimeout)
+	defer cancel()
+	msg, err := sub.NextMsgWithContext(chunkCtx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, ErrSnapshotTimeout
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// RestoreStream restores a stream from a snapshot created using
+// [Stream.Snapshot].
+func (js *jetStream) RestoreStream(ctx context.Context, name string, r io.Reader, opts ...RestoreOpt) (Stream, error) {
+	if err := validateStreamName(name); err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, fmt.Errorf("%w: reader is required", ErrInvalidOption)
+	}
+	o := restoreOpts{chunkSize: defaultSnapshotChunkSize}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+
+	var cfg StreamConfig
+	if o.config != nil {
+		cfg = *o.config
+	} else {
+		// The configuration of the restored stream is taken from the
+		// snapshot. Data consumed while reading it is sent to the server
+		// along with the rest of the snapshot.
+		var buf bytes.Buffer
+		snapshotCfg, err := readSnapshotConfig(io.TeeReader(r, &buf))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSnapshot, err)
+		}
+		cfg = *snapshotCfg
+		r = io.MultiReader(&buf, r)
+	}
+	cfg.Name = name
+
+	req, err := json.Marshal(streamRestoreRequest{Config: cfg})
+	if err != nil {
+		return nil, err
+	}
+
+	reqCtx, cancel := js.wrapContextWithoutDeadline(ctx)
+	if cancel != nil {
+		defer cancel()
+	}
+	var resp streamRestoreResponse
+	restoreSubject := fmt.Sprintf(apiStreamRestoreT, name)
+	if _, err := js.apiRequestJSON(reqCtx, restoreSubject, &resp, req); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		switch resp.Error.ErrorCode {
+		case JSErrCodeStreamNameInUse, JSErrCodeStreamNameInUseRestore:
+			return nil, ErrStreamNameAlreadyInUse
+		}
+		return nil, resp.Error
+	}
+
+	var progress SnapshotProgress
+	chunk := make([]byte, o.chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			if err := js.sendRestoreChunk(ctx, resp.DeliverSubject, chunk[:n]); err != nil {
+				return nil, err
+			}
+			progress.Chunks++
+			progress.Bytes += uint64(n)
+			if o.progress != nil {
+				o.progress(progress)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return js.finishRestore(ctx, name, resp.DeliverSubject)
+}
+
+// sendRestoreChunk sends a single chunk of the snapshot and waits for the
+// server to confirm it.
+func (js *jetStream) sendRestoreChunk(ctx context.Context, subject string, data []byte) error {
+	chunkCtx, cancel := context.WithTimeout(ctx, defaultAPITimeout)
+	defer cancel()
+	msg, err := js.conn.RequestWithContext(chunkCtx, subject, data)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return ErrRestoreTimeout
+		}
+		return err
+	}
+	if len(msg.Data) == 0 {
+		return nil
+	}
+	var resp apiResponse
+	if err := json.Unmarshal(msg.Data, &resp); err == nil && resp.Error != nil {
+		return resp.Error
+	}
+	return fmt.Errorf("nats: restore failed: %s", string(msg.Data))
+}
+
+// finishRestore signals the end of the snapshot and waits for the stream to
+// be restored. Restoring large snapshots may take a while, so if the
+// server does not respond in time, the stream state is polled until it
+// becomes available.
+func (js *jetStream) finishRestore(ctx context.Context, name, subject string) (Stream, error) {
+	finishCtx, cancel := context.WithTimeout(ctx, defaultAPITimeout)
+	defer cancel()
+	msg, err := js.conn.RequestWithContext(finishCtx, subject, nil)
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+			return nil, err
+		}
+		return js.waitForRestoredStream(ctx, name)
+	}
+	var resp streamInfoResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return &stream{
+		js:   js,
+		name: name,
+		info: resp.StreamInfo,
+	}, nil
+}
+
+func (js *jetStream) waitForRestoredStream(ctx context.Context, name string) (Stream, error) {
+	ctx, cancel := js.wrapContextWithoutDeadline(ctx)
+	if cancel != nil {
+		defer cancel()
+	}
+	ticker := time.NewTicker(restoreStatusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s, err := js.Stream(ctx, name)
+			if err == nil {
+				return s, nil
+			}
+			if !errors.Is(err, ErrStreamNotFound) {
+				return nil, err
+			}
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrRestoreTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// readSnapshotConfig reads the stream configuration stored in the snapshot
+// archive.
+func readSnapshotConfig(r io.Reader) (*StreamConfig, error) {
+	tr := tar.NewReader(s2.NewReader(r))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("%s not found", snapshotMetaFile)
+			}
+			return nil, err
+		}
+		if hdr.Name != snapshotMetaFile {
+			continue
+		}
+		var cfg StreamConfig
+		if err := json.NewDecoder(tr).Decode(&cfg); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
+	}
+}
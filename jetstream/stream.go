@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"time"
 
@@ -47,6 +48,22 @@ type (
 		// GetMsg retrieves a raw stream message stored in JetStream by sequence number.
 		GetMsg(ctx context.Context, seq uint64, opts ...GetMsgOpt) (*RawStreamMsg, error)
 
+		// StreamBrowser allows iterating over messages stored in the stream
+		// without creating a consumer. It is only available when building
+		// with Go 1.23 or later.
+		StreamBrowser
+
+		// Snapshot creates a snapshot of the stream and writes it to w.
+		// The snapshot can be restored using [StreamManager.RestoreStream].
+		// Consumers are included in the snapshot unless
+		// WithSnapshotConsumers(false) option is used.
+		//
+		// Chunks are acknowledged only after being written, so that the
+		// server does not send more data than the writer can handle. If a
+		// chunk is not received in time, ErrSnapshotTimeout is returned and
+		// the snapshot is aborted on the server, allowing it to be retried.
+		Snapshot(ctx context.Context, w io.Writer, opts ...SnapshotOpt) (*SnapshotInfo, error)
+
 		// GetLastMsgForSubject retrieves the last raw stream message stored in
 		// JetStream on a given subject subject.
 		GetLastMsgForSubject(ctx context.Context, subject string) (*RawStreamMsg, error)
@@ -108,6 +125,30 @@ type (
 		// ConsumerNames returns a ConsumerNameLister enabling iterating over a
 		// channel of consumer names.
 		ConsumerNames(context.Context) ConsumerNameLister
+
+		// CreateOrUpdatePushConsumer creates a push consumer on a given stream
+		// with given config. If consumer already exists, it will be updated
+		// (if possible). DeliverSubject has to be set in the config.
+		// PushConsumer interface is returned, allowing to consume messages.
+		CreateOrUpdatePushConsumer(ctx context.Context, cfg ConsumerConfig) (PushConsumer, error)
+
+		// CreatePushConsumer creates a push consumer on a given stream with
+		// given config. If consumer already exists and the provided
+		// configuration differs from its configuration, ErrConsumerExists is
+		// returned. DeliverSubject has to be set in the config. PushConsumer
+		// interface is returned, allowing to consume messages.
+		CreatePushConsumer(ctx context.Context, cfg ConsumerConfig) (PushConsumer, error)
+
+		// UpdatePushConsumer updates an existing push consumer. If consumer
+		// does not exist, ErrConsumerDoesNotExist is returned. PushConsumer
+		// interface is returned, allowing to consume messages.
+		UpdatePushConsumer(ctx context.Context, cfg ConsumerConfig) (PushConsumer, error)
+
+		// PushConsumer returns an interface to an existing push consumer,
+		// allowing processing of messages. If consumer does not exist,
+		// ErrConsumerNotFound is returned. If the consumer is not a push
+		// consumer, ErrNotPushConsumer is returned.
+		PushConsumer(ctx context.Context, consumer string) (PushConsumer, error)
 	}
 
 	RawStreamMsg struct {
@@ -163,6 +204,22 @@ type (
 		Success bool `json:"success,omitempty"`
 	}
 
+	// StreamBrowseOpt is a function setting options for browsing stream
+	// messages using [StreamBrowser].
+	StreamBrowseOpt func(*streamBrowseOpts) error
+
+	streamBrowseOpts struct {
+		startSeq  uint64
+		endSeq    uint64
+		subject   string
+		maxMsgs   int
+		direction BrowseDirection
+	}
+
+	// BrowseDirection determines the order in which stream messages are
+	// returned when browsing a stream.
+	BrowseDirection int
+
 	// GetMsgOpt is a function setting options for [Stream.GetMsg]
 	GetMsgOpt func(*apiMsgGetRequest) error
 
@@ -296,6 +353,45 @@ func (s *stream) DeleteConsumer(ctx context.Context, name string) error {
 	return deleteConsumer(ctx, s.js, s.name, name)
 }
 
+// CreateOrUpdatePushConsumer creates a push consumer on a given stream
+// with given config. If consumer already exists, it will be updated
+// (if possible). PushConsumer interface is returned, allowing to consume
+// messages.
+func (s *stream) CreateOrUpdatePushConsumer(ctx context.Context, cfg ConsumerConfig) (PushConsumer, error) {
+	return upsertPushConsumer(ctx, s.js, s.name, cfg, consumerActionCreateOrUpdate)
+}
+
+// CreatePushConsumer creates a push consumer on a given stream with
+// given config. If consumer already exists and the provided
+// configuration differs from its configuration, ErrConsumerExists is
+// returned. PushConsumer interface is returned, allowing to consume
+// messages.
+func (s *stream) CreatePushConsumer(ctx context.Context, cfg ConsumerConfig) (PushConsumer, error) {
+	return upsertPushConsumer(ctx, s.js, s.name, cfg, consumerActionCreate)
+}
+
+// UpdatePushConsumer updates an existing push consumer. If consumer
+// does not exist, ErrConsumerDoesNotExist is returned. PushConsumer
+// interface is returned, allowing to consume messages.
+func (s *stream) UpdatePushConsumer(ctx context.Context, cfg ConsumerConfig) (PushConsumer, error) {
+	return upsertPushConsumer(ctx, s.js, s.name, cfg, consumerActionUpdate)
+}
+
+// PushConsumer returns an interface to an existing push consumer,
+// allowing processing of messages. If consumer does not exist,
+// ErrConsumerNotFound is returned.
+func (s *stream) PushConsumer(ctx context.Context, name string) (PushConsumer, error) {
+	return getPushConsumer(ctx, s.js, s.name, name)
+}
+
+const (
+	// BrowseForward returns messages in ascending sequence order.
+	BrowseForward BrowseDirection = iota
+
+	// BrowseBackward returns messages in descending sequence order.
+	BrowseBackward
+)
+
 // Info returns StreamInfo from the server.
 func (s *stream) Info(ctx context.Context, opts ...StreamInfoOpt) (*StreamInfo, error) {
 	ctx, cancel := s.js.wrapContextWithoutDeadline(ctx)
@@ -332,7 +428,7 @@ func (s *stream) Info(ctx context.Context, opts ...StreamInfoOpt) (*StreamInfo,
 			}
 		}
 		var resp streamInfoResponse
-		if _, err = s.js.apiRequestJSON(ctx, infoSubject, &resp, req); err != nil {
+		if _, err = s.js.idempotentAPIRequestJSON(ctx, infoSubject, &resp, req); err != nil {
 			return nil, err
 		}
 		if resp.Error != nil {
@@ -437,14 +533,14 @@ func (s *stream) getMsg(ctx context.Context, mreq *apiMsgGetRequest) (*RawStream
 	if s.info.Config.AllowDirect {
 		if mreq.LastFor != "" {
 			gmSubj = fmt.Sprintf(apiDirectMsgGetLastBySubjectT, s.name, mreq.LastFor)
-			r, err := s.js.apiRequest(ctx, gmSubj, nil)
+			r, err := s.js.idempotentAPIRequest(ctx, gmSubj, nil, nil)
 			if err != nil {
 				return nil, err
 			}
 			return convertDirectGetMsgResponseToMsg(r.msg)
 		}
 		gmSubj = fmt.Sprintf(apiDirectMsgGetT, s.name)
-		r, err := s.js.apiRequest(ctx, gmSubj, req)
+		r, err := s.js.idempotentAPIRequest(ctx, gmSubj, nil, req)
 		if err != nil {
 			return nil, err
 		}
@@ -453,7 +549,7 @@ func (s *stream) getMsg(ctx context.Context, mreq *apiMsgGetRequest) (*RawStream
 
 	var resp apiMsgGetResponse
 	dsSubj := fmt.Sprintf(apiMsgGetT, s.name)
-	_, err = s.js.apiRequestJSON(ctx, dsSubj, &resp, req)
+	_, err = s.js.idempotentAPIRequestJSON(ctx, dsSubj, &resp, req)
 	if err != nil {
 		return nil, err
 	}
@@ -676,7 +772,7 @@ func (s *consumerLister) consumerInfos(ctx context.Context, stream string) ([]*C
 
 	slSubj := fmt.Sprintf(apiConsumerListT, stream)
 	var resp consumerListResponse
-	_, err = s.js.apiRequestJSON(ctx, slSubj, &resp, req)
+	_, err = s.js.idempotentAPIRequestJSON(ctx, slSubj, &resp, req)
 	if err != nil {
 		return nil, err
 	}
@@ -704,7 +800,7 @@ func (s *consumerLister) consumerNames(ctx context.Context, stream string) ([]st
 
 	slSubj := fmt.Sprintf(apiConsumerNamesT, stream)
 	var resp consumerNamesResponse
-	_, err = s.js.apiRequestJSON(ctx, slSubj, &resp, req)
+	_, err = s.js.idempotentAPIRequestJSON(ctx, slSubj, &resp, req)
 	if err != nil {
 		return nil, err
 	}
@@ -155,6 +155,11 @@ type (
 		// the API. Defaults to false.
 		DenyPurge bool `json:"deny_purge,omitempty"`
 
+		// AllowMsgTTL allows setting a TTL on individual messages using the
+		// Nats-TTL header. Once enabled, it cannot be disabled. This feature
+		// requires nats-server v2.11.0 or later.
+		AllowMsgTTL bool `json:"allow_msg_ttl,omitempty"`
+
 		// AllowRollup allows the use of the Nats-Rollup header to replace all
 		// contents of a stream, or subject in a stream, with a single new
 		// message.
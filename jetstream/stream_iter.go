@@ -0,0 +1,148 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+)
+
+// StreamBrowser allows iterating over messages stored in a stream without
+// creating a consumer.
+type StreamBrowser interface {
+	// Messages returns an iter.Seq2[*RawStreamMsg, error] which can be used
+	// to iterate over messages stored in the stream. Messages are retrieved
+	// one by one using direct get if AllowDirect is set on the stream, or
+	// using the STREAM.MSG.GET API otherwise, so no consumer is created.
+	//
+	// The range of returned messages can be limited using StreamBrowseOpt
+	// options (start and end sequence, subject filter, maximum number of
+	// messages and direction). Iteration stops when there are no more
+	// messages in the range. If an error occurs, it is yielded and the
+	// iteration stops.
+	Messages(ctx context.Context, opts ...StreamBrowseOpt) iter.Seq2[*RawStreamMsg, error]
+}
+
+// Messages returns an iter.Seq2[*RawStreamMsg, error] which can be used to
+// iterate over messages stored in the stream.
+func (s *stream) Messages(ctx context.Context, opts ...StreamBrowseOpt) iter.Seq2[*RawStreamMsg, error] {
+	return func(yield func(*RawStreamMsg, error) bool) {
+		var o streamBrowseOpts
+		for _, opt := range opts {
+			if err := opt(&o); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+		if o.direction == BrowseBackward {
+			s.browseBackward(ctx, o, yield)
+			return
+		}
+		s.browseForward(ctx, o, yield)
+	}
+}
+
+func (s *stream) browseForward(ctx context.Context, o streamBrowseOpts, yield func(*RawStreamMsg, error) bool) {
+	// Using next_by_subj skips deleted messages, so a wildcard is used if
+	// no subject filter is set.
+	filter := o.subject
+	if filter == "" {
+		filter = ">"
+	}
+	seq := o.startSeq
+	if seq == 0 {
+		seq = 1
+	}
+	for count := 0; o.maxMsgs == 0 || count < o.maxMsgs; count++ {
+		if o.endSeq != 0 && seq > o.endSeq {
+			return
+		}
+		msg, err := s.getMsg(ctx, &apiMsgGetRequest{Seq: seq, NextFor: filter})
+		if err != nil {
+			if !errors.Is(err, ErrMsgNotFound) {
+				yield(nil, err)
+			}
+			return
+		}
+		if o.endSeq != 0 && msg.Sequence > o.endSeq {
+			return
+		}
+		if !yield(msg, nil) {
+			return
+		}
+		seq = msg.Sequence + 1
+	}
+}
+
+func (s *stream) browseBackward(ctx context.Context, o streamBrowseOpts, yield func(*RawStreamMsg, error) bool) {
+	info, err := s.Info(ctx)
+	if err != nil {
+		yield(nil, err)
+		return
+	}
+	seq := info.State.LastSeq
+	if o.startSeq != 0 && o.startSeq < seq {
+		seq = o.startSeq
+	}
+	lowest := info.State.FirstSeq
+	if o.endSeq > lowest {
+		lowest = o.endSeq
+	}
+	// There is no API to get the previous message for a subject, so
+	// messages are fetched by sequence and filtered on the client.
+	count := 0
+	for ; seq >= lowest && seq > 0; seq-- {
+		if o.maxMsgs != 0 && count >= o.maxMsgs {
+			return
+		}
+		msg, err := s.getMsg(ctx, &apiMsgGetRequest{Seq: seq})
+		if err != nil {
+			if errors.Is(err, ErrMsgNotFound) {
+				continue
+			}
+			yield(nil, err)
+			return
+		}
+		if o.subject != "" && !subjectMatchesFilter(msg.Subject, o.subject) {
+			continue
+		}
+		count++
+		if !yield(msg, nil) {
+			return
+		}
+	}
+}
+
+// subjectMatchesFilter checks whether subject matches the filter, which may
+// contain wildcards.
+func subjectMatchesFilter(subject, filter string) bool {
+	subjectTokens := strings.Split(subject, ".")
+	filterTokens := strings.Split(filter, ".")
+	for i, token := range filterTokens {
+		if token == ">" {
+			return len(subjectTokens) > i
+		}
+		if i >= len(subjectTokens) {
+			return false
+		}
+		if token != "*" && token != subjectTokens[i] {
+			return false
+		}
+	}
+	return len(subjectTokens) == len(filterTokens)
+}
@@ -0,0 +1,286 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestAckPipeline(t *testing.T) {
+	setup := func(t *testing.T, ackPolicy jetstream.AckPolicy, numMsgs int) (jetstream.Stream, jetstream.Consumer, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: ackPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < numMsgs; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte(fmt.Sprintf("msg %d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		return s, c, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("confirm acks", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.AckExplicitPolicy, 100)
+		defer cleanup()
+
+		received := make(chan jetstream.Msg, 100)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 100; i++ {
+			select {
+			case msg := <-received:
+				if err := cc.Acks().Ack(msg); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := cc.Acks().Flush(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if pending := cc.Acks().Pending(); pending != 0 {
+			t.Fatalf("Expected no pending acks; got: %d", pending)
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending != 0 || info.AckFloor.Consumer != 100 {
+			t.Fatalf("Expected all messages to be acknowledged; got: %d ack pending, ack floor %d", info.NumAckPending, info.AckFloor.Consumer)
+		}
+	})
+
+	t.Run("collapse acks with AckAll policy", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.AckAllPolicy, 10)
+		defer cleanup()
+
+		received := make(chan jetstream.Msg, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		}, jetstream.WithAckPipeline(jetstream.AckPipelineConfig{FlushInterval: time.Hour}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 10; i++ {
+			select {
+			case msg := <-received:
+				if err := cc.Acks().Ack(msg); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := cc.Acks().Flush(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending != 0 || info.AckFloor.Consumer != 10 {
+			t.Fatalf("Expected all messages to be acknowledged; got: %d ack pending, ack floor %d", info.NumAckPending, info.AckFloor.Consumer)
+		}
+	})
+
+	t.Run("report failed acks", func(t *testing.T) {
+		s, c, cleanup := setup(t, jetstream.AckExplicitPolicy, 1)
+		defer cleanup()
+
+		failed := make(chan error, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {}, jetstream.WithAckPipeline(jetstream.AckPipelineConfig{
+			AckTimeout: 100 * time.Millisecond,
+			MaxRetries: 1,
+			ErrHandler: func(msg jetstream.Msg, err error) {
+				failed <- err
+			},
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		// acks of a message from a deleted consumer are never confirmed,
+		// while consuming from cons continues
+		ctx := context.Background()
+		other, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "other",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msgs, err := other.FetchNoWait(1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, ok := <-msgs.Messages()
+		if !ok {
+			t.Fatalf("Expected message: %v", msgs.Error())
+		}
+		if err := s.DeleteConsumer(ctx, "other"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := cc.Acks().Ack(msg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case err := <-failed:
+			if !errors.Is(err, nats.ErrTimeout) {
+				t.Fatalf("Expected error: %v; got: %v", nats.ErrTimeout, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for failed ack")
+		}
+		// message can be acknowledged again after a failure
+		if err := cc.Acks().Ack(msg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fail pending acks on stop", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.AckExplicitPolicy, 1)
+		defer cleanup()
+
+		failed := make(chan error, 10)
+		received := make(chan jetstream.Msg, 1)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		}, jetstream.WithAckPipeline(jetstream.AckPipelineConfig{
+			FlushInterval: time.Hour,
+			ErrHandler: func(msg jetstream.Msg, err error) {
+				failed <- err
+			},
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var msg jetstream.Msg
+		select {
+		case msg = <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for message")
+		}
+		if err := cc.Acks().Ack(msg); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cc.Stop()
+		select {
+		case err := <-failed:
+			if !errors.Is(err, jetstream.ErrAckPipelineClosed) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrAckPipelineClosed, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for failed ack")
+		}
+		if err := cc.Acks().Ack(msg); !errors.Is(err, jetstream.ErrAckPipelineClosed) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrAckPipelineClosed, err)
+		}
+	})
+
+	t.Run("confirm pending acks on drain", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.AckExplicitPolicy, 10)
+		defer cleanup()
+
+		received := make(chan jetstream.Msg, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- msg
+		}, jetstream.WithAckPipeline(jetstream.AckPipelineConfig{FlushInterval: time.Hour}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			select {
+			case msg := <-received:
+				if err := cc.Acks().Ack(msg); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for messages")
+			}
+		}
+		cc.Drain()
+		select {
+		case <-cc.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for consume to be closed")
+		}
+		info, err := c.Info(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending != 0 {
+			t.Fatalf("Expected all messages to be acknowledged; got: %d ack pending", info.NumAckPending)
+		}
+		if err := cc.Acks().Ack(nil); !errors.Is(err, jetstream.ErrMsgNotBound) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrMsgNotBound, err)
+		}
+	})
+
+	t.Run("ordered consumer", func(t *testing.T) {
+		s, _, cleanup := setup(t, jetstream.AckExplicitPolicy, 1)
+		defer cleanup()
+
+		c, err := s.OrderedConsumer(context.Background(), jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {}, jetstream.WithAckPipeline(jetstream.AckPipelineConfig{}))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestAdvisories(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.JetStream, jetstream.Stream, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		s, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, s, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	nextEvent := func(t *testing.T, w jetstream.AdvisoryWatcher) jetstream.Advisory {
+		t.Helper()
+		select {
+		case event, ok := <-w.Events():
+			if !ok {
+				t.Fatalf("Events channel closed")
+			}
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for event")
+		}
+		return nil
+	}
+
+	t.Run("consumer events", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		w, err := js.Advisories(ctx, jetstream.WithAdvisoryStream("foo"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer w.Stop()
+
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:         "cons",
+			AckPolicy:       jetstream.AckExplicitPolicy,
+			MaxDeliver:      1,
+			SampleFrequency: "100%",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		created, ok := nextEvent(t, w).(*jetstream.ConsumerActionAdvisory)
+		if !ok {
+			t.Fatalf("Expected consumer action advisory")
+		}
+		if created.Type != jetstream.AdvisoryConsumerCreated || created.Action != "create" {
+			t.Fatalf("Invalid advisory; want: %s; got: %s (%s)", jetstream.AdvisoryConsumerCreated, created.Type, created.Action)
+		}
+		if created.Stream != "foo" || created.Consumer != "cons" {
+			t.Fatalf("Invalid stream or consumer; want: foo/cons; got: %s/%s", created.Stream, created.Consumer)
+		}
+
+		for _, subj := range []string{"FOO.A", "FOO.B"} {
+			if _, err := js.Publish(ctx, subj, []byte("hello")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		msg, err := c.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.DoubleAck(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ack, ok := nextEvent(t, w).(*jetstream.ConsumerAckMetric)
+		if !ok {
+			t.Fatalf("Expected consumer ack metric")
+		}
+		if ack.StreamSeq != 1 || ack.Deliveries != 1 {
+			t.Fatalf("Invalid ack metric: %+v", ack)
+		}
+
+		msg, err = c.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.TermWithReason("invalid"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		terminated, ok := nextEvent(t, w).(*jetstream.ConsumerMsgTerminatedAdvisory)
+		if !ok {
+			t.Fatalf("Expected message terminated advisory")
+		}
+		if terminated.StreamSeq != 2 || terminated.Reason != "invalid" {
+			t.Fatalf("Invalid terminated advisory: %+v", terminated)
+		}
+
+		if err := s.DeleteConsumer(ctx, "cons"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		deleted, ok := nextEvent(t, w).(*jetstream.ConsumerActionAdvisory)
+		if !ok {
+			t.Fatalf("Expected consumer action advisory")
+		}
+		if deleted.Type != jetstream.AdvisoryConsumerDeleted {
+			t.Fatalf("Invalid advisory type; want: %s; got: %s", jetstream.AdvisoryConsumerDeleted, deleted.Type)
+		}
+	})
+
+	t.Run("max deliveries", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		w, err := js.Advisories(ctx,
+			jetstream.WithAdvisoryTypes(jetstream.AdvisoryMaxDeliveries),
+			jetstream.WithAdvisoryConsumer("cons"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer w.Stop()
+
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:    "cons",
+			AckPolicy:  jetstream.AckExplicitPolicy,
+			MaxDeliver: 1,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.A", []byte("hello")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, err := c.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.Nak(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// pull again so that the server notices exceeded deliveries
+		if _, err := c.Fetch(1, jetstream.FetchMaxWait(200*time.Millisecond)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		maxDeliveries, ok := nextEvent(t, w).(*jetstream.ConsumerMaxDeliveriesAdvisory)
+		if !ok {
+			t.Fatalf("Expected max deliveries advisory")
+		}
+		if maxDeliveries.Type != jetstream.AdvisoryMaxDeliveries {
+			t.Fatalf("Invalid advisory type; want: %s; got: %s", jetstream.AdvisoryMaxDeliveries, maxDeliveries.Type)
+		}
+		if maxDeliveries.StreamSeq != 1 || maxDeliveries.Consumer != "cons" {
+			t.Fatalf("Invalid max deliveries advisory: %+v", maxDeliveries)
+		}
+	})
+
+	t.Run("snapshot and restore events", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		w, err := js.Advisories(ctx, jetstream.WithAdvisoryTypes(
+			jetstream.AdvisorySnapshotCreate,
+			jetstream.AdvisorySnapshotComplete,
+			jetstream.AdvisoryRestoreCreate,
+			jetstream.AdvisoryRestoreComplete,
+		))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer w.Stop()
+
+		var buf bytes.Buffer
+		if _, err := s.Snapshot(ctx, &buf); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := nextEvent(t, w).(*jetstream.SnapshotCreateAdvisory); !ok {
+			t.Fatalf("Expected snapshot create advisory")
+		}
+		if _, ok := nextEvent(t, w).(*jetstream.SnapshotCompleteAdvisory); !ok {
+			t.Fatalf("Expected snapshot complete advisory")
+		}
+
+		if err := js.DeleteStream(ctx, "foo"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.RestoreStream(ctx, "foo", &buf); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := nextEvent(t, w).(*jetstream.RestoreCreateAdvisory); !ok {
+			t.Fatalf("Expected restore create advisory")
+		}
+		complete, ok := nextEvent(t, w).(*jetstream.RestoreCompleteAdvisory)
+		if !ok {
+			t.Fatalf("Expected restore complete advisory")
+		}
+		if complete.Stream != "foo" || complete.Bytes == 0 {
+			t.Fatalf("Invalid restore complete advisory: %+v", complete)
+		}
+	})
+
+	t.Run("stop on context cancel", func(t *testing.T) {
+		js, _, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		w, err := js.Advisories(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cancel()
+		select {
+		case _, ok := <-w.Events():
+			if ok {
+				t.Fatalf("Expected events channel to be closed")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for events channel to be closed")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		js, _, cleanup := setup(t)
+		defer cleanup()
+
+		_, err := js.Advisories(context.Background(), jetstream.WithAdvisoryTypes("unknown"))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		_, err = js.Advisories(context.Background(), jetstream.WithAdvisoryStream("foo.bar"))
+		if !errors.Is(err, jetstream.ErrInvalidStreamName) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidStreamName, err)
+		}
+	})
+}
+
+func TestAdvisoriesWithDomain(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: { domain: ABC }
+	`))
+	defer os.Remove(conf)
+	srv, _ := RunServerWithConfig(conf)
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	js, err := jetstream.NewWithDomain(nc, "ABC")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	w, err := js.Advisories(ctx, jetstream.WithAdvisoryTypes(jetstream.AdvisoryConsumerCreated))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer w.Stop()
+
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.CreateOrUpdateConsumer(ctx, "foo", jetstream.ConsumerConfig{Durable: "cons"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case event := <-w.Events():
+		meta := event.Meta()
+		if meta.Domain != "ABC" {
+			t.Fatalf("Invalid domain; want: %s; got: %s", "ABC", meta.Domain)
+		}
+		if meta.Stream != "foo" || meta.Consumer != "cons" {
+			t.Fatalf("Invalid stream or consumer; want: foo/cons; got: %s/%s", meta.Stream, meta.Consumer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for event")
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestAPIRetry(t *testing.T) {
+	// JetStream is not enabled, so API requests fail with no responders
+	srv := RunDefaultServer()
+	defer srv.Shutdown()
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	var requests atomic.Int32
+	js, err := jetstream.New(nc,
+		jetstream.WithClientTrace(&jetstream.ClientTrace{
+			RequestSent: func(string, []byte) { requests.Add(1) },
+		}),
+		jetstream.WithAPIRetry(jetstream.APIRetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: 50 * time.Millisecond,
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("idempotent request is retried", func(t *testing.T) {
+		requests.Store(0)
+		start := time.Now()
+		_, err := js.AccountInfo(ctx)
+		if !errors.Is(err, jetstream.ErrJetStreamNotEnabled) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrJetStreamNotEnabled, err)
+		}
+		if n := requests.Load(); n != 3 {
+			t.Fatalf("Expected 3 attempts; got: %d", n)
+		}
+		// 2 retries with 50ms and 100ms backoff, with jitter
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Fatalf("Expected backoff between attempts; elapsed: %s", elapsed)
+		}
+	})
+
+	t.Run("non idempotent request is not retried", func(t *testing.T) {
+		requests.Store(0)
+		if err := js.DeleteStream(ctx, "foo"); err == nil {
+			t.Fatalf("Expected error")
+		}
+		if n := requests.Load(); n != 1 {
+			t.Fatalf("Expected single attempt; got: %d", n)
+		}
+	})
+
+	t.Run("canceled context stops retries", func(t *testing.T) {
+		requests.Store(0)
+		js, err := jetstream.New(nc,
+			jetstream.WithClientTrace(&jetstream.ClientTrace{
+				RequestSent: func(string, []byte) { requests.Add(1) },
+			}),
+			jetstream.WithAPIRetry(jetstream.APIRetryPolicy{
+				MaxAttempts:    10,
+				InitialBackoff: time.Second,
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if _, err := js.Stream(ctx, "foo"); err == nil {
+			t.Fatalf("Expected error")
+		}
+		if n := requests.Load(); n != 1 {
+			t.Fatalf("Expected single attempt; got: %d", n)
+		}
+	})
+
+	t.Run("direct get is retried", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer nc.Close()
+
+		var directGets atomic.Int32
+		js, err := jetstream.New(nc,
+			jetstream.WithClientTrace(&jetstream.ClientTrace{
+				RequestSent: func(subj string, _ []byte) {
+					if strings.Contains(subj, ".DIRECT.GET.") {
+						directGets.Add(1)
+					}
+				},
+			}),
+			jetstream.WithAPIRetry(jetstream.APIRetryPolicy{
+				MaxAttempts:    3,
+				InitialBackoff: 50 * time.Millisecond,
+				AttemptTimeout: 100 * time.Millisecond,
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}, AllowDirect: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// the handle still uses direct gets, which are no longer answered
+		if err := js.DeleteStream(ctx, "foo"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if _, err := s.GetLastMsgForSubject(ctx, "FOO.A"); !errors.Is(err, nats.ErrTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrTimeout, err)
+		}
+		if n := directGets.Load(); n != 3 {
+			t.Fatalf("Expected 3 attempts; got: %d", n)
+		}
+		directGets.Store(0)
+		if _, err := s.GetMsg(ctx, 1); !errors.Is(err, nats.ErrTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrTimeout, err)
+		}
+		if n := directGets.Load(); n != 3 {
+			t.Fatalf("Expected 3 attempts; got: %d", n)
+		}
+	})
+
+	t.Run("last error is returned when context is done", func(t *testing.T) {
+		// the first request fails with a retryable error and the next one
+		// is never answered
+		var infoRequests atomic.Int32
+		sub, err := nc.Subscribe("$JS.API.INFO", func(msg *nats.Msg) {
+			if infoRequests.Add(1) == 1 {
+				msg.Respond([]byte(`{"type":"io.nats.jetstream.api.v1.account_info_response","error":{"code":503,"err_code":10008,"description":"JetStream system temporarily unavailable"}}`))
+			}
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer sub.Unsubscribe()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		expectedErr := &jetstream.APIError{ErrorCode: jetstream.JSErrCodeClusterNotAvailable}
+		if _, err := js.AccountInfo(ctx); !errors.Is(err, expectedErr) {
+			t.Fatalf("Expected error: %v; got: %v", expectedErr, err)
+		}
+		if n := infoRequests.Load(); n != 2 {
+			t.Fatalf("Expected 2 attempts; got: %d", n)
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		_, err := jetstream.New(nc, jetstream.WithAPIRetry(jetstream.APIRetryPolicy{Jitter: 2}))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		_, err = jetstream.New(nc, jetstream.WithAPIRetry(jetstream.APIRetryPolicy{
+			InitialBackoff: 5 * time.Second,
+			MaxBackoff:     time.Second,
+		}))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
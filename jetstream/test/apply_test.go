@@ -0,0 +1,212 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestApply(t *testing.T) {
+	manifestJSON := []byte(`{
+		"streams": [{"name": "ORDERS", "subjects": ["orders.>"], "storage": "file", "max_age": 3600000000000}],
+		"consumers": [
+			{"stream": "ORDERS", "config": {"durable_name": "processor", "ack_policy": "explicit", "max_deliver": 5}},
+			{"stream": "ORDERS", "config": {"durable_name": "audit", "deliver_subject": "audit.orders"}}
+		],
+		"key_value_stores": [{"bucket": "config", "history": 5}],
+		"object_stores": [{"bucket": "files"}]
+	}`)
+
+	setup := func(t *testing.T) (jetstream.JetStream, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	expectActions := func(t *testing.T, plan *jetstream.Plan, expected ...jetstream.ActionType) {
+		t.Helper()
+		if len(plan.Actions) != len(expected) {
+			t.Fatalf("Invalid number of actions; want: %d; got: %d", len(expected), len(plan.Actions))
+		}
+		for i, action := range plan.Actions {
+			if action.Action != expected[i] {
+				t.Fatalf("Invalid action for %s %q; want: %s; got: %s", action.Resource, action.Name, expected[i], action.Action)
+			}
+		}
+	}
+
+	t.Run("dry run, create and reapply", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		m, err := jetstream.ParseManifest(manifestJSON)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		plan, err := jetstream.Apply(ctx, js, *m, jetstream.WithDryRun())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !plan.DryRun {
+			t.Fatalf("Expected dry run plan")
+		}
+		// stream, kv, object store, 2 consumers
+		create := jetstream.ActionCreate
+		expectActions(t, plan, create, create, create, create, create)
+		if _, err := js.Stream(ctx, "ORDERS"); !errors.Is(err, jetstream.ErrStreamNotFound) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrStreamNotFound, err)
+		}
+
+		plan, err = jetstream.Apply(ctx, js, *m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectActions(t, plan, create, create, create, create, create)
+
+		if _, err := js.KeyValue(ctx, "config"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.ObjectStore(ctx, "files"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Consumer(ctx, "ORDERS", "processor"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.PushConsumer(ctx, "ORDERS", "audit"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// applying the same manifest again should not result in any changes
+		plan, err = jetstream.Apply(ctx, js, *m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if plan.HasChanges() {
+			for _, action := range plan.Actions {
+				t.Logf("%s %q: %s %+v", action.Resource, action.Name, action.Action, action.Changes)
+			}
+			t.Fatalf("Expected no changes")
+		}
+	})
+
+	t.Run("update mutable fields", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		m, err := jetstream.ParseManifest(manifestJSON)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := jetstream.Apply(ctx, js, *m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		m.Streams[0].Description = "orders stream"
+		m.Consumers[0].Config.MaxDeliver = 10
+		plan, err := jetstream.Apply(ctx, js, *m)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		none, update := jetstream.ActionNone, jetstream.ActionUpdate
+		expectActions(t, plan, update, none, none, update, none)
+		if plan.Actions[0].Changes[0].Field != "description" {
+			t.Fatalf("Invalid changed field; want: %s; got: %s", "description", plan.Actions[0].Changes[0].Field)
+		}
+
+		s, err := js.Stream(ctx, "ORDERS")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if s.CachedInfo().Config.Description != "orders stream" {
+			t.Fatalf("Invalid description; want: %s; got: %s", "orders stream", s.CachedInfo().Config.Description)
+		}
+		c, err := s.Consumer(ctx, "processor")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.CachedInfo().Config.MaxDeliver != 10 {
+			t.Fatalf("Invalid max deliver; want: %d; got: %d", 10, c.CachedInfo().Config.MaxDeliver)
+		}
+	})
+
+	t.Run("immutable changes are not applied", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		m, err := jetstream.ParseManifest(manifestJSON)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := jetstream.Apply(ctx, js, *m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		m.Streams[0].Storage = jetstream.MemoryStorage
+		m.Consumers[0].Config.MaxDeliver = 10
+		plan, err := jetstream.Apply(ctx, js, *m)
+		if !errors.Is(err, jetstream.ErrNotUpdatable) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotUpdatable, err)
+		}
+		notUpdatable := plan.NotUpdatable()
+		if len(notUpdatable) != 1 || notUpdatable[0].Name != "ORDERS" {
+			t.Fatalf("Expected stream ORDERS to be not updatable; got: %+v", notUpdatable)
+		}
+
+		// no changes should be applied, including mutable ones
+		c, err := js.Consumer(ctx, "ORDERS", "processor")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.CachedInfo().Config.MaxDeliver != 5 {
+			t.Fatalf("Invalid max deliver; want: %d; got: %d", 5, c.CachedInfo().Config.MaxDeliver)
+		}
+	})
+
+	t.Run("consumer without name", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+
+		m := jetstream.Manifest{
+			Streams:   []jetstream.StreamConfig{{Name: "foo"}},
+			Consumers: []jetstream.ManifestConsumer{{Stream: "foo"}},
+		}
+		_, err := jetstream.Apply(context.Background(), js, m)
+		if !errors.Is(err, jetstream.ErrInvalidConsumerName) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidConsumerName, err)
+		}
+	})
+}
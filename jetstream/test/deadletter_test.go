@@ -0,0 +1,259 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestDeadLetter(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.JetStream, jetstream.Stream, jetstream.Stream, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		dlq, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "dlq", Subjects: []string{"DLQ.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, s, dlq, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	waitForDeadLetters := func(t *testing.T, dlq jetstream.Stream, expected uint64) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for {
+			info, err := dlq.Info(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if info.State.Msgs == expected {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				t.Fatalf("Timeout waiting for dead letters; want: %d; got: %d", expected, info.State.Msgs)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	expectHeader := func(t *testing.T, hdr nats.Header, key, expected string) {
+		t.Helper()
+		if got := hdr.Get(key); got != expected {
+			t.Fatalf("Invalid %s header; want: %q; got: %q", key, expected, got)
+		}
+	}
+
+	t.Run("consume with dead letter on max deliveries", func(t *testing.T) {
+		js, s, dlq, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:    "cons",
+			AckPolicy:  jetstream.AckExplicitPolicy,
+			MaxDeliver: 2,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		errs := make(chan error, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			msg.Nak()
+		}, jetstream.WithDeadLetter("DLQ.foo"), jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+			errs <- err
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		if _, err := js.PublishMsg(ctx, &nats.Msg{
+			Subject: "FOO.A",
+			Header:  nats.Header{"X-Custom": []string{"value"}},
+			Data:    []byte("hello"),
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		waitForDeadLetters(t, dlq, 1)
+
+		msg, err := dlq.GetMsg(ctx, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(msg.Data) != "hello" {
+			t.Fatalf("Invalid message data; want: %q; got: %q", "hello", string(msg.Data))
+		}
+		expectHeader(t, msg.Header, jetstream.DeadLetterStreamHeader, "foo")
+		expectHeader(t, msg.Header, jetstream.DeadLetterSequenceHeader, "1")
+		expectHeader(t, msg.Header, jetstream.DeadLetterSubjectHeader, "FOO.A")
+		expectHeader(t, msg.Header, jetstream.DeadLetterConsumerHeader, "cons")
+		expectHeader(t, msg.Header, jetstream.DeadLetterDeliveriesHeader, "2")
+		expectHeader(t, msg.Header, jetstream.DeadLetterReasonHeader, jetstream.DeadLetterReasonMaxDeliveries)
+		expectHeader(t, msg.Header, "X-Custom", "value")
+
+		select {
+		case err := <-errs:
+			t.Fatalf("Unexpected error: %v", err)
+		default:
+		}
+	})
+
+	t.Run("forwarder with term reason", func(t *testing.T) {
+		js, s, dlq, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		f, err := jetstream.NewDeadLetterForwarder(js, jetstream.DeadLetterConfig{
+			Stream:  "foo",
+			Subject: "DLQ.foo",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer f.Stop()
+
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, subj := range []string{"FOO.A", "FOO.B"} {
+			if _, err := js.Publish(ctx, subj, []byte("hello")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		msgs, err := c.Fetch(2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for msg := range msgs.Messages() {
+			if msg.Subject() == "FOO.B" {
+				if err := msg.TermWithReason("invalid payload"); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				continue
+			}
+			if err := msg.Ack(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		waitForDeadLetters(t, dlq, 1)
+
+		msg, err := dlq.GetMsg(ctx, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expectHeader(t, msg.Header, jetstream.DeadLetterSequenceHeader, "2")
+		expectHeader(t, msg.Header, jetstream.DeadLetterSubjectHeader, "FOO.B")
+		expectHeader(t, msg.Header, jetstream.DeadLetterReasonHeader, "invalid payload")
+	})
+
+	t.Run("forwarding error is reported", func(t *testing.T) {
+		js, s, _, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		errs := make(chan error, 1)
+		f, err := jetstream.NewDeadLetterForwarder(js, jetstream.DeadLetterConfig{
+			Stream:     "foo",
+			Consumer:   "cons",
+			Subject:    "DLQ.foo",
+			ErrHandler: func(err error) { errs <- err },
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer f.Stop()
+
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.A", []byte("hello")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, err := c.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// remove the message before the forwarder is able to retrieve it
+		if err := s.DeleteMsg(ctx, 1); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := msg.TermWithReason("invalid payload"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, jetstream.ErrDeadLetterForward) || !errors.Is(err, jetstream.ErrMsgNotFound) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrDeadLetterForward, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for error")
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		js, s, _, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := jetstream.NewDeadLetterForwarder(js, jetstream.DeadLetterConfig{Stream: "foo"}); !errors.Is(err, jetstream.ErrInvalidSubject) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidSubject, err)
+		}
+		if _, err := jetstream.NewDeadLetterForwarder(js, jetstream.DeadLetterConfig{Subject: "DLQ.foo"}); !errors.Is(err, jetstream.ErrStreamNameRequired) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrStreamNameRequired, err)
+		}
+
+		c, err := s.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := c.Messages(jetstream.WithDeadLetter("DLQ.foo")); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
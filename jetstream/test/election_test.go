@@ -0,0 +1,307 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/jetstream/election"
+)
+
+// partitionProxy forwards TCP connections to a server. While partitioned,
+// existing connections are closed and new ones are refused.
+type partitionProxy struct {
+	listener    net.Listener
+	target      string
+	mu          sync.Mutex
+	conns       []net.Conn
+	partitioned bool
+}
+
+func newPartitionProxy(t *testing.T, target string) *partitionProxy {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p := &partitionProxy{listener: l, target: target}
+	go p.accept()
+	return p
+}
+
+func (p *partitionProxy) URL() string {
+	return fmt.Sprintf("nats://%s", p.listener.Addr())
+}
+
+func (p *partitionProxy) accept() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		if p.partitioned {
+			p.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		upstream, err := net.Dial("tcp", p.target)
+		if err != nil {
+			p.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		p.conns = append(p.conns, conn, upstream)
+		p.mu.Unlock()
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		go func() {
+			io.Copy(conn, upstream)
+			conn.Close()
+		}()
+	}
+}
+
+func (p *partitionProxy) partition() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partitioned = true
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+func (p *partitionProxy) heal() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partitioned = false
+}
+
+func (p *partitionProxy) close() {
+	p.partition()
+	p.listener.Close()
+}
+
+func TestElection(t *testing.T) {
+	expectLeadership := func(t *testing.T, ch <-chan bool, expected bool, timeout time.Duration) {
+		t.Helper()
+		select {
+		case leader := <-ch:
+			if leader != expected {
+				t.Fatalf("Expected leadership to be %v", expected)
+			}
+		case <-time.After(timeout):
+			t.Fatalf("Did not receive leadership change to %v", expected)
+		}
+	}
+
+	t.Run("resign", func(t *testing.T) {
+		s := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, s)
+
+		nc, js := jsClient(t, s)
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "ELECTIONS", TTL: time.Second})
+		expectOk(t, err)
+
+		a, err := election.Campaign(ctx, kv, "worker", "a")
+		expectOk(t, err)
+		defer a.Resign(ctx)
+		b, err := election.Campaign(ctx, kv, "worker", "b")
+		expectOk(t, err)
+		defer b.Resign(ctx)
+
+		if !a.IsLeader() || b.IsLeader() {
+			t.Fatalf("Expected a to be the leader")
+		}
+		if b.Leader() != "a" {
+			t.Fatalf("Expected b to observe a as the leader; got %q", b.Leader())
+		}
+		observeB := b.Observe()
+		expectLeadership(t, observeB, false, time.Second)
+
+		// leadership is kept past the bucket TTL
+		time.Sleep(1500 * time.Millisecond)
+		if !a.IsLeader() || b.IsLeader() {
+			t.Fatalf("Expected a to stay the leader")
+		}
+
+		termA := a.Term()
+		expectOk(t, a.Resign(ctx))
+		expectLeadership(t, observeB, true, time.Second)
+		if b.Term() <= termA {
+			t.Fatalf("Expected term to increase; got %d after %d", b.Term(), termA)
+		}
+	})
+
+	t.Run("network partition", func(t *testing.T) {
+		s := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, s)
+
+		clientURL, err := url.Parse(s.ClientURL())
+		expectOk(t, err)
+		proxy := newPartitionProxy(t, clientURL.Host)
+		defer proxy.close()
+
+		// a is connected through the proxy, b directly
+		ncA, err := nats.Connect(proxy.URL(), nats.ReconnectWait(50*time.Millisecond), nats.MaxReconnects(-1))
+		expectOk(t, err)
+		defer ncA.Close()
+		jsA, err := jetstream.New(ncA)
+		expectOk(t, err)
+		ncB, jsB := jsClient(t, s)
+		defer ncB.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		ttl := time.Second
+		kvA, err := jsA.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "ELECTIONS", TTL: ttl})
+		expectOk(t, err)
+		kvB, err := jsB.KeyValue(ctx, "ELECTIONS")
+		expectOk(t, err)
+
+		a, err := election.Campaign(ctx, kvA, "worker", "a")
+		expectOk(t, err)
+		defer a.Resign(ctx)
+		observeA := a.Observe()
+		expectLeadership(t, observeA, true, time.Second)
+		b, err := election.Campaign(ctx, kvB, "worker", "b")
+		expectOk(t, err)
+		defer b.Resign(ctx)
+		observeB := b.Observe()
+		expectLeadership(t, observeB, false, time.Second)
+
+		// the partitioned leader steps down before its key expires on the
+		// server, then b is elected
+		termA := a.Term()
+		partitionedAt := time.Now()
+		proxy.partition()
+		expectLeadership(t, observeA, false, 2*ttl)
+		if b.IsLeader() {
+			t.Fatalf("Expected b not to be elected before a stepped down")
+		}
+		expectLeadership(t, observeB, true, 3*ttl)
+		if elapsed := time.Since(partitionedAt); elapsed < ttl/2 {
+			t.Fatalf("Leadership moved after %v, before the key could expire", elapsed)
+		}
+		if a.IsLeader() {
+			t.Fatalf("Expected a not to be the leader while partitioned")
+		}
+		termB := b.Term()
+		if termB <= termA {
+			t.Fatalf("Expected term to increase; got %d after %d", termB, termA)
+		}
+
+		// once the partition heals, a observes b as the leader
+		proxy.heal()
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			if !ncA.IsConnected() {
+				return fmt.Errorf("a is not reconnected")
+			}
+			if a.Leader() != "b" {
+				return fmt.Errorf("expected a to observe b as the leader; got %q", a.Leader())
+			}
+			return nil
+		})
+
+		// a stays a follower while b keeps refreshing the key
+		time.Sleep(3 * ttl)
+		select {
+		case leader := <-observeA:
+			if leader {
+				t.Fatalf("Expected a to stay a follower after the partition healed")
+			}
+		default:
+		}
+		if a.IsLeader() || !b.IsLeader() || b.Term() != termB {
+			t.Fatalf("Expected b to stay the leader after the partition healed")
+		}
+		if a.Leader() != "b" {
+			t.Fatalf("Expected a to observe b as the leader; got %q", a.Leader())
+		}
+	})
+
+	t.Run("server restart", func(t *testing.T) {
+		s := RunBasicJetStreamServer()
+		defer func() {
+			shutdownJSServerAndRemoveStorage(t, s)
+		}()
+
+		reconnect := []nats.Option{nats.ReconnectWait(50 * time.Millisecond), nats.MaxReconnects(-1)}
+		ncA, jsA := jsClient(t, s, reconnect...)
+		defer ncA.Close()
+		ncB, jsB := jsClient(t, s, reconnect...)
+		defer ncB.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		ttl := time.Second
+		kvA, err := jsA.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "ELECTIONS", TTL: ttl})
+		expectOk(t, err)
+		kvB, err := jsB.KeyValue(ctx, "ELECTIONS")
+		expectOk(t, err)
+
+		a, err := election.Campaign(ctx, kvA, "worker", "a")
+		expectOk(t, err)
+		defer a.Resign(ctx)
+		observeA := a.Observe()
+		expectLeadership(t, observeA, true, time.Second)
+		b, err := election.Campaign(ctx, kvB, "worker", "b")
+		expectOk(t, err)
+		defer b.Resign(ctx)
+		termA := a.Term()
+
+		// the leader steps down while the server is unavailable
+		restart := stopBasicJSServer(t, s)
+		expectLeadership(t, observeA, false, 2*ttl)
+		if a.IsLeader() || b.IsLeader() {
+			t.Fatalf("Expected no leader while the server is down")
+		}
+
+		// once the server is back, the stale key expires and a single
+		// leader is elected, observed by both candidates
+		s = restart()
+		checkFor(t, 10*time.Second, 100*time.Millisecond, func() error {
+			if a.IsLeader() == b.IsLeader() {
+				return fmt.Errorf("expected a single leader; a: %v, b: %v", a.IsLeader(), b.IsLeader())
+			}
+			leader := "a"
+			if b.IsLeader() {
+				leader = "b"
+			}
+			if a.Leader() != leader || b.Leader() != leader {
+				return fmt.Errorf("expected both to observe %q as the leader; got %q and %q", leader, a.Leader(), b.Leader())
+			}
+			return nil
+		})
+		if term := max(a.Term(), b.Term()); term <= termA {
+			t.Fatalf("Expected term to increase; got %d after %d", term, termA)
+		}
+	})
+}
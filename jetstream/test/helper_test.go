@@ -305,6 +305,12 @@ func withJSCluster(t *testing.T, clusterName string, size int, tfn func(t *testi
 }
 
 func restartBasicJSServer(t *testing.T, s *server.Server) *server.Server {
+	return stopBasicJSServer(t, s)()
+}
+
+// stopBasicJSServer shuts down the server, returning a function which
+// restarts it with the same port and storage.
+func stopBasicJSServer(t *testing.T, s *server.Server) func() *server.Server {
 	opts := natsserver.DefaultTestOptions
 	clientURL, err := url.Parse(s.ClientURL())
 	if err != nil {
@@ -319,7 +325,9 @@ func restartBasicJSServer(t *testing.T, s *server.Server) *server.Server {
 	opts.StoreDir = s.JetStreamConfig().StoreDir
 	s.Shutdown()
 	s.WaitForShutdown()
-	return RunServerWithOptions(opts)
+	return func() *server.Server {
+		return RunServerWithOptions(opts)
+	}
 }
 
 func checkFor(t *testing.T, totalWait, sleepDur time.Duration, f func() error) {
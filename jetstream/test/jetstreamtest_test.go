@@ -0,0 +1,385 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/jetstream/jetstreamtest"
+)
+
+// runWithBackends runs f against nats-server and against the in-memory
+// implementation from jetstreamtest, so that suites exercising the public
+// API also verify the behavior of the fake.
+func runWithBackends(t *testing.T, f func(t *testing.T, js jetstream.JetStream)) {
+	t.Helper()
+	t.Run("server", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		nc, js := jsClient(t, srv)
+		defer nc.Close()
+		f(t, js)
+	})
+	t.Run("jetstreamtest", func(t *testing.T) {
+		f(t, jetstreamtest.New())
+	})
+}
+
+// TestJetStreamTestParity runs the same scenarios against nats-server and
+// the in-memory implementation from jetstreamtest.
+func TestJetStreamTestParity(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, js jetstream.JetStream)
+	}{
+		{
+			name: "max msgs per subject",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO.*"}, MaxMsgsPerSubject: 2})
+				expectOk(t, err)
+				for _, subj := range []string{"FOO.A", "FOO.A", "FOO.A", "FOO.B"} {
+					_, err := js.Publish(ctx, subj, []byte("msg"))
+					expectOk(t, err)
+				}
+				info, err := s.Info(ctx)
+				expectOk(t, err)
+				if info.State.Msgs != 3 || info.State.FirstSeq != 2 || info.State.LastSeq != 4 || info.State.NumSubjects != 2 {
+					t.Fatalf("Unexpected stream state: %+v", info.State)
+				}
+				msg, err := s.GetLastMsgForSubject(ctx, "FOO.A")
+				expectOk(t, err)
+				if msg.Sequence != 3 {
+					t.Fatalf("Expected sequence 3; got %d", msg.Sequence)
+				}
+			},
+		},
+		{
+			name: "discard new",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				_, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}, MaxMsgs: 1, Discard: jetstream.DiscardNew})
+				expectOk(t, err)
+				_, err = js.Publish(ctx, "FOO", []byte("msg"))
+				expectOk(t, err)
+				_, err = js.Publish(ctx, "FOO", []byte("msg"))
+				var apiErr *jetstream.APIError
+				if !errors.As(err, &apiErr) || apiErr.ErrorCode != 10077 {
+					t.Fatalf("Expected maximum messages exceeded error; got %v", err)
+				}
+			},
+		},
+		{
+			name: "deduplication and expectations",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				_, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}})
+				expectOk(t, err)
+				_, err = js.Publish(ctx, "FOO", []byte("msg"), jetstream.WithMsgID("1"))
+				expectOk(t, err)
+				ack, err := js.Publish(ctx, "FOO", []byte("msg"), jetstream.WithMsgID("1"))
+				expectOk(t, err)
+				if !ack.Duplicate || ack.Sequence != 1 {
+					t.Fatalf("Expected duplicate of sequence 1; got %+v", ack)
+				}
+				_, err = js.Publish(ctx, "FOO", []byte("msg"), jetstream.WithExpectLastSequence(2))
+				expectErr(t, err)
+				_, err = js.Publish(ctx, "FOO", []byte("msg"), jetstream.WithExpectLastMsgID("1"))
+				expectOk(t, err)
+				_, err = js.Publish(ctx, "FOO", []byte("msg"), jetstream.WithExpectStream("OTHER"))
+				expectErr(t, err)
+				_, err = js.Publish(ctx, "BAR", []byte("msg"))
+				expectErr(t, err, jetstream.ErrNoStreamResponse)
+			},
+		},
+		{
+			name: "work queue",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO.*"}, Retention: jetstream.WorkQueuePolicy})
+				expectOk(t, err)
+				_, err = s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "none", AckPolicy: jetstream.AckNonePolicy})
+				expectErr(t, err)
+				c, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "a", AckPolicy: jetstream.AckExplicitPolicy, FilterSubject: "FOO.A"})
+				expectOk(t, err)
+				_, err = s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "b", AckPolicy: jetstream.AckExplicitPolicy, FilterSubject: "FOO.*"})
+				expectErr(t, err)
+				for _, subj := range []string{"FOO.A", "FOO.B", "FOO.A"} {
+					_, err := js.Publish(ctx, subj, []byte("msg"))
+					expectOk(t, err)
+				}
+				msgs, err := c.Fetch(5, jetstream.FetchMaxWait(200*time.Millisecond))
+				expectOk(t, err)
+				var count int
+				for msg := range msgs.Messages() {
+					expectOk(t, msg.DoubleAck(ctx))
+					count++
+				}
+				if count != 2 {
+					t.Fatalf("Expected 2 messages; got %d", count)
+				}
+				info, err := s.Info(ctx)
+				expectOk(t, err)
+				if info.State.Msgs != 1 {
+					t.Fatalf("Expected 1 message left in stream; got %d", info.State.Msgs)
+				}
+			},
+		},
+		{
+			name: "nak and ack wait redelivery",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				_, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}})
+				expectOk(t, err)
+				c, err := js.CreateConsumer(ctx, "TEST", jetstream.ConsumerConfig{Durable: "cons", AckPolicy: jetstream.AckExplicitPolicy, AckWait: 500 * time.Millisecond})
+				expectOk(t, err)
+				_, err = js.Publish(ctx, "FOO", []byte("msg"))
+				expectOk(t, err)
+
+				msg, err := c.Next()
+				expectOk(t, err)
+				expectOk(t, msg.Nak())
+				expectErr(t, msg.Ack(), jetstream.ErrMsgAlreadyAckd)
+
+				msg, err = c.Next()
+				expectOk(t, err)
+				start := time.Now()
+				msg, err = c.Next()
+				expectOk(t, err)
+				if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+					t.Fatalf("Expected redelivery after ack wait; got it after %v", elapsed)
+				}
+				meta, err := msg.Metadata()
+				expectOk(t, err)
+				if meta.NumDelivered != 3 || meta.Sequence.Stream != 1 || meta.Sequence.Consumer != 3 {
+					t.Fatalf("Unexpected metadata: %+v", meta)
+				}
+				expectOk(t, msg.DoubleAck(ctx))
+				_, err = c.Next(jetstream.FetchMaxWait(200 * time.Millisecond))
+				expectErr(t, err, nats.ErrTimeout)
+				info, err := c.Info(ctx)
+				expectOk(t, err)
+				if info.NumAckPending != 0 || info.NumRedelivered != 0 || info.AckFloor.Stream != 1 {
+					t.Fatalf("Unexpected consumer info: %+v", info)
+				}
+			},
+		},
+		{
+			name: "consumer errors",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				_, err := js.Stream(ctx, "TEST")
+				expectErr(t, err, jetstream.ErrStreamNotFound)
+				s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "TEST", Subjects: []string{"FOO"}})
+				expectOk(t, err)
+				_, err = s.Consumer(ctx, "cons")
+				expectErr(t, err, jetstream.ErrConsumerNotFound)
+				_, err = s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "cons"})
+				expectOk(t, err)
+				_, err = s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "cons", Description: "changed"})
+				expectErr(t, err, jetstream.ErrConsumerExists)
+				_, err = s.UpdateConsumer(ctx, jetstream.ConsumerConfig{Durable: "other"})
+				expectErr(t, err, jetstream.ErrConsumerDoesNotExist)
+				expectOk(t, s.DeleteConsumer(ctx, "cons"))
+				expectErr(t, s.DeleteConsumer(ctx, "cons"), jetstream.ErrConsumerNotFound)
+			},
+		},
+		{
+			name: "key value",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TEST", History: 3})
+				expectOk(t, err)
+				_, err = kv.Put(ctx, "a", []byte("1"))
+				expectOk(t, err)
+				_, err = kv.Put(ctx, "b", []byte("1"))
+				expectOk(t, err)
+
+				w, err := kv.Watch(ctx, "a")
+				expectOk(t, err)
+				defer w.Stop()
+				expectEntry := func(revision uint64, op jetstream.KeyValueOp) {
+					t.Helper()
+					select {
+					case entry := <-w.Updates():
+						if revision == 0 {
+							if entry != nil {
+								t.Fatalf("Expected nil marker; got %v", entry)
+							}
+							return
+						}
+						if entry == nil || entry.Revision() != revision || entry.Operation() != op {
+							t.Fatalf("Unexpected entry: %+v", entry)
+						}
+					case <-time.After(time.Second):
+						t.Fatalf("Did not receive update")
+					}
+				}
+				expectEntry(1, jetstream.KeyValuePut)
+				expectEntry(0, 0)
+
+				_, err = kv.Create(ctx, "a", []byte("2"))
+				expectErr(t, err, jetstream.ErrKeyExists)
+				rev, err := kv.Update(ctx, "a", []byte("2"), 1)
+				expectOk(t, err)
+				if rev != 3 {
+					t.Fatalf("Expected revision 3; got %d", rev)
+				}
+				expectEntry(3, jetstream.KeyValuePut)
+				expectOk(t, kv.Delete(ctx, "a"))
+				expectEntry(4, jetstream.KeyValueDelete)
+				_, err = kv.Get(ctx, "a")
+				expectErr(t, err, jetstream.ErrKeyNotFound)
+				e, err := kv.GetRevision(ctx, "a", 3)
+				expectOk(t, err)
+				if string(e.Value()) != "2" {
+					t.Fatalf("Unexpected value: %q", e.Value())
+				}
+				keys, err := kv.Keys(ctx)
+				expectOk(t, err)
+				if len(keys) != 1 || keys[0] != "b" {
+					t.Fatalf("Unexpected keys: %v", keys)
+				}
+				status, err := kv.Status(ctx)
+				expectOk(t, err)
+				if status.Values() != 4 || status.History() != 3 {
+					t.Fatalf("Unexpected status: %d values, %d history", status.Values(), status.History())
+				}
+			},
+		},
+		{
+			name: "object store",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				obs, err := js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "OBJS"})
+				expectOk(t, err)
+				data := bytes.Repeat([]byte("abc"), 1000)
+				info, err := obs.Put(ctx, jetstream.ObjectMeta{Name: "blob", Opts: &jetstream.ObjectMetaOptions{ChunkSize: 512}}, bytes.NewReader(data))
+				expectOk(t, err)
+				if info.Chunks != 6 || info.Size != 3000 {
+					t.Fatalf("Unexpected object info: %+v", info)
+				}
+				res, err := obs.GetBytes(ctx, "blob")
+				expectOk(t, err)
+				if !bytes.Equal(res, data) {
+					t.Fatalf("Unexpected object data")
+				}
+				_, err = obs.AddLink(ctx, "link", info)
+				expectOk(t, err)
+				res, err = obs.GetBytes(ctx, "link")
+				expectOk(t, err)
+				if !bytes.Equal(res, data) {
+					t.Fatalf("Unexpected linked object data")
+				}
+				objs, err := obs.List(ctx)
+				expectOk(t, err)
+				if len(objs) != 2 {
+					t.Fatalf("Expected 2 objects; got %d", len(objs))
+				}
+				expectOk(t, obs.Delete(ctx, "blob"))
+				_, err = obs.GetInfo(ctx, "blob")
+				expectErr(t, err, jetstream.ErrObjectNotFound)
+			},
+		},
+		{
+			name: "watch stopped with context",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TEST"})
+				expectOk(t, err)
+				obs, err := js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "OBJS"})
+				expectOk(t, err)
+
+				watchCtx, cancel := context.WithCancel(ctx)
+				kw, err := kv.WatchAll(watchCtx)
+				expectOk(t, err)
+				ow, err := obs.Watch(watchCtx)
+				expectOk(t, err)
+				cancel()
+				for _, updates := range []func() bool{
+					func() bool { _, ok := <-kw.Updates(); return ok },
+					func() bool { _, ok := <-ow.Updates(); return ok },
+				} {
+					done := make(chan struct{})
+					go func() {
+						defer close(done)
+						for updates() {
+						}
+					}()
+					select {
+					case <-done:
+					case <-time.After(time.Second):
+						t.Fatalf("Expected updates channel to be closed")
+					}
+				}
+
+				w, err := kv.WatchAll(ctx)
+				expectOk(t, err)
+				expectOk(t, w.Stop())
+				expectErr(t, w.Stop(), nats.ErrBadSubscription)
+			},
+		},
+		{
+			name: "bucket status",
+			run: func(t *testing.T, js jetstream.JetStream) {
+				ctx := context.Background()
+				kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TEST", History: 2})
+				expectOk(t, err)
+				_, err = kv.Put(ctx, "a", []byte("1"))
+				expectOk(t, err)
+				kvStatus, err := kv.Status(ctx)
+				expectOk(t, err)
+				if _, ok := kvStatus.(*jetstream.KeyValueBucketStatus); !ok {
+					t.Fatalf("Unexpected status type: %T", kvStatus)
+				}
+				if kvStatus.Bucket() != "TEST" || kvStatus.Values() != 1 || kvStatus.History() != 2 {
+					t.Fatalf("Unexpected status: %s, %d values, %d history", kvStatus.Bucket(), kvStatus.Values(), kvStatus.History())
+				}
+				var listed int
+				for status := range js.KeyValueStores(ctx).Status() {
+					if status.Bucket() != "TEST" {
+						t.Fatalf("Unexpected bucket: %s", status.Bucket())
+					}
+					listed++
+				}
+				if listed != 1 {
+					t.Fatalf("Expected 1 bucket; got %d", listed)
+				}
+
+				obs, err := js.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "OBJS", Description: "objects"})
+				expectOk(t, err)
+				obsStatus, err := obs.Status(ctx)
+				expectOk(t, err)
+				if _, ok := obsStatus.(*jetstream.ObjectBucketStatus); !ok {
+					t.Fatalf("Unexpected status type: %T", obsStatus)
+				}
+				if obsStatus.Bucket() != "OBJS" || obsStatus.Description() != "objects" || obsStatus.Sealed() {
+					t.Fatalf("Unexpected status: %s, %q, sealed: %v", obsStatus.Bucket(), obsStatus.Description(), obsStatus.Sealed())
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runWithBackends(t, test.run)
+		})
+	}
+}
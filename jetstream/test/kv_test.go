@@ -14,6 +14,7 @@
 package test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -21,6 +22,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -682,6 +684,236 @@ func TestKeyValueWatchContextUpdates(t *testing.T) {
 	}
 }
 
+func TestKeyValueWatchConsumerDeleted(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "WATCHDEL"})
+	expectOk(t, err)
+
+	_, err = kv.Put(ctx, "name", []byte("derek"))
+	expectOk(t, err)
+
+	watcher, err := kv.WatchAll(ctx)
+	expectOk(t, err)
+	defer watcher.Stop()
+
+	expectUpdate := func(key, value string, revision uint64) {
+		t.Helper()
+		select {
+		case v := <-watcher.Updates():
+			if v == nil {
+				t.Fatalf("Expected update, got nil marker")
+			}
+			if v.Key() != key || string(v.Value()) != value || v.Revision() != revision {
+				t.Fatalf("Did not get expected: %q %q %d vs %q %q %d", v.Key(), string(v.Value()), v.Revision(), key, value, revision)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Did not receive an update like expected")
+		}
+	}
+	expectUpdate("name", "derek", 1)
+	select {
+	case v := <-watcher.Updates():
+		if v != nil {
+			t.Fatalf("Expected nil marker, got %+v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Did not receive nil marker like expected")
+	}
+
+	// Delete the consumer backing the watcher, it should be recreated
+	// without redelivering or skipping any entries.
+	stream, err := js.Stream(ctx, "KV_WATCHDEL")
+	expectOk(t, err)
+	names := stream.ConsumerNames(ctx)
+	for name := range names.Name() {
+		expectOk(t, stream.DeleteConsumer(ctx, name))
+	}
+	expectOk(t, names.Err())
+
+	_, err = kv.Put(ctx, "name", []byte("rip"))
+	expectOk(t, err)
+	expectUpdate("name", "rip", 2)
+
+	// Stopping the watcher closes the updates channel.
+	expectOk(t, watcher.Stop())
+	select {
+	case _, ok := <-watcher.Updates():
+		if ok {
+			t.Fatalf("Expected updates channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Updates channel was not closed")
+	}
+	if err := watcher.Stop(); !errors.Is(err, nats.ErrBadSubscription) {
+		t.Fatalf("Expected error: %v; got: %v", nats.ErrBadSubscription, err)
+	}
+}
+
+func TestTypedKeyValue(t *testing.T) {
+	type order struct {
+		ID  string
+		Qty int
+	}
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "ORDERS", History: 5})
+	expectOk(t, err)
+	orders, err := jetstream.NewTypedKeyValue[order](kv, jetstream.JSONCodec)
+	expectOk(t, err)
+
+	rev, err := orders.Put(ctx, "a", order{ID: "a", Qty: 1})
+	expectOk(t, err)
+	_, err = orders.Update(ctx, "a", order{ID: "a", Qty: 2}, rev)
+	expectOk(t, err)
+	_, err = orders.Update(ctx, "a", order{ID: "a", Qty: 3}, rev)
+	expectErr(t, err, jetstream.ErrKeyExists)
+	_, err = orders.Create(ctx, "a", order{ID: "a"})
+	expectErr(t, err, jetstream.ErrKeyExists)
+
+	entry, err := orders.Get(ctx, "a")
+	expectOk(t, err)
+	if entry.Value() != (order{ID: "a", Qty: 2}) || entry.Revision() != 2 || entry.Operation() != jetstream.KeyValuePut {
+		t.Fatalf("Invalid entry: %+v", entry)
+	}
+
+	// values which cannot be decoded are reported on the entry
+	_, err = kv.PutString(ctx, "b", "not json")
+	expectOk(t, err)
+	entry, err = orders.Get(ctx, "b")
+	expectErr(t, err, jetstream.ErrMsgDecode)
+	if entry == nil || entry.Revision() != 3 || string(entry.RawValue()) != "not json" {
+		t.Fatalf("Invalid entry: %+v", entry)
+	}
+
+	history, err := orders.History(ctx, "a")
+	expectOk(t, err)
+	if len(history) != 2 || history[0].Value().Qty != 1 || history[1].Value().Qty != 2 {
+		t.Fatalf("Invalid history: %+v", history)
+	}
+
+	watcher, err := orders.WatchAll(ctx)
+	expectOk(t, err)
+	defer watcher.Stop()
+	next := func() *jetstream.TypedKeyValueEntry[order] {
+		t.Helper()
+		select {
+		case e := <-watcher.Updates():
+			return e
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive an update like expected")
+		}
+		return nil
+	}
+	if e := next(); e.Key() != "a" || e.Value().Qty != 2 {
+		t.Fatalf("Invalid entry: %+v", e)
+	}
+	if e := next(); e.Key() != "b" || !errors.Is(e.Err(), jetstream.ErrMsgDecode) {
+		t.Fatalf("Expected decode error; got: %+v", e)
+	}
+	if e := next(); e != nil {
+		t.Fatalf("Expected nil marker; got: %+v", e)
+	}
+	expectOk(t, orders.Delete(ctx, "a"))
+	if e := next(); e.Key() != "a" || e.Operation() != jetstream.KeyValueDelete || e.Err() != nil {
+		t.Fatalf("Invalid delete entry: %+v", e)
+	}
+	_, err = orders.Put(ctx, "c", order{ID: "c", Qty: 5})
+	expectOk(t, err)
+	if e := next(); e.Key() != "c" || e.Value().Qty != 5 {
+		t.Fatalf("Invalid entry: %+v", e)
+	}
+}
+
+func TestTypedKeyValueRoundTrip(t *testing.T) {
+	runWithBackends(t, func(t *testing.T, js jetstream.JetStream) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "TYPED", History: 5})
+		expectOk(t, err)
+
+		t.Run("string", func(t *testing.T) {
+			strs, err := jetstream.NewTypedKeyValue[string](kv, jetstream.JSONCodec)
+			expectOk(t, err)
+			watcher, err := strs.Watch(ctx, "str", jetstream.UpdatesOnly())
+			expectOk(t, err)
+			defer watcher.Stop()
+
+			values := []string{"abc", `a"b`, `a\b`}
+			for _, v := range values {
+				_, err = strs.Put(ctx, "str", v)
+				expectOk(t, err)
+				select {
+				case e := <-watcher.Updates():
+					if e.Err() != nil || e.Value() != v {
+						t.Fatalf("Invalid watcher value; want: %q; got: %q (%v)", v, e.Value(), e.Err())
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("Did not receive an update like expected")
+				}
+			}
+			entry, err := strs.Get(ctx, "str")
+			expectOk(t, err)
+			if entry.Value() != values[len(values)-1] {
+				t.Fatalf("Invalid value; want: %q; got: %q", values[len(values)-1], entry.Value())
+			}
+			history, err := strs.History(ctx, "str")
+			expectOk(t, err)
+			if len(history) != len(values) {
+				t.Fatalf("Invalid history length: %d", len(history))
+			}
+			for i, e := range history {
+				if e.Value() != values[i] {
+					t.Fatalf("Invalid history value; want: %q; got: %q", values[i], e.Value())
+				}
+			}
+		})
+
+		t.Run("byte slice", func(t *testing.T) {
+			raw, err := jetstream.NewTypedKeyValue[[]byte](kv, jetstream.JSONCodec)
+			expectOk(t, err)
+			watcher, err := raw.Watch(ctx, "raw", jetstream.UpdatesOnly())
+			expectOk(t, err)
+			defer watcher.Stop()
+
+			v := []byte{0, 1, '"', 0xff}
+			_, err = raw.Put(ctx, "raw", v)
+			expectOk(t, err)
+			select {
+			case e := <-watcher.Updates():
+				if e.Err() != nil || !bytes.Equal(e.Value(), v) {
+					t.Fatalf("Invalid watcher value; want: %v; got: %v (%v)", v, e.Value(), e.Err())
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Did not receive an update like expected")
+			}
+			entry, err := raw.Get(ctx, "raw")
+			expectOk(t, err)
+			if !bytes.Equal(entry.Value(), v) {
+				t.Fatalf("Invalid value; want: %v; got: %v", v, entry.Value())
+			}
+			history, err := raw.History(ctx, "raw")
+			expectOk(t, err)
+			if len(history) != 1 || !bytes.Equal(history[0].Value(), v) {
+				t.Fatalf("Invalid history: %+v", history)
+			}
+		})
+	})
+}
+
 func TestKeyValueBindStore(t *testing.T) {
 	s := RunBasicJetStreamServer()
 	defer shutdownJSServerAndRemoveStorage(t, s)
@@ -1854,3 +2086,206 @@ func TestKeyValueCreateRepairOldKV(t *testing.T) {
 		t.Fatalf("Expected error to be ErrBucketExists, got: %v", err)
 	}
 }
+
+func TestKeyValueUpdateFunc(t *testing.T) {
+	s := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	nc, js := jsClient(t, s)
+	defer nc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "COUNTERS"})
+	expectOk(t, err)
+
+	t.Run("create missing key", func(t *testing.T) {
+		rev, err := kv.UpdateFunc(ctx, "a", func(entry jetstream.KeyValueEntry) ([]byte, error) {
+			if entry != nil {
+				t.Fatalf("Expected nil entry; got %+v", entry)
+			}
+			return []byte("value"), nil
+		})
+		expectOk(t, err)
+		if rev != 1 {
+			t.Fatalf("Expected revision 1; got %d", rev)
+		}
+	})
+
+	t.Run("update existing key", func(t *testing.T) {
+		rev, err := kv.UpdateFunc(ctx, "a", func(entry jetstream.KeyValueEntry) ([]byte, error) {
+			return append(entry.Value(), "-updated"...), nil
+		})
+		expectOk(t, err)
+		entry, err := kv.Get(ctx, "a")
+		expectOk(t, err)
+		if entry.Revision() != rev || string(entry.Value()) != "value-updated" {
+			t.Fatalf("Invalid entry: %d %q", entry.Revision(), entry.Value())
+		}
+	})
+
+	t.Run("deleted key", func(t *testing.T) {
+		expectOk(t, kv.Delete(ctx, "a"))
+		_, err := kv.UpdateFunc(ctx, "a", func(entry jetstream.KeyValueEntry) ([]byte, error) {
+			if entry != nil {
+				t.Fatalf("Expected nil entry; got %+v", entry)
+			}
+			return []byte("value"), nil
+		})
+		expectOk(t, err)
+	})
+
+	t.Run("error from fn", func(t *testing.T) {
+		errAbort := errors.New("abort")
+		_, err := kv.UpdateFunc(ctx, "a", func(entry jetstream.KeyValueEntry) ([]byte, error) {
+			return nil, errAbort
+		})
+		expectErr(t, err, errAbort)
+	})
+
+	t.Run("concurrent counter increments", func(t *testing.T) {
+		const workers, increments = 5, 20
+		errs := make(chan error, workers)
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < increments; j++ {
+					if _, err := jetstream.IncrementCounter(ctx, kv, "counter", 1); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		v, err := jetstream.GetCounter(ctx, kv, "counter")
+		expectOk(t, err)
+		if v != workers*increments {
+			t.Fatalf("Expected counter to be %d; got %d", workers*increments, v)
+		}
+
+		v, err = jetstream.IncrementCounter(ctx, kv, "counter", -10)
+		expectOk(t, err)
+		if v != workers*increments-10 {
+			t.Fatalf("Expected counter to be %d; got %d", workers*increments-10, v)
+		}
+	})
+
+	t.Run("invalid counter", func(t *testing.T) {
+		_, err := jetstream.IncrementCounter(ctx, kv, "a", 1)
+		expectErr(t, err, jetstream.ErrInvalidCounter)
+	})
+}
+
+func TestKeyValueCache(t *testing.T) {
+	t.Run("read your writes", func(t *testing.T) {
+		s := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, s)
+
+		nc, js := jsClient(t, s)
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "CONFIG"})
+		expectOk(t, err)
+		_, err = kv.PutString(ctx, "service.timeout", "5s")
+		expectOk(t, err)
+
+		changes := make(chan jetstream.KeyValueEntry, 10)
+		cache, err := kv.Cache(ctx, jetstream.CacheChangeHandler(func(entry jetstream.KeyValueEntry) {
+			changes <- entry
+		}))
+		expectOk(t, err)
+		defer cache.Stop()
+
+		entry, err := cache.Get("service.timeout")
+		expectOk(t, err)
+		if string(entry.Value()) != "5s" || entry.Revision() != 1 {
+			t.Fatalf("Invalid entry: %d %q", entry.Revision(), entry.Value())
+		}
+
+		rev, err := kv.PutString(ctx, "service.retries", "3")
+		expectOk(t, err)
+		expectOk(t, cache.WaitForRevision(ctx, rev))
+		entry, err = cache.Get("service.retries")
+		expectOk(t, err)
+		if string(entry.Value()) != "3" || entry.Revision() != rev {
+			t.Fatalf("Invalid entry: %d %q", entry.Revision(), entry.Value())
+		}
+		select {
+		case entry := <-changes:
+			if entry.Key() != "service.retries" {
+				t.Fatalf("Unexpected change: %s", entry.Key())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive change")
+		}
+
+		expectOk(t, kv.Purge(ctx, "service.timeout"))
+		expectOk(t, cache.WaitForRevision(ctx, rev+1))
+		_, err = cache.Get("service.timeout")
+		expectErr(t, err, jetstream.ErrKeyNotFound)
+		if keys := cache.Keys(); !reflect.DeepEqual(keys, []string{"service.retries"}) {
+			t.Fatalf("Unexpected keys: %v", keys)
+		}
+
+		expectOk(t, cache.Stop())
+		if !cache.Stale() {
+			t.Fatalf("Expected cache to be stale after stop")
+		}
+		err = cache.WaitForRevision(ctx, rev+10)
+		expectErr(t, err, jetstream.ErrKeyValueCacheStopped)
+	})
+
+	t.Run("stale on disconnect", func(t *testing.T) {
+		srv := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+
+		nc, js := jsClient(t, srv, nats.ReconnectWait(50*time.Millisecond))
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "CONFIG", Storage: jetstream.FileStorage})
+		expectOk(t, err)
+
+		staleChanges := make(chan bool, 10)
+		cache, err := kv.Cache(ctx, jetstream.CacheStaleHandler(func(stale bool) {
+			staleChanges <- stale
+		}))
+		expectOk(t, err)
+		defer cache.Stop()
+
+		expectStale := func(expected bool) {
+			t.Helper()
+			select {
+			case stale := <-staleChanges:
+				if stale != expected {
+					t.Fatalf("Expected stale to be %v", expected)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Did not receive stale change")
+			}
+		}
+
+		srv = restartBasicJSServer(t, srv)
+		defer shutdownJSServerAndRemoveStorage(t, srv)
+		expectStale(true)
+		expectStale(false)
+
+		// cache receives updates after reconnect
+		var rev uint64
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			rev, err = kv.PutString(ctx, "key", "value")
+			return err
+		})
+		expectOk(t, cache.WaitForRevision(ctx, rev))
+	})
+}
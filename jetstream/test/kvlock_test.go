@@ -0,0 +1,98 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/jetstream/kvlock"
+)
+
+func TestKVLock(t *testing.T) {
+	t.Run("acquire and release", func(t *testing.T) {
+		s := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, s)
+
+		nc, js := jsClient(t, s)
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "LOCKS", TTL: time.Second})
+		expectOk(t, err)
+
+		l, err := kvlock.Acquire(ctx, kv, "job", time.Second)
+		expectOk(t, err)
+		_, err = kvlock.TryAcquire(ctx, kv, "job", time.Second)
+		expectErr(t, err, kvlock.ErrLocked)
+
+		// lease is kept past the bucket TTL
+		time.Sleep(1500 * time.Millisecond)
+		_, err = kvlock.TryAcquire(ctx, kv, "job", time.Second)
+		expectErr(t, err, kvlock.ErrLocked)
+		expectOk(t, l.Err())
+
+		acquired := make(chan *kvlock.Lease)
+		go func() {
+			l, err := kvlock.Acquire(ctx, kv, "job", time.Second)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				close(acquired)
+				return
+			}
+			acquired <- l
+		}()
+		expectOk(t, l.Release(ctx))
+		select {
+		case l2 := <-acquired:
+			if l2 == nil {
+				t.FailNow()
+			}
+			if l2.Token() <= l.Token() {
+				t.Fatalf("Expected fencing token to increase; got %d after %d", l2.Token(), l.Token())
+			}
+			expectOk(t, l2.Release(ctx))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Lock was not acquired after release")
+		}
+	})
+
+	t.Run("lease lost", func(t *testing.T) {
+		s := RunBasicJetStreamServer()
+		defer shutdownJSServerAndRemoveStorage(t, s)
+
+		nc, js := jsClient(t, s)
+		defer nc.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "LOCKS", TTL: time.Minute})
+		expectOk(t, err)
+
+		l, err := kvlock.TryAcquire(ctx, kv, "job", time.Minute)
+		expectOk(t, err)
+		_, err = kv.PutString(ctx, "job", "other")
+		expectOk(t, err)
+		select {
+		case <-l.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Lease was not lost")
+		}
+		expectErr(t, l.Err(), kvlock.ErrLeaseLost)
+		expectErr(t, l.Release(ctx), kvlock.ErrLeaseLost)
+	})
+}
@@ -0,0 +1,454 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestConsumeMiddleware(t *testing.T) {
+	setup := func(t *testing.T, cfg jetstream.ConsumerConfig) (jetstream.JetStream, jetstream.Consumer, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.A", []byte("hello")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, c, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("recover terminates message", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+			AckWait:   time.Second,
+		})
+		defer cleanup()
+
+		recovered := make(chan any, 1)
+		deliveries := make(chan struct{}, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			deliveries <- struct{}{}
+			panic("boom")
+		}, jetstream.WithConsumeMiddleware(jetstream.RecoverMiddleware(func(msg jetstream.Msg, r any) {
+			recovered <- r
+		})))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case r := <-recovered:
+			if r != "boom" {
+				t.Fatalf("Invalid recovered value; want: %v; got: %v", "boom", r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for panic")
+		}
+		// terminated message should not be redelivered
+		time.Sleep(1500 * time.Millisecond)
+		if len(deliveries) != 1 {
+			t.Fatalf("Expected single delivery; got: %d", len(deliveries))
+		}
+	})
+
+	t.Run("nak with backoff", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		defer cleanup()
+
+		var (
+			mu    sync.Mutex
+			times []time.Time
+		)
+		done := make(chan struct{})
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			mu.Lock()
+			defer mu.Unlock()
+			times = append(times, time.Now())
+			if len(times) == 3 {
+				msg.Ack()
+				close(done)
+			}
+		}, jetstream.WithConsumeMiddleware(jetstream.NakBackoffMiddleware(100*time.Millisecond, time.Second)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for redeliveries")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if d := times[1].Sub(times[0]); d < 100*time.Millisecond {
+			t.Fatalf("Expected redelivery after at least %s; got: %s", 100*time.Millisecond, d)
+		}
+		if d := times[2].Sub(times[1]); d < 200*time.Millisecond {
+			t.Fatalf("Expected redelivery after at least %s; got: %s", 200*time.Millisecond, d)
+		}
+	})
+
+	t.Run("deadline rejects late acks", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		defer cleanup()
+
+		errs := make(chan error, 1)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			ctx := jetstream.MsgContext(msg)
+			if _, ok := ctx.Deadline(); !ok {
+				errs <- errors.New("expected deadline on message context")
+				return
+			}
+			<-ctx.Done()
+			errs <- msg.Ack()
+		}, jetstream.WithConsumeMiddleware(jetstream.DeadlineMiddleware(100*time.Millisecond)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, jetstream.ErrAckWaitExceeded) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrAckWaitExceeded, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for handler")
+		}
+	})
+
+	t.Run("structured logging", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		defer cleanup()
+
+		var (
+			mu  sync.Mutex
+			buf bytes.Buffer
+		)
+		logger := slog.New(slog.NewJSONHandler(&lockedWriter{mu: &mu, w: &buf}, nil))
+		handled := make(chan struct{})
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			msg.Ack()
+			close(handled)
+		}, jetstream.WithConsumeMiddleware(jetstream.LoggingMiddleware(logger)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for handler")
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if entry["subject"] != "FOO.A" || entry["stream"] != "foo" || entry["consumer"] != "cons" || entry["acked"] != true {
+			t.Fatalf("Invalid log entry: %v", entry)
+		}
+	})
+
+	t.Run("middleware on messages", func(t *testing.T) {
+		_, c, cleanup := setup(t, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		defer cleanup()
+
+		var (
+			mu  sync.Mutex
+			buf bytes.Buffer
+		)
+		logger := slog.New(slog.NewJSONHandler(&lockedWriter{mu: &mu, w: &buf}, nil))
+		msgs, err := c.Messages(jetstream.WithConsumeMiddleware(
+			jetstream.LoggingMiddleware(logger),
+			jetstream.NakBackoffMiddleware(100*time.Millisecond, time.Second),
+			jetstream.DeadlineMiddleware(time.Minute),
+		))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer msgs.Stop()
+
+		msg, err := msgs.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, ok := jetstream.MsgContext(msg).Deadline(); !ok {
+			t.Fatalf("Expected deadline on message context")
+		}
+
+		// the message is not acknowledged, so it is naked with backoff once
+		// the next message is requested
+		start := time.Now()
+		msg, err = msgs.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if d := time.Since(start); d < 100*time.Millisecond {
+			t.Fatalf("Expected redelivery after at least %s; got: %s", 100*time.Millisecond, d)
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if meta.NumDelivered != 2 {
+			t.Fatalf("Expected redelivered message; got: %d deliveries", meta.NumDelivered)
+		}
+		if err := msg.Ack(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msgs.Stop()
+
+		mu.Lock()
+		defer mu.Unlock()
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 log entries; got: %d", len(lines))
+		}
+		for i, line := range lines {
+			var entry map[string]any
+			if err := json.Unmarshal(line, &entry); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if entry["subject"] != "FOO.A" || entry["num_delivered"] != float64(i+1) {
+				t.Fatalf("Invalid log entry: %v", entry)
+			}
+		}
+	})
+
+	t.Run("middleware on ordered consumer messages", func(t *testing.T) {
+		js, _, cleanup := setup(t, jetstream.ConsumerConfig{Durable: "cons"})
+		defer cleanup()
+
+		c, err := js.OrderedConsumer(context.Background(), "foo", jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		wrapped := make(chan string, 1)
+		msgs, err := c.Messages(jetstream.WithConsumeMiddleware(func(next jetstream.MessageHandler) jetstream.MessageHandler {
+			return func(msg jetstream.Msg) {
+				wrapped <- string(msg.Data())
+				next(msg)
+			}
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer msgs.Stop()
+
+		msg, err := msgs.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(msg.Data()) != "hello" {
+			t.Fatalf("Invalid message data; want: %s; got: %s", "hello", msg.Data())
+		}
+		select {
+		case data := <-wrapped:
+			if data != "hello" {
+				t.Fatalf("Invalid message data; want: %s; got: %s", "hello", data)
+			}
+		default:
+			t.Fatalf("Expected middleware to be called")
+		}
+	})
+
+	t.Run("middleware on ordered consumer", func(t *testing.T) {
+		js, _, cleanup := setup(t, jetstream.ConsumerConfig{Durable: "cons"})
+		defer cleanup()
+
+		c, err := js.OrderedConsumer(context.Background(), "foo", jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		wrapped := make(chan string, 1)
+		cc, err := c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeMiddleware(func(next jetstream.MessageHandler) jetstream.MessageHandler {
+			return func(msg jetstream.Msg) {
+				wrapped <- string(msg.Data())
+				next(msg)
+			}
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case data := <-wrapped:
+			if data != "hello" {
+				t.Fatalf("Invalid message data; want: %s; got: %s", "hello", data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for handler")
+		}
+	})
+}
+
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  *bytes.Buffer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+func TestConsumeAutoInProgress(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.Consumer, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:      "foo",
+			Subjects:  []string{"FOO.*"},
+			Retention: jetstream.WorkQueuePolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+			AckWait:   time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.A", []byte("hello")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return c, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("long running handler is not redelivered", func(t *testing.T) {
+		c, cleanup := setup(t)
+		defer cleanup()
+
+		deliveries := make(chan uint64, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, _ := msg.Metadata()
+			deliveries <- meta.NumDelivered
+			time.Sleep(2500 * time.Millisecond)
+			msg.Ack()
+		}, jetstream.WithAutoInProgress(300*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		time.Sleep(3 * time.Second)
+		if len(deliveries) != 1 {
+			t.Fatalf("Expected single delivery; got: %d", len(deliveries))
+		}
+	})
+
+	t.Run("stop extending after max extension", func(t *testing.T) {
+		c, cleanup := setup(t)
+		defer cleanup()
+
+		deliveries := make(chan uint64, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			meta, _ := msg.Metadata()
+			deliveries <- meta.NumDelivered
+			if meta.NumDelivered == 1 {
+				time.Sleep(2500 * time.Millisecond)
+			}
+			msg.Ack()
+		}, jetstream.WithAutoInProgress(300*time.Millisecond),
+			jetstream.WithAutoInProgressMaxExtension(500*time.Millisecond),
+			jetstream.WithConsumeWorkers(2, func(msg jetstream.Msg) string {
+				meta, _ := msg.Metadata()
+				return strconv.FormatUint(meta.NumDelivered, 10)
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		time.Sleep(3 * time.Second)
+		if len(deliveries) < 2 {
+			t.Fatalf("Expected message to be redelivered; got: %d deliveries", len(deliveries))
+		}
+	})
+
+	t.Run("interval greater than ack wait", func(t *testing.T) {
+		c, cleanup := setup(t)
+		defer cleanup()
+
+		_, err := c.Consume(func(msg jetstream.Msg) {}, jetstream.WithAutoInProgress(2*time.Second))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
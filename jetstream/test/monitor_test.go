@@ -0,0 +1,250 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestMonitor(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.JetStream, jetstream.Consumer, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:       "cons",
+			AckPolicy:     jetstream.AckExplicitPolicy,
+			MaxAckPending: 10,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := js.Publish(ctx, "FOO.A", []byte("msg")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		return js, c, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	expectAlert := func(t *testing.T, m jetstream.Monitor, alertType jetstream.MonitorAlertType, resolved bool) jetstream.MonitorAlert {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case alert := <-m.Alerts():
+				if alert.Type == alertType && alert.Resolved == resolved {
+					return alert
+				}
+			case <-timeout:
+				t.Fatalf("Timeout waiting for %q alert (resolved: %v)", alertType, resolved)
+			}
+		}
+	}
+
+	t.Run("pending and ack pending alerts", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		m, err := jetstream.NewMonitor(js, jetstream.MonitorConfig{
+			Streams:   []string{"foo"},
+			Consumers: []jetstream.MonitorConsumer{{Stream: "foo", Consumer: "cons"}},
+			Interval:  100 * time.Millisecond,
+			Rules: jetstream.MonitorRules{
+				MaxPending:      5,
+				AckPendingRatio: 0.8,
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer m.Stop()
+
+		alert := expectAlert(t, m, jetstream.MonitorAlertPending, false)
+		if alert.Stream != "foo" || alert.Consumer != "cons" || alert.Value != 10 || alert.Threshold != 5 {
+			t.Fatalf("Invalid alert: %+v", alert)
+		}
+
+		// fetch without acking, moving messages from pending to ack pending
+		msgs, err := c.Fetch(10, jetstream.FetchMaxWait(time.Second))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var fetched []jetstream.Msg
+		for msg := range msgs.Messages() {
+			fetched = append(fetched, msg)
+		}
+		expectAlert(t, m, jetstream.MonitorAlertPending, true)
+		alert = expectAlert(t, m, jetstream.MonitorAlertAckPending, false)
+		if alert.Value != 10 || alert.Threshold != 8 {
+			t.Fatalf("Invalid alert: %+v", alert)
+		}
+
+		snapshot := m.Snapshot()
+		if len(snapshot.Alerts) != 1 || snapshot.Alerts[0].Type != jetstream.MonitorAlertAckPending {
+			t.Fatalf("Invalid active alerts: %+v", snapshot.Alerts)
+		}
+		if info := snapshot.Consumers[jetstream.MonitorConsumer{Stream: "foo", Consumer: "cons"}]; info == nil || info.NumAckPending != 10 {
+			t.Fatalf("Invalid consumer info in snapshot: %+v", info)
+		}
+		if info := snapshot.Streams["foo"]; info == nil || info.State.Msgs != 10 {
+			t.Fatalf("Invalid stream info in snapshot: %+v", info)
+		}
+
+		for _, msg := range fetched {
+			if err := msg.DoubleAck(context.Background()); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		expectAlert(t, m, jetstream.MonitorAlertAckPending, true)
+		if alerts := m.Snapshot().Alerts; len(alerts) != 0 {
+			t.Fatalf("Expected no active alerts; got: %+v", alerts)
+		}
+	})
+
+	t.Run("push consumer", func(t *testing.T) {
+		js, _, cleanup := setup(t)
+		defer cleanup()
+
+		// no subscription on the deliver subject, so all messages stay pending
+		if _, err := js.CreateOrUpdatePushConsumer(context.Background(), "foo", jetstream.ConsumerConfig{
+			Durable:        "push",
+			DeliverSubject: "deliver.push",
+			AckPolicy:      jetstream.AckExplicitPolicy,
+		}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		m, err := jetstream.NewMonitor(js, jetstream.MonitorConfig{
+			Consumers: []jetstream.MonitorConsumer{{Stream: "foo", Consumer: "push"}},
+			Interval:  100 * time.Millisecond,
+			Rules:     jetstream.MonitorRules{MaxPending: 5},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer m.Stop()
+
+		alert := expectAlert(t, m, jetstream.MonitorAlertPending, false)
+		if alert.Consumer != "push" || alert.Value != 10 {
+			t.Fatalf("Invalid alert: %+v", alert)
+		}
+		for _, alert := range m.Snapshot().Alerts {
+			if alert.Type == jetstream.MonitorAlertUnavailable {
+				t.Fatalf("Unexpected alert: %+v", alert)
+			}
+		}
+	})
+
+	t.Run("redelivered alert", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		m, err := jetstream.NewMonitor(js, jetstream.MonitorConfig{
+			Consumers: []jetstream.MonitorConsumer{{Stream: "foo", Consumer: "cons"}},
+			Interval:  100 * time.Millisecond,
+			Rules:     jetstream.MonitorRules{MaxRedelivered: 2},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer m.Stop()
+
+		// wait for the first poll, as the increase is measured between polls
+		time.Sleep(200 * time.Millisecond)
+		for i := 0; i < 2; i++ {
+			msgs, err := c.Fetch(10, jetstream.FetchMaxWait(time.Second))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for msg := range msgs.Messages() {
+				msg.Nak()
+			}
+		}
+		alert := expectAlert(t, m, jetstream.MonitorAlertRedelivered, false)
+		if alert.Value <= 2 {
+			t.Fatalf("Invalid alert: %+v", alert)
+		}
+		expectAlert(t, m, jetstream.MonitorAlertRedelivered, true)
+	})
+
+	t.Run("consumer unavailable", func(t *testing.T) {
+		js, _, cleanup := setup(t)
+		defer cleanup()
+
+		m, err := jetstream.NewMonitor(js, jetstream.MonitorConfig{
+			Consumers: []jetstream.MonitorConsumer{{Stream: "foo", Consumer: "cons"}},
+			Interval:  100 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := js.DeleteConsumer(context.Background(), "foo", "cons"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		alert := expectAlert(t, m, jetstream.MonitorAlertUnavailable, false)
+		if !errors.Is(alert.Err, jetstream.ErrConsumerNotFound) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrConsumerNotFound, alert.Err)
+		}
+
+		if err := m.Stop(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case _, ok := <-m.Alerts():
+			if ok {
+				t.Fatalf("Expected alerts channel to be closed")
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for alerts channel to be closed")
+		}
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		js, _, cleanup := setup(t)
+		defer cleanup()
+
+		tests := []jetstream.MonitorConfig{
+			{},
+			{Streams: []string{"foo"}, Interval: -1},
+			{Streams: []string{"foo"}, Rules: jetstream.MonitorRules{AckPendingRatio: 2}},
+			{Consumers: []jetstream.MonitorConsumer{{Stream: "foo"}}},
+		}
+		for _, cfg := range tests {
+			if _, err := jetstream.NewMonitor(js, cfg); err == nil {
+				t.Fatalf("Expected error for config: %+v", cfg)
+			}
+		}
+	})
+}
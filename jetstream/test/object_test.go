@@ -1268,3 +1268,68 @@ func TestObjectStoreMirror(t *testing.T) {
 		}
 	}
 }
+
+func TestObjectStoreCrossAccounts(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		listen: 127.0.0.1:-1
+		jetstream: enabled
+		accounts: {
+			A: {
+				users: [ {user: a, password: a} ]
+				jetstream: enabled
+				exports: [
+					{service: '$JS.API.>' }
+					{stream: 'accI.>'}
+				]
+			},
+			I: {
+				users: [ {user: i, password: i} ]
+				imports: [
+					{service: {account: A, subject: '$JS.API.>'}, to: 'fromA.>' }
+					{stream: {subject: 'accI.>', account: A}}
+				]
+			}
+		}`))
+	defer os.Remove(conf)
+	s, _ := RunServerWithConfig(conf)
+	defer shutdownJSServerAndRemoveStorage(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nc1, js1 := jsClient(t, s, nats.UserInfo("a", "a"))
+	defer nc1.Close()
+	obs1, err := js1.CreateObjectStore(ctx, jetstream.ObjectStoreConfig{Bucket: "OBJS"})
+	expectOk(t, err)
+
+	nc2, err := nats.Connect(s.ClientURL(), nats.UserInfo("i", "i"), nats.CustomInboxPrefix("accI"))
+	expectOk(t, err)
+	defer nc2.Close()
+	js2, err := jetstream.NewWithAPIPrefix(nc2, "fromA")
+	expectOk(t, err)
+	obs2, err := js2.ObjectStore(ctx, "OBJS")
+	expectOk(t, err)
+
+	watcher, err := obs2.Watch(ctx, jetstream.UpdatesOnly())
+	expectOk(t, err)
+	defer watcher.Stop()
+
+	// several chunks are delivered to the importing account
+	data := bytes.Repeat([]byte("abc"), 100)
+	_, err = obs1.Put(ctx, jetstream.ObjectMeta{Name: "A", Opts: &jetstream.ObjectMetaOptions{ChunkSize: 32}}, bytes.NewReader(data))
+	expectOk(t, err)
+
+	select {
+	case info := <-watcher.Updates():
+		if info == nil || info.Name != "A" {
+			t.Fatalf("Unexpected update: %+v", info)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected to receive an update")
+	}
+	res, err := obs2.GetBytes(ctx, "A")
+	expectOk(t, err)
+	if !bytes.Equal(res, data) {
+		t.Fatalf("Invalid object data; want: %q; got: %q", data, res)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestOutbox(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.JetStream, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	waitForPending := func(t *testing.T, ob jetstream.Outbox) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if ob.Pending() == 0 {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("Timeout waiting for pending messages; got: %d", ob.Pending())
+	}
+
+	t.Run("publish and truncate log", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "outbox.log")
+		ob, err := jetstream.NewOutbox(js, jetstream.OutboxConfig{Path: path})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer ob.Close()
+
+		futures := make([]jetstream.PubAckFuture, 0, 10)
+		for i := 0; i < 10; i++ {
+			paf, err := ob.Publish(fmt.Sprintf("FOO.%d", i), []byte("hello"))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			futures = append(futures, paf)
+		}
+		for i, paf := range futures {
+			select {
+			case ack := <-paf.Ok():
+				if ack.Sequence != uint64(i+1) {
+					t.Fatalf("Invalid sequence; want: %d; got: %d", i+1, ack.Sequence)
+				}
+			case err := <-paf.Err():
+				t.Fatalf("Unexpected error: %v", err)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for ack")
+			}
+		}
+		waitForPending(t, ob)
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fi.Size() != 0 {
+			t.Fatalf("Expected log to be truncated; got size: %d", fi.Size())
+		}
+		msg, err := s.GetMsg(ctx, 1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if msg.Header.Get(jetstream.MsgIDHeader) == "" {
+			t.Fatalf("Expected message ID to be set")
+		}
+	})
+
+	t.Run("replay pending messages on startup", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		path := filepath.Join(t.TempDir(), "outbox.log")
+		ob, err := jetstream.NewOutbox(js, jetstream.OutboxConfig{Path: path, RetryWait: 100 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// stream does not exist yet, so messages are not acknowledged
+		for i := 0; i < 5; i++ {
+			if _, err := ob.Publish("FOO.A", []byte("hello"), jetstream.WithMsgID(fmt.Sprintf("id-%d", i))); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if pending := ob.Pending(); pending != 5 {
+			t.Fatalf("Invalid number of pending messages; want: %d; got: %d", 5, pending)
+		}
+		if err := ob.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := ob.Publish("FOO.A", []byte("hello")); !errors.Is(err, jetstream.ErrOutboxClosed) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrOutboxClosed, err)
+		}
+
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		// publish one of the messages, replayed message should be discarded
+		if _, err := js.Publish(ctx, "FOO.A", []byte("hello"), jetstream.WithMsgID("id-0")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		ob, err = jetstream.NewOutbox(js, jetstream.OutboxConfig{Path: path})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer ob.Close()
+		waitForPending(t, ob)
+
+		info, err := s.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.State.Msgs != 5 {
+			t.Fatalf("Invalid number of messages in stream; want: %d; got: %d", 5, info.State.Msgs)
+		}
+	})
+
+	t.Run("rejected message", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+		if _, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		errs := make(chan error, 1)
+		ob, err := jetstream.NewOutbox(js, jetstream.OutboxConfig{
+			Path: filepath.Join(t.TempDir(), "outbox.log"),
+			ErrHandler: func(msg *nats.Msg, err error) {
+				errs <- err
+			},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer ob.Close()
+
+		paf, err := ob.Publish("FOO.A", []byte("hello"), jetstream.WithExpectLastSequence(10))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case err := <-paf.Err():
+			var apiErr *jetstream.APIError
+			if !errors.As(err, &apiErr) || apiErr.ErrorCode != jetstream.JSErrCodeStreamWrongLastSequence {
+				t.Fatalf("Expected wrong last sequence error; got: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for error")
+		}
+		select {
+		case <-errs:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for error handler")
+		}
+		if pending := ob.Pending(); pending != 0 {
+			t.Fatalf("Expected rejected message to be removed; got: %d pending", pending)
+		}
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		js, cleanup := setup(t)
+		defer cleanup()
+
+		if _, err := jetstream.NewOutbox(js, jetstream.OutboxConfig{}); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
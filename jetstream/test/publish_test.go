@@ -1552,3 +1552,363 @@ func TestPublishAsyncRetryInErrHandler(t *testing.T) {
 		t.Fatalf("Expected 10 messages in the stream; got: %d", info.State.Msgs)
 	}
 }
+
+func TestPublishAsyncTimeout(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	errs := make(chan error, 10)
+	js, err := jetstream.New(nc,
+		jetstream.WithPublishAsyncTimeout(100*time.Millisecond),
+		jetstream.WithPublishAsyncErrHandler(func(js jetstream.JetStream, msg *nats.Msg, err error) {
+			errs <- err
+		}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:     "foo",
+		Subjects: []string{"FOO.*"},
+		// disable stream acks
+		NoAck: true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	paf, err := js.PublishAsync("FOO.1", []byte("msg"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case err := <-paf.Err():
+		if !errors.Is(err, jetstream.ErrAsyncPublishTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrAsyncPublishTimeout, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for async publish timeout")
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, jetstream.ErrAsyncPublishTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrAsyncPublishTimeout, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout waiting for error handler")
+	}
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive completion signal")
+	}
+	if pending := js.PublishAsyncPending(); pending != 0 {
+		t.Fatalf("Expected no pending messages; got: %d", pending)
+	}
+
+	if _, err := jetstream.New(nc, jetstream.WithPublishAsyncTimeout(0)); !errors.Is(err, jetstream.ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+	}
+}
+
+func TestPublishAsyncTimeoutStalled(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc,
+		jetstream.WithPublishAsyncTimeout(100*time.Millisecond),
+		jetstream.WithPublishAsyncMaxPending(2))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "bar", Subjects: []string{"BAR.*"}, NoAck: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// the first publishes are never acked, so the next one stalls until
+	// they time out
+	for i := 0; i < 2; i++ {
+		if _, err := js.PublishAsync("BAR.1", []byte("msg")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	paf, err := js.PublishAsync("FOO.1", []byte("msg"), jetstream.WithStallWait(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	select {
+	case <-paf.Ok():
+	case err := <-paf.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive ack")
+	}
+}
+
+func TestPublishAsyncAckHandler(t *testing.T) {
+	type result struct {
+		ack *jetstream.PubAck
+		err error
+	}
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "bar", Subjects: []string{"BAR.*"}, NoAck: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	results := make(chan result, 10)
+	handler := jetstream.WithAckHandler(func(ack *jetstream.PubAck, err error) {
+		results <- result{ack, err}
+	})
+	nextResult := func(t *testing.T) result {
+		t.Helper()
+		select {
+		case res := <-results:
+			return res
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for ack handler")
+		}
+		return result{}
+	}
+
+	if _, err := js.PublishAsync("FOO.1", []byte("msg"), handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res := nextResult(t)
+	if res.err != nil || res.ack == nil || res.ack.Stream != "foo" || res.ack.Sequence != 1 {
+		t.Fatalf("Invalid result: %+v", res)
+	}
+
+	if _, err := js.PublishAsync("FOO.1", []byte("msg"), handler, jetstream.WithExpectLastSequence(10)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res = nextResult(t)
+	var apiErr *jetstream.APIError
+	if res.ack != nil || !errors.As(res.err, &apiErr) || apiErr.ErrorCode != jetstream.JSErrCodeStreamWrongLastSequence {
+		t.Fatalf("Expected wrong last sequence error; got: %+v", res)
+	}
+
+	if _, err := js.PublishAsync("BAR.1", []byte("msg"), handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	res = nextResult(t)
+	if !errors.Is(res.err, jetstream.ErrAsyncPublishTimeout) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrAsyncPublishTimeout, res.err)
+	}
+
+	if _, err := js.Publish(ctx, "FOO.1", []byte("msg"), handler); !errors.Is(err, jetstream.ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+	}
+}
+
+func TestPublishAsyncAckHandlerReconnect(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer func() { shutdownJSServerAndRemoveStorage(t, srv) }()
+	nc, err := nats.Connect(srv.ClientURL(), nats.ReconnectWait(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// acks are never received on a NoAck stream, so publishes stay pending
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "bar", Subjects: []string{"BAR.*"}, NoAck: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	errs := make(chan error, 10)
+	handler := jetstream.WithAckHandler(func(_ *jetstream.PubAck, err error) {
+		errs <- err
+	})
+	expectDisconnected := func(t *testing.T, count int) {
+		t.Helper()
+		for i := 0; i < count; i++ {
+			select {
+			case err := <-errs:
+				if !errors.Is(err, nats.ErrDisconnected) {
+					t.Fatalf("Expected error: %v; got: %v", nats.ErrDisconnected, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for ack handler")
+			}
+		}
+	}
+
+	// handlers are invoked on each reconnect, not only when the connection
+	// is closed
+	for _, count := range []int{2, 1} {
+		for i := 0; i < count; i++ {
+			if _, err := js.PublishAsync("BAR.1", []byte("msg"), handler); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		srv = restartBasicJSServer(t, srv)
+		expectDisconnected(t, count)
+		checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+			if !nc.IsConnected() {
+				return errors.New("not reconnected")
+			}
+			return nil
+		})
+	}
+}
+
+func TestPublishAsyncAdaptive(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncAdaptive(jetstream.PublishAsyncAdaptiveConfig{
+		MinPending: 8,
+		MaxPending: 256,
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stats := js.PublishAsyncStats()
+	if !stats.Adaptive || stats.MaxPending != 8 {
+		t.Fatalf("Invalid initial stats: %+v", stats)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, err := js.PublishAsync("FOO.1", []byte("msg"), jetstream.WithStallWait(5*time.Second)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stats := js.PublishAsyncStats(); stats.Pending > 256 {
+			t.Fatalf("Pending messages exceeded max pending: %+v", stats)
+		}
+	}
+	select {
+	case <-js.PublishAsyncComplete():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive completion signal")
+	}
+
+	stats = js.PublishAsyncStats()
+	if stats.Acks != 1000 || stats.Errors != 0 || stats.Pending != 0 {
+		t.Fatalf("Invalid stats: %+v", stats)
+	}
+	if stats.MaxPending < 8 || stats.MaxPending > 256 {
+		t.Fatalf("Window out of bounds: %d", stats.MaxPending)
+	}
+	if stats.Latency <= 0 || stats.MinLatency <= 0 {
+		t.Fatalf("Expected latency to be measured: %+v", stats)
+	}
+
+	_, err = jetstream.New(nc, jetstream.WithPublishAsyncAdaptive(jetstream.PublishAsyncAdaptiveConfig{
+		MinPending: 100,
+		MaxPending: 10,
+	}))
+	if !errors.Is(err, jetstream.ErrInvalidOption) {
+		t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+	}
+}
+
+func TestPublishAsyncAdaptiveStalled(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc, jetstream.WithPublishAsyncAdaptive(jetstream.PublishAsyncAdaptiveConfig{
+		MinPending:     1,
+		InitialPending: 2,
+		MaxPending:     4,
+		TargetLatency:  100 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Fill the window with publishes which are rejected after a delay, so
+	// that the next publish stalls without affecting the measured latency.
+	_, err = nc.Subscribe("SLOW.*", func(msg *nats.Msg) {
+		time.AfterFunc(300*time.Millisecond, func() {
+			msg.Respond([]byte(`{"error":{"code":400,"err_code":10999,"description":"rejected"}}`))
+		})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := js.PublishAsync("SLOW.1", []byte("msg")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	start := time.Now()
+	ack, err := js.PublishAsync("FOO.1", []byte("msg"), jetstream.WithStallWait(5*time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stalled := time.Since(start); stalled < 200*time.Millisecond {
+		t.Fatalf("Expected publish to stall; got: %v", stalled)
+	}
+	select {
+	case <-ack.Ok():
+	case err := <-ack.Err():
+		t.Fatalf("Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Did not receive ack")
+	}
+
+	stats := js.PublishAsyncStats()
+	if stats.Latency >= 100*time.Millisecond {
+		t.Fatalf("Expected stall time to be excluded from latency; got: %v", stats.Latency)
+	}
+	if stats.MaxPending < 2 {
+		t.Fatalf("Expected window not to shrink; got: %d", stats.MaxPending)
+	}
+}
@@ -18,7 +18,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -3134,6 +3136,379 @@ func TestPullConsumerConsume(t *testing.T) {
 	})
 }
 
+func TestPullConsumerConsumeWithWorkers(t *testing.T) {
+	setup := func(t *testing.T, cfg jetstream.ConsumerConfig) (jetstream.JetStream, jetstream.Consumer, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, cfg)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, c, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("messages with the same key are ordered", func(t *testing.T) {
+		js, c, cleanup := setup(t, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		defer cleanup()
+
+		var (
+			mu                sync.Mutex
+			received          = make(map[string][]int)
+			active, maxActive atomic.Int32
+			wg                sync.WaitGroup
+		)
+		wg.Add(100)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			defer wg.Done()
+			current := active.Add(1)
+			defer active.Add(-1)
+			for {
+				max := maxActive.Load()
+				if current <= max || maxActive.CompareAndSwap(max, current) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			i, err := strconv.Atoi(string(msg.Data()))
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			mu.Lock()
+			received[msg.Subject()] = append(received[msg.Subject()], i)
+			mu.Unlock()
+			msg.Ack()
+		}, jetstream.WithConsumeWorkers(5, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 100; i++ {
+			if _, err := js.Publish(context.Background(), fmt.Sprintf("FOO.%d", i%5), []byte(strconv.Itoa(i))); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+		wg.Wait()
+
+		if maxActive.Load() < 2 {
+			t.Fatalf("Expected messages to be handled concurrently")
+		}
+		for subject, seqs := range received {
+			if len(seqs) != 20 {
+				t.Fatalf("Invalid number of messages on %s; want: %d; got: %d", subject, 20, len(seqs))
+			}
+			for i := 1; i < len(seqs); i++ {
+				if seqs[i] < seqs[i-1] {
+					t.Fatalf("Messages on %s out of order: %v", subject, seqs)
+				}
+			}
+		}
+	})
+
+	t.Run("custom key func", func(t *testing.T) {
+		js, c, cleanup := setup(t, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		defer cleanup()
+
+		var (
+			mu       sync.Mutex
+			received []string
+			wg       sync.WaitGroup
+		)
+		wg.Add(10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			defer wg.Done()
+			mu.Lock()
+			received = append(received, string(msg.Data()))
+			mu.Unlock()
+			msg.Ack()
+		}, jetstream.WithConsumeWorkers(5, func(msg jetstream.Msg) string {
+			// all messages share the same key
+			return msg.Headers().Get("Key")
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 10; i++ {
+			if _, err := js.PublishMsg(context.Background(), &nats.Msg{
+				Subject: fmt.Sprintf("FOO.%d", i),
+				Header:  nats.Header{"Key": []string{"a"}},
+				Data:    []byte(strconv.Itoa(i)),
+			}); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+		wg.Wait()
+		for i, data := range received {
+			if data != strconv.Itoa(i) {
+				t.Fatalf("Messages out of order: %v", received)
+			}
+		}
+	})
+
+	t.Run("in-flight messages count towards max messages", func(t *testing.T) {
+		js, c, cleanup := setup(t, jetstream.ConsumerConfig{Durable: "cons", AckPolicy: jetstream.AckExplicitPolicy})
+		defer cleanup()
+
+		release := make(chan struct{})
+		var handled atomic.Int32
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			<-release
+			handled.Add(1)
+			msg.Ack()
+		}, jetstream.WithConsumeWorkers(2, nil), jetstream.PullMaxMessages(10))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for i := 0; i < 50; i++ {
+			if _, err := js.Publish(context.Background(), fmt.Sprintf("FOO.%d", i), []byte("msg")); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+		info, err := c.Info(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending > 10 {
+			t.Fatalf("Too many messages delivered; want at most: %d; got: %d", 10, info.NumAckPending)
+		}
+
+		close(release)
+		deadline := time.Now().Add(5 * time.Second)
+		for handled.Load() != 50 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timeout waiting for messages; want: %d; got: %d", 50, handled.Load())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("in-flight messages count towards max bytes", func(t *testing.T) {
+		js, c, cleanup := setup(t, jetstream.ConsumerConfig{Durable: "cons", AckPolicy: jetstream.AckExplicitPolicy})
+		defer cleanup()
+
+		release := make(chan struct{})
+		var handled atomic.Int32
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			<-release
+			handled.Add(1)
+			msg.Ack()
+		}, jetstream.WithConsumeWorkers(2, nil), jetstream.PullMaxBytes(2048))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		payload := make([]byte, 100)
+		for i := 0; i < 100; i++ {
+			if _, err := js.Publish(context.Background(), "FOO.A", payload); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+		info, err := c.Info(context.Background())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.NumAckPending == 0 || info.NumAckPending > 20 {
+			t.Fatalf("Invalid number of delivered messages; want between 1 and %d; got: %d", 20, info.NumAckPending)
+		}
+
+		close(release)
+		deadline := time.Now().Add(5 * time.Second)
+		for handled.Load() != 100 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timeout waiting for messages; want: %d; got: %d", 100, handled.Load())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("drain waits for workers", func(t *testing.T) {
+		js, c, cleanup := setup(t, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		defer cleanup()
+
+		for i := 0; i < 10; i++ {
+			if _, err := js.Publish(context.Background(), fmt.Sprintf("FOO.%d", i), []byte("msg")); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+		var handled atomic.Int32
+		received := make(chan struct{}, 10)
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			received <- struct{}{}
+			time.Sleep(50 * time.Millisecond)
+			handled.Add(1)
+			msg.Ack()
+		}, jetstream.WithConsumeWorkers(2, nil))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		<-received
+		cc.Drain()
+		select {
+		case <-cc.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for consume to be closed")
+		}
+		if handled.Load() != 10 {
+			t.Fatalf("Expected all buffered messages to be handled; want: %d; got: %d", 10, handled.Load())
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		js, c, cleanup := setup(t, jetstream.ConsumerConfig{AckPolicy: jetstream.AckExplicitPolicy})
+		defer cleanup()
+
+		_, err := c.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeWorkers(0, nil))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+
+		oc, err := js.OrderedConsumer(context.Background(), "foo", jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = oc.Consume(func(msg jetstream.Msg) {}, jetstream.WithConsumeWorkers(2, nil))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
+
+func TestPullConsumerConsumeStats(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := js.Publish(ctx, "FOO.A", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	t.Run("consume", func(t *testing.T) {
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			AckPolicy: jetstream.AckExplicitPolicy,
+			AckWait:   time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var calls atomic.Int32
+		done := make(chan struct{})
+		cc, err := c.Consume(func(msg jetstream.Msg) {
+			time.Sleep(10 * time.Millisecond)
+			switch n := calls.Add(1); {
+			case n == 1:
+				msg.Nak()
+			case n == 2:
+				msg.Term()
+			default:
+				msg.Ack()
+				if n == 4 {
+					close(done)
+				}
+			}
+		}, jetstream.PullMaxMessages(10))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for messages")
+		}
+
+		stats := cc.Stats()
+		if stats.Delivered != 4 || stats.Redelivered != 1 {
+			t.Fatalf("Invalid delivery stats: %+v", stats)
+		}
+		if stats.Acked != 2 || stats.Naked != 1 || stats.Termed != 1 {
+			t.Fatalf("Invalid ack stats: %+v", stats)
+		}
+		if stats.PullRequests == 0 || stats.PendingMsgs == 0 {
+			t.Fatalf("Invalid pull request stats: %+v", stats)
+		}
+		if stats.HandlerLatency < 10*time.Millisecond || stats.MaxHandlerLatency < stats.HandlerLatency {
+			t.Fatalf("Invalid handler latency: %+v", stats)
+		}
+	})
+
+	t.Run("ordered messages", func(t *testing.T) {
+		oc, err := js.OrderedConsumer(ctx, "foo", jetstream.OrderedConsumerConfig{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		it, err := oc.Messages()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer it.Stop()
+		for i := 0; i < 3; i++ {
+			if _, err := it.Next(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+
+		// deleting the consumer triggers a reset
+		name := oc.CachedInfo().Name
+		if err := s.DeleteConsumer(ctx, name); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := js.Publish(ctx, "FOO.A", []byte("3")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, err := it.Next()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(msg.Data()) != "3" {
+			t.Fatalf("Unexpected message: %q", msg.Data())
+		}
+
+		stats := it.Stats()
+		if stats.Delivered != 4 || stats.Resets != 1 {
+			t.Fatalf("Invalid stats: %+v", stats)
+		}
+		if stats.HandlerLatency != 0 {
+			t.Fatalf("Expected no handler latency for Messages; got: %v", stats.HandlerLatency)
+		}
+	})
+}
+
 func TestPullConsumerConsume_WithCluster(t *testing.T) {
 	testSubject := "FOO.123"
 	testMsgs := []string{"m1", "m2", "m3", "m4", "m5"}
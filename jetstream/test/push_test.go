@@ -0,0 +1,436 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestPushConsumerCreate(t *testing.T) {
+	srv := RunBasicJetStreamServer()
+	defer shutdownJSServerAndRemoveStorage(t, srv)
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer nc.Close()
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	t.Run("create push consumer", func(t *testing.T) {
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:        "push",
+			DeliverSubject: "deliver.push",
+			AckPolicy:      jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.CachedInfo().Config.DeliverSubject != "deliver.push" {
+			t.Fatalf("Invalid deliver subject; want: %s; got: %s", "deliver.push", c.CachedInfo().Config.DeliverSubject)
+		}
+
+		c, err = js.PushConsumer(ctx, "foo", "push")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.CachedInfo().Name != "push" {
+			t.Fatalf("Invalid consumer name; want: %s; got: %s", "push", c.CachedInfo().Name)
+		}
+	})
+
+	t.Run("update push consumer", func(t *testing.T) {
+		c, err := js.UpdatePushConsumer(ctx, "foo", jetstream.ConsumerConfig{
+			Durable:        "push",
+			DeliverSubject: "deliver.push",
+			AckPolicy:      jetstream.AckExplicitPolicy,
+			Description:    "updated",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.CachedInfo().Config.Description != "updated" {
+			t.Fatalf("Invalid description; want: %s; got: %s", "updated", c.CachedInfo().Config.Description)
+		}
+	})
+
+	t.Run("missing deliver subject", func(t *testing.T) {
+		_, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "pull",
+			AckPolicy: jetstream.AckExplicitPolicy,
+		})
+		if !errors.Is(err, jetstream.ErrNotPushConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotPushConsumer, err)
+		}
+	})
+
+	t.Run("pull messages from consumer with deliver subject", func(t *testing.T) {
+		c, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:        "deliver",
+			DeliverSubject: "deliver.pull",
+			AckPolicy:      jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if c.CachedInfo().Config.DeliverSubject != "deliver.pull" {
+			t.Fatalf("Invalid deliver subject; want: %s; got: %s", "deliver.pull", c.CachedInfo().Config.DeliverSubject)
+		}
+		if _, err := c.Fetch(1); !errors.Is(err, jetstream.ErrNotPullConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotPullConsumer, err)
+		}
+		if _, err := c.Consume(func(jetstream.Msg) {}); !errors.Is(err, jetstream.ErrNotPullConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotPullConsumer, err)
+		}
+		if _, err := c.Messages(); !errors.Is(err, jetstream.ErrNotPullConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotPullConsumer, err)
+		}
+	})
+
+	t.Run("get push consumer as pull consumer", func(t *testing.T) {
+		c, err := s.Consumer(ctx, "push")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		info, err := c.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.Config.DeliverSubject == "" {
+			t.Fatalf("Expected deliver subject to be set")
+		}
+		if _, err := c.Next(); !errors.Is(err, jetstream.ErrNotPullConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotPullConsumer, err)
+		}
+	})
+
+	t.Run("get pull consumer as push consumer", func(t *testing.T) {
+		if _, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "pull"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err := s.PushConsumer(ctx, "pull")
+		if !errors.Is(err, jetstream.ErrNotPushConsumer) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNotPushConsumer, err)
+		}
+	})
+
+	t.Run("consumer not found", func(t *testing.T) {
+		_, err := s.PushConsumer(ctx, "abc")
+		if !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrConsumerNotFound, err)
+		}
+	})
+}
+
+func TestPushConsumerConsume(t *testing.T) {
+	testSubject := "FOO.123"
+	testMsgs := []string{"m1", "m2", "m3", "m4", "m5"}
+	publishTestMsgs := func(t *testing.T, js jetstream.JetStream) {
+		for _, msg := range testMsgs {
+			if _, err := js.Publish(context.Background(), testSubject, []byte(msg)); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+	}
+
+	setup := func(t *testing.T) (jetstream.JetStream, jetstream.Stream, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		s, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, s, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("no options", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			DeliverSubject: nats.NewInbox(),
+			AckPolicy:      jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		msgs := make([]jetstream.Msg, 0)
+		wg := &sync.WaitGroup{}
+		wg.Add(len(testMsgs))
+		l, err := c.Consume(func(msg jetstream.Msg) {
+			msgs = append(msgs, msg)
+			msg.Ack()
+			wg.Done()
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer l.Stop()
+
+		publishTestMsgs(t, js)
+		wg.Wait()
+
+		for i, msg := range msgs {
+			if string(msg.Data()) != testMsgs[i] {
+				t.Fatalf("Invalid msg on index %d; expected: %s; got: %s", i, testMsgs[i], string(msg.Data()))
+			}
+		}
+	})
+
+	t.Run("consumer already consuming", func(t *testing.T) {
+		_, s, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			DeliverSubject: nats.NewInbox(),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		l, err := c.Consume(func(msg jetstream.Msg) {})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(func(msg jetstream.Msg) {})
+		if !errors.Is(err, jetstream.ErrConsumerHasActiveSubscription) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrConsumerHasActiveSubscription, err)
+		}
+
+		l.Stop()
+		select {
+		case <-l.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for consume to be closed")
+		}
+		l, err = c.Consume(func(msg jetstream.Msg) {})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		l.Stop()
+	})
+
+	t.Run("with deliver group", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:        "queue",
+			DeliverSubject: "deliver.queue",
+			DeliverGroup:   "workers",
+			AckPolicy:      jetstream.AckExplicitPolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var mu sync.Mutex
+		received := make(map[string]int)
+		wg := &sync.WaitGroup{}
+		wg.Add(len(testMsgs))
+		for i := 0; i < 3; i++ {
+			l, err := c.Consume(func(msg jetstream.Msg) {
+				mu.Lock()
+				received[string(msg.Data())]++
+				mu.Unlock()
+				msg.Ack()
+				wg.Done()
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer l.Stop()
+		}
+
+		publishTestMsgs(t, js)
+		wg.Wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, msg := range testMsgs {
+			if received[msg] != 1 {
+				t.Fatalf("Expected message %q to be received once; got: %d", msg, received[msg])
+			}
+		}
+	})
+
+	t.Run("with flow control and heartbeat", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			DeliverSubject: nats.NewInbox(),
+			FlowControl:    true,
+			IdleHeartbeat:  100 * time.Millisecond,
+			AckPolicy:      jetstream.AckNonePolicy,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data := make([]byte, 64*1024)
+		numMsgs := 200
+		wg := &sync.WaitGroup{}
+		wg.Add(numMsgs)
+		var errs []error
+		var mu sync.Mutex
+		l, err := c.Consume(func(msg jetstream.Msg) {
+			wg.Done()
+		}, jetstream.PushConsumeErrHandler(func(consumeCtx jetstream.ConsumeContext, err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer l.Stop()
+
+		for i := 0; i < numMsgs; i++ {
+			if _, err := js.Publish(ctx, testSubject, data); err != nil {
+				t.Fatalf("Unexpected error during publish: %s", err)
+			}
+		}
+		wg.Wait()
+
+		// wait for a few heartbeats and make sure no errors were reported
+		time.Sleep(500 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		if len(errs) != 0 {
+			t.Fatalf("Unexpected errors: %v", errs)
+		}
+	})
+
+	t.Run("missing heartbeat", func(t *testing.T) {
+		_, s, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:        "hb",
+			DeliverSubject: "deliver.hb",
+			IdleHeartbeat:  100 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		errs := make(chan error, 10)
+		l, err := c.Consume(func(msg jetstream.Msg) {}, jetstream.PushConsumeErrHandler(func(consumeCtx jetstream.ConsumeContext, err error) {
+			errs <- err
+		}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer l.Stop()
+
+		// deleting the consumer stops heartbeats
+		if err := s.DeleteConsumer(ctx, "hb"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case err := <-errs:
+			if !errors.Is(err, jetstream.ErrNoHeartbeat) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrNoHeartbeat, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Timeout waiting for %v", jetstream.ErrNoHeartbeat)
+		}
+	})
+
+	t.Run("with stop after", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx := context.Background()
+
+		c, err := s.CreatePushConsumer(ctx, jetstream.ConsumerConfig{
+			DeliverSubject: nats.NewInbox(),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var mu sync.Mutex
+		msgs := make([]jetstream.Msg, 0)
+		l, err := c.Consume(func(msg jetstream.Msg) {
+			mu.Lock()
+			msgs = append(msgs, msg)
+			mu.Unlock()
+		}, jetstream.StopAfter(3))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		publishTestMsgs(t, js)
+		select {
+		case <-l.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for consume to be closed")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(msgs) != 3 {
+			t.Fatalf("Expected %d messages; got: %d", 3, len(msgs))
+		}
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		_, s, cleanup := setup(t)
+		defer cleanup()
+
+		c, err := s.CreatePushConsumer(context.Background(), jetstream.ConsumerConfig{
+			DeliverSubject: nats.NewInbox(),
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = c.Consume(nil)
+		if !errors.Is(err, jetstream.ErrHandlerRequired) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrHandlerRequired, err)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestStreamSnapshotRestore(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.JetStream, jetstream.Stream, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     "foo",
+			Subjects: []string{"FOO.*"},
+			MaxMsgs:  1000,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		data := bytes.Repeat([]byte("a"), 1024)
+		for i := 0; i < 500; i++ {
+			if _, err := js.Publish(ctx, fmt.Sprintf("FOO.%d", i%10), data); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		if _, err := s.CreateConsumer(ctx, jetstream.ConsumerConfig{Durable: "cons"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, s, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("snapshot and restore with consumers", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var buf bytes.Buffer
+		var progress []jetstream.SnapshotProgress
+		info, err := s.Snapshot(ctx, &buf,
+			jetstream.WithSnapshotChunkSize(4*1024),
+			jetstream.WithSnapshotHealthCheck(),
+			jetstream.WithSnapshotProgress(func(p jetstream.SnapshotProgress) {
+				progress = append(progress, p)
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if info.State.Msgs != 500 {
+			t.Fatalf("Invalid number of messages in snapshot state; want: %d; got: %d", 500, info.State.Msgs)
+		}
+		if info.Bytes != uint64(buf.Len()) {
+			t.Fatalf("Invalid snapshot size; want: %d; got: %d", buf.Len(), info.Bytes)
+		}
+		if len(progress) != info.Chunks || len(progress) < 2 {
+			t.Fatalf("Invalid number of progress updates; want: %d; got: %d", info.Chunks, len(progress))
+		}
+
+		if err := js.DeleteStream(ctx, "foo"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var restoreProgress jetstream.SnapshotProgress
+		restored, err := js.RestoreStream(ctx, "foo", bytes.NewReader(buf.Bytes()),
+			jetstream.WithRestoreChunkSize(8*1024),
+			jetstream.WithRestoreProgress(func(p jetstream.SnapshotProgress) {
+				restoreProgress = p
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if restoreProgress.Bytes != info.Bytes {
+			t.Fatalf("Invalid number of restored bytes; want: %d; got: %d", info.Bytes, restoreProgress.Bytes)
+		}
+		streamInfo, err := restored.Info(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if streamInfo.State.Msgs != 500 {
+			t.Fatalf("Invalid number of messages; want: %d; got: %d", 500, streamInfo.State.Msgs)
+		}
+		if streamInfo.Config.MaxMsgs != 1000 {
+			t.Fatalf("Invalid stream config; want MaxMsgs: %d; got: %d", 1000, streamInfo.Config.MaxMsgs)
+		}
+		if _, err := restored.Consumer(ctx, "cons"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("snapshot without consumers", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var buf bytes.Buffer
+		if _, err := s.Snapshot(ctx, &buf, jetstream.WithSnapshotConsumers(false)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := js.DeleteStream(ctx, "foo"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		restored, err := js.RestoreStream(ctx, "foo", &buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = restored.Consumer(ctx, "cons")
+		if !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrConsumerNotFound, err)
+		}
+	})
+
+	t.Run("restore existing stream", func(t *testing.T) {
+		js, s, cleanup := setup(t)
+		defer cleanup()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var buf bytes.Buffer
+		if _, err := s.Snapshot(ctx, &buf); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err := js.RestoreStream(ctx, "foo", &buf)
+		if !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrStreamNameAlreadyInUse, err)
+		}
+	})
+
+	t.Run("restore invalid snapshot", func(t *testing.T) {
+		js, _, cleanup := setup(t)
+		defer cleanup()
+
+		_, err := js.RestoreStream(context.Background(), "bar", bytes.NewReader([]byte("invalid")))
+		if !errors.Is(err, jetstream.ErrInvalidSnapshot) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidSnapshot, err)
+		}
+	})
+
+	t.Run("invalid chunk size", func(t *testing.T) {
+		_, s, cleanup := setup(t)
+		defer cleanup()
+
+		var buf bytes.Buffer
+		_, err := s.Snapshot(context.Background(), &buf, jetstream.WithSnapshotChunkSize(10))
+		if !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func TestStreamMessages(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowDirect  bool
+		opts         []jetstream.StreamBrowseOpt
+		expectedSeqs []uint64
+		withError    error
+	}{
+		{
+			name:         "all messages",
+			expectedSeqs: []uint64{1, 2, 3, 4, 6, 7, 8, 9, 10},
+		},
+		{
+			name:         "all messages, direct get",
+			allowDirect:  true,
+			expectedSeqs: []uint64{1, 2, 3, 4, 6, 7, 8, 9, 10},
+		},
+		{
+			name:         "start and end sequence",
+			opts:         []jetstream.StreamBrowseOpt{jetstream.WithBrowseStartSeq(3), jetstream.WithBrowseEndSeq(7)},
+			expectedSeqs: []uint64{3, 4, 6, 7},
+		},
+		{
+			name:         "subject filter",
+			opts:         []jetstream.StreamBrowseOpt{jetstream.WithBrowseSubject("FOO.A")},
+			expectedSeqs: []uint64{1, 3, 7, 9},
+		},
+		{
+			name:         "subject filter with wildcard, direct get",
+			allowDirect:  true,
+			opts:         []jetstream.StreamBrowseOpt{jetstream.WithBrowseSubject("FOO.*"), jetstream.WithBrowseStartSeq(5)},
+			expectedSeqs: []uint64{6, 7, 8, 9, 10},
+		},
+		{
+			name:         "max messages",
+			opts:         []jetstream.StreamBrowseOpt{jetstream.WithBrowseMaxMsgs(3)},
+			expectedSeqs: []uint64{1, 2, 3},
+		},
+		{
+			name:         "backward",
+			opts:         []jetstream.StreamBrowseOpt{jetstream.WithBrowseDirection(jetstream.BrowseBackward)},
+			expectedSeqs: []uint64{10, 9, 8, 7, 6, 4, 3, 2, 1},
+		},
+		{
+			name: "backward with subject filter and range",
+			opts: []jetstream.StreamBrowseOpt{
+				jetstream.WithBrowseDirection(jetstream.BrowseBackward),
+				jetstream.WithBrowseSubject("FOO.B"),
+				jetstream.WithBrowseStartSeq(8),
+				jetstream.WithBrowseEndSeq(2),
+			},
+			expectedSeqs: []uint64{8, 6, 4, 2},
+		},
+		{
+			name:         "backward with max messages, direct get",
+			allowDirect:  true,
+			opts:         []jetstream.StreamBrowseOpt{jetstream.WithBrowseDirection(jetstream.BrowseBackward), jetstream.WithBrowseMaxMsgs(2)},
+			expectedSeqs: []uint64{10, 9},
+		},
+		{
+			name:      "invalid max messages",
+			opts:      []jetstream.StreamBrowseOpt{jetstream.WithBrowseMaxMsgs(0)},
+			withError: jetstream.ErrInvalidOption,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := RunBasicJetStreamServer()
+			defer shutdownJSServerAndRemoveStorage(t, srv)
+			nc, err := nats.Connect(srv.ClientURL())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer nc.Close()
+			js, err := jetstream.New(nc)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			s, err := js.CreateStream(ctx, jetstream.StreamConfig{
+				Name:        "foo",
+				Subjects:    []string{"FOO.*"},
+				AllowDirect: test.allowDirect,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for i := 1; i <= 10; i++ {
+				subj := "FOO.A"
+				if i%2 == 0 {
+					subj = "FOO.B"
+				}
+				if i == 5 {
+					subj = "FOO.C"
+				}
+				if _, err := js.Publish(ctx, subj, []byte(fmt.Sprintf("msg %d", i))); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err := s.DeleteMsg(ctx, 5); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var seqs []uint64
+			for msg, err := range s.Messages(ctx, test.opts...) {
+				if err != nil {
+					if test.withError == nil {
+						t.Fatalf("Unexpected error: %v", err)
+					}
+					if !errors.Is(err, test.withError) {
+						t.Fatalf("Expected error: %v; got: %v", test.withError, err)
+					}
+					return
+				}
+				if string(msg.Data) != fmt.Sprintf("msg %d", msg.Sequence) {
+					t.Fatalf("Invalid message data: %s", string(msg.Data))
+				}
+				seqs = append(seqs, msg.Sequence)
+			}
+			if test.withError != nil {
+				t.Fatalf("Expected error: %v", test.withError)
+			}
+			if fmt.Sprint(seqs) != fmt.Sprint(test.expectedSeqs) {
+				t.Fatalf("Invalid sequences; want: %v; got: %v", test.expectedSeqs, seqs)
+			}
+
+			// make sure no consumers were created
+			info, err := s.Info(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if info.State.Consumers != 0 {
+				t.Fatalf("Expected no consumers; got: %d", info.State.Consumers)
+			}
+		})
+	}
+}
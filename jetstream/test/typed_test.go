@@ -0,0 +1,213 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type typedOrder struct {
+	ID  string
+	Qty int
+}
+
+func TestTypedPublishConsume(t *testing.T) {
+	setup := func(t *testing.T) (jetstream.JetStream, jetstream.Consumer, func()) {
+		srv := RunBasicJetStreamServer()
+		nc, err := nats.Connect(srv.ClientURL())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		js, err := jetstream.New(nc)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		s, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "foo", Subjects: []string{"FOO.*"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		c, err := s.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+			Durable:   "cons",
+			AckPolicy: jetstream.AckExplicitPolicy,
+			AckWait:   time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return js, c, func() {
+			nc.Close()
+			shutdownJSServerAndRemoveStorage(t, srv)
+		}
+	}
+
+	t.Run("publish and consume json", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		pub, err := jetstream.NewTypedPublisher[typedOrder](js, jetstream.JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ctx := context.Background()
+		if _, err := pub.Publish(ctx, "FOO.A", typedOrder{ID: "1", Qty: 2}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		ackF, err := pub.PublishAsync("FOO.A", typedOrder{ID: "2", Qty: 3})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		select {
+		case <-ackF.Ok():
+		case err := <-ackF.Err():
+			t.Fatalf("Unexpected error: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for ack")
+		}
+
+		typed, err := jetstream.NewTypedConsumer[typedOrder](c, jetstream.JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		received := make(chan typedOrder, 2)
+		cc, err := typed.Consume(func(msg jetstream.Msg, v typedOrder) {
+			if ct := msg.Headers().Get(jetstream.ContentTypeHeader); ct != "application/json" {
+				t.Errorf("Invalid content type: %q", ct)
+			}
+			msg.Ack()
+			received <- v
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		for _, expected := range []typedOrder{{ID: "1", Qty: 2}, {ID: "2", Qty: 3}} {
+			select {
+			case v := <-received:
+				if v != expected {
+					t.Fatalf("Invalid value; want: %+v; got: %+v", expected, v)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for message")
+			}
+		}
+	})
+
+	t.Run("next with gob codec", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		pub, err := jetstream.NewTypedPublisher[*typedOrder](js, jetstream.GobCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := pub.Publish(context.Background(), "FOO.A", &typedOrder{ID: "1", Qty: 2}, jetstream.WithMsgID("1")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		typed, err := jetstream.NewTypedConsumer[*typedOrder](c, jetstream.GobCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		msg, v, err := typed.Next(jetstream.FetchMaxWait(time.Second))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if *v != (typedOrder{ID: "1", Qty: 2}) {
+			t.Fatalf("Invalid value: %+v", v)
+		}
+		if id := msg.Headers().Get(jetstream.MsgIDHeader); id != "1" {
+			t.Fatalf("Invalid message ID; want: %q; got: %q", "1", id)
+		}
+	})
+
+	t.Run("decode error terminates message", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		pub, err := jetstream.NewTypedPublisher[typedOrder](js, jetstream.GobCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if _, err := pub.Publish(context.Background(), "FOO.A", typedOrder{ID: "1"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		typed, err := jetstream.NewTypedConsumer[typedOrder](c, jetstream.JSONCodec)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, _, err = typed.Next(jetstream.FetchMaxWait(time.Second))
+		if !errors.Is(err, jetstream.ErrMsgDecode) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrMsgDecode, err)
+		}
+		// terminated message should not be redelivered
+		if _, _, err := typed.Next(jetstream.FetchMaxWait(1500 * time.Millisecond)); !errors.Is(err, nats.ErrTimeout) {
+			t.Fatalf("Expected error: %v; got: %v", nats.ErrTimeout, err)
+		}
+	})
+
+	t.Run("decode error handler", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		if _, err := js.Publish(context.Background(), "FOO.A", []byte("not json")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		errs := make(chan error, 1)
+		typed, err := jetstream.NewTypedConsumer[typedOrder](c, jetstream.JSONCodec,
+			jetstream.WithDecodeErrHandler(func(msg jetstream.Msg, err error) {
+				msg.Ack()
+				errs <- err
+			}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cc, err := typed.Consume(func(msg jetstream.Msg, v typedOrder) {
+			t.Errorf("Unexpected message: %+v", v)
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer cc.Stop()
+
+		select {
+		case err := <-errs:
+			if !errors.Is(err, jetstream.ErrMsgDecode) {
+				t.Fatalf("Expected error: %v; got: %v", jetstream.ErrMsgDecode, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout waiting for decode error")
+		}
+	})
+
+	t.Run("missing codec", func(t *testing.T) {
+		js, c, cleanup := setup(t)
+		defer cleanup()
+
+		if _, err := jetstream.NewTypedPublisher[typedOrder](js, nil); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+		if _, err := jetstream.NewTypedConsumer[typedOrder](c, nil); !errors.Is(err, jetstream.ErrInvalidOption) {
+			t.Fatalf("Expected error: %v; got: %v", jetstream.ErrInvalidOption, err)
+		}
+	})
+}
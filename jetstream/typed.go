@@ -0,0 +1,193 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/nats-io/nats.go"
+)
+
+type (
+	// TypedPublisher publishes values of type T, encoded using a [Codec].
+	// It is created using [NewTypedPublisher].
+	TypedPublisher[T any] struct {
+		js    Publisher
+		codec Codec
+	}
+
+	// TypedConsumer consumes messages from a consumer, decoding their
+	// payloads into values of type T using a [Codec]. It is created using
+	// [NewTypedConsumer].
+	//
+	// By default, messages which cannot be decoded are terminated using
+	// [Msg.TermWithReason], so that they are not redelivered. This can be
+	// changed using [WithDecodeErrHandler].
+	TypedConsumer[T any] struct {
+		cons       Consumer
+		codec      Codec
+		errHandler DecodeErrHandler
+	}
+
+	// TypedMessageHandler is a handler function used as callback in
+	// [TypedConsumer.Consume], receiving the message and its decoded
+	// payload.
+	TypedMessageHandler[T any] func(msg Msg, v T)
+
+	// DecodeErrHandler is used to handle messages which could not be
+	// decoded by a [TypedConsumer]. The error wraps [ErrMsgDecode].
+	DecodeErrHandler func(msg Msg, err error)
+
+	// TypedConsumerOpt is used to configure a [TypedConsumer].
+	TypedConsumerOpt func(*typedConsumerOpts) error
+
+	typedConsumerOpts struct {
+		errHandler DecodeErrHandler
+	}
+)
+
+// NewTypedPublisher returns a [TypedPublisher] publishing values of type T
+// using the provided publisher and codec.
+func NewTypedPublisher[T any](js Publisher, codec Codec) (*TypedPublisher[T], error) {
+	if codec == nil {
+		return nil, fmt.Errorf("%w: codec is required", ErrInvalidOption)
+	}
+	return &TypedPublisher[T]{js: js, codec: codec}, nil
+}
+
+// Publish encodes v and publishes it to the given subject, waiting for the
+// ack from the server. [ContentTypeHeader] is set to the content type of
+// the codec.
+func (p *TypedPublisher[T]) Publish(ctx context.Context, subject string, v T, opts ...PublishOpt) (*PubAck, error) {
+	m, err := p.encode(subject, v)
+	if err != nil {
+		return nil, err
+	}
+	return p.js.PublishMsg(ctx, m, opts...)
+}
+
+// PublishAsync encodes v and publishes it to the given subject without
+// waiting for the ack from the server. [ContentTypeHeader] is set to the
+// content type of the codec.
+func (p *TypedPublisher[T]) PublishAsync(subject string, v T, opts ...PublishOpt) (PubAckFuture, error) {
+	m, err := p.encode(subject, v)
+	if err != nil {
+		return nil, err
+	}
+	return p.js.PublishMsgAsync(m, opts...)
+}
+
+func (p *TypedPublisher[T]) encode(subject string, v T) (*nats.Msg, error) {
+	data, err := p.codec.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMsgEncode, err)
+	}
+	m := nats.NewMsg(subject)
+	m.Header.Set(ContentTypeHeader, p.codec.ContentType())
+	m.Data = data
+	return m, nil
+}
+
+// NewTypedConsumer returns a [TypedConsumer] decoding messages of the
+// provided consumer using codec. Available options:
+//
+//   - [WithDecodeErrHandler] - sets a handler for messages which could not
+//     be decoded, instead of terminating them.
+func NewTypedConsumer[T any](cons Consumer, codec Codec, opts ...TypedConsumerOpt) (*TypedConsumer[T], error) {
+	if codec == nil {
+		return nil, fmt.Errorf("%w: codec is required", ErrInvalidOption)
+	}
+	var o typedConsumerOpts
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	return &TypedConsumer[T]{cons: cons, codec: codec, errHandler: o.errHandler}, nil
+}
+
+// Consume continuously receives messages, decodes them and handles them
+// with the provided callback function. It accepts the same options as
+// [Consumer.Consume].
+func (c *TypedConsumer[T]) Consume(handler TypedMessageHandler[T], opts ...PullConsumeOpt) (ConsumeContext, error) {
+	return c.cons.Consume(c.Handler(handler), opts...)
+}
+
+// Next retrieves the next message from the consumer and decodes it. If the
+// message cannot be decoded, it is handled the same way as in Consume and
+// an error wrapping [ErrMsgDecode] is returned together with the message.
+func (c *TypedConsumer[T]) Next(opts ...FetchOpt) (Msg, T, error) {
+	var v T
+	msg, err := c.cons.Next(opts...)
+	if err != nil {
+		return nil, v, err
+	}
+	v, err = c.Decode(msg)
+	if err != nil {
+		c.handleDecodeErr(msg, err)
+		return msg, v, err
+	}
+	return msg, v, nil
+}
+
+// Handler returns a [MessageHandler] decoding messages and passing them to
+// handler. It can be used to consume typed messages using e.g. an ordered
+// or push consumer.
+func (c *TypedConsumer[T]) Handler(handler TypedMessageHandler[T]) MessageHandler {
+	return func(msg Msg) {
+		v, err := c.Decode(msg)
+		if err != nil {
+			c.handleDecodeErr(msg, err)
+			return
+		}
+		handler(msg, v)
+	}
+}
+
+// Decode decodes the payload of the message. If [ContentTypeHeader] is
+// set on the message, it has to match the content type of the codec.
+func (c *TypedConsumer[T]) Decode(msg Msg) (T, error) {
+	if ct := msg.Headers().Get(ContentTypeHeader); ct != "" && ct != c.codec.ContentType() {
+		var zero T
+		return zero, fmt.Errorf("%w: unexpected content type %q", ErrMsgDecode, ct)
+	}
+	return decodeValue[T](c.codec, msg.Data())
+}
+
+// decodeValue decodes data into a value of type T using codec.
+func decodeValue[T any](codec Codec, data []byte) (T, error) {
+	var v T
+	// decode into a new value for pointer types (e.g. protobuf messages),
+	// as codecs expect a pointer to the value
+	target := any(&v)
+	if t := reflect.TypeFor[T](); t.Kind() == reflect.Pointer {
+		v = reflect.New(t.Elem()).Interface().(T)
+		target = v
+	}
+	if err := codec.Decode(data, target); err != nil {
+		var zero T
+		return zero, fmt.Errorf("%w: %w", ErrMsgDecode, err)
+	}
+	return v, nil
+}
+
+func (c *TypedConsumer[T]) handleDecodeErr(msg Msg, err error) {
+	if c.errHandler != nil {
+		c.errHandler(msg, err)
+		return
+	}
+	msg.TermWithReason(err.Error())
+}
@@ -0,0 +1,283 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type (
+	// TypedKeyValue stores values of type T in a [KeyValue] bucket, encoded
+	// using a [Codec]. It is created using [NewTypedKeyValue].
+	//
+	// Values which cannot be decoded do not fail watchers or listings.
+	// Instead, the decode error is reported on the entry using
+	// [TypedKeyValueEntry.Err].
+	TypedKeyValue[T any] struct {
+		kv    KeyValue
+		codec Codec
+	}
+
+	// TypedKeyValueEntry is a [KeyValueEntry] with its value decoded into
+	// a value of type T.
+	TypedKeyValueEntry[T any] struct {
+		entry KeyValueEntry
+		value T
+		err   error
+	}
+
+	// TypedKeyWatcher is a watcher returned by [TypedKeyValue.Watch],
+	// delivering decoded entries. Similar to [KeyWatcher], a nil entry is
+	// sent once all initial values were delivered.
+	TypedKeyWatcher[T any] interface {
+		// Updates returns a channel to read any updates to entries.
+		Updates() <-chan *TypedKeyValueEntry[T]
+
+		// Stop stops the watcher.
+		Stop() error
+	}
+
+	typedKeyWatcher[T any] struct {
+		watcher  KeyWatcher
+		updates  chan *TypedKeyValueEntry[T]
+		stop     chan struct{}
+		stopOnce sync.Once
+	}
+)
+
+// NewTypedKeyValue returns a [TypedKeyValue] storing values of type T in kv
+// using codec.
+func NewTypedKeyValue[T any](kv KeyValue, codec Codec) (*TypedKeyValue[T], error) {
+	if kv == nil {
+		return nil, fmt.Errorf("%w: key value bucket is required", ErrInvalidOption)
+	}
+	if codec == nil {
+		return nil, fmt.Errorf("%w: codec is required", ErrInvalidOption)
+	}
+	return &TypedKeyValue[T]{kv: kv, codec: codec}, nil
+}
+
+// KeyValue returns the underlying [KeyValue], e.g. to list keys or get
+// the status of the bucket.
+func (kv *TypedKeyValue[T]) KeyValue() KeyValue {
+	return kv.kv
+}
+
+// Get returns the latest value for the key. If the value cannot be
+// decoded, the entry is returned together with an error wrapping
+// [ErrMsgDecode].
+func (kv *TypedKeyValue[T]) Get(ctx context.Context, key string) (*TypedKeyValueEntry[T], error) {
+	entry, err := kv.kv.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	e := kv.decodeEntry(entry)
+	return e, e.err
+}
+
+// GetRevision returns a specific revision value for the key. If the value
+// cannot be decoded, the entry is returned together with an error wrapping
+// [ErrMsgDecode].
+func (kv *TypedKeyValue[T]) GetRevision(ctx context.Context, key string, revision uint64) (*TypedKeyValueEntry[T], error) {
+	entry, err := kv.kv.GetRevision(ctx, key, revision)
+	if err != nil {
+		return nil, err
+	}
+	e := kv.decodeEntry(entry)
+	return e, e.err
+}
+
+// Put encodes v and places it for the key, returning the revision.
+func (kv *TypedKeyValue[T]) Put(ctx context.Context, key string, v T) (uint64, error) {
+	data, err := kv.encode(v)
+	if err != nil {
+		return 0, err
+	}
+	return kv.kv.Put(ctx, key, data)
+}
+
+// Create encodes v and places it for the key only if the key does not
+// exist or its latest revision is a delete marker.
+func (kv *TypedKeyValue[T]) Create(ctx context.Context, key string, v T) (uint64, error) {
+	data, err := kv.encode(v)
+	if err != nil {
+		return 0, err
+	}
+	return kv.kv.Create(ctx, key, data)
+}
+
+// Update encodes v and places it for the key only if the latest revision
+// matches the provided revision.
+func (kv *TypedKeyValue[T]) Update(ctx context.Context, key string, v T, revision uint64) (uint64, error) {
+	data, err := kv.encode(v)
+	if err != nil {
+		return 0, err
+	}
+	return kv.kv.Update(ctx, key, data, revision)
+}
+
+// UpdateFunc atomically updates the value of the key using fn, retrying on
+// concurrent modifications. fn is called with a nil entry if the key does
+// not exist or was deleted. An entry which could not be decoded is passed
+// to fn with [TypedKeyValueEntry.Err] set. See [KeyValue.UpdateFunc].
+func (kv *TypedKeyValue[T]) UpdateFunc(ctx context.Context, key string, fn func(entry *TypedKeyValueEntry[T]) (T, error)) (uint64, error) {
+	return kv.kv.UpdateFunc(ctx, key, func(entry KeyValueEntry) ([]byte, error) {
+		var e *TypedKeyValueEntry[T]
+		if entry != nil {
+			e = kv.decodeEntry(entry)
+		}
+		v, err := fn(e)
+		if err != nil {
+			return nil, err
+		}
+		return kv.encode(v)
+	})
+}
+
+// Delete places a delete marker for the key. See [KeyValue.Delete].
+func (kv *TypedKeyValue[T]) Delete(ctx context.Context, key string, opts ...KVDeleteOpt) error {
+	return kv.kv.Delete(ctx, key, opts...)
+}
+
+// Purge places a delete marker and removes all previous revisions of the
+// key. See [KeyValue.Purge].
+func (kv *TypedKeyValue[T]) Purge(ctx context.Context, key string, opts ...KVDeleteOpt) error {
+	return kv.kv.Purge(ctx, key, opts...)
+}
+
+// History returns all historical values for the key. Values which cannot
+// be decoded are returned with [TypedKeyValueEntry.Err] set.
+func (kv *TypedKeyValue[T]) History(ctx context.Context, key string, opts ...WatchOpt) ([]*TypedKeyValueEntry[T], error) {
+	entries, err := kv.kv.History(ctx, key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*TypedKeyValueEntry[T], 0, len(entries))
+	for _, entry := range entries {
+		res = append(res, kv.decodeEntry(entry))
+	}
+	return res, nil
+}
+
+// Watch for any updates to keys that match the keys argument which could
+// include wildcards. See [KeyValue.Watch].
+func (kv *TypedKeyValue[T]) Watch(ctx context.Context, keys string, opts ...WatchOpt) (TypedKeyWatcher[T], error) {
+	return kv.watch(kv.kv.Watch(ctx, keys, opts...))
+}
+
+// WatchAll watches for updates of all keys. See [KeyValue.WatchAll].
+func (kv *TypedKeyValue[T]) WatchAll(ctx context.Context, opts ...WatchOpt) (TypedKeyWatcher[T], error) {
+	return kv.watch(kv.kv.WatchAll(ctx, opts...))
+}
+
+// WatchFiltered watches for updates of keys matching any of the provided
+// filters. See [KeyValue.WatchFiltered].
+func (kv *TypedKeyValue[T]) WatchFiltered(ctx context.Context, keys []string, opts ...WatchOpt) (TypedKeyWatcher[T], error) {
+	return kv.watch(kv.kv.WatchFiltered(ctx, keys, opts...))
+}
+
+func (kv *TypedKeyValue[T]) watch(watcher KeyWatcher, err error) (TypedKeyWatcher[T], error) {
+	if err != nil {
+		return nil, err
+	}
+	w := &typedKeyWatcher[T]{
+		watcher: watcher,
+		updates: make(chan *TypedKeyValueEntry[T], 256),
+		stop:    make(chan struct{}),
+	}
+	go w.run(kv.decodeEntry)
+	return w, nil
+}
+
+func (kv *TypedKeyValue[T]) encode(v T) ([]byte, error) {
+	data, err := kv.codec.Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMsgEncode, err)
+	}
+	return data, nil
+}
+
+// decodeEntry decodes the value of entry. Delete and purge markers and
+// entries without a value (e.g. watched using [MetaOnly]) are not decoded.
+func (kv *TypedKeyValue[T]) decodeEntry(entry KeyValueEntry) *TypedKeyValueEntry[T] {
+	e := &TypedKeyValueEntry[T]{entry: entry}
+	if entry.Operation() == KeyValuePut && len(entry.Value()) > 0 {
+		e.value, e.err = decodeValue[T](kv.codec, entry.Value())
+	}
+	return e
+}
+
+// run forwards decoded entries until the underlying watcher is stopped.
+func (w *typedKeyWatcher[T]) run(decode func(KeyValueEntry) *TypedKeyValueEntry[T]) {
+	defer close(w.updates)
+	for entry := range w.watcher.Updates() {
+		var e *TypedKeyValueEntry[T]
+		if entry != nil {
+			e = decode(entry)
+		}
+		select {
+		case w.updates <- e:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Updates returns a channel to read decoded updates. The channel is closed
+// once the watcher is stopped.
+func (w *typedKeyWatcher[T]) Updates() <-chan *TypedKeyValueEntry[T] {
+	return w.updates
+}
+
+// Stop stops the underlying watcher.
+func (w *typedKeyWatcher[T]) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	return w.watcher.Stop()
+}
+
+// Bucket returns the bucket the entry was retrieved from.
+func (e *TypedKeyValueEntry[T]) Bucket() string { return e.entry.Bucket() }
+
+// Key returns the key that was retrieved.
+func (e *TypedKeyValueEntry[T]) Key() string { return e.entry.Key() }
+
+// Value returns the decoded value. It is the zero value of T for delete
+// and purge markers, empty values and values which could not be decoded.
+func (e *TypedKeyValueEntry[T]) Value() T { return e.value }
+
+// RawValue returns the encoded value.
+func (e *TypedKeyValueEntry[T]) RawValue() []byte { return e.entry.Value() }
+
+// Revision is a unique sequence for this value.
+func (e *TypedKeyValueEntry[T]) Revision() uint64 { return e.entry.Revision() }
+
+// Created is the time the data was put in the bucket.
+func (e *TypedKeyValueEntry[T]) Created() time.Time { return e.entry.Created() }
+
+// Delta is distance from the latest value (how far the current sequence
+// is from the latest).
+func (e *TypedKeyValueEntry[T]) Delta() uint64 { return e.entry.Delta() }
+
+// Operation returns Put or Delete or Purge, depending on the manner in
+// which the current revision was created.
+func (e *TypedKeyValueEntry[T]) Operation() KeyValueOp { return e.entry.Operation() }
+
+// Err returns an error wrapping [ErrMsgDecode] if the value could not be
+// decoded.
+func (e *TypedKeyValueEntry[T]) Err() error { return e.err }
@@ -0,0 +1,158 @@
+// Copyright 2024 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jetstream
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+type (
+	// MsgKeyFunc returns the key used to distribute messages between
+	// workers when using [WithConsumeWorkers]. Messages with the same key
+	// are always handled by the same worker, in order.
+	MsgKeyFunc func(msg Msg) string
+
+	// workerPool distributes messages between a fixed number of
+	// goroutines, based on the message key.
+	workerPool struct {
+		workers []*worker
+		keyFunc MsgKeyFunc
+		wg      sync.WaitGroup
+		done    chan struct{}
+	}
+
+	// worker handles the messages in its queue in order. The queue is not
+	// bounded, as the number of messages dispatched to workers is limited
+	// by the pending messages and bytes of pull requests, which are only
+	// released once messages are processed.
+	worker struct {
+		sync.Mutex
+		queue  []*jetStreamMsg
+		closed bool
+		notify chan struct{}
+	}
+)
+
+// subjectKey is the default MsgKeyFunc, preserving the order of messages
+// on the same subject.
+func subjectKey(msg Msg) string {
+	return msg.Subject()
+}
+
+// newWorkerPool starts n workers calling process for each dispatched
+// message.
+func newWorkerPool(n int, keyFunc MsgKeyFunc, process func(*jetStreamMsg)) *workerPool {
+	if keyFunc == nil {
+		keyFunc = subjectKey
+	}
+	pool := &workerPool{
+		workers: make([]*worker, n),
+		keyFunc: keyFunc,
+		done:    make(chan struct{}),
+	}
+	pool.wg.Add(n)
+	for i := range pool.workers {
+		w := &worker{notify: make(chan struct{}, 1)}
+		pool.workers[i] = w
+		go func() {
+			defer pool.wg.Done()
+			for {
+				msg, ok := w.next()
+				if !ok {
+					return
+				}
+				process(msg)
+			}
+		}()
+	}
+	go func() {
+		pool.wg.Wait()
+		close(pool.done)
+	}()
+	return pool
+}
+
+// dispatch adds the message to the queue of the worker responsible for
+// the message key. It does not block, so that the subscription is never
+// held up by busy workers.
+func (p *workerPool) dispatch(msg *jetStreamMsg) {
+	h := fnv.New32a()
+	h.Write([]byte(p.keyFunc(msg)))
+	w := p.workers[h.Sum32()%uint32(len(p.workers))]
+	w.Lock()
+	w.queue = append(w.queue, msg)
+	w.Unlock()
+	w.signal()
+}
+
+// close stops the workers once all queued messages are processed. No
+// messages can be dispatched after calling close.
+func (p *workerPool) close() {
+	for _, w := range p.workers {
+		w.Lock()
+		w.closed = true
+		w.Unlock()
+		w.signal()
+	}
+}
+
+// finished returns true if all workers are stopped.
+func (p *workerPool) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// queued returns the number of messages waiting in worker queues.
+func (p *workerPool) queued() int {
+	var n int
+	for _, w := range p.workers {
+		w.Lock()
+		n += len(w.queue)
+		w.Unlock()
+	}
+	return n
+}
+
+// next waits for the next queued message, returning false once the
+// worker is closed and its queue is empty.
+func (w *worker) next() (*jetStreamMsg, bool) {
+	for {
+		w.Lock()
+		if len(w.queue) > 0 {
+			msg := w.queue[0]
+			w.queue[0] = nil
+			w.queue = w.queue[1:]
+			w.Unlock()
+			return msg, true
+		}
+		closed := w.closed
+		w.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-w.notify
+	}
+}
+
+func (w *worker) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}